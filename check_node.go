@@ -0,0 +1,163 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/nxtlytics/cloud-lifecycle-controller/controllers"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	corev1 "k8s.io/api/core/v1"
+	ctrl "sigs.k8s.io/controller-runtime"
+)
+
+var outputFormat string
+
+func bindOutputFlag(fs *flag.FlagSet) {
+	fs.StringVar(&outputFormat, "output", "text", "Output format (text, json)")
+}
+
+// checkNodeCommand evaluates a single node once and prints what the controller would do with it
+func checkNodeCommand(ctx context.Context, args []string) error {
+	fs, _, err := parseFlags("check-node", args, bindOutputFlag)
+	if err != nil {
+		return err
+	}
+	if fs.NArg() != 1 {
+		return errors.New("usage: check-node [flags] <node name>")
+	}
+
+	reconciler, err := newOneShotReconciler(ctx)
+	if err != nil {
+		return err
+	}
+
+	node := &corev1.Node{}
+	if err := reconciler.Get(ctx, types.NamespacedName{Name: fs.Arg(0)}, node); err != nil {
+		return fmt.Errorf("unable to get node %s: %w", fs.Arg(0), err)
+	}
+
+	decision, err := explainNode(ctx, reconciler, node)
+	if err != nil {
+		return err
+	}
+
+	switch outputFormat {
+	case "json":
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(decision)
+	case "text":
+		printDecision(os.Stdout, decision)
+		return nil
+	default:
+		return fmt.Errorf("unknown output format %q", outputFormat)
+	}
+}
+
+// newOneShotReconciler sets up a reconciler for evaluating nodes outside of the controller manager
+func newOneShotReconciler(ctx context.Context) (*controllers.NodeReconciler, error) {
+	cfg, err := restConfig()
+	if err != nil {
+		return nil, configError(fmt.Errorf("unable to get kubernetes client configuration: %w", err))
+	}
+	c, err := client.New(cfg, client.Options{Scheme: scheme})
+	if err != nil {
+		return nil, fmt.Errorf("unable to create kubernetes client: %w", err)
+	}
+
+	instances, err := newCloudInstances(ctx, c)
+	if err != nil {
+		return nil, err
+	}
+	if err := resolveShard(); err != nil {
+		return nil, configError(err)
+	}
+	pools, err := loadPools()
+	if err != nil {
+		return nil, err
+	}
+	profile, err := settleProfile()
+	if err != nil {
+		return nil, err
+	}
+	evictionAction, err := controllers.ParseEvictionAction(spotEvictionAction)
+	if err != nil {
+		return nil, configError(err)
+	}
+
+	return &controllers.NodeReconciler{
+		Client:             c,
+		CloudInstances:     instances,
+		Log:                ctrl.Log.WithName("controllers").WithName("Node"),
+		Scheme:             scheme,
+		DryRun:             true,
+		DryRunCloud:        true,
+		LeaseMaxAge:        leaseMaxAge,
+		Probe:              controllers.Probe{Port: probePort, Timeout: probeTimeout},
+		Verify:             controllers.VerifyHook{Command: strings.Fields(verifyCommand), Timeout: verifyTimeout},
+		Chaos:              chaos,
+		UnknownDeadline:    unknownDeadline,
+		Shard:              controllers.Shard{Count: shardCount, Index: shardIndex},
+		GiveUpAfter:        giveUpAfter,
+		MinNotReady:        minNotReady,
+		CleanUpTerminating: cleanUpTerminating,
+		Pools:              pools,
+		SettleProfile:      profile,
+		SpotEvictionAction: evictionAction,
+	}, nil
+}
+
+func printDecision(w io.Writer, d *controllers.Decision) {
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintf(tw, "Node:\t%s\n", d.Node)
+	fmt.Fprintf(tw, "ProviderID:\t%s\n", d.ProviderID)
+	fmt.Fprintf(tw, "Ready:\t%s\n", d.Ready)
+	fmt.Fprintf(tw, "Instance exists:\t%s\n", formatAnswer(d.InstanceExists))
+	fmt.Fprintf(tw, "Instance shutdown:\t%s\n", formatAnswer(d.InstanceShutdown))
+	fmt.Fprintf(tw, "Cloud status:\t%s\n", d.CloudStatus)
+	fmt.Fprintf(tw, "Action:\t%s\n", d.Action)
+	fmt.Fprintf(tw, "Reason:\t%s\n", d.Reason)
+	if d.Error != "" {
+		fmt.Fprintf(tw, "Error:\t%s\n", d.Error)
+	}
+	if len(d.Checks) > 0 {
+		fmt.Fprintf(tw, "Checks:\n")
+	}
+	for _, c := range d.Checks {
+		fmt.Fprintf(tw, "  %s:\t%s\n", c.Name, c.Result)
+	}
+	tw.Flush()
+}
+
+// formatAnswer formats a cloud provider answer, which is nil if the provider wasn't asked
+func formatAnswer(answer *bool) string {
+	if answer == nil {
+		return "-"
+	}
+	return fmt.Sprint(*answer)
+}
@@ -0,0 +1,682 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/nxtlytics/cloud-lifecycle-controller/pkg/cloud"
+	"github.com/nxtlytics/cloud-lifecycle-controller/pkg/config"
+	"github.com/nxtlytics/cloud-lifecycle-controller/pkg/vault"
+	"golang.org/x/time/rate"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/manager"
+
+	alicloud "github.com/nxtlytics/cloud-lifecycle-controller/pkg/cloud/alicloud"
+	awscloud "github.com/nxtlytics/cloud-lifecycle-controller/pkg/cloud/aws"
+	azurecloud "github.com/nxtlytics/cloud-lifecycle-controller/pkg/cloud/azure"
+	bmccloud "github.com/nxtlytics/cloud-lifecycle-controller/pkg/cloud/bmc"
+	docloud "github.com/nxtlytics/cloud-lifecycle-controller/pkg/cloud/digitalocean"
+	metalcloud "github.com/nxtlytics/cloud-lifecycle-controller/pkg/cloud/equinixmetal"
+	gcecloud "github.com/nxtlytics/cloud-lifecycle-controller/pkg/cloud/gce"
+	hetznercloud "github.com/nxtlytics/cloud-lifecycle-controller/pkg/cloud/hetzner"
+	ibmcloud "github.com/nxtlytics/cloud-lifecycle-controller/pkg/cloud/ibm"
+	inventorycloud "github.com/nxtlytics/cloud-lifecycle-controller/pkg/cloud/inventory"
+	libvirtcloud "github.com/nxtlytics/cloud-lifecycle-controller/pkg/cloud/libvirt"
+	linodecloud "github.com/nxtlytics/cloud-lifecycle-controller/pkg/cloud/linode"
+	maascloud "github.com/nxtlytics/cloud-lifecycle-controller/pkg/cloud/maas"
+	ocicloud "github.com/nxtlytics/cloud-lifecycle-controller/pkg/cloud/oci"
+	corev1 "k8s.io/api/core/v1"
+	ctrl "sigs.k8s.io/controller-runtime"
+)
+
+// newCloudInstances initializes the cloud provider selected by the -cloud and -cloud-config flags.
+// reader is used to read the cloud config from a Secret or ConfigMap and to list nodes, and should not be cached.
+func newCloudInstances(ctx context.Context, reader client.Reader) (*cloud.Reloadable, error) {
+	if vaultCredentialsPath != "" {
+		vaultCredentials = vault.NewCredentials(vault.NewClient(vaultAddress, vaultAuthPath, vaultRole), vaultCredentialsPath)
+		if _, err := vaultCredentials.Fetch(ctx); err != nil {
+			return nil, cloudError(fmt.Errorf("unable to fetch cloud credentials from Vault: %w", err))
+		}
+	}
+
+	data, err := readCloudConfig(ctx, reader)
+	if err != nil {
+		return nil, configError(err)
+	}
+	instances, err := initCloudProvider(ctx, reader, data)
+	if err != nil {
+		return nil, cloudError(err)
+	}
+	return cloud.NewReloadable(instances), nil
+}
+
+// vaultCredentials are the cloud credentials fetched from Vault, if -vault-credentials-path is set
+var vaultCredentials *vault.Credentials
+
+// readCloudConfig returns the contents of the cloud config, or nil if there is none
+func readCloudConfig(ctx context.Context, reader client.Reader) ([]byte, error) {
+	if cloudConfig == "" {
+		// no cloud config specified... let the library automatically init, and propagagte errors up
+		setupLog.Info("Proceeding without cloud config, relying on flags and the underlying cloud library for init")
+		return nil, nil
+	}
+
+	source, err := config.ParseSource(cloudConfig)
+	if err != nil {
+		return nil, err
+	}
+	data, err := source.Read(ctx, reader)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read cloud provider configuration %s: %w", source, err)
+	}
+	return data, nil
+}
+
+// initCloudProvider initializes the cloud provider with the given cloud config contents
+func initCloudProvider(ctx context.Context, reader client.Reader, data []byte) (cloud.Instances, error) {
+	var cloudConfigReader io.Reader
+	if data != nil {
+		cloudConfigReader = bytes.NewReader(data)
+	}
+
+	scope, err := cloud.ParseScope(instanceScope)
+	if err != nil {
+		return nil, configError(err)
+	}
+	switch cloudProvider {
+	case "aws":
+		return newAWSInstances(ctx, reader, cloudConfigReader, scope)
+	case "gce":
+		return newGCEInstances(ctx, cloudConfigReader, scope)
+	case "digitalocean":
+		return newDigitalOceanInstances(cloudConfigReader, scope)
+	case "equinixmetal":
+		return newEquinixMetalInstances(cloudConfigReader, scope)
+	case "hcloud":
+		return newHetznerInstances(cloudConfigReader, scope)
+	case "linode":
+		return newLinodeInstances(cloudConfigReader, scope)
+	case "maas":
+		return newMAASInstances(ctx, cloudConfigReader, scope)
+	case "oci":
+		return newOCIInstances(cloudConfigReader, scope)
+	case "alicloud":
+		return newAlibabaInstances(cloudConfigReader, scope)
+	}
+	if !scope.Empty() {
+		return nil, configError(fmt.Errorf("cloud provider %q does not support -instance-scope", cloudProvider))
+	}
+	switch cloudProvider {
+	case "azure":
+		return newAzureInstances(cloudConfigReader)
+	case "ibm":
+		return newIBMInstances(ctx, cloudConfigReader)
+	case "libvirt":
+		return newLibvirtInstances(cloudConfigReader)
+	case "bmc":
+		return newBMCInstances(reader, cloudConfigReader)
+	case "inventory":
+		return newInventoryInstances(cloudConfigReader)
+	}
+	return nil, configError(fmt.Errorf("unknown cloud provider %q", cloudProvider))
+}
+
+// watchCloudConfig re-initializes the cloud provider whenever the cloud config changes, e.g. when a mounted Secret
+// with rotated credentials is updated
+func watchCloudConfig(ctx context.Context, mgr manager.Manager, instances *cloud.Reloadable) error {
+	if cloudConfig == "" {
+		return nil
+	}
+	source, err := config.ParseSource(cloudConfig)
+	if err != nil {
+		return err
+	}
+
+	current, err := source.Read(ctx, mgr.GetAPIReader())
+	if err != nil {
+		return err
+	}
+
+	log := ctrl.Log.WithName("cloud-config")
+	return mgr.Add(manager.RunnableFunc(func(ctx context.Context) error {
+		config.PollSource(ctx, source, mgr.GetAPIReader(), cloudConfigRefreshInterval, current, log, func(data []byte) error {
+			reloaded, err := initCloudProvider(ctx, mgr.GetAPIReader(), data)
+			if err != nil {
+				return err
+			}
+			instances.Set(reloaded)
+			log.Info("Re-initialized cloud provider", "provider", cloudProvider)
+			return nil
+		})
+		return nil
+	}))
+}
+
+// recoverCloudCredentials re-initializes the cloud provider, re-reading the cloud config and credentials, whenever
+// a cloud lookup fails because of expired or invalid credentials, or if it couldn't be initialized at startup.
+// Failed attempts are retried with exponential backoff.
+func recoverCloudCredentials(mgr manager.Manager, instances *cloud.Reloadable) error {
+	log := ctrl.Log.WithName("cloud-credentials")
+	return mgr.Add(manager.RunnableFunc(func(ctx context.Context) error {
+		for {
+			select {
+			case <-ctx.Done():
+				return nil
+			case <-instances.CredentialsFailed():
+			}
+
+			log.Info("Cloud provider unavailable or its credentials failed, re-initializing it", "provider", cloudProvider)
+			backoff := wait.Backoff{Duration: time.Second, Factor: 2, Jitter: 0.1, Steps: math.MaxInt32, Cap: 5 * time.Minute}
+			for {
+				var err error
+				if vaultCredentials != nil {
+					_, err = vaultCredentials.Fetch(ctx)
+				}
+				if err == nil {
+					err = reinitCloudProvider(ctx, mgr.GetAPIReader(), instances)
+				}
+				if err == nil {
+					log.Info("Re-initialized cloud provider", "provider", cloudProvider)
+					break
+				}
+				log.Error(err, "Unable to re-initialize cloud provider, will retry")
+				select {
+				case <-ctx.Done():
+					return nil
+				case <-time.After(backoff.Step()):
+				}
+			}
+		}
+	}))
+}
+
+// renewVaultCredentials keeps the Vault lease of the cloud credentials renewed, and re-initializes the cloud provider
+// with new credentials when the lease can't be renewed any more
+func renewVaultCredentials(mgr manager.Manager, instances *cloud.Reloadable) error {
+	if vaultCredentials == nil {
+		return nil
+	}
+	log := ctrl.Log.WithName("vault")
+	return mgr.Add(manager.RunnableFunc(func(ctx context.Context) error {
+		vaultCredentials.Run(ctx, log, func() {
+			if err := reinitCloudProvider(ctx, mgr.GetAPIReader(), instances); err != nil {
+				log.Error(err, "Unable to re-initialize cloud provider with new credentials")
+				return
+			}
+			log.Info("Re-initialized cloud provider with new credentials", "provider", cloudProvider)
+		})
+		return nil
+	}))
+}
+
+// reinitCloudProvider re-reads the cloud config and replaces the cloud provider
+func reinitCloudProvider(ctx context.Context, reader client.Reader, instances *cloud.Reloadable) error {
+	data, err := readCloudConfig(ctx, reader)
+	if err != nil {
+		return err
+	}
+	reloaded, err := initCloudProvider(ctx, reader, data)
+	if err != nil {
+		return err
+	}
+	instances.Set(reloaded)
+	return nil
+}
+
+// cloudAPILimiter limits the rate of all cloud API calls. It is shared by re-initialized cloud providers.
+var cloudAPILimiter *rate.Limiter
+
+// cloudHTTPClient returns the HTTP client for cloud API calls, or nil to use the default one
+func cloudHTTPClient() (*http.Client, error) {
+	if cloudCABundle == "" && cloudAPIQPS <= 0 {
+		return nil, nil
+	}
+
+	httpClient := &http.Client{}
+	if cloudCABundle != "" {
+		var err error
+		if httpClient, err = cloud.NewHTTPClient(cloudCABundle); err != nil {
+			return nil, err
+		}
+	}
+	if cloudAPIQPS > 0 {
+		if cloudAPILimiter == nil {
+			// a burst of 0 would block every call
+			burst := cloudAPIBurst
+			if burst < 1 {
+				burst = 1
+			}
+			cloudAPILimiter = rate.NewLimiter(rate.Limit(cloudAPIQPS), burst)
+		}
+		httpClient.Transport = cloud.NewRateLimitedTransport(httpClient.Transport, cloudAPILimiter)
+	}
+	return httpClient, nil
+}
+
+// newAWSInstances initializes the AWS backend from the cloud config, with the zone, role and cluster ID from the flags
+// taking precedence, restricted to the instances in scope. Missing values are detected from the environment and instance tags.
+func newAWSInstances(ctx context.Context, reader client.Reader, cloudConfigReader io.Reader, scope cloud.Scope) (cloud.Instances, error) {
+	cfg, err := awscloud.ReadConfig(cloudConfigReader)
+	if err != nil {
+		return nil, err
+	}
+
+	if cfg.Global.Zone, err = awsZone(ctx, cfg.Global.Zone); err != nil {
+		return nil, err
+	}
+	if awsAssumeRoleARN != "" {
+		cfg.Global.RoleARN = awsAssumeRoleARN
+	}
+	if awsAssumeRoleExternalID != "" {
+		cfg.Global.ExternalID = awsAssumeRoleExternalID
+	}
+	cfg.Global.AdditionalRegion = append(cfg.Global.AdditionalRegion, awsAdditionalRegions...)
+	if awsEndpointURL != "" {
+		cfg.Global.EndpointURL = awsEndpointURL
+	}
+	if cfg.HTTPClient, err = cloudHTTPClient(); err != nil {
+		return nil, err
+	}
+	cfg.BatchWindow = cloudBatchWindow
+	cfg.Scope = scope
+	cfg.StateSource = awsStateSource
+	cfg.ConfigAggregator = awsConfigAggregator
+	if vaultCredentials != nil {
+		secret := vaultCredentials.Current()
+		cfg.Credentials = credentials.NewStaticCredentials(
+			secret.String("access_key"), secret.String("secret_key"), secret.String("security_token"))
+	}
+	if cfg.Global.KubernetesClusterID, err = awsClusterID(ctx, reader, cfg); err != nil {
+		return nil, err
+	}
+	setupLog.Info("Using AWS region", "region", cfg.Region(), "partition", cfg.Partition())
+	return awscloud.New(cfg)
+}
+
+// awsZone returns the zone to use from the -zone and -region flags, or the one from the cloud config.
+// A bare region name is accepted as the zone. Without either, the zone is detected from the environment
+// or the instance metadata service.
+func awsZone(ctx context.Context, configured string) (string, error) {
+	if cloudZone != "" && cloudRegion != "" && !strings.HasPrefix(cloudZone, cloudRegion) {
+		return "", fmt.Errorf("zone %q is not in region %q", cloudZone, cloudRegion)
+	}
+	if cloudZone != "" {
+		return cloudZone, nil
+	}
+	if cloudRegion != "" {
+		return cloudRegion, nil
+	}
+	if configured != "" {
+		return configured, nil
+	}
+
+	zone, err := awscloud.DetectZone(ctx)
+	if err != nil {
+		return "", err
+	}
+	setupLog.Info("Detected AWS zone", "zone", zone)
+	return zone, nil
+}
+
+// awsClusterID returns the cluster ID from the -cluster-id flag or the cloud config, or discovers it from the
+// cluster tag of the controller's own instance or the instances of the cluster's nodes
+func awsClusterID(ctx context.Context, reader client.Reader, cfg *awscloud.Config) (string, error) {
+	if clusterID != "" {
+		return clusterID, nil
+	}
+	if cfg.Global.KubernetesClusterID != "" {
+		return cfg.Global.KubernetesClusterID, nil
+	}
+
+	var instanceIDs []string
+	nodes := &corev1.NodeList{}
+	if err := reader.List(ctx, nodes); err != nil {
+		return "", fmt.Errorf("unable to list nodes to discover the cluster ID: %w", err)
+	}
+	for _, node := range nodes.Items {
+		if id, err := awscloud.InstanceIDFromProviderID(node.Spec.ProviderID); err == nil {
+			instanceIDs = append(instanceIDs, id)
+		}
+	}
+
+	discovered, err := awscloud.DiscoverClusterID(ctx, cfg, instanceIDs)
+	if err != nil {
+		setupLog.Error(err, "Unable to discover cluster ID from instance tags, tag-scoped cloud queries will not work")
+		return "", nil
+	}
+	if discovered == "" {
+		setupLog.Info("No cluster tag found on instances, tag-scoped cloud queries will not work; set -cluster-id to fix this")
+		return "", nil
+	}
+	setupLog.Info("Discovered cluster ID from instance tags", "clusterID", discovered)
+	return discovered, nil
+}
+
+// newAzureInstances initializes the Azure backend from the cloud config, with the environment and managed identity flags
+// taking precedence
+func newAzureInstances(cloudConfigReader io.Reader) (cloud.Instances, error) {
+	cfg, err := azurecloud.ReadConfig(cloudConfigReader)
+	if err != nil {
+		return nil, err
+	}
+
+	if azureEnvironment != "" {
+		cfg.Cloud = azureEnvironment
+	}
+	if azureUseManagedIdentity {
+		cfg.UseManagedIdentityExtension = true
+	}
+	if azureUserAssignedIdentity != "" {
+		cfg.UserAssignedIdentityID = azureUserAssignedIdentity
+	}
+	if cfg.HTTPClient, err = cloudHTTPClient(); err != nil {
+		return nil, err
+	}
+	cfg.BatchWindow = cloudBatchWindow
+	cfg.StateSource = azureStateSource
+	if vaultCredentials != nil {
+		secret := vaultCredentials.Current()
+		cfg.AADClientID = secret.String("client_id")
+		cfg.AADClientSecret = secret.String("client_secret")
+	}
+	return azurecloud.New(cfg)
+}
+
+// newGCEInstances initializes the GCE backend from the cloud config, with the credentials from the flags, restricted
+// to the instances in scope
+func newGCEInstances(ctx context.Context, cloudConfigReader io.Reader, scope cloud.Scope) (cloud.Instances, error) {
+	if vaultCredentials != nil {
+		return nil, configError(errors.New("cloud provider \"gce\" does not support Vault credentials"))
+	}
+	cfg, err := gcecloud.ReadConfig(cloudConfigReader)
+	if err != nil {
+		return nil, err
+	}
+
+	cfg.Auth = gcecloud.AuthOptions{
+		CredentialsFile:           gceCredentialsFile,
+		ImpersonateServiceAccount: gceImpersonate,
+	}
+	if cfg.HTTPClient, err = cloudHTTPClient(); err != nil {
+		return nil, err
+	}
+	cfg.BatchWindow = cloudBatchWindow
+	cfg.Scope = scope
+	return gcecloud.New(ctx, cfg)
+}
+
+// rejectCloudConfig returns an error if Vault credentials or a cloud config are set for a provider that has no cloud
+// config and reads its credentials from the environment
+func rejectCloudConfig(provider string, cloudConfigReader io.Reader) error {
+	if vaultCredentials != nil {
+		return configError(fmt.Errorf("cloud provider %q does not support Vault credentials", provider))
+	}
+	if cloudConfigReader != nil {
+		return configError(fmt.Errorf("cloud provider %q has no cloud config, unset -cloud-config", provider))
+	}
+	return nil
+}
+
+// tokenFromEnv returns the API token of a provider that has no cloud config from the env environment variable
+func tokenFromEnv(provider, env string, cloudConfigReader io.Reader) (string, error) {
+	if err := rejectCloudConfig(provider, cloudConfigReader); err != nil {
+		return "", err
+	}
+	token := os.Getenv(env)
+	if token == "" {
+		return "", configError(fmt.Errorf("%s is not set", env))
+	}
+	return token, nil
+}
+
+// newDigitalOceanInstances initializes the DigitalOcean backend with the API token from DIGITALOCEAN_ACCESS_TOKEN,
+// restricted to the droplets in scope
+func newDigitalOceanInstances(cloudConfigReader io.Reader, scope cloud.Scope) (cloud.Instances, error) {
+	token, err := tokenFromEnv("digitalocean", "DIGITALOCEAN_ACCESS_TOKEN", cloudConfigReader)
+	if err != nil {
+		return nil, err
+	}
+
+	cfg := &docloud.Config{Token: token, Scope: scope}
+	if cfg.HTTPClient, err = cloudHTTPClient(); err != nil {
+		return nil, err
+	}
+	return docloud.New(cfg)
+}
+
+// newEquinixMetalInstances initializes the Equinix Metal backend with the API token from METAL_AUTH_TOKEN, restricted
+// to the devices in scope
+func newEquinixMetalInstances(cloudConfigReader io.Reader, scope cloud.Scope) (cloud.Instances, error) {
+	token, err := tokenFromEnv("equinixmetal", "METAL_AUTH_TOKEN", cloudConfigReader)
+	if err != nil {
+		return nil, err
+	}
+
+	cfg := &metalcloud.Config{Token: token, Scope: scope}
+	if cfg.HTTPClient, err = cloudHTTPClient(); err != nil {
+		return nil, err
+	}
+	return metalcloud.New(cfg)
+}
+
+// newHetznerInstances initializes the Hetzner Cloud backend with the API token from HCLOUD_TOKEN, restricted to the
+// servers in scope
+func newHetznerInstances(cloudConfigReader io.Reader, scope cloud.Scope) (cloud.Instances, error) {
+	token, err := tokenFromEnv("hcloud", "HCLOUD_TOKEN", cloudConfigReader)
+	if err != nil {
+		return nil, err
+	}
+
+	cfg := &hetznercloud.Config{Token: token, Scope: scope}
+	if cfg.HTTPClient, err = cloudHTTPClient(); err != nil {
+		return nil, err
+	}
+	return hetznercloud.New(cfg)
+}
+
+// newLinodeInstances initializes the Linode backend with the API token from LINODE_API_TOKEN, restricted to the
+// Linodes in scope
+func newLinodeInstances(cloudConfigReader io.Reader, scope cloud.Scope) (cloud.Instances, error) {
+	token, err := tokenFromEnv("linode", "LINODE_API_TOKEN", cloudConfigReader)
+	if err != nil {
+		return nil, err
+	}
+
+	cfg := &linodecloud.Config{Token: token, Scope: scope}
+	if cfg.HTTPClient, err = cloudHTTPClient(); err != nil {
+		return nil, err
+	}
+	return linodecloud.New(cfg)
+}
+
+// newMAASInstances initializes the MAAS backend for the -maas-url server with the API key from MAAS_API_KEY,
+// restricted to the machines in scope
+func newMAASInstances(ctx context.Context, cloudConfigReader io.Reader, scope cloud.Scope) (cloud.Instances, error) {
+	if err := rejectCloudConfig("maas", cloudConfigReader); err != nil {
+		return nil, err
+	}
+
+	cfg := &maascloud.Config{URL: maasURL, APIKey: os.Getenv("MAAS_API_KEY"), Scope: scope}
+	var err error
+	if cfg.HTTPClient, err = cloudHTTPClient(); err != nil {
+		return nil, err
+	}
+	instances, err := maascloud.New(ctx, cfg)
+	if err != nil {
+		return nil, configError(err)
+	}
+	return instances, nil
+}
+
+// newOCIInstances initializes the OCI backend from the cloud config, with the region from the flags taking
+// precedence, restricted to the instances in scope
+func newOCIInstances(cloudConfigReader io.Reader, scope cloud.Scope) (cloud.Instances, error) {
+	if vaultCredentials != nil {
+		return nil, configError(errors.New("cloud provider \"oci\" does not support Vault credentials"))
+	}
+	cfg, err := ocicloud.ReadConfig(cloudConfigReader)
+	if err != nil {
+		return nil, err
+	}
+	if cloudRegion != "" {
+		cfg.Auth.Region = cloudRegion
+	}
+	if cfg.HTTPClient, err = cloudHTTPClient(); err != nil {
+		return nil, err
+	}
+	cfg.Scope = scope
+	instances, err := ocicloud.New(cfg)
+	if err != nil {
+		return nil, configError(err)
+	}
+	return instances, nil
+}
+
+// newAlibabaInstances initializes the Alibaba Cloud backend with the RAM role from the flags, or the AccessKey from
+// ALIBABA_CLOUD_ACCESS_KEY_ID and ALIBABA_CLOUD_ACCESS_KEY_SECRET, restricted to the instances in scope
+func newAlibabaInstances(cloudConfigReader io.Reader, scope cloud.Scope) (cloud.Instances, error) {
+	if err := rejectCloudConfig("alicloud", cloudConfigReader); err != nil {
+		return nil, err
+	}
+
+	cfg := &alicloud.Config{
+		Auth: alicloud.AuthOptions{
+			AccessKeyID:     os.Getenv("ALIBABA_CLOUD_ACCESS_KEY_ID"),
+			AccessKeySecret: os.Getenv("ALIBABA_CLOUD_ACCESS_KEY_SECRET"),
+			SecurityToken:   os.Getenv("ALIBABA_CLOUD_SECURITY_TOKEN"),
+			RAMRole:         alicloudRAMRole,
+		},
+		APIEndpoint: alicloudEndpoint,
+		BatchWindow: cloudBatchWindow,
+		Scope:       scope,
+	}
+	var err error
+	if cfg.HTTPClient, err = cloudHTTPClient(); err != nil {
+		return nil, err
+	}
+	instances, err := alicloud.New(cfg)
+	if err != nil {
+		return nil, configError(err)
+	}
+	return instances, nil
+}
+
+// newIBMInstances initializes the IBM Cloud VPC backend for the region from the flags, with the API key from
+// IBMCLOUD_API_KEY
+func newIBMInstances(ctx context.Context, cloudConfigReader io.Reader) (cloud.Instances, error) {
+	if err := rejectCloudConfig("ibm", cloudConfigReader); err != nil {
+		return nil, err
+	}
+
+	cfg := &ibmcloud.Config{
+		APIKey:      os.Getenv("IBMCLOUD_API_KEY"),
+		Region:      cloudRegion,
+		APIEndpoint: ibmEndpoint,
+	}
+	var err error
+	if cfg.HTTPClient, err = cloudHTTPClient(); err != nil {
+		return nil, err
+	}
+	instances, err := ibmcloud.New(ctx, cfg)
+	if err != nil {
+		return nil, configError(err)
+	}
+	return instances, nil
+}
+
+// newLibvirtInstances initializes the libvirt backend for the -libvirt-uri connection
+func newLibvirtInstances(cloudConfigReader io.Reader) (cloud.Instances, error) {
+	if err := rejectCloudConfig("libvirt", cloudConfigReader); err != nil {
+		return nil, err
+	}
+
+	instances, err := libvirtcloud.New(&libvirtcloud.Config{URI: libvirtURI})
+	if err != nil {
+		return nil, configError(err)
+	}
+	return instances, nil
+}
+
+// newBMCInstances initializes the bare metal backend, with the BMC credentials from BMC_USERNAME and BMC_PASSWORD.
+// reader reads the BMC address annotation of nodes.
+func newBMCInstances(reader client.Reader, cloudConfigReader io.Reader) (cloud.Instances, error) {
+	if err := rejectCloudConfig("bmc", cloudConfigReader); err != nil {
+		return nil, err
+	}
+
+	cfg := &bmccloud.Config{
+		Address: func(ctx context.Context, nodeName string) (string, error) {
+			node := &corev1.Node{}
+			if err := reader.Get(ctx, client.ObjectKey{Name: nodeName}, node); err != nil {
+				return "", client.IgnoreNotFound(err)
+			}
+			return node.Annotations[bmccloud.AddressAnnotation], nil
+		},
+		Username:           os.Getenv("BMC_USERNAME"),
+		Password:           os.Getenv("BMC_PASSWORD"),
+		CriticalIsShutdown: bmcCriticalIsShutdown,
+	}
+	for _, cidr := range bmcAllowedNetworks {
+		_, network, err := net.ParseCIDR(cidr)
+		if err != nil {
+			return nil, configError(fmt.Errorf("invalid -bmc-allowed-networks: %w", err))
+		}
+		cfg.AllowedNetworks = append(cfg.AllowedNetworks, network)
+	}
+	var err error
+	if cfg.HTTPClient, err = cloudHTTPClient(); err != nil {
+		return nil, err
+	}
+	instances, err := bmccloud.New(cfg)
+	if err != nil {
+		return nil, configError(err)
+	}
+	return instances, nil
+}
+
+// newInventoryInstances initializes the static inventory backend from the cloud config, which is the inventory
+func newInventoryInstances(cloudConfigReader io.Reader) (cloud.Instances, error) {
+	if vaultCredentials != nil {
+		return nil, configError(errors.New("cloud provider \"inventory\" does not support Vault credentials"))
+	}
+	if cloudConfigReader == nil {
+		return nil, configError(errors.New("cloud provider \"inventory\" needs an inventory, set -cloud-config"))
+	}
+
+	cfg, err := inventorycloud.ReadConfig(cloudConfigReader)
+	if err != nil {
+		return nil, configError(err)
+	}
+	instances, err := inventorycloud.New(cfg)
+	if err != nil {
+		return nil, configError(err)
+	}
+	return instances, nil
+}
@@ -0,0 +1,308 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"sort"
+	"strings"
+
+	"github.com/nxtlytics/cloud-lifecycle-controller/controllers"
+	"github.com/nxtlytics/cloud-lifecycle-controller/pkg/cloud"
+	"github.com/nxtlytics/cloud-lifecycle-controller/pkg/nodecleanup"
+	"golang.org/x/time/rate"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/util/workqueue"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/manager"
+	"sigs.k8s.io/controller-runtime/pkg/ratelimiter"
+
+	awscloud "github.com/nxtlytics/cloud-lifecycle-controller/pkg/cloud/aws"
+	azurecloud "github.com/nxtlytics/cloud-lifecycle-controller/pkg/cloud/azure"
+	ctrl "sigs.k8s.io/controller-runtime"
+)
+
+// controllerInitializer sets up a controller with the manager
+type controllerInitializer func(mgr manager.Manager, instances cloud.Instances) error
+
+// controllerInitializers are the controllers that can be selected with -controllers, by name
+var controllerInitializers = map[string]controllerInitializer{
+	"node":        setupNodeController,
+	"cloud-node":  setupCloudNodeController,
+	"node-labels": setupNodeLabelsController,
+}
+
+// controllersDisabledByDefault are the controllers '*' doesn't enable, which have to be enabled by name
+var controllersDisabledByDefault = map[string]bool{
+	"cloud-node":  true,
+	"node-labels": true,
+}
+
+// controllerNames returns the names of all controllers, sorted
+func controllerNames() []string {
+	names := make([]string, 0, len(controllerInitializers))
+	for name := range controllerInitializers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// enabledControllers returns the names of the controllers selected with -controllers, which works like
+// kube-controller-manager's --controllers: '*' enables all controllers, 'foo' enables the controller named foo
+// and '-foo' disables it. Controllers disabled by default are only enabled by name.
+func enabledControllers() ([]string, error) {
+	enabled := map[string]bool{}
+	for _, item := range enabledControllerNames {
+		name := strings.TrimPrefix(item, "-")
+		if name != "*" && controllerInitializers[name] == nil {
+			return nil, configError(fmt.Errorf("unknown controller %q, expected one of %s", name,
+				strings.Join(controllerNames(), ", ")))
+		}
+		switch {
+		case item == "*":
+			for _, name := range controllerNames() {
+				if _, ok := enabled[name]; !ok && !controllersDisabledByDefault[name] {
+					enabled[name] = true
+				}
+			}
+		case strings.HasPrefix(item, "-"):
+			enabled[name] = false
+		default:
+			enabled[name] = true
+		}
+	}
+
+	var names []string
+	for _, name := range controllerNames() {
+		if enabled[name] {
+			names = append(names, name)
+		}
+	}
+	return names, nil
+}
+
+// setupControllers sets up the controllers selected with -controllers
+func setupControllers(mgr manager.Manager, instances cloud.Instances) error {
+	names, err := enabledControllers()
+	if err != nil {
+		return err
+	}
+	if len(names) == 0 {
+		return configError(fmt.Errorf("no controllers enabled"))
+	}
+	for _, name := range names {
+		if err := controllerInitializers[name](mgr, instances); err != nil {
+			return fmt.Errorf("unable to create controller %s: %w", name, err)
+		}
+	}
+	setupLog.Info("Enabled controllers", "controllers", names)
+	return nil
+}
+
+// setupNodeController sets up the controller that deletes nodes whose instances are gone
+func setupNodeController(mgr manager.Manager, instances cloud.Instances) error {
+	notifier, err := newNotifier(mgr)
+	if err != nil {
+		return err
+	}
+	pools, err := loadPools()
+	if err != nil {
+		return err
+	}
+	profile, err := settleProfile()
+	if err != nil {
+		return err
+	}
+	evictionAction, err := controllers.ParseEvictionAction(spotEvictionAction)
+	if err != nil {
+		return configError(err)
+	}
+	deleter, err := newDeleter(mgr)
+	if err != nil {
+		return err
+	}
+	reconciler, err := nodecleanup.New(mgr,
+		nodecleanup.WithCloud(instances),
+		nodecleanup.WithDryRunKube(dryRunKube),
+		nodecleanup.WithDryRunCloud(dryRunCloud),
+		nodecleanup.WithAudit(audit),
+		nodecleanup.WithPolicy(nodecleanup.Policy{
+			SettleInterval:     settleInterval,
+			SettleJitter:       settleJitter,
+			SettleProfile:      profile,
+			GiveUpAfter:        giveUpAfter,
+			UnknownDeadline:    unknownDeadline,
+			MinNotReady:        minNotReady,
+			LeaseMaxAge:        leaseMaxAge,
+			SpotEvictionAction: evictionAction,
+			Pools:              pools,
+		}),
+		nodecleanup.WithRateLimiter(newRateLimiter()),
+		nodecleanup.WithShard(shardCount, shardIndex),
+		nodecleanup.WithStartupSpread(startupSpread),
+		nodecleanup.WithWorkers(workers, deletionWorkers),
+		nodecleanup.WithActionLimits(actionLimits.limits),
+		nodecleanup.WithProbe(probePort, probeTimeout),
+		nodecleanup.WithVerifyCommand(strings.Fields(verifyCommand), verifyTimeout),
+		nodecleanup.WithChaos(chaos),
+		nodecleanup.WithDeleteNodeClaims(deleteNodeClaims),
+		nodecleanup.WithCleanUpTerminating(cleanUpTerminating),
+		nodecleanup.WithDeleter(deleter),
+		nodecleanup.WithNotifier(notifier),
+		nodecleanup.WithStatefulPods(jiraURL != "" && jiraStatefulOnly),
+		nodecleanup.WithPersistState(persistState),
+		nodecleanup.WithInstanceCondition(instanceConditionEnabled),
+		nodecleanup.WithSweep(sweepInterval, maxBacklog),
+		nodecleanup.WithGroupSync(groupSyncInterval),
+		nodecleanup.WithJournal(journalSize),
+	)
+	if err != nil {
+		return err
+	}
+	if explainEndpoint {
+		if err := mgr.AddMetricsExtraHandler(explainPath, explainHandler(mgr.GetAPIReader(), reconciler)); err != nil {
+			return fmt.Errorf("unable to set up the explain endpoint: %w", err)
+		}
+	}
+	if groupSyncInterval > 0 {
+		if err := mgr.AddMetricsExtraHandler(orphansPath, orphansHandler(reconciler)); err != nil {
+			return fmt.Errorf("unable to set up the orphans endpoint: %w", err)
+		}
+	}
+	if journalSize > 0 {
+		if err := mgr.AddMetricsExtraHandler(decisionsPath, decisionsHandler(reconciler)); err != nil {
+			return fmt.Errorf("unable to set up the decisions endpoint: %w", err)
+		}
+		return mgr.Add(decisionDumper{reconciler: reconciler})
+	}
+	return nil
+}
+
+// setupCloudNodeController sets up the controller that removes the uninitialized taint from new nodes whose instances
+// are running
+func setupCloudNodeController(mgr manager.Manager, instances cloud.Instances) error {
+	return (&controllers.CloudNodeReconciler{
+		Client:         mgr.GetClient(),
+		Recorder:       mgr.GetEventRecorderFor("cloud-lifecycle-controller"),
+		CloudInstances: instances,
+		Log:            ctrl.Log.WithName("controllers").WithName("CloudNode"),
+		DryRun:         dryRunKube,
+		Shard:          controllers.Shard{Count: shardCount, Index: shardIndex},
+	}).SetupWithManager(mgr)
+}
+
+// setupNodeLabelsController sets up the controller that sets missing topology and instance type labels on nodes
+func setupNodeLabelsController(mgr manager.Manager, instances cloud.Instances) error {
+	return (&controllers.NodeLabelsReconciler{
+		Client:         mgr.GetClient(),
+		CloudInstances: instances,
+		Log:            ctrl.Log.WithName("controllers").WithName("NodeLabels"),
+		DryRun:         dryRunKube,
+		Shard:          controllers.Shard{Count: shardCount, Index: shardIndex},
+	}).SetupWithManager(mgr)
+}
+
+// loadPools reads the per-pool overrides from -pool-config, if set
+func loadPools() (controllers.Pools, error) {
+	if poolConfig == "" {
+		return controllers.Pools{}, nil
+	}
+	data, err := ioutil.ReadFile(poolConfig)
+	if err != nil {
+		return controllers.Pools{}, configError(fmt.Errorf("unable to read -pool-config: %w", err))
+	}
+	pools, err := controllers.ParsePools(data)
+	if err != nil {
+		return pools, configError(err)
+	}
+	return pools, nil
+}
+
+// deleteAsConfig returns a copy of cfg impersonating the -delete-as service account, or nil if it isn't set
+func deleteAsConfig(cfg *rest.Config) (*rest.Config, error) {
+	if deleteAs == "" {
+		return nil, nil
+	}
+	namespace, name, ok := splitDeleteAs()
+	if !ok {
+		return nil, configError(fmt.Errorf("invalid -delete-as %q, must be <namespace>/<service account>", deleteAs))
+	}
+	impersonated := rest.CopyConfig(cfg)
+	impersonated.Impersonate = rest.ImpersonationConfig{
+		UserName: "system:serviceaccount:" + namespace + ":" + name,
+	}
+	return impersonated, nil
+}
+
+// splitDeleteAs returns the namespace and name of the -delete-as service account, and whether it is set and valid
+func splitDeleteAs() (string, string, bool) {
+	parts := strings.Split(deleteAs, "/")
+	if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+		return "", "", false
+	}
+	return parts[0], parts[1], true
+}
+
+// newDeleter returns a client that deletes nodes as the -delete-as service account, or nil to delete them with the
+// manager's client
+func newDeleter(mgr manager.Manager) (client.Client, error) {
+	cfg, err := deleteAsConfig(mgr.GetConfig())
+	if err != nil || cfg == nil {
+		return nil, err
+	}
+	c, err := client.New(cfg, client.Options{Scheme: mgr.GetScheme(), Mapper: mgr.GetRESTMapper()})
+	if err != nil {
+		return nil, fmt.Errorf("unable to create the -delete-as client: %w", err)
+	}
+	if dryRunKube {
+		// like the manager's client
+		c = client.NewDryRunClient(c)
+	}
+	return c, nil
+}
+
+// settleProfile returns the settle profile named by -settle-profile, or the -cloud provider's if it isn't set
+func settleProfile() (controllers.SettleProfile, error) {
+	switch settleProfileName {
+	case "":
+		switch {
+		case cloudProvider == "aws" && awsStateSource == awscloud.StateSourceConfig:
+			return controllers.SettleProfiles["aws-config"], nil
+		case cloudProvider == "azure" && azureStateSource == azurecloud.StateSourceResourceGraph:
+			return controllers.SettleProfiles["azure-resource-graph"], nil
+		}
+		return controllers.SettleProfiles[cloudProvider], nil
+	case "none":
+		return controllers.SettleProfile{}, nil
+	}
+	profile, ok := controllers.SettleProfiles[settleProfileName]
+	if !ok {
+		return profile, configError(fmt.Errorf("unknown -settle-profile %q", settleProfileName))
+	}
+	return profile, nil
+}
+
+// newRateLimiter returns the workqueue rate limiter configured with the -rate-limiter-* flags: per-node exponential
+// backoff between -rate-limiter-base-delay and -rate-limiter-max-delay, and an overall token bucket
+func newRateLimiter() ratelimiter.RateLimiter {
+	return workqueue.NewMaxOfRateLimiter(
+		workqueue.NewItemExponentialFailureRateLimiter(rateLimiterBaseDelay, rateLimiterMaxDelay),
+		&workqueue.BucketRateLimiter{Limiter: rate.NewLimiter(rate.Limit(rateLimiterQPS), rateLimiterBurst)},
+	)
+}
@@ -0,0 +1,48 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// FieldManager is the field manager the controllers apply changes to nodes with
+const FieldManager = "cloud-lifecycle-controller"
+
+// applyNode changes a node with a server-side apply patch of fields, a partial Node object holding only the fields
+// the controller manages, e.g. {"metadata": {"annotations": {...}}}. Nodes are never updated, since cached nodes are
+// stripped and updates would conflict with the kubelet's and other controllers' changes; with server-side apply, the
+// controller only owns the fields it sets. Status fields have to be applied to the status subresource instead.
+func applyNode(ctx context.Context, c client.Client, name string, fields map[string]interface{}) error {
+	patch := &unstructured.Unstructured{Object: fields}
+	patch.SetAPIVersion("v1")
+	patch.SetKind("Node")
+	patch.SetName(name)
+	return c.Patch(ctx, patch, client.Apply, client.FieldOwner(FieldManager), client.ForceOwnership)
+}
+
+// applyNodeStatus is applyNode for the node's status subresource, e.g. {"status": {"conditions": [...]}}
+func applyNodeStatus(ctx context.Context, c client.Client, name string, fields map[string]interface{}) error {
+	patch := &unstructured.Unstructured{Object: fields}
+	patch.SetAPIVersion("v1")
+	patch.SetKind("Node")
+	patch.SetName(name)
+	return c.Status().Patch(ctx, patch, client.Apply, client.FieldOwner(FieldManager), client.ForceOwnership)
+}
@@ -0,0 +1,33 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"math/rand"
+)
+
+// chaos picks a Chaos fraction of evaluations to fake, returning true and the cloud status to report for the node
+// if this one is picked
+func (r *NodeReconciler) chaos() (providerNodeStatus, bool) {
+	if r.Chaos <= 0 || rand.Float64() >= r.Chaos {
+		return providerNodeStatusUnknown, false
+	}
+	if rand.Intn(2) == 0 {
+		return providerNodeStatusShutdown, true
+	}
+	return providerNodeStatusNotFound, true
+}
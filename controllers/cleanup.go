@@ -0,0 +1,120 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/go-logr/logr"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	corev1 "k8s.io/api/core/v1"
+	storagev1 "k8s.io/api/storage/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	ctrl "sigs.k8s.io/controller-runtime"
+)
+
+const cleanUpNodeEvent = "CleaningUpNode"
+
+// cleanUp finishes the deletion of a dead node someone else is already deleting, instead of deleting it again: pods
+// stuck terminating on it are force deleted, since its kubelet will never confirm they stopped, and once none of its
+// pods use persistent volume claims any more, its VolumeAttachments are deleted so the volumes can be attached
+// elsewhere. The node is checked again until it is gone.
+func (r *NodeReconciler) cleanUp(ctx context.Context, node *corev1.Node, decision *Decision, logger logr.Logger) (ctrl.Result, error) {
+	reader := r.APIReader
+	if reader == nil {
+		reader = r.Client
+	}
+	result := ctrl.Result{RequeueAfter: r.requeueDelay(decision)}
+
+	pods := &corev1.PodList{}
+	if err := reader.List(ctx, pods, client.MatchingFields{"spec.nodeName": node.Name}); err != nil {
+		return ctrl.Result{}, fmt.Errorf("unable to list the node's pods: %w", err)
+	}
+	var stuck []*corev1.Pod
+	claimsInUse := false
+	for i := range pods.Items {
+		pod := &pods.Items[i]
+		if pod.DeletionTimestamp != nil && pod.DeletionTimestamp.Time.Before(time.Now()) {
+			// past its grace period
+			stuck = append(stuck, pod)
+		} else {
+			claimsInUse = claimsInUse || usesClaims(pod)
+		}
+	}
+
+	var attachments []*storagev1.VolumeAttachment
+	if !claimsInUse {
+		list := &storagev1.VolumeAttachmentList{}
+		if err := reader.List(ctx, list); err != nil {
+			return ctrl.Result{}, fmt.Errorf("unable to list volume attachments: %w", err)
+		}
+		for i := range list.Items {
+			if list.Items[i].Spec.NodeName == node.Name && list.Items[i].DeletionTimestamp == nil {
+				attachments = append(attachments, &list.Items[i])
+			}
+		}
+	}
+	if len(stuck) == 0 && len(attachments) == 0 {
+		logger.Info("Nothing to clean up on node being deleted")
+		return result, nil
+	}
+
+	var cleaned []string
+	for _, pod := range stuck {
+		cleaned = append(cleaned, "pod "+pod.Namespace+"/"+pod.Name)
+	}
+	for _, attachment := range attachments {
+		cleaned = append(cleaned, "volume attachment "+attachment.Name)
+	}
+	msg := fmt.Sprintf("Node %s is being deleted and its status is %s, cleaning up %s", node.Name, decision.CloudStatus,
+		strings.Join(cleaned, ", "))
+	logger.Info(msg)
+	r.Recorder.Event(newNodeRef(node), corev1.EventTypeNormal, cleanUpNodeEvent, msg)
+	if r.DryRun {
+		logger.Info("Dry run: skipping clean up")
+		return result, nil
+	}
+
+	deleter := r.deleter()
+	for _, pod := range stuck {
+		err := deleter.Delete(ctx, pod, client.GracePeriodSeconds(0), client.Preconditions{UID: &pod.UID})
+		if err != nil && !apierrors.IsNotFound(err) {
+			return ctrl.Result{}, fmt.Errorf("unable to force delete pod %s/%s: %w", pod.Namespace, pod.Name, err)
+		}
+	}
+	for _, attachment := range attachments {
+		err := deleter.Delete(ctx, attachment, client.Preconditions{UID: &attachment.UID})
+		if err != nil && !apierrors.IsNotFound(err) {
+			return ctrl.Result{}, fmt.Errorf("unable to delete volume attachment %s: %w", attachment.Name, err)
+		}
+	}
+	return result, nil
+}
+
+// usesClaims returns true if the pod mounts persistent volume claims
+func usesClaims(pod *corev1.Pod) bool {
+	for _, volume := range pod.Spec.Volumes {
+		if volume.PersistentVolumeClaim != nil {
+			return true
+		}
+	}
+	return false
+}
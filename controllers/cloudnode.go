@@ -0,0 +1,140 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/go-logr/logr"
+	"github.com/nxtlytics/cloud-lifecycle-controller/pkg/cloud"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/builder"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	cloudproviderapi "k8s.io/cloud-provider/api"
+	ctrl "sigs.k8s.io/controller-runtime"
+)
+
+const initializedNodeEvent = "InitializedNode"
+
+// CloudNodeReconciler initializes new nodes in clusters without a cloud-controller-manager: once a node's instance is
+// found running in the cloud, it removes the node.cloudprovider.kubernetes.io/uninitialized taint the kubelet
+// registers the node with when it runs with --cloud-provider=external. Nodes need a provider ID, e.g. from the
+// kubelet's --provider-id flag, since there's no cloud-controller-manager to set it.
+type CloudNodeReconciler struct {
+	client.Client
+	Recorder       record.EventRecorder
+	CloudInstances cloud.Instances
+	Log            logr.Logger
+	// DryRun only logs and records events for the taints that would be removed
+	DryRun bool
+	// Shard restricts the controller to the nodes of one shard
+	Shard Shard
+}
+
+// Reconcile removes the uninitialized taint from the node if its instance is running
+func (r *CloudNodeReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
+	logger := r.Log.WithValues("node", req.NamespacedName)
+
+	node := &corev1.Node{}
+	if err := r.Client.Get(ctx, req.NamespacedName, node); err != nil {
+		return ctrl.Result{}, client.IgnoreNotFound(err)
+	}
+	if !hasUninitializedTaint(node) {
+		return ctrl.Result{}, nil
+	}
+	if node.Spec.ProviderID == "" {
+		// reconciled again once the provider ID is set
+		logger.Info("Node has no provider ID, can't initialize it")
+		return ctrl.Result{}, nil
+	}
+
+	exists, err := r.CloudInstances.InstanceExistsByProviderID(ctx, node.Spec.ProviderID)
+	if cloud.IsOutOfScope(err) {
+		logger.Info("Node's instance isn't the cluster's, not initializing it", "error", err.Error())
+		return ctrl.Result{}, nil
+	}
+	if err != nil && !cloud.IsInstanceNotFound(err) {
+		return ctrl.Result{}, fmt.Errorf("unable to look up instance: %w", err)
+	}
+	if !exists {
+		// the node controller deletes the node once it's not ready
+		logger.Info("Node's instance doesn't exist, not initializing it")
+		return ctrl.Result{}, nil
+	}
+	shutdown, err := r.CloudInstances.InstanceShutdownByProviderID(ctx, node.Spec.ProviderID)
+	if err != nil {
+		return ctrl.Result{}, fmt.Errorf("unable to look up instance: %w", err)
+	}
+	if shutdown {
+		logger.Info("Node's instance is shut down, not initializing it")
+		return ctrl.Result{}, nil
+	}
+
+	msg := fmt.Sprintf("Removing taint %s from node %s, its instance is running", cloudproviderapi.TaintExternalCloudProvider,
+		node.Name)
+	logger.Info(msg)
+	r.Recorder.Event(newNodeRef(node), corev1.EventTypeNormal, initializedNodeEvent, msg)
+	if r.DryRun {
+		logger.Info("Dry run: skipping taint removal")
+		return ctrl.Result{}, nil
+	}
+
+	// taints are an atomic list, so applying them would take ownership of every taint; a merge patch with the
+	// resourceVersion instead fails if the taints changed in the meantime
+	patch := client.MergeFromWithOptions(node.DeepCopy(), client.MergeFromWithOptimisticLock{})
+	taints := make([]corev1.Taint, 0, len(node.Spec.Taints))
+	for _, taint := range node.Spec.Taints {
+		if taint.Key != cloudproviderapi.TaintExternalCloudProvider {
+			taints = append(taints, taint)
+		}
+	}
+	node.Spec.Taints = taints
+	if err := r.Client.Patch(ctx, node, patch); err != nil {
+		if apierrors.IsConflict(err) {
+			return ctrl.Result{Requeue: true}, nil
+		}
+		return ctrl.Result{}, fmt.Errorf("unable to remove taint: %w", err)
+	}
+	return ctrl.Result{}, nil
+}
+
+// hasUninitializedTaint returns true if the node has the taint of nodes waiting for a cloud provider to initialize them
+func hasUninitializedTaint(node *corev1.Node) bool {
+	for _, taint := range node.Spec.Taints {
+		if taint.Key == cloudproviderapi.TaintExternalCloudProvider {
+			return true
+		}
+	}
+	return false
+}
+
+// SetupWithManager sets up the controller with the Manager
+func (r *CloudNodeReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	uninitialized := predicate.NewPredicateFuncs(func(obj client.Object) bool {
+		node, ok := obj.(*corev1.Node)
+		return ok && hasUninitializedTaint(node)
+	})
+	return ctrl.NewControllerManagedBy(mgr).
+		Named("cloud-node").
+		For(&corev1.Node{}, builder.WithPredicates(r.Shard.predicate(), virtualNodePredicate(), uninitialized)).
+		Complete(r)
+}
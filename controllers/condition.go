@@ -0,0 +1,113 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+// InstanceCondition is the node condition the controller maintains when InstanceCondition is set, with what the cloud
+// provider said about the node's instance the last time it was checked
+const InstanceCondition corev1.NodeConditionType = "CloudInstanceHealthy"
+
+// Reasons of InstanceCondition
+const (
+	instanceRunningReason  = "InstanceRunning"
+	instanceNotFoundReason = "InstanceNotFound"
+	instanceShutdownReason = "InstanceShutdown"
+	lookupFailedReason     = "LookupFailed"
+	notCheckedReason       = "NotChecked"
+)
+
+// instanceCondition returns the InstanceCondition for a decision, or nil if the cloud provider wasn't asked
+func instanceCondition(decision *Decision) *corev1.NodeCondition {
+	condition := &corev1.NodeCondition{Type: InstanceCondition}
+	switch {
+	case decision.Ready == corev1.ConditionTrue:
+		condition.Status = corev1.ConditionUnknown
+		condition.Reason = notCheckedReason
+		condition.Message = "The instance is only checked while the node is not ready"
+	case decision.InstanceExists != nil && !*decision.InstanceExists:
+		condition.Status = corev1.ConditionFalse
+		condition.Reason = instanceNotFoundReason
+		condition.Message = "The instance doesn't exist"
+	case decision.InstanceShutdown != nil && *decision.InstanceShutdown:
+		condition.Status = corev1.ConditionFalse
+		condition.Reason = instanceShutdownReason
+		condition.Message = "The instance is shut down"
+	case decision.InstanceShutdown != nil:
+		condition.Status = corev1.ConditionTrue
+		condition.Reason = instanceRunningReason
+		condition.Message = "The instance exists and isn't shut down"
+	case decision.Error != "":
+		condition.Status = corev1.ConditionUnknown
+		condition.Reason = lookupFailedReason
+		condition.Message = decision.Error
+	default:
+		return nil
+	}
+	return condition
+}
+
+// updateInstanceCondition sets the node's InstanceCondition from the decision if it changed. Nodes that are ready
+// only get it updated if they have it already, so healthy clusters aren't written to.
+func (r *NodeReconciler) updateInstanceCondition(ctx context.Context, node *corev1.Node, decision *Decision) {
+	if !r.InstanceCondition || r.DryRun || r.Audit || decision.Chaos {
+		return
+	}
+	condition := instanceCondition(decision)
+	if condition == nil {
+		return
+	}
+	var current *corev1.NodeCondition
+	for i := range node.Status.Conditions {
+		if node.Status.Conditions[i].Type == InstanceCondition {
+			current = &node.Status.Conditions[i]
+		}
+	}
+	if current == nil && condition.Reason == notCheckedReason {
+		return
+	}
+	if current != nil && current.Status == condition.Status && current.Reason == condition.Reason {
+		return
+	}
+
+	now := time.Now().UTC().Format(time.RFC3339)
+	// the transition time only moves when the status does, not when just the reason changes
+	transition := now
+	if current != nil && current.Status == condition.Status {
+		transition = current.LastTransitionTime.UTC().Format(time.RFC3339)
+	}
+	err := applyNodeStatus(ctx, r.Client, node.Name, map[string]interface{}{
+		"status": map[string]interface{}{
+			"conditions": []interface{}{map[string]interface{}{
+				"type":               string(condition.Type),
+				"status":             string(condition.Status),
+				"reason":             condition.Reason,
+				"message":            condition.Message,
+				"lastHeartbeatTime":  now,
+				"lastTransitionTime": transition,
+			}},
+		},
+	})
+	if err != nil {
+		r.Log.Error(err, "Unable to update node condition", "node", node.Name, "condition", InstanceCondition)
+	}
+}
@@ -0,0 +1,84 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"fmt"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+// Action is what the controller does with a node after evaluating it
+type Action string
+
+const (
+	// ActionNone means the node is left alone
+	ActionNone Action = "None"
+	// ActionRequeue means the cloud status is not conclusive yet and the node will be checked again later
+	ActionRequeue Action = "Requeue"
+	// ActionDelete means the node is deleted from the cluster
+	ActionDelete Action = "Delete"
+	// ActionGiveUp means the cloud status hasn't settled for too long, and the node is left alone until its Ready
+	// condition changes
+	ActionGiveUp Action = "GiveUp"
+	// ActionCleanUp means the node would be deleted, but is already being deleted, so only its stuck pods and volume
+	// attachments are cleaned up. Pools allow it where they allow Delete.
+	ActionCleanUp Action = "CleanUp"
+)
+
+// Decision is the result of evaluating a node against the API server and the cloud provider
+type Decision struct {
+	Node       string                 `json:"node"`
+	ProviderID string                 `json:"providerID"`
+	Ready      corev1.ConditionStatus `json:"ready"`
+	// InstanceExists and InstanceShutdown are the cloud provider's answers, nil if it wasn't asked
+	InstanceExists   *bool `json:"instanceExists"`
+	InstanceShutdown *bool `json:"instanceShutdown"`
+	// InstanceEvicted is set if the shut down instance is a spot instance whose capacity was reclaimed
+	InstanceEvicted *bool  `json:"instanceEvicted,omitempty"`
+	CloudStatus     string `json:"cloudStatus,omitempty"`
+	Action          Action `json:"action"`
+	Reason          string `json:"reason"`
+	// Error is the error returned by the cloud provider, if any
+	Error string `json:"error,omitempty"`
+	// Chaos is true if the node's status was faked by chaos mode
+	Chaos bool `json:"chaos,omitempty"`
+	// Checks are the steps of the evaluation, in order, up to the one that decided the action
+	Checks []Check `json:"checks,omitempty"`
+
+	// retryAfter is how long the cloud API asked to wait before asking again, if it throttled the lookup
+	retryAfter time.Duration
+	// pastDeadline is true if the node is deleted because its cloud status stayed unknown past the deadline
+	pastDeadline bool
+	// protected is set when the node would have been deleted if it weren't protected
+	protected bool
+	// settleInterval is how long to wait before re-checking the node, before jitter, as set for its pool
+	settleInterval time.Duration
+}
+
+// Check is one step of a node's evaluation, e.g. a threshold or a cloud provider answer, recorded so operators can
+// see exactly why the controller did or didn't act
+type Check struct {
+	Name   string `json:"name"`
+	Result string `json:"result"`
+}
+
+// check records a step of the evaluation
+func (d *Decision) check(name, format string, args ...interface{}) {
+	d.Checks = append(d.Checks, Check{Name: name, Result: fmt.Sprintf(format, args...)})
+}
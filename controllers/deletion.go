@@ -0,0 +1,183 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/go-logr/logr"
+	"k8s.io/client-go/util/workqueue"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+)
+
+// DefaultDeletionWorkers is the default number of workers deleting nodes
+const DefaultDeletionWorkers = 2
+
+// deletionTimeout bounds each node deletion
+const deletionTimeout = 30 * time.Second
+
+// deletionQueue deletes the nodes the controller decided to delete, with its own workers and workqueue, so that
+// during a large incident deletions aren't held up behind the many nodes waiting for cloud lookups
+type deletionQueue struct {
+	client client.Client
+	// deleter deletes the nodes, if set; client is still used to re-check them first
+	deleter client.Client
+	log     logr.Logger
+	workers int
+	queue   workqueue.RateLimitingInterface
+	// nodeClaims deletes the Karpenter NodeClaims owning nodes instead of the nodes
+	nodeClaims bool
+	// limits limits the deletions of each action class, if set
+	limits *actionLimiter
+
+	// nodes holds the deletions waiting to be carried out, by node name
+	nodes sync.Map
+	// deleted, if set, is called after each node deletion
+	deleted func(node *corev1.Node, decision *Decision, dryRun bool)
+}
+
+// deletion is a node the controller decided to delete, and why
+type deletion struct {
+	node     *corev1.Node
+	decision *Decision
+}
+
+func newDeletionQueue(c client.Client, log logr.Logger, workers int, nodeClaims bool) *deletionQueue {
+	if workers <= 0 {
+		workers = DefaultDeletionWorkers
+	}
+	return &deletionQueue{
+		client:     c,
+		log:        log,
+		workers:    workers,
+		queue:      workqueue.NewNamedRateLimitingQueue(workqueue.DefaultControllerRateLimiter(), "node-deletion"),
+		nodeClaims: nodeClaims,
+	}
+}
+
+// add queues a node for deletion
+func (q *deletionQueue) add(node *corev1.Node, decision *Decision) {
+	q.nodes.Store(node.Name, &deletion{node: node, decision: decision})
+	q.queue.Add(node.Name)
+}
+
+// Start runs the workers until ctx is done. It implements manager.Runnable, and like the controllers only runs on
+// the leader.
+//
+// When ctx is done, no more nodes are queued, but the nodes already queued are still deleted before Start returns,
+// so the controller doesn't leave decided deletions undone when it is stopped. The manager waits for that for up to
+// its graceful shutdown timeout.
+func (q *deletionQueue) Start(ctx context.Context) error {
+	var wg sync.WaitGroup
+	for i := 0; i < q.workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for q.processNext() {
+			}
+		}()
+	}
+	<-ctx.Done()
+	if pending := q.queue.Len(); pending > 0 {
+		q.log.Info("Finishing pending node deletions before stopping", "pending", pending)
+	}
+	q.queue.ShutDown()
+	wg.Wait()
+	return nil
+}
+
+// processNext deletes the next node in the queue, returning false once the queue is shut down and empty
+func (q *deletionQueue) processNext() bool {
+	item, shutdown := q.queue.Get()
+	if shutdown {
+		return false
+	}
+	defer q.queue.Done(item)
+
+	value, ok := q.nodes.Load(item)
+	if !ok {
+		q.queue.Forget(item)
+		return true
+	}
+	node := value.(*deletion).node
+	logger := q.log.WithValues("node", node.Name)
+
+	// deletions aren't tied to the manager's context, so they are finished when it stops
+	ctx, cancel := context.WithTimeout(context.Background(), deletionTimeout)
+	defer cancel()
+	current := &corev1.Node{}
+	if err := q.client.Get(ctx, client.ObjectKeyFromObject(node), current); err == nil && current.DeletionTimestamp != nil {
+		// someone else deleted it since it was queued, e.g. Karpenter or an operator
+		logger.Info("Node is already being deleted")
+		q.nodes.Delete(item)
+		q.queue.Forget(item)
+		return true
+	}
+	if by := protection(current); by != "" {
+		// protected since it was queued
+		logger.Info("Node was protected in the meantime, not deleting it", "protection", by)
+		q.nodes.Delete(item)
+		q.queue.Forget(item)
+		return true
+	}
+	class := deletionClass(node, q.nodeClaims)
+	release, wait := q.limits.acquire(class)
+	if release == nil {
+		if q.queue.ShuttingDown() {
+			logger.Info("Node deletion is throttled while stopping, leaving it for the next leader", "class", class)
+			q.nodes.Delete(item)
+			q.queue.Forget(item)
+			return true
+		}
+		// put off without counting as a failure, so it doesn't add to the node's retry backoff
+		logger.V(1).Info("Node deletion is throttled", "class", class, "retryAfter", wait)
+		q.queue.AddAfter(item, wait)
+		return true
+	}
+	deleter := q.deleter
+	if deleter == nil {
+		deleter = q.client
+	}
+	err := deleteNode(ctx, deleter, node, q.nodeClaims, logger)
+	release()
+	switch {
+	case err == nil:
+		logger.Info("Deleted node")
+		nodeDeletionsTotal.WithLabelValues("live").Inc()
+		if q.deleted != nil {
+			q.deleted(node, value.(*deletion).decision, false)
+		}
+	case apierrors.IsNotFound(err):
+		logger.Info("Node was already deleted")
+	case apierrors.IsConflict(err):
+		logger.Info("Node re-registered in the meantime, not deleting it")
+	case q.queue.ShuttingDown():
+		logger.Error(err, "Unable to delete node while stopping, leaving it for the next leader")
+	default:
+		logger.Error(err, "Unable to delete node, retrying")
+		q.queue.AddRateLimited(item)
+		return true
+	}
+	q.nodes.Delete(item)
+	q.queue.Forget(item)
+	return true
+}
@@ -0,0 +1,159 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers_test
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/nxtlytics/cloud-lifecycle-controller/controllers"
+	"github.com/nxtlytics/cloud-lifecycle-controller/pkg/clctest"
+	"github.com/nxtlytics/cloud-lifecycle-controller/pkg/cloud/fake"
+	"k8s.io/client-go/rest"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/envtest"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+)
+
+// cfg is the config of the envtest API server, or nil if KUBEBUILDER_ASSETS isn't set and the scenarios are skipped
+var cfg *rest.Config
+
+func TestMain(m *testing.M) {
+	if os.Getenv("KUBEBUILDER_ASSETS") == "" {
+		os.Exit(m.Run())
+	}
+	testEnv := &envtest.Environment{}
+	var err error
+	cfg, err = testEnv.Start()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "unable to start envtest:", err)
+		os.Exit(1)
+	}
+	code := m.Run()
+	if err := testEnv.Stop(); err != nil {
+		fmt.Fprintln(os.Stderr, "unable to stop envtest:", err)
+	}
+	os.Exit(code)
+}
+
+// newEnv creates the node in the envtest API server and returns an Env whose reconciler talks to it
+func newEnv(t *testing.T, node *corev1.Node) *clctest.Env {
+	t.Helper()
+	if cfg == nil {
+		t.Skip("KUBEBUILDER_ASSETS is not set, run make test to set up envtest")
+	}
+	c, err := client.New(cfg, client.Options{Scheme: clientgoscheme.Scheme})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+	status := node.Status
+	if err := c.Create(ctx, node); err != nil {
+		t.Fatal(err)
+	}
+	node.Status = status
+	if err := c.Status().Update(ctx, node); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		if err := c.Delete(ctx, node); err != nil && !apierrors.IsNotFound(err) {
+			t.Error(err)
+		}
+	})
+	return clctest.NewWithClient(c)
+}
+
+// assertNode fails the test unless the node's existence and events are as expected
+func assertNode(t *testing.T, env *clctest.Env, name string, exists bool) {
+	t.Helper()
+	found, err := env.NodeExists(context.Background(), name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if found != exists {
+		t.Errorf("node %s exists: %t, want %t", name, found, exists)
+	}
+	deleting := false
+	for _, reason := range env.Recorder.Reasons(name) {
+		deleting = deleting || reason == "DeletingNode"
+	}
+	if deleting == exists {
+		t.Errorf("node %s has events %v, want a DeletingNode event: %t", name, env.Recorder.Reasons(name), !exists)
+	}
+}
+
+func TestInstanceDisappears(t *testing.T) {
+	const providerID = "aws:///us-east-1a/i-disappears"
+	env := newEnv(t, clctest.NotReadyNode("disappears", providerID, time.Hour))
+	env.Cloud.Script(providerID, fake.Running, fake.Gone)
+
+	if _, err := env.Drive(context.Background(), "disappears", 5); err != nil {
+		t.Fatal(err)
+	}
+	if calls := env.Cloud.Calls(providerID); calls != 2 {
+		t.Errorf("cloud was asked %d times, want 2", calls)
+	}
+	assertNode(t, env, "disappears", false)
+}
+
+func TestInstanceReappears(t *testing.T) {
+	const providerID = "aws:///us-east-1a/i-reappears"
+	env := newEnv(t, clctest.NotReadyNode("reappears", providerID, time.Minute))
+	// the node is younger than the window in which its instance may be missing from the cloud API
+	env.Reconciler.SettleProfile = controllers.SettleProfile{NotFoundWindow: 10 * time.Minute}
+	env.Cloud.Script(providerID, fake.Gone, fake.Running)
+
+	for i := 0; i < 3; i++ {
+		result, err := env.Reconcile(context.Background(), "reappears")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if result.RequeueAfter == 0 {
+			t.Errorf("reconcile %d didn't requeue the node", i)
+		}
+	}
+	assertNode(t, env, "reappears", true)
+}
+
+func TestThrottled(t *testing.T) {
+	const providerID = "aws:///us-east-1a/i-throttled"
+	env := newEnv(t, clctest.NotReadyNode("throttled", providerID, time.Hour))
+	env.Cloud.Script(providerID, fake.Throttled(time.Hour), fake.Throttled(time.Hour), fake.Gone)
+
+	for i := 0; i < 2; i++ {
+		result, err := env.Reconcile(context.Background(), "throttled")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if result.RequeueAfter < time.Hour {
+			t.Errorf("reconcile %d requeued the node after %s, want at least the cloud API's retry after", i,
+				result.RequeueAfter)
+		}
+	}
+	assertNode(t, env, "throttled", true)
+
+	if _, err := env.Reconcile(context.Background(), "throttled"); err != nil {
+		t.Fatal(err)
+	}
+	assertNode(t, env, "throttled", false)
+}
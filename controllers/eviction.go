@@ -0,0 +1,54 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"fmt"
+	"strings"
+)
+
+// ParseEvictionAction parses what to do with nodes whose spot instance was evicted, Delete, GiveUp or None in any
+// case. An empty string is Delete.
+func ParseEvictionAction(s string) (Action, error) {
+	for _, action := range []Action{ActionDelete, ActionGiveUp, ActionNone} {
+		if strings.EqualFold(s, string(action)) {
+			return action, nil
+		}
+	}
+	if s == "" {
+		return ActionDelete, nil
+	}
+	return "", fmt.Errorf("invalid spot eviction action %q, must be Delete, GiveUp or None", s)
+}
+
+// evicted decides what to do with a node whose spot instance was evicted, returning true if the decision is final.
+// With Delete it isn't: the node goes through the usual checks before deletion, except the settle profile's shutdown
+// delay, since an evicted instance won't come back on its own like a redeployed one does.
+func (t thresholds) evicted(decision *Decision) bool {
+	decision.check("spot-eviction", "action %s", t.evictionAction)
+	switch t.evictionAction {
+	case ActionNone:
+		decision.Action = ActionNone
+		decision.Reason = "Node's spot instance was evicted, leaving it alone"
+		return true
+	case ActionGiveUp:
+		decision.Action = ActionGiveUp
+		decision.Reason = "Node's spot instance was evicted, giving up until its Ready condition changes"
+		return true
+	}
+	return false
+}
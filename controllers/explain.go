@@ -0,0 +1,47 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"fmt"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+// Explain evaluates a node like Evaluate, first checking whether this replica's shard owns it. The decision's Checks
+// record every step of the evaluation, so operators can see why the controller did or didn't act.
+func (r *NodeReconciler) Explain(ctx context.Context, node *corev1.Node) (*Decision, error) {
+	if r.Shard.Count <= 1 {
+		return r.Evaluate(ctx, node)
+	}
+
+	shard := Check{Name: "shard", Result: fmt.Sprintf("owned by shard %d of %d: %t", r.Shard.Index, r.Shard.Count,
+		r.Shard.Owns(node.Name))}
+	if !r.Shard.Owns(node.Name) {
+		return &Decision{
+			Node:       node.Name,
+			ProviderID: node.Spec.ProviderID,
+			Action:     ActionNone,
+			Reason:     "Node belongs to another shard",
+			Checks:     []Check{shard},
+		}, nil
+	}
+	decision, err := r.Evaluate(ctx, node)
+	decision.Checks = append([]Check{shard}, decision.Checks...)
+	return decision, err
+}
@@ -0,0 +1,213 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/nxtlytics/cloud-lifecycle-controller/pkg/cloud"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+// orphanGrace is how long an autoscaling group instance may be without a node before it is reported as an orphan,
+// since new instances take a while to boot and register
+const orphanGrace = 10 * time.Minute
+
+// Orphan is an autoscaling group instance without a node, e.g. one that failed to join the cluster
+type Orphan struct {
+	Group      string `json:"group"`
+	ProviderID string `json:"providerID"`
+	// Since is when the group sync first found the instance without a node
+	Since time.Time `json:"since"`
+}
+
+// groupSyncer lists the membership of the cloud's autoscaling groups each interval, the authoritative list of the
+// instances that should exist. Nodes whose instance was in a group and no longer is in any are reconciled right away,
+// bypassing the cache, rather than waiting for their next event or sweep.
+type groupSyncer struct {
+	reconciler *NodeReconciler
+	interval   time.Duration
+
+	mu sync.Mutex
+	// grouped holds the group of the instance of each node found in one, by node name
+	grouped map[string]string
+	// departed holds the nodes whose instance left its group and that haven't been reconciled since
+	departed map[string]bool
+	// unmatched holds the group instances without a node, by provider ID
+	unmatched map[string]*unmatchedInstance
+}
+
+// unmatchedInstance is a group instance without a node
+type unmatchedInstance struct {
+	Orphan
+	// reported is true once the instance was logged as an orphan
+	reported bool
+}
+
+// Start implements manager.Runnable
+func (g *groupSyncer) Start(ctx context.Context) error {
+	r := g.reconciler
+	ticker := time.NewTicker(g.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+		err := g.sync(ctx)
+		if errors.Is(err, cloud.ErrGroupsNotSupported) {
+			r.Log.Info("Cloud provider can't list autoscaling groups, not syncing with them")
+			return nil
+		}
+		if err != nil {
+			r.Log.Error(err, "Unable to sync with autoscaling groups")
+		}
+	}
+}
+
+// sync lists the groups of the nodes' instances and compares them with the previous sync
+func (g *groupSyncer) sync(ctx context.Context) error {
+	r := g.reconciler
+	nodes := &corev1.NodeList{}
+	if err := r.List(ctx, nodes); err != nil {
+		return err
+	}
+	// all nodes are matched with group members, so other shards' nodes aren't reported as orphans, but only the
+	// shard's nodes are reconciled
+	owned := map[string]string{}
+	var providerIDs []string
+	for i := range nodes.Items {
+		node := &nodes.Items[i]
+		if isVirtualNode(node) || node.Spec.ProviderID == "" {
+			continue
+		}
+		providerIDs = append(providerIDs, node.Spec.ProviderID)
+		if r.Shard.Owns(node.Name) {
+			owned[node.Spec.ProviderID] = node.Name
+		}
+	}
+	membership, err := cloud.ListGroups(ctx, r.CloudInstances, providerIDs)
+	if err != nil {
+		return err
+	}
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if g.departed == nil {
+		g.departed = map[string]bool{}
+	}
+
+	grouped := make(map[string]string, len(membership.Groups))
+	var departed []string
+	for providerID, name := range owned {
+		if group, ok := membership.Groups[providerID]; ok {
+			grouped[name] = group
+			continue
+		}
+		if group, ok := g.grouped[name]; ok {
+			r.Log.Info("Node's instance left its autoscaling group", "node", name, "providerID", providerID,
+				"group", group)
+			groupDeparturesTotal.WithLabelValues(group).Inc()
+			g.departed[name] = true
+			departed = append(departed, name)
+		}
+	}
+	g.grouped = grouped
+	// forget departed nodes that were deleted or rejoined a group before they were reconciled
+	names := make(map[string]bool, len(owned))
+	for _, name := range owned {
+		names[name] = true
+	}
+	for name := range g.departed {
+		if _, ok := grouped[name]; ok || !names[name] {
+			delete(g.departed, name)
+		}
+	}
+
+	now := time.Now()
+	unmatched := map[string]*unmatchedInstance{}
+	groupOrphans.Reset()
+	for group, members := range membership.Others {
+		for _, providerID := range members {
+			instance, ok := g.unmatched[providerID]
+			if !ok {
+				instance = &unmatchedInstance{Orphan: Orphan{Group: group, ProviderID: providerID, Since: now}}
+			}
+			unmatched[providerID] = instance
+			if now.Sub(instance.Since) < orphanGrace {
+				continue
+			}
+			groupOrphans.WithLabelValues(group).Inc()
+			if !instance.reported {
+				r.Log.Info("Autoscaling group instance has no node", "providerID", providerID, "group", group,
+					"since", instance.Since)
+				instance.reported = true
+			}
+		}
+	}
+	g.unmatched = unmatched
+
+	for _, name := range departed {
+		r.Trigger(name, "group-sync", PriorityHigh)
+	}
+	return nil
+}
+
+// takeDeparted returns true if the node's instance left its group since the node was last reconciled, and forgets
+// about it. It is safe to call on a nil groupSyncer.
+func (g *groupSyncer) takeDeparted(name string) bool {
+	if g == nil {
+		return false
+	}
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if !g.departed[name] {
+		return false
+	}
+	delete(g.departed, name)
+	return true
+}
+
+// Orphans returns the autoscaling group instances that have been without a node for longer than a grace period, as of
+// the last group sync, sorted by group and provider ID. It returns nil unless GroupSyncInterval is set.
+func (r *NodeReconciler) Orphans() []Orphan {
+	g := r.groups
+	if g == nil {
+		return nil
+	}
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	var orphans []Orphan
+	for _, instance := range g.unmatched {
+		if instance.reported {
+			orphans = append(orphans, instance.Orphan)
+		}
+	}
+	sort.Slice(orphans, func(i, j int) bool {
+		if orphans[i].Group != orphans[j].Group {
+			return orphans[i].Group < orphans[j].Group
+		}
+		return orphans[i].ProviderID < orphans[j].ProviderID
+	})
+	return orphans
+}
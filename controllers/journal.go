@@ -0,0 +1,91 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"sync"
+	"time"
+)
+
+// DefaultJournalSize is the number of decisions the journal keeps by default
+const DefaultJournalSize = 500
+
+// JournalEntry is a decision kept in the journal
+type JournalEntry struct {
+	// Time is when the decision was made
+	Time time.Time `json:"time"`
+	Decision
+}
+
+// journal keeps the last decisions in memory, so the controller's recent reasoning can be inspected during an incident
+// even if the notification sinks are down
+type journal struct {
+	mu      sync.Mutex
+	entries []JournalEntry
+	// next is the index the next entry is written to, wrapping around once entries is full
+	next int
+}
+
+// newJournal returns a journal keeping the last size decisions, or nil if size isn't positive
+func newJournal(size int) *journal {
+	if size <= 0 {
+		return nil
+	}
+	return &journal{entries: make([]JournalEntry, 0, size)}
+}
+
+// record adds a decision to the journal. Nodes left alone are skipped unless they were protected or the evaluation
+// failed, so healthy nodes checked by a sweep don't push the interesting decisions out. It is safe to call on a nil
+// journal.
+func (j *journal) record(decision *Decision, err error) {
+	if j == nil || decision == nil || (decision.Action == ActionNone && !decision.protected && err == nil) {
+		return
+	}
+	entry := JournalEntry{Time: time.Now(), Decision: *decision}
+	// the decision's checks may still be appended to
+	entry.Checks = append([]Check(nil), decision.Checks...)
+	if err != nil && entry.Error == "" {
+		entry.Error = err.Error()
+	}
+
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	if len(j.entries) < cap(j.entries) {
+		j.entries = append(j.entries, entry)
+		return
+	}
+	j.entries[j.next] = entry
+	j.next = (j.next + 1) % len(j.entries)
+}
+
+// list returns the decisions in the journal, oldest first
+func (j *journal) list() []JournalEntry {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	entries := make([]JournalEntry, 0, len(j.entries))
+	entries = append(entries, j.entries[j.next:]...)
+	return append(entries, j.entries[:j.next]...)
+}
+
+// Decisions returns the decisions in the journal, oldest first. Decisions to leave a node alone are only kept if the
+// node was protected or its evaluation failed. It returns nil unless JournalSize is set.
+func (r *NodeReconciler) Decisions() []JournalEntry {
+	if r.journal == nil {
+		return nil
+	}
+	return r.journal.list()
+}
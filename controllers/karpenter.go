@@ -0,0 +1,72 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"strings"
+
+	"github.com/go-logr/logr"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// karpenterGroup is the API group of Karpenter's NodeClaims
+const karpenterGroup = "karpenter.sh"
+
+// nodeClaimOwner returns the owner reference of the Karpenter NodeClaim that owns the node, or nil if it has none
+func nodeClaimOwner(node *corev1.Node) *metav1.OwnerReference {
+	for i, owner := range node.OwnerReferences {
+		if owner.Kind == "NodeClaim" && strings.HasPrefix(owner.APIVersion, karpenterGroup+"/") {
+			return &node.OwnerReferences[i]
+		}
+	}
+	return nil
+}
+
+// deletionClass returns the action class of deleting the node: with nodeClaims, deleting a node owned by a NodeClaim
+// terminates its instance
+func deletionClass(node *corev1.Node, nodeClaims bool) ActionClass {
+	if nodeClaims && nodeClaimOwner(node) != nil {
+		return ActionClassTerminateInstance
+	}
+	return ActionClassDeleteNode
+}
+
+// deleteNode deletes the node. With nodeClaims, a node owned by a Karpenter NodeClaim is deleted by deleting the
+// NodeClaim instead, so Karpenter's accounting and replacement logic run; Karpenter then deletes the node itself.
+// Both deletions have a UID precondition, so a node or NodeClaim that was re-created under the same name in the
+// meantime isn't deleted.
+func deleteNode(ctx context.Context, c client.Client, node *corev1.Node, nodeClaims bool, logger logr.Logger) error {
+	if owner := nodeClaimOwner(node); nodeClaims && owner != nil {
+		claim := &unstructured.Unstructured{}
+		claim.SetAPIVersion(owner.APIVersion)
+		claim.SetKind(owner.Kind)
+		claim.SetName(owner.Name)
+		err := c.Delete(ctx, claim, client.Preconditions{UID: &owner.UID})
+		if err == nil || !(apierrors.IsNotFound(err) || apierrors.IsConflict(err)) {
+			return err
+		}
+		// the node outlived its NodeClaim, so only the node is left to delete
+		logger.Info("NodeClaim is already gone, deleting the node", "nodeClaim", owner.Name)
+	}
+	return c.Delete(ctx, node, client.Preconditions{UID: &node.UID})
+}
@@ -0,0 +1,144 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+
+	"github.com/go-logr/logr"
+	"github.com/nxtlytics/cloud-lifecycle-controller/pkg/cloud"
+	"sigs.k8s.io/controller-runtime/pkg/builder"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
+
+	corev1 "k8s.io/api/core/v1"
+	ctrl "sigs.k8s.io/controller-runtime"
+)
+
+// syncedLabels are the well-known labels the NodeLabelsReconciler sets from the cloud
+var syncedLabels = []string{corev1.LabelTopologyZone, corev1.LabelTopologyRegion, corev1.LabelInstanceTypeStable}
+
+// NodeLabelsReconciler sets the topology.kubernetes.io/zone, topology.kubernetes.io/region and
+// node.kubernetes.io/instance-type labels on nodes that are missing them, e.g. in kubeadm clusters without a
+// cloud-controller-manager, from the cloud's description of their instance. Labels that are already set to other
+// values are left alone.
+type NodeLabelsReconciler struct {
+	client.Client
+	CloudInstances cloud.Instances
+	Log            logr.Logger
+	// DryRun only logs the labels that would be set
+	DryRun bool
+	// Shard restricts the controller to the nodes of one shard
+	Shard Shard
+}
+
+// Reconcile sets the missing labels on the node
+func (r *NodeLabelsReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
+	logger := r.Log.WithValues("node", req.NamespacedName)
+
+	node := &corev1.Node{}
+	if err := r.Client.Get(ctx, req.NamespacedName, node); err != nil {
+		return ctrl.Result{}, client.IgnoreNotFound(err)
+	}
+	if !missingLabels(node) || node.Spec.ProviderID == "" {
+		return ctrl.Result{}, nil
+	}
+
+	metadata, err := cloud.InstanceMetadata(ctx, r.CloudInstances, node.Spec.ProviderID)
+	if errors.Is(err, cloud.ErrMetadataNotSupported) || cloud.IsOutOfScope(err) {
+		logger.Error(err, "Unable to sync node labels")
+		return ctrl.Result{}, nil
+	}
+	if err != nil {
+		return ctrl.Result{}, fmt.Errorf("unable to look up instance: %w", err)
+	}
+	if metadata == nil {
+		logger.Info("Node's instance doesn't exist, not syncing its labels")
+		return ctrl.Result{}, nil
+	}
+
+	// the apply patch has to hold every label the controller set before, or server-side apply would remove them, so
+	// it holds all the labels that are missing or already have the cloud's value
+	values := map[string]string{
+		corev1.LabelTopologyZone:       metadata.Zone,
+		corev1.LabelTopologyRegion:     metadata.Region,
+		corev1.LabelInstanceTypeStable: metadata.InstanceType,
+	}
+	labels := map[string]interface{}{}
+	for _, key := range syncedLabels {
+		value := values[key]
+		if current, ok := node.Labels[key]; value != "" && (!ok || current == value) {
+			labels[key] = value
+		}
+	}
+	if len(labels) == 0 {
+		return ctrl.Result{}, nil
+	}
+	logger.Info("Setting node labels from the cloud", "labels", labels)
+	if r.DryRun {
+		logger.Info("Dry run: skipping node labels")
+		return ctrl.Result{}, nil
+	}
+	err = applyNode(ctx, r.Client, node.Name, map[string]interface{}{
+		"metadata": map[string]interface{}{"labels": labels},
+	})
+	if err != nil {
+		return ctrl.Result{}, fmt.Errorf("unable to set node labels: %w", err)
+	}
+	return ctrl.Result{}, nil
+}
+
+// missingLabels returns true if the node is missing any of the synced labels
+func missingLabels(node *corev1.Node) bool {
+	for _, key := range syncedLabels {
+		if _, ok := node.Labels[key]; !ok {
+			return true
+		}
+	}
+	return false
+}
+
+// SetupWithManager sets up the controller with the Manager
+func (r *NodeLabelsReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	missing := predicate.NewPredicateFuncs(func(obj client.Object) bool {
+		node, ok := obj.(*corev1.Node)
+		return ok && missingLabels(node)
+	})
+	// status heartbeats would cause a lookup for every node whose instance lacks some of the labels' values
+	changed := predicate.Funcs{
+		UpdateFunc: func(e event.UpdateEvent) bool {
+			oldNode, ok := e.ObjectOld.(*corev1.Node)
+			if !ok {
+				return true
+			}
+			newNode, ok := e.ObjectNew.(*corev1.Node)
+			if !ok {
+				return true
+			}
+			return oldNode.ResourceVersion == newNode.ResourceVersion ||
+				!reflect.DeepEqual(oldNode.Labels, newNode.Labels) || oldNode.Spec.ProviderID != newNode.Spec.ProviderID
+		},
+	}
+	return ctrl.NewControllerManagedBy(mgr).
+		Named("node-labels").
+		For(&corev1.Node{}, builder.WithPredicates(r.Shard.predicate(), virtualNodePredicate(), missing, changed)).
+		Complete(r)
+}
@@ -0,0 +1,205 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/time/rate"
+)
+
+// ActionClass is a kind of change the controller makes, with its own rate limit and concurrency cap, so e.g.
+// instance terminations can be throttled harder than node deletions. The controller doesn't reboot or drain nodes, so
+// there are no classes for that yet; each action gets its class when it is added.
+type ActionClass string
+
+const (
+	// ActionClassDeleteNode deletes a node object, leaving its instance to the cloud
+	ActionClassDeleteNode ActionClass = "delete-node"
+	// ActionClassTerminateInstance deletes a node's Karpenter NodeClaim with -delete-nodeclaims, which terminates the
+	// instance if it is still there
+	ActionClassTerminateInstance ActionClass = "terminate-instance"
+)
+
+// actionClasses are all action classes
+var actionClasses = []ActionClass{ActionClassDeleteNode, ActionClassTerminateInstance}
+
+// plannedActionClasses are the classes of actions the controller doesn't take yet, so limits for them are rejected
+// with an explanation rather than as unknown classes
+var plannedActionClasses = map[ActionClass]string{
+	"reboot": "the controller doesn't reboot nodes",
+	"drain":  "the controller doesn't drain nodes, it deletes dead ones",
+}
+
+// actionLimitRetry is how long an action waits for a slot when its class is at its concurrency cap
+const actionLimitRetry = time.Second
+
+// ActionLimit limits the actions of a class
+type ActionLimit struct {
+	// QPS is the most actions per second, 0 for no limit
+	QPS float64
+	// Burst is the number of actions allowed in a burst above QPS. Defaults to 1.
+	Burst int
+	// Concurrency is the most actions carried out at once, 0 for no limit other than the deletion workers
+	Concurrency int
+}
+
+// ActionLimits holds the limits of each action class. Classes without one are only limited by the deletion workers.
+type ActionLimits map[ActionClass]ActionLimit
+
+// ParseActionLimit parses the limit of an action class in the form
+// <class>=qps:<actions per second>,burst:<actions>,concurrency:<actions>, any of which may be left out, e.g.
+// terminate-instance=qps:0.1,concurrency:1
+func ParseActionLimit(s string) (ActionClass, ActionLimit, error) {
+	var limit ActionLimit
+	name, params := s, ""
+	if i := strings.Index(s, "="); i >= 0 {
+		name, params = s[:i], s[i+1:]
+	}
+	class := ActionClass(strings.TrimSpace(name))
+	if reason, ok := plannedActionClasses[class]; ok {
+		return "", limit, fmt.Errorf("invalid action limit %q: action class %q has no actions yet: %s", s, class, reason)
+	}
+	valid := false
+	for _, c := range actionClasses {
+		valid = valid || c == class
+	}
+	if !valid {
+		return "", limit, fmt.Errorf("invalid action limit %q: unknown action class %q, must be one of %s", s, class,
+			joinActionClasses())
+	}
+
+	for _, param := range strings.Split(params, ",") {
+		if param = strings.TrimSpace(param); param == "" {
+			continue
+		}
+		i := strings.Index(param, ":")
+		if i < 0 {
+			return "", limit, fmt.Errorf("invalid action limit %q: %q is not <key>:<value>", s, param)
+		}
+		key, value := param[:i], param[i+1:]
+		var err error
+		switch key {
+		case "qps":
+			limit.QPS, err = strconv.ParseFloat(value, 64)
+			if err == nil && limit.QPS < 0 {
+				err = fmt.Errorf("qps must not be negative")
+			}
+		case "burst":
+			limit.Burst, err = strconv.Atoi(value)
+			if err == nil && limit.Burst < 0 {
+				err = fmt.Errorf("burst must not be negative")
+			}
+		case "concurrency":
+			limit.Concurrency, err = strconv.Atoi(value)
+			if err == nil && limit.Concurrency < 0 {
+				err = fmt.Errorf("concurrency must not be negative")
+			}
+		default:
+			err = fmt.Errorf("unknown key %q, must be qps, burst or concurrency", key)
+		}
+		if err != nil {
+			return "", limit, fmt.Errorf("invalid action limit %q: %w", s, err)
+		}
+	}
+	return class, limit, nil
+}
+
+// String formats the limits as ParseActionLimit parses them, separated by spaces
+func (l ActionLimits) String() string {
+	var limits []string
+	for _, class := range actionClasses {
+		limit, ok := l[class]
+		if !ok {
+			continue
+		}
+		limits = append(limits, fmt.Sprintf("%s=qps:%g,burst:%d,concurrency:%d", class, limit.QPS, limit.Burst,
+			limit.Concurrency))
+	}
+	return strings.Join(limits, " ")
+}
+
+func joinActionClasses() string {
+	names := make([]string, len(actionClasses))
+	for i, class := range actionClasses {
+		names[i] = string(class)
+	}
+	return strings.Join(names, ", ")
+}
+
+// actionLimiter enforces ActionLimits. The zero value and nil allow everything.
+type actionLimiter struct {
+	limiters map[ActionClass]*rate.Limiter
+	caps     map[ActionClass]int
+
+	mu       sync.Mutex
+	inFlight map[ActionClass]int
+}
+
+func newActionLimiter(limits ActionLimits) *actionLimiter {
+	l := &actionLimiter{
+		limiters: map[ActionClass]*rate.Limiter{},
+		caps:     map[ActionClass]int{},
+		inFlight: map[ActionClass]int{},
+	}
+	for class, limit := range limits {
+		if limit.QPS > 0 {
+			burst := limit.Burst
+			if burst <= 0 {
+				burst = 1
+			}
+			l.limiters[class] = rate.NewLimiter(rate.Limit(limit.QPS), burst)
+		}
+		if limit.Concurrency > 0 {
+			l.caps[class] = limit.Concurrency
+		}
+	}
+	return l
+}
+
+// acquire takes a slot for an action of the class. If it can be carried out now, it returns a func to call once it
+// is done; otherwise it returns how long to wait before trying again, without using up any of the class's budget.
+// Callers requeue the action instead of waiting, so an action throttled in one class doesn't hold up the others.
+func (l *actionLimiter) acquire(class ActionClass) (func(), time.Duration) {
+	if l == nil {
+		return func() {}, 0
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if limit, ok := l.caps[class]; ok && l.inFlight[class] >= limit {
+		actionsThrottledTotal.WithLabelValues(string(class), "concurrency").Inc()
+		return nil, actionLimitRetry
+	}
+	if limiter, ok := l.limiters[class]; ok {
+		reservation := limiter.Reserve()
+		if delay := reservation.Delay(); delay > 0 {
+			reservation.Cancel()
+			actionsThrottledTotal.WithLabelValues(string(class), "rate").Inc()
+			return nil, delay
+		}
+	}
+	l.inFlight[class]++
+	return func() {
+		l.mu.Lock()
+		defer l.mu.Unlock()
+		l.inFlight[class]--
+	}, 0
+}
@@ -0,0 +1,105 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"sigs.k8s.io/controller-runtime/pkg/metrics"
+)
+
+var (
+	// decisionsTotal counts the decisions made for NotReady nodes, by action
+	decisionsTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "cloud_lifecycle_controller_decisions_total",
+		Help: "Number of decisions made for nodes that are not ready, by action",
+	}, []string{"action"})
+
+	// nodeDeletionsTotal counts node deletions, by whether they were carried out, skipped for a dry run or audited
+	nodeDeletionsTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "cloud_lifecycle_controller_node_deletions_total",
+		Help: "Number of nodes deleted (mode=live), or that would have been deleted (mode=dry-run or mode=audit)",
+	}, []string{"mode"})
+
+	// nodesWithoutReadyCondition is the number of nodes last seen without a Ready condition
+	nodesWithoutReadyCondition = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "cloud_lifecycle_controller_nodes_without_ready_condition",
+		Help: "Number of nodes without a Ready condition, e.g. because they were just registered",
+	})
+
+	// scheduledReconcilesTotal counts the reconciles asked for by sources other than the node watch, by source
+	scheduledReconcilesTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "cloud_lifecycle_controller_scheduled_reconciles_total",
+		Help: "Number of node reconciles asked for by sources other than the node watch, e.g. the sweep, by source",
+	}, []string{"source"})
+
+	// schedulerPending is the number of nodes waiting for the work queue's backlog to go down
+	schedulerPending = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "cloud_lifecycle_controller_scheduler_pending",
+		Help: "Number of scheduled node reconciles waiting for the work queue's backlog to go down",
+	})
+
+	// lastSweepNodes is how the reconciles of the nodes of the last finished sweep ended, by result
+	lastSweepNodes = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "cloud_lifecycle_controller_last_sweep_nodes",
+		Help: "Number of nodes of the last finished sweep by result: evaluated, healthy, pending, deleted, skipped, " +
+			"error or unfinished",
+	}, []string{"result"})
+
+	// lastSweepCompleted is when the last sweep that reconciled all its nodes completed
+	lastSweepCompleted = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "cloud_lifecycle_controller_last_sweep_completed_timestamp_seconds",
+		Help: "Unix time the last sweep that reconciled all its nodes completed",
+	})
+
+	// lastSweepDuration is how long the last finished sweep took
+	lastSweepDuration = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "cloud_lifecycle_controller_last_sweep_duration_seconds",
+		Help: "Seconds from the start of the last finished sweep until its last node was reconciled",
+	})
+
+	// groupDeparturesTotal counts the nodes whose instance left its autoscaling group, by group
+	groupDeparturesTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "cloud_lifecycle_controller_group_departures_total",
+		Help: "Number of nodes whose instance left its autoscaling group, by group",
+	}, []string{"group"})
+
+	// notificationsDroppedTotal counts the notifications dropped because the notification queue was full, by event
+	// type
+	notificationsDroppedTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "cloud_lifecycle_controller_notifications_dropped_total",
+		Help: "Number of notifications dropped because the notification queue was full, e.g. NodeEvaluated events " +
+			"missing from -history-dsn, by event type",
+	}, []string{"type"})
+
+	// groupOrphans is the number of autoscaling group instances without a node as of the last group sync, by group
+	groupOrphans = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "cloud_lifecycle_controller_group_orphans",
+		Help: "Number of autoscaling group instances that have been without a node for over 10 minutes, by group",
+	}, []string{"group"})
+
+	// actionsThrottledTotal counts the actions put off by their class's limits, by class and limit
+	actionsThrottledTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "cloud_lifecycle_controller_actions_throttled_total",
+		Help: "Number of times an action was put off by its class's limit (limit=rate or limit=concurrency), by class",
+	}, []string{"class", "limit"})
+)
+
+func init() {
+	metrics.Registry.MustRegister(decisionsTotal, nodeDeletionsTotal, nodesWithoutReadyCondition, scheduledReconcilesTotal,
+		schedulerPending, lastSweepNodes, lastSweepCompleted, lastSweepDuration, groupDeparturesTotal, groupOrphans,
+		actionsThrottledTotal, notificationsDroppedTotal)
+}
@@ -20,21 +20,37 @@ import (
 	"context"
 	"errors"
 	"fmt"
-	"strings"
+	"math/rand"
+	"sync"
+	"time"
 
 	"github.com/go-logr/logr"
+	"github.com/nxtlytics/cloud-lifecycle-controller/pkg/cloud"
+	"github.com/nxtlytics/cloud-lifecycle-controller/pkg/notify"
 	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/wait"
 	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/builder"
 	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/ratelimiter"
 
+	coordinationv1 "k8s.io/api/coordination/v1"
 	corev1 "k8s.io/api/core/v1"
 	apierrors "k8s.io/apimachinery/pkg/api/errors"
-	cloudprovider "k8s.io/cloud-provider"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	ctrl "sigs.k8s.io/controller-runtime"
 )
 
+// DefaultSettleInterval is how long to wait by default before re-checking a node whose cloud status hasn't settled
+const DefaultSettleInterval = time.Minute
+
 const (
-	deleteNodeEvent = "DeletingNode"
+	deleteNodeEvent         = "DeletingNode"
+	wouldDeleteNodeEvent    = "WouldDeleteNode"
+	giveUpEvent             = "GaveUpOnNode"
+	deletePastDeadlineEvent = "DeletingNodePastDeadline"
 )
 
 type providerNodeStatus int
@@ -45,6 +61,8 @@ func (s providerNodeStatus) String() string {
 		return "Shutdown"
 	case providerNodeStatusNotFound:
 		return "Not Found"
+	case providerNodeStatusEvicted:
+		return "Evicted"
 	default:
 		return "Unknown"
 	}
@@ -54,33 +72,160 @@ const (
 	providerNodeStatusUnknown providerNodeStatus = iota
 	providerNodeStatusShutdown
 	providerNodeStatusNotFound
+	// providerNodeStatusEvicted is a shut down spot instance whose capacity was reclaimed
+	providerNodeStatusEvicted
 )
 
 var (
-	errProviderIDEmpty = errors.New("ProviderID is empty")
+	errProviderIDEmpty  = errors.New("ProviderID is empty")
+	errNoReadyCondition = errors.New("unable to find NodeReady condition. something is wrong, bruh")
 )
 
 // NodeReconciler reconciles a Node object
 type NodeReconciler struct {
 	client.Client
 	Recorder       record.EventRecorder
-	CloudInstances cloudprovider.Instances
+	CloudInstances cloud.Instances
 	Log            logr.Logger
 	Scheme         *runtime.Scheme
-	DryRun         bool
+	// DryRun skips changes to Kubernetes objects, e.g. node deletions
+	DryRun bool
+	// DryRunCloud skips changes to cloud resources: deleting the NodeClaims of nodes with DeleteNodeClaims, which
+	// terminates their instances. Nodes that would be deleted by deleting their NodeClaim are left alone like in a dry
+	// run, while other nodes are still deleted.
+	DryRunCloud bool
+	// SettleInterval is how long to wait before re-checking a node whose cloud status isn't conclusive yet,
+	// e.g. because its instance is still shutting down. Each wait is extended by up to SettleJitter times the
+	// interval, so nodes that failed together aren't all re-checked at once. Defaults to DefaultSettleInterval.
+	SettleInterval time.Duration
+	SettleJitter   float64
+	// UnknownDeadline deletes a node that has been not ready for this long even though its cloud status is still
+	// unknown, e.g. because lookups keep failing with broken credentials, with a Warning event. Zero never does.
+	// It should be shorter than GiveUpAfter, since nodes given up on are only re-checked on resyncs.
+	UnknownDeadline time.Duration
+	// GiveUpAfter stops re-checking a node whose cloud status still hasn't settled this long after its Ready
+	// condition last changed. A Warning event is recorded, and the node is only checked again once its Ready
+	// condition changes. Zero never gives up.
+	GiveUpAfter time.Duration
+	// SettleProfile is how long the cloud provider's API may take to converge after an instance goes away. Shut down
+	// and missing instances are only acted on once it has.
+	SettleProfile SettleProfile
+	// SpotEvictionAction is what to do with nodes whose spot instance was evicted, for cloud providers that can tell
+	// evictions from other shutdowns: ActionDelete (the default) deletes them like nodes whose instance is gone,
+	// ActionGiveUp and ActionNone leave them alone, e.g. for pools whose evicted VMs are restarted when capacity returns
+	SpotEvictionAction Action
+	// MinNotReady leaves nodes that have been not ready for less than this alone, without asking the cloud provider,
+	// e.g. to ride out kubelet restarts. Zero checks nodes as soon as they're not ready.
+	MinNotReady time.Duration
+	// Pools overrides the thresholds and allowed actions for the nodes of some pools
+	Pools Pools
+	// StartupSpread spreads the first reconcile of each node over this window after the controller starts (or becomes
+	// the leader), so the initial list of nodes doesn't cause a burst of cloud API calls. Zero reconciles at once.
+	StartupSpread time.Duration
+	// LeaseMaxAge, if set, keeps a node from being deleted while its Lease in kube-node-lease was renewed within
+	// this long, since that means the kubelet is still alive. The lease is read with APIReader, or Client if unset;
+	// it should not be cached, since leases change every few seconds.
+	LeaseMaxAge time.Duration
+	APIReader   client.Reader
+	// Probe, if its port is set, keeps a node from being deleted while one of its addresses accepts connections
+	Probe Probe
+	// Verify, if its command is set, keeps a node from being deleted unless the command confirms it is dead
+	Verify VerifyHook
+	// Workers is the number of nodes checked concurrently. Defaults to 1.
+	Workers int
+	// DeletionWorkers is the number of nodes deleted concurrently. Deletions have their own workers and queue, so they
+	// aren't held up by the nodes waiting for cloud lookups. Defaults to DefaultDeletionWorkers.
+	DeletionWorkers int
+	// ActionLimits limits the deletions of each action class on top of DeletionWorkers, e.g. to throttle instance
+	// terminations harder than node deletions. Classes without a limit are only limited by DeletionWorkers.
+	ActionLimits ActionLimits
+	// CleanUpTerminating evaluates nodes that are already being deleted like any other, and instead of deleting the
+	// dead ones again, force deletes their pods stuck terminating and then deletes their VolumeAttachments, so their
+	// workloads and volumes can move elsewhere while the node waits on finalizers. Pods and VolumeAttachments are
+	// listed with APIReader, or Client if unset, and deleted with Deleter.
+	CleanUpTerminating bool
+	// DeleteNodeClaims deletes the Karpenter NodeClaim owning a node instead of the node, so Karpenter's accounting and
+	// replacement logic run
+	DeleteNodeClaims bool
+	// Deleter, if set, is the client nodes and NodeClaims are deleted with, e.g. one impersonating a service account
+	// that may only delete them, so RBAC separates observing nodes from deleting them. Defaults to Client.
+	Deleter client.Client
+	// Notifier, if set, is told about every node deletion, including dry-run and audited ones
+	Notifier notify.Notifier
+	// NotifyStatefulPods adds the node's pods with persistent volume claims to the notifications, e.g. so issues are
+	// only opened for nodes that ran stateful workloads
+	NotifyStatefulPods bool
+	// SweepInterval, if set, schedules a low priority reconcile of every node this often, to catch missed events.
+	// Unlike the manager's SyncPeriod resync, the sweep waits while the work queue is backed up.
+	SweepInterval time.Duration
+	// GroupSyncInterval, if set, lists the members of the cloud's autoscaling groups this often, reconciling nodes
+	// whose instance left its group right away and reporting group instances without a node as orphans. The cloud
+	// provider must implement cloud.GroupLister.
+	GroupSyncInterval time.Duration
+	// MaxBacklog is the number of nodes the work queue may hold before reconciles from the sweep and other sources
+	// than the node watch wait, by priority. Defaults to DefaultMaxBacklog.
+	MaxBacklog int
+	// Shard restricts the controller to the nodes of one shard, when nodes are sharded across several active replicas
+	Shard Shard
+	// RateLimiter limits how often nodes are retried after errors. Defaults to controller-runtime's default.
+	RateLimiter ratelimiter.RateLimiter
+	// Chaos is the fraction of evaluations in which a node is reported as not ready with its instance shut down or
+	// not found, whatever their real status, so staging clusters can validate alerting, dashboards and rate limits
+	// end to end. It must only be used with DryRun or Audit.
+	Chaos float64
+	// Audit only observes: every decision is logged and nodes that would be deleted get a WouldDeleteNode event,
+	// but nothing is changed. Unlike a dry run, audited deletions are not reported as DeletingNode events.
+	Audit bool
+	// InstanceCondition maintains the InstanceCondition of the nodes checked against the cloud provider, so other
+	// controllers and dashboards can see the cloud's view of the node even when it isn't deleted
+	InstanceCondition bool
+	// PersistState stores what the controller remembers about nodes in their StateAnnotation, so restarts and leader
+	// changes don't reset it. It isn't stored in dry runs and audit mode.
+	PersistState bool
+	// JournalSize is the number of recent decisions kept in memory for Decisions. Zero keeps none.
+	JournalSize int
+
+	// gaveUp holds the Ready condition transition time of the nodes given up on, keyed by UID, so the Warning event is
+	// only recorded once per transition
+	gaveUp sync.Map
+
+	deletions *deletionQueue
+	scheduler *scheduler
+	// sweeps follows the nodes of the sweep in progress, if SweepInterval is set
+	sweeps *sweepTracker
+	// groups syncs with the cloud's autoscaling groups, if GroupSyncInterval is set
+	groups *groupSyncer
+	// journal keeps the last JournalSize decisions
+	journal *journal
+
+	startOnce sync.Once
+	started   time.Time
+	// spread holds the nodes already delayed by StartupSpread
+	spread sync.Map
+	// protectedNodes holds the Ready condition transition time of the protected nodes whose deletion was blocked, keyed
+	// by UID, so the event is only recorded once per transition
+	protectedNodes sync.Map
+	// rechecks holds the last RecheckAnnotation value acted on, keyed by UID
+	rechecks sync.Map
+	// pending holds the names of the nodes without a Ready condition
+	pending sync.Map
 }
 
 // Recursively check the list of nodes for any nodes that need to be removed from the cluster
-func (r *NodeReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
+func (r *NodeReconciler) Reconcile(ctx context.Context, req ctrl.Request) (result ctrl.Result, err error) {
 	logger := r.Log.WithValues("node", req.NamespacedName).V(1)
 
+	var decision *Decision
+	defer func() { r.sweepFinished(r.sweeps.reconciled(req.Name, result, err, decision)) }()
+
 	node := &corev1.Node{}
-	err := r.Client.Get(ctx, req.NamespacedName, node)
+	err = r.Client.Get(ctx, req.NamespacedName, node)
 	if err != nil {
 		if apierrors.IsNotFound(err) {
 			// Request object not found, could have been deleted after reconcile request.
 			// Return and don't requeue
 			logger.Info("Node deleted while performing reconciliation step")
+			r.trackPending(req.Name, false)
 			return ctrl.Result{}, nil
 		}
 		// Error reading the object - requeue the request.
@@ -88,97 +233,561 @@ func (r *NodeReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.
 		return ctrl.Result{}, err
 	}
 
-	status, err := getNodeReadyCondition(node.Status.Conditions)
+	if r.recheckRequested(node) {
+		logger.Info("Re-check requested", "annotation", node.Annotations[RecheckAnnotation])
+		ctx = cloud.WithoutCache(ctx)
+		r.saveState(ctx, node, func(state *nodeState) { state.Recheck = node.Annotations[RecheckAnnotation] })
+	} else if delay := backoffRemaining(node); r.PersistState && delay > 0 {
+		logger.Info("Cloud API asked to back off before looking the node up again", "after", delay)
+		return ctrl.Result{RequeueAfter: delay}, nil
+	} else if delay := r.startupDelay(req.Name); delay > 0 {
+		logger.Info("Delaying first reconciliation after startup", "after", delay)
+		return ctrl.Result{RequeueAfter: delay}, nil
+	}
+	if r.groups.takeDeparted(req.Name) {
+		// the group membership is more recent than any cached lookup
+		ctx = cloud.WithoutCache(ctx)
+	}
+
+	decision, err = r.evaluate(ctx, node, logger)
+	r.journal.record(decision, err)
 	if err != nil {
 		logger.Error(err, "Unable to get node ready condition.")
 		return ctrl.Result{}, err
 	}
+	r.updateInstanceCondition(ctx, node, decision)
+
+	if decision.protected {
+		logger.Info("Not deleting protected node", "reason", decision.Reason)
+		r.protected(node, decision)
+	}
+	if decision.Action == ActionNone {
+		return ctrl.Result{}, nil
+	}
+	decisionsTotal.WithLabelValues(string(decision.Action)).Inc()
+	r.nodeEvaluated(node, decision)
+	if decision.Action == ActionGiveUp {
+		r.giveUp(ctx, node, decision, logger)
+		return ctrl.Result{}, nil
+	}
+	if r.Audit {
+		return r.auditNode(node, decision)
+	}
+	return r.reconcileNode(ctx, node, decision, logger)
+}
+
+// Evaluate decides what the controller would do with a node, without acting on it
+func (r *NodeReconciler) Evaluate(ctx context.Context, node *corev1.Node) (*Decision, error) {
+	return r.evaluate(ctx, node, r.Log.WithValues("node", node.Name).V(1))
+}
+
+func (r *NodeReconciler) evaluate(ctx context.Context, node *corev1.Node, logger logr.Logger) (*Decision, error) {
+	t := r.thresholds(node)
+	decision, err := r.decide(ctx, node, t, logger)
+	if err == nil {
+		t.restrict(decision)
+		protect(node, decision)
+	}
+	return decision, err
+}
+
+// decide evaluates the node with the thresholds of its pool
+func (r *NodeReconciler) decide(ctx context.Context, node *corev1.Node, t thresholds, logger logr.Logger) (*Decision, error) {
+	decision := &Decision{
+		Node:           node.Name,
+		ProviderID:     r.providerID(node),
+		Action:         ActionNone,
+		settleInterval: t.settleInterval,
+	}
+	if t.pool != "" {
+		decision.check("pool", "overrides of pool %s apply", t.pool)
+	}
+
+	if isVirtualNode(node) {
+		decision.check("virtual", "node is not backed by a VM")
+		decision.Reason = "Node is not backed by a VM (virtual-kubelet or Fargate)"
+		return decision, nil
+	}
+	if node.DeletionTimestamp != nil {
+		// deleting it again would only duplicate events and conflict with whoever is waiting on its finalizers
+		decision.check("terminating", "deletion requested at %s", node.DeletionTimestamp.UTC().Format(time.RFC3339))
+		if !r.CleanUpTerminating {
+			decision.Reason = "Node is already being deleted"
+			return decision, nil
+		}
+	}
+
+	status, err := getNodeReadyCondition(node.Status.Conditions)
+	r.trackPending(node.Name, errors.Is(err, errNoReadyCondition))
+	if errors.Is(err, errNoReadyCondition) {
+		// newly registered nodes may not have it yet; the node is reconciled again once it does
+		age := time.Since(node.CreationTimestamp.Time)
+		decision.check("ready", "no Ready condition %s after the node was created", age.Round(time.Second))
+		if t.giveUpAfter > 0 {
+			decision.check("give-up-after", "%s, %s", t.giveUpAfter, exceeded(age > t.giveUpAfter))
+		}
+		if t.giveUpAfter > 0 && age > t.giveUpAfter {
+			decision.Action = ActionGiveUp
+			decision.Reason = fmt.Sprintf("Node still has no Ready condition %s after it was created, "+
+				"giving up until it has one", age.Round(time.Second))
+			return decision, nil
+		}
+		decision.Action = ActionRequeue
+		decision.Reason = "Node has no Ready condition yet, waiting for the kubelet to report it"
+		return decision, nil
+	}
+	if err != nil {
+		return decision, err
+	}
+	decision.Ready = status.Status
+	notReadyFor := time.Since(status.LastTransitionTime.Time)
+	decision.check("ready", "%s for %s", status.Status, notReadyFor.Round(time.Second))
+	chaosStatus, chaos := r.chaos()
+	if chaos {
+		logger.Info("Chaos: faking a not ready node", "cloudStatus", chaosStatus.String())
+		decision.check("chaos", "faking Ready %s and cloud status %s", corev1.ConditionUnknown, chaosStatus.String())
+		decision.Chaos = true
+		decision.Ready = corev1.ConditionUnknown
+		defer func() {
+			decision.Reason = "Chaos: " + decision.Reason
+		}()
+	}
 
 	logger.Info("Node status", "status", status)
 
 	// Operate on nodes that are not ready (ready=false) or conspicuously missing (ready=unknown)
 	// TODO: does NodeTermination feature gate change the status to 'Shutdown'? If so, where's the value for that in corev1?
-	switch status.Status {
+	switch decision.Ready {
 	case corev1.ConditionFalse, corev1.ConditionUnknown:
 		logger.Info("Node appears down according to APIServer, investigating", "status", status.Status)
-		return r.reconcileNode(ctx, node, logger)
 	default:
 		logger.Info("Node is up according to APIServer, ignoring.")
+		decision.Reason = "Node is up according to APIServer"
+		return decision, nil
 	}
 
-	return ctrl.Result{}, nil
+	if t.minNotReady > 0 {
+		decision.check("min-not-ready", "%s, %s", t.minNotReady, exceeded(notReadyFor > t.minNotReady))
+	}
+	if notReadyFor < t.minNotReady {
+		decision.Action = ActionRequeue
+		decision.Reason = fmt.Sprintf("Node has only been not ready for %s, waiting for %s before checking it",
+			notReadyFor.Round(time.Second), t.minNotReady)
+		return decision, nil
+	}
+
+	nodeStatus, err := r.nodeStatus(ctx, node, decision)
+	if cloud.IsOutOfScope(err) {
+		// a hard boundary, not even -unknown-status-deadline applies
+		decision.check("scope", "%s", err.Error())
+		decision.Action = ActionGiveUp
+		decision.Reason = "Node's instance isn't the cluster's, refusing to act on it until its Ready condition changes"
+		decision.Error = err.Error()
+		return decision, nil
+	}
+	if chaos {
+		// the cloud is still asked, so chaos exercises the cloud API rate limits too
+		nodeStatus, err = chaosStatus, nil
+	}
+	if err != nil {
+		logger.Error(err, "Unable to get node status")
+		decision.Error = err.Error()
+	}
+	retryAfter, throttled := cloud.RetryAfter(err)
+	decision.CloudStatus = nodeStatus.String()
+	decision.check("cloud", "status %s (instance exists: %s, shutdown: %s)", nodeStatus.String(),
+		formatAnswer(decision.InstanceExists), formatAnswer(decision.InstanceShutdown))
+
+	pastDeadline := nodeStatus == providerNodeStatusUnknown && t.unknownDeadline > 0 && notReadyFor > t.unknownDeadline
+	if nodeStatus == providerNodeStatusUnknown && t.unknownDeadline > 0 {
+		decision.check("unknown-status-deadline", "%s, %s", t.unknownDeadline, exceeded(pastDeadline))
+	}
+	if nodeStatus == providerNodeStatusUnknown && !pastDeadline {
+		if t.giveUpAfter > 0 {
+			decision.check("give-up-after", "%s, %s", t.giveUpAfter, exceeded(notReadyFor > t.giveUpAfter))
+		}
+		if t.giveUpAfter > 0 && notReadyFor > t.giveUpAfter {
+			decision.Action = ActionGiveUp
+			decision.Reason = fmt.Sprintf("Cloud status has not settled %s after the node became not ready, "+
+				"giving up until its Ready condition changes", notReadyFor.Round(time.Second))
+			return decision, nil
+		}
+		decision.Action = ActionRequeue
+		decision.Reason = "Cloud status is not conclusive, waiting for it to settle (node may be shutting down)"
+		if throttled {
+			decision.Reason = "Cloud API is throttling lookups, checking again later"
+			decision.retryAfter = retryAfter
+		}
+		return decision, nil
+	}
+
+	if nodeStatus == providerNodeStatusEvicted && t.evicted(decision) {
+		return decision, nil
+	}
+	if wait := t.settling(node, nodeStatus, notReadyFor, decision); wait > 0 {
+		decision.Action = ActionRequeue
+		decision.Reason = fmt.Sprintf("Cloud status is %s, but the cloud API may not have settled yet, checking again "+
+			"in %s", nodeStatus.String(), wait.Round(time.Second))
+		decision.settleInterval = wait
+		return decision, nil
+	}
+
+	renewed, err := r.leaseRenewedWithin(ctx, node, t.leaseMaxAge)
+	if err != nil {
+		logger.Error(err, "Unable to get node lease")
+		decision.check("lease", "unable to get the node's lease")
+		decision.Action = ActionRequeue
+		decision.Reason = "Unable to check the node's lease before deleting it"
+		decision.Error = err.Error()
+		return decision, nil
+	}
+	if t.leaseMaxAge > 0 {
+		decision.check("lease", "renewed within %s: %t", t.leaseMaxAge, renewed)
+	}
+	if renewed {
+		decision.Action = ActionRequeue
+		decision.Reason = fmt.Sprintf("Node status is %s, but its lease was renewed in the last %s",
+			nodeStatus.String(), t.leaseMaxAge)
+		return decision, nil
+	}
+
+	hostPort := r.Probe.reachable(ctx, node)
+	if r.Probe.Port > 0 {
+		decision.check("probe", "port %d reachable: %t", r.Probe.Port, hostPort != "")
+	}
+	if hostPort != "" {
+		decision.Action = ActionRequeue
+		decision.Reason = fmt.Sprintf("Node status is %s, but it accepted a connection on %s",
+			nodeStatus.String(), hostPort)
+		return decision, nil
+	}
+
+	err = r.Verify.verify(ctx, node)
+	if len(r.Verify.Command) > 0 {
+		decision.check("verify", "confirmed dead: %t", err == nil)
+	}
+	if err != nil {
+		decision.Action = ActionRequeue
+		decision.Reason = fmt.Sprintf("Node status is %s, but the verification command didn't confirm it is dead",
+			nodeStatus.String())
+		decision.Error = err.Error()
+		return decision, nil
+	}
+
+	decision.Action = ActionDelete
+	decision.Reason = fmt.Sprintf("Node status is %s", nodeStatus.String())
+	if pastDeadline {
+		decision.pastDeadline = true
+		decision.Reason = fmt.Sprintf("Node has been not ready for %s while its cloud status stayed %s, past the %s "+
+			"deadline", notReadyFor.Round(time.Second), nodeStatus.String(), t.unknownDeadline)
+	}
+	if node.DeletionTimestamp != nil {
+		decision.Action = ActionCleanUp
+		decision.pastDeadline = false
+		decision.Reason += ", but the node is already being deleted, cleaning up its stuck pods and volume attachments"
+	}
+	return decision, nil
+}
+
+// nodeLeaseNamespace is the namespace of the kubelets' node leases
+const nodeLeaseNamespace = "kube-node-lease"
+
+// leaseRenewedWithin returns true if maxAge is set and the node's lease was renewed within it, which means the
+// kubelet is still alive despite what the Ready condition and the cloud provider say
+func (r *NodeReconciler) leaseRenewedWithin(ctx context.Context, node *corev1.Node, maxAge time.Duration) (bool, error) {
+	if maxAge <= 0 {
+		return false, nil
+	}
+	reader := r.APIReader
+	if reader == nil {
+		reader = r.Client
+	}
+
+	lease := &coordinationv1.Lease{}
+	if err := reader.Get(ctx, client.ObjectKey{Namespace: nodeLeaseNamespace, Name: node.Name}, lease); err != nil {
+		if apierrors.IsNotFound(err) {
+			return false, nil
+		}
+		return false, err
+	}
+	if lease.Spec.RenewTime == nil {
+		return false, nil
+	}
+	return time.Since(lease.Spec.RenewTime.Time) < maxAge, nil
+}
+
+// exceeded describes whether a threshold was exceeded, for the evaluation's checks
+func exceeded(b bool) string {
+	if b {
+		return "exceeded"
+	}
+	return "not exceeded"
+}
+
+// formatAnswer formats a cloud provider answer, which is nil if the provider wasn't asked
+func formatAnswer(answer *bool) string {
+	if answer == nil {
+		return "-"
+	}
+	return fmt.Sprint(*answer)
 }
 
 // SetupWithManager sets up the controller with the Manager.
 func (r *NodeReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	r.deletions = newDeletionQueue(r.Client, r.Log, r.DeletionWorkers, r.DeleteNodeClaims)
+	r.deletions.deleted = r.nodeDeleted
+	r.deletions.deleter = r.deleter()
+	r.deletions.limits = newActionLimiter(r.ActionLimits)
+	if err := mgr.Add(r.deletions); err != nil {
+		return err
+	}
+	r.scheduler = newScheduler(r.MaxBacklog)
+	r.journal = newJournal(r.JournalSize)
+	if r.SweepInterval > 0 {
+		r.sweeps = &sweepTracker{}
+		if err := mgr.Add(&sweeper{reconciler: r, interval: r.SweepInterval}); err != nil {
+			return err
+		}
+	}
+	if r.GroupSyncInterval > 0 {
+		r.groups = &groupSyncer{reconciler: r, interval: r.GroupSyncInterval}
+		if err := mgr.Add(r.groups); err != nil {
+			return err
+		}
+	}
 	return ctrl.NewControllerManagedBy(mgr).
-		For(&corev1.Node{}).
+		For(&corev1.Node{}, builder.WithPredicates(r.Shard.predicate(), virtualNodePredicate(),
+			nodeChangedPredicate(r.forget))).
+		Watches(r.scheduler, &handler.EnqueueRequestForObject{}).
+		WithOptions(controller.Options{RateLimiter: r.RateLimiter, MaxConcurrentReconciles: r.Workers}).
 		Complete(r)
 }
 
-func (r *NodeReconciler) nodeStatus(ctx context.Context, node *corev1.Node) (providerNodeStatus, error) {
-	providerID := node.Spec.ProviderID
+// providerID returns the node's provider ID, or for nodes without one the provider ID of the instance named after the
+// node, if the cloud provider names instances after nodes
+func (r *NodeReconciler) providerID(node *corev1.Node) string {
+	if node.Spec.ProviderID != "" {
+		return node.Spec.ProviderID
+	}
+	return cloud.NodeProviderID(r.CloudInstances, node.Name)
+}
+
+// nodeStatus asks the cloud provider about the node's instance, recording the answers in decision
+func (r *NodeReconciler) nodeStatus(ctx context.Context, node *corev1.Node, decision *Decision) (providerNodeStatus, error) {
+	providerID := decision.ProviderID
 	if providerID == "" {
 		return providerNodeStatusUnknown, errProviderIDEmpty
 	}
 
 	nodeExists, err := r.CloudInstances.InstanceExistsByProviderID(ctx, providerID)
-	if err != nil && !isAWSNotFoundErr(err) { // This is a hack to work around aws bug
+	if err != nil && !cloud.IsInstanceNotFound(err) {
 		return providerNodeStatusUnknown, err
 	}
+	decision.InstanceExists = &nodeExists
 	if !nodeExists {
 		return providerNodeStatusNotFound, nil
 	}
 
 	nodeShutdown, err := r.CloudInstances.InstanceShutdownByProviderID(ctx, providerID)
-	if err != nil && !isAWSNotFoundErr(err) { // This is a hack to work around aws bug
+	if cloud.IsInstanceNotFound(err) {
+		// the instance went away between the two calls; decision.InstanceExists points at nodeExists
+		nodeExists = false
+		return providerNodeStatusNotFound, nil
+	}
+	if err != nil {
 		return providerNodeStatusUnknown, err
 	}
-	if nodeShutdown {
-		return providerNodeStatusShutdown, nil
+	decision.InstanceShutdown = &nodeShutdown
+	if !nodeShutdown {
+		return providerNodeStatusUnknown, nil
 	}
-	return providerNodeStatusUnknown, nil
-}
 
-func (r *NodeReconciler) reconcileNode(ctx context.Context, node *corev1.Node, logger logr.Logger) (ctrl.Result, error) {
-	nodeStatus, err := r.nodeStatus(ctx, node)
+	evicted, err := cloud.InstanceEvicted(ctx, r.CloudInstances, providerID)
 	if err != nil {
-		logger.Error(err, "Unable to get node status")
+		return providerNodeStatusUnknown, err
+	}
+	if evicted {
+		decision.InstanceEvicted = &evicted
+		return providerNodeStatusEvicted, nil
 	}
+	return providerNodeStatusShutdown, nil
+}
 
-	if nodeStatus == providerNodeStatusUnknown {
+func (r *NodeReconciler) reconcileNode(ctx context.Context, node *corev1.Node, decision *Decision, logger logr.Logger) (ctrl.Result, error) {
+	if decision.Action == ActionCleanUp {
+		return r.cleanUp(ctx, node, decision, logger)
+	}
+	if decision.Action == ActionRequeue {
 		// If kubelet on a node is turned off as part of a shutdown, the health check may mark the node as
 		// unreachable/unhealthy before the node is actually shut down in the cloud provider.
 		// If this happens, we need to schedule another check on this node in a few minutes to see if the cloud provider
 		// says the instance is missing
-		logger.Info("Requeuing reconciliation for node to let cloud status settle (node may be shutting down)")
-		return ctrl.Result{Requeue: true}, nil
+		requeueAfter := r.requeueDelay(decision)
+		logger.Info("Requeuing reconciliation for node to let cloud status settle (node may be shutting down)",
+			"after", requeueAfter)
+		if decision.retryAfter > 0 {
+			notBefore := metav1.NewTime(time.Now().Add(requeueAfter))
+			r.saveState(ctx, node, func(state *nodeState) { state.NotBefore = &notBefore })
+		}
+		return ctrl.Result{RequeueAfter: requeueAfter}, nil
 	}
 
 	logger.Info(
 		"Node condition matches unhealthy criteria",
-		"nodeStatus", nodeStatus.String(),
+		"nodeStatus", decision.CloudStatus,
 	)
 
 	ref := newNodeRef(node)
-	msg := fmt.Sprintf("Deleting node %s because node status is %s", node.Name, nodeStatus.String())
+	msg := fmt.Sprintf("Deleting node %s because node status is %s", node.Name, decision.CloudStatus)
+	if decision.Chaos {
+		msg = "Chaos: " + msg
+	}
 	logger.Info(msg)
-	r.Recorder.Event(ref, corev1.EventTypeNormal, deleteNodeEvent, msg)
+	if decision.pastDeadline {
+		r.Recorder.Event(ref, corev1.EventTypeWarning, deletePastDeadlineEvent,
+			fmt.Sprintf("Deleting node %s: %s", node.Name, decision.Reason))
+	} else {
+		r.Recorder.Event(ref, corev1.EventTypeNormal, deleteNodeEvent, msg)
+	}
 
 	// Nuke 'em, captain.
-	if !r.DryRun {
-		err := r.Client.Delete(ctx, node)
+	dryRun := r.dryRun(node)
+	if !dryRun && r.deletions != nil {
+		r.deletions.add(node, decision)
+		return ctrl.Result{}, nil
+	}
+	if !dryRun {
+		err := deleteNode(ctx, r.deleter(), node, r.DeleteNodeClaims, logger)
 		if err != nil {
 			logger.Error(err, "Unable to delete node")
+			return ctrl.Result{}, err
 		}
-		return ctrl.Result{}, err
+		nodeDeletionsTotal.WithLabelValues("live").Inc()
+		r.nodeDeleted(node, decision, false)
+		return ctrl.Result{}, nil
 	}
 	logger.Info("Dry run: skipping node deletion")
+	nodeDeletionsTotal.WithLabelValues("dry-run").Inc()
+	r.nodeDeleted(node, decision, true)
+	return ctrl.Result{}, nil
+}
+
+// dryRun returns true if deleting the node is skipped: DryRun skips every deletion, DryRunCloud the ones that
+// terminate the node's instance
+func (r *NodeReconciler) dryRun(node *corev1.Node) bool {
+	return r.DryRun || r.DryRunCloud && deletionClass(node, r.DeleteNodeClaims) == ActionClassTerminateInstance
+}
+
+// deleter returns the client to delete nodes with
+func (r *NodeReconciler) deleter() client.Client {
+	if r.Deleter != nil {
+		return r.Deleter
+	}
+	return r.Client
+}
+
+// giveUp records a Warning event for a node whose cloud status hasn't settled, once per Ready condition transition
+func (r *NodeReconciler) giveUp(ctx context.Context, node *corev1.Node, decision *Decision, logger logr.Logger) {
+	status, _ := getNodeReadyCondition(node.Status.Conditions)
+	transition := status.LastTransitionTime.String()
+	if previous, ok := r.gaveUp.Load(node.UID); ok && previous == transition {
+		return
+	}
+	r.gaveUp.Store(node.UID, transition)
+	if r.PersistState && loadState(node).GaveUp == transition {
+		// already recorded before a restart or by the previous leader
+		return
+	}
+
+	logger.Info("Giving up on node", "reason", decision.Reason)
+	r.Recorder.Event(newNodeRef(node), corev1.EventTypeWarning, giveUpEvent, decision.Reason)
+	r.saveState(ctx, node, func(state *nodeState) { state.GaveUp = transition })
+}
+
+// forget drops what the controller remembers about a node once it is deleted, so the state of nodes that come and go
+// doesn't pile up
+func (r *NodeReconciler) forget(node *corev1.Node) {
+	r.gaveUp.Delete(node.UID)
+	r.protectedNodes.Delete(node.UID)
+	r.rechecks.Delete(node.UID)
+	r.spread.Delete(node.Name)
+	r.trackPending(node.Name, false)
+}
+
+// startupDelay returns how long to delay the first reconcile of a node after the controller started, a random point
+// in the StartupSpread window, or zero once the node has been delayed or the window has passed
+func (r *NodeReconciler) startupDelay(name string) time.Duration {
+	if r.StartupSpread <= 0 {
+		return 0
+	}
+	r.startOnce.Do(func() { r.started = time.Now() })
+	elapsed := time.Since(r.started)
+	if elapsed >= r.StartupSpread {
+		return 0
+	}
+	if _, delayed := r.spread.LoadOrStore(name, true); delayed {
+		return 0
+	}
+	return time.Duration(rand.Int63n(int64(r.StartupSpread))) - elapsed
+}
+
+// settleDelay returns how long to wait before re-checking a node whose cloud status hasn't settled, with jitter
+func (r *NodeReconciler) settleDelay(interval time.Duration) time.Duration {
+	if interval <= 0 {
+		interval = DefaultSettleInterval
+	}
+	return wait.Jitter(interval, r.SettleJitter)
+}
+
+// requeueDelay returns how long to wait before re-checking a node: the settle delay, or longer if the cloud API
+// throttled the lookup and asked to wait longer
+func (r *NodeReconciler) requeueDelay(decision *Decision) time.Duration {
+	delay := r.settleDelay(decision.settleInterval)
+	if decision.retryAfter > delay {
+		delay = wait.Jitter(decision.retryAfter, r.SettleJitter)
+	}
+	return delay
+}
+
+// auditNode records the decision for a node without acting on it. Audit records are always logged, regardless of
+// the log level, so they can be collected for review.
+func (r *NodeReconciler) auditNode(node *corev1.Node, decision *Decision) (ctrl.Result, error) {
+	r.Log.Info("Audit",
+		"node", decision.Node,
+		"providerID", decision.ProviderID,
+		"ready", decision.Ready,
+		"cloudStatus", decision.CloudStatus,
+		"action", decision.Action,
+		"reason", decision.Reason,
+		"error", decision.Error,
+	)
+
+	if decision.Action == ActionRequeue || decision.Action == ActionCleanUp {
+		return ctrl.Result{RequeueAfter: r.requeueDelay(decision)}, nil
+	}
+	msg := fmt.Sprintf("Audit: node %s would be deleted because node status is %s", node.Name, decision.CloudStatus)
+	if decision.Chaos {
+		msg = "Chaos: " + msg
+	}
+	r.Recorder.Event(newNodeRef(node), corev1.EventTypeNormal, wouldDeleteNodeEvent, msg)
+	nodeDeletionsTotal.WithLabelValues("audit").Inc()
+	r.nodeDeleted(node, decision, true)
 	return ctrl.Result{}, nil
 }
 
-func isAWSNotFoundErr(err error) bool {
-	return strings.Contains(err.Error(), "does not exist")
+// trackPending records whether the node has no Ready condition, updating the nodes_without_ready_condition metric
+func (r *NodeReconciler) trackPending(name string, pending bool) {
+	if pending {
+		r.pending.Store(name, true)
+	} else {
+		r.pending.Delete(name)
+	}
+	count := 0
+	r.pending.Range(func(interface{}, interface{}) bool {
+		count++
+		return true
+	})
+	nodesWithoutReadyCondition.Set(float64(count))
 }
 
 // Filter to only the NodeReady condition
@@ -188,7 +797,7 @@ func getNodeReadyCondition(status []corev1.NodeCondition) (corev1.NodeCondition,
 			return condition, nil
 		}
 	}
-	return corev1.NodeCondition{}, errors.New("unable to find NodeReady condition. something is wrong, bruh")
+	return corev1.NodeCondition{}, errNoReadyCondition
 }
 
 func newNodeRef(node *corev1.Node) *corev1.ObjectReference {
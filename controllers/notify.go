@@ -0,0 +1,108 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/nxtlytics/cloud-lifecycle-controller/pkg/notify"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+// podListTimeout bounds listing a node's pods for a notification
+const podListTimeout = 10 * time.Second
+
+// nodeDeleted reports a node deletion, or one skipped for a dry run or audit, to the Notifier
+func (r *NodeReconciler) nodeDeleted(node *corev1.Node, decision *Decision, dryRun bool) {
+	if r.Notifier == nil {
+		return
+	}
+	event := notify.Event{
+		Type:       notify.NodeDeleted,
+		Node:       node.Name,
+		ProviderID: decision.ProviderID,
+		Pool:       r.nodePool(node),
+		Reason:     decision.CloudStatus,
+		Message:    fmt.Sprintf("Node %s: %s", node.Name, decision.Reason),
+		DryRun:     dryRun,
+		Decision:   decision,
+	}
+	if r.NotifyStatefulPods {
+		pods, err := r.statefulPods(node)
+		if err != nil {
+			r.Log.Error(err, "Unable to list the node's pods for the notification", "node", node.Name)
+		}
+		event.StatefulPods = pods
+	}
+	r.notify(event)
+}
+
+// statefulPods returns the namespace/name of the node's pods with persistent volume claims. Pods aren't cached, so
+// they are listed from the API server with APIReader, or Client if unset.
+func (r *NodeReconciler) statefulPods(node *corev1.Node) ([]string, error) {
+	reader := r.APIReader
+	if reader == nil {
+		reader = r.Client
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), podListTimeout)
+	defer cancel()
+
+	pods := &corev1.PodList{}
+	if err := reader.List(ctx, pods, client.MatchingFields{"spec.nodeName": node.Name}); err != nil {
+		return nil, err
+	}
+	var stateful []string
+	for i := range pods.Items {
+		if usesClaims(&pods.Items[i]) {
+			stateful = append(stateful, pods.Items[i].Namespace+"/"+pods.Items[i].Name)
+		}
+	}
+	return stateful, nil
+}
+
+// nodeEvaluated reports a decision about a node to the Notifier
+func (r *NodeReconciler) nodeEvaluated(node *corev1.Node, decision *Decision) {
+	if r.Notifier == nil {
+		return
+	}
+	r.notify(notify.Event{
+		Type:       notify.NodeEvaluated,
+		Node:       node.Name,
+		ProviderID: decision.ProviderID,
+		Pool:       r.nodePool(node),
+		Reason:     decision.CloudStatus,
+		Message:    fmt.Sprintf("%s: %s", decision.Action, decision.Reason),
+		DryRun:     r.dryRun(node) || r.Audit,
+		Decision:   decision,
+	})
+}
+
+// notify hands the event to the Notifier, counting the events it drops
+func (r *NodeReconciler) notify(event notify.Event) {
+	err := r.Notifier.Notify(context.Background(), event)
+	if errors.Is(err, notify.ErrQueueFull) {
+		notificationsDroppedTotal.WithLabelValues(string(event.Type)).Inc()
+	}
+	if err != nil {
+		r.Log.Error(err, "Unable to send notification", "node", event.Node)
+	}
+}
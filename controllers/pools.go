@@ -0,0 +1,193 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"fmt"
+	"time"
+
+	"sigs.k8s.io/yaml"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// nodePoolLabels are the labels that name a node's pool or node group, in order of preference
+var nodePoolLabels = []string{
+	"karpenter.sh/nodepool",
+	"eks.amazonaws.com/nodegroup",
+	"kubernetes.azure.com/agentpool",
+	"agentpool",
+	"cloud.google.com/gke-nodepool",
+	"node.kubernetes.io/pool",
+}
+
+// nodePool returns the name of the node's pool: the value of Pools.Label if set, or else of the first of the usual
+// node pool labels the node has. It is "" if the node has none of them.
+func (r *NodeReconciler) nodePool(node *corev1.Node) string {
+	if r.Pools.Label != "" {
+		return node.Labels[r.Pools.Label]
+	}
+	for _, label := range nodePoolLabels {
+		if pool := node.Labels[label]; pool != "" {
+			return pool
+		}
+	}
+	return ""
+}
+
+// PoolOverrides replace the controller's thresholds for the nodes of one pool, e.g. to clean up spot pools
+// aggressively and stateful pools conservatively. Unset fields keep the controller's settings.
+type PoolOverrides struct {
+	GiveUpAfter     *metav1.Duration `json:"giveUpAfter,omitempty"`
+	UnknownDeadline *metav1.Duration `json:"unknownStatusDeadline,omitempty"`
+	SettleInterval  *metav1.Duration `json:"settleInterval,omitempty"`
+	LeaseMaxAge     *metav1.Duration `json:"leaseMaxAge,omitempty"`
+	MinNotReady     *metav1.Duration `json:"minNotReady,omitempty"`
+	// ShutdownDelay and NotFoundWindow replace the settle profile's
+	ShutdownDelay  *metav1.Duration `json:"shutdownDelay,omitempty"`
+	NotFoundWindow *metav1.Duration `json:"notFoundWindow,omitempty"`
+	// SpotEvictionAction replaces what to do with nodes whose spot instance was evicted: Delete, GiveUp or None
+	SpotEvictionAction *Action `json:"spotEvictionAction,omitempty"`
+	// Actions are the actions allowed for the pool's nodes, all of them if empty. Nodes that would be deleted
+	// without Delete are given up on instead, and nodes that would be given up on without GiveUp are requeued.
+	Actions []Action `json:"actions,omitempty"`
+}
+
+// Pools holds per-pool overrides, keyed by the value of Label on the nodes, or by the node's pool as named by the
+// usual node pool labels (karpenter.sh/nodepool, eks.amazonaws.com/nodegroup, ...) if Label is empty
+type Pools struct {
+	Label     string                   `json:"label,omitempty"`
+	Overrides map[string]PoolOverrides `json:"pools"`
+}
+
+// ParsePools parses per-pool overrides from YAML or JSON:
+//
+//	label: node.kubernetes.io/lifecycle
+//	pools:
+//	  spot:
+//	    minNotReady: 1m
+//	    unknownStatusDeadline: 10m
+//	  stateful:
+//	    giveUpAfter: 72h
+//	    actions: [Requeue, GiveUp]
+func ParsePools(data []byte) (Pools, error) {
+	pools := Pools{}
+	if err := yaml.UnmarshalStrict(data, &pools); err != nil {
+		return pools, fmt.Errorf("unable to parse pool overrides: %w", err)
+	}
+	for pool, overrides := range pools.Overrides {
+		for _, action := range overrides.Actions {
+			switch action {
+			case ActionNone, ActionRequeue, ActionDelete, ActionGiveUp:
+			default:
+				return pools, fmt.Errorf("invalid action %q for pool %s", action, pool)
+			}
+		}
+		if overrides.SpotEvictionAction != nil {
+			action, err := ParseEvictionAction(string(*overrides.SpotEvictionAction))
+			if err != nil {
+				return pools, fmt.Errorf("%w for pool %s", err, pool)
+			}
+			*overrides.SpotEvictionAction = action
+		}
+	}
+	return pools, nil
+}
+
+// thresholds are the settings a node is evaluated with, after its pool's overrides
+type thresholds struct {
+	// pool is the name of the pool whose overrides apply, "" if none do
+	pool            string
+	giveUpAfter     time.Duration
+	unknownDeadline time.Duration
+	settleInterval  time.Duration
+	leaseMaxAge     time.Duration
+	minNotReady     time.Duration
+	shutdownDelay   time.Duration
+	notFoundWindow  time.Duration
+	evictionAction  Action
+	actions         []Action
+}
+
+// thresholds returns the settings to evaluate the node with
+func (r *NodeReconciler) thresholds(node *corev1.Node) thresholds {
+	t := thresholds{
+		giveUpAfter:     r.GiveUpAfter,
+		unknownDeadline: r.UnknownDeadline,
+		settleInterval:  r.SettleInterval,
+		leaseMaxAge:     r.LeaseMaxAge,
+		minNotReady:     r.MinNotReady,
+		shutdownDelay:   r.SettleProfile.ShutdownDelay,
+		notFoundWindow:  r.SettleProfile.NotFoundWindow,
+		evictionAction:  r.SpotEvictionAction,
+	}
+	if t.evictionAction == "" {
+		t.evictionAction = ActionDelete
+	}
+
+	pool := r.nodePool(node)
+	overrides, ok := r.Pools.Overrides[pool]
+	if pool == "" || !ok {
+		return t
+	}
+	t.pool = pool
+	override := func(d *time.Duration, o *metav1.Duration) {
+		if o != nil {
+			*d = o.Duration
+		}
+	}
+	override(&t.giveUpAfter, overrides.GiveUpAfter)
+	override(&t.unknownDeadline, overrides.UnknownDeadline)
+	override(&t.settleInterval, overrides.SettleInterval)
+	override(&t.leaseMaxAge, overrides.LeaseMaxAge)
+	override(&t.minNotReady, overrides.MinNotReady)
+	override(&t.shutdownDelay, overrides.ShutdownDelay)
+	override(&t.notFoundWindow, overrides.NotFoundWindow)
+	if overrides.SpotEvictionAction != nil {
+		t.evictionAction = *overrides.SpotEvictionAction
+	}
+	t.actions = overrides.Actions
+	return t
+}
+
+// allows returns true if the action is allowed for the node's pool
+func (t thresholds) allows(action Action) bool {
+	if len(t.actions) == 0 || action == ActionNone {
+		return true
+	}
+	for _, allowed := range t.actions {
+		if allowed == action {
+			return true
+		}
+	}
+	return false
+}
+
+// restrict replaces a decision's action with a less drastic one if its pool doesn't allow it
+func (t thresholds) restrict(decision *Decision) {
+	if (decision.Action == ActionDelete || decision.Action == ActionCleanUp) && !t.allows(ActionDelete) {
+		decision.check("pool-actions", "pool %s doesn't allow %s", t.pool, ActionDelete)
+		decision.Action = ActionGiveUp
+		decision.Reason = fmt.Sprintf("%s, but pool %s doesn't allow deleting nodes", decision.Reason, t.pool)
+		decision.pastDeadline = false
+	}
+	if decision.Action == ActionGiveUp && !t.allows(ActionGiveUp) {
+		decision.check("pool-actions", "pool %s doesn't allow %s", t.pool, ActionGiveUp)
+		decision.Action = ActionRequeue
+	}
+}
@@ -0,0 +1,67 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"sigs.k8s.io/controller-runtime/pkg/event"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+// nodeChangedPredicate filters out node updates that can't change the controller's decision, most importantly the
+// kubelet's status heartbeats, which would otherwise trigger a reconcile for every node every few seconds.
+// Nodes are reconciled when they're created, when their Ready condition status, provider ID, RecheckAnnotation or
+// protection changes, when their deletion is requested, and on periodic resyncs. Deleted nodes aren't reconciled, but
+// are passed to deleted.
+func nodeChangedPredicate(deleted func(node *corev1.Node)) predicate.Predicate {
+	return predicate.Funcs{
+		UpdateFunc: func(e event.UpdateEvent) bool {
+			oldNode, ok := e.ObjectOld.(*corev1.Node)
+			if !ok {
+				return true
+			}
+			newNode, ok := e.ObjectNew.(*corev1.Node)
+			if !ok {
+				return true
+			}
+			if oldNode.ResourceVersion == newNode.ResourceVersion {
+				// periodic resync
+				return true
+			}
+			return readyStatus(oldNode) != readyStatus(newNode) || oldNode.Spec.ProviderID != newNode.Spec.ProviderID ||
+				oldNode.Annotations[RecheckAnnotation] != newNode.Annotations[RecheckAnnotation] ||
+				protection(oldNode) != protection(newNode) ||
+				oldNode.DeletionTimestamp.IsZero() != newNode.DeletionTimestamp.IsZero()
+		},
+		DeleteFunc: func(e event.DeleteEvent) bool {
+			if node, ok := e.Object.(*corev1.Node); ok {
+				deleted(node)
+			}
+			return false
+		},
+	}
+}
+
+// readyStatus returns the status of the node's Ready condition, or "" if it has none
+func readyStatus(node *corev1.Node) corev1.ConditionStatus {
+	condition, err := getNodeReadyCondition(node.Status.Conditions)
+	if err != nil {
+		return ""
+	}
+	return condition.Status
+}
@@ -0,0 +1,65 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"net"
+	"strconv"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+// DefaultProbeTimeout is how long a Probe waits for each connection by default
+const DefaultProbeTimeout = 2 * time.Second
+
+// Probe is a TCP connection to a node's addresses, e.g. the kubelet port, made as a second opinion before deleting
+// it, for cloud APIs that are flaky or eventually consistent. ICMP isn't used since it needs a privileged socket.
+type Probe struct {
+	// Port is the TCP port to connect to, e.g. 10250 for the kubelet; 0 disables the probe
+	Port int
+	// Timeout is how long to wait for each connection. Defaults to DefaultProbeTimeout.
+	Timeout time.Duration
+}
+
+// reachable returns the first of the node's internal and external addresses that accepts a connection on the probe
+// port, or "" if none does
+func (p Probe) reachable(ctx context.Context, node *corev1.Node) string {
+	if p.Port <= 0 {
+		return ""
+	}
+	timeout := p.Timeout
+	if timeout <= 0 {
+		timeout = DefaultProbeTimeout
+	}
+
+	dialer := &net.Dialer{Timeout: timeout}
+	for _, addr := range node.Status.Addresses {
+		if addr.Type != corev1.NodeInternalIP && addr.Type != corev1.NodeExternalIP {
+			continue
+		}
+		hostPort := net.JoinHostPort(addr.Address, strconv.Itoa(p.Port))
+		conn, err := dialer.DialContext(ctx, "tcp", hostPort)
+		if err != nil {
+			continue
+		}
+		conn.Close()
+		return hostPort
+	}
+	return ""
+}
@@ -0,0 +1,74 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"fmt"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+// ProtectedAnnotation and ProtectedFinalizer pin a node, e.g. while it is examined after an incident: the controller
+// never deletes a node with either of them, records a ProtectedNode event instead, and never removes them. The
+// finalizer also holds up deletions by anyone else until it is removed by hand.
+const (
+	ProtectedAnnotation = "clc.nxtlytics.com/protected"
+	ProtectedFinalizer  = "clc.nxtlytics.com/protected"
+)
+
+const protectedNodeEvent = "ProtectedNode"
+
+// protection returns how the node is protected, or "" if it isn't. An annotation value of "false" doesn't protect it.
+func protection(node *corev1.Node) string {
+	for _, finalizer := range node.Finalizers {
+		if finalizer == ProtectedFinalizer {
+			return "finalizer " + ProtectedFinalizer
+		}
+	}
+	if value, ok := node.Annotations[ProtectedAnnotation]; ok && value != "false" {
+		return "annotation " + ProtectedAnnotation
+	}
+	return ""
+}
+
+// protect keeps a protected node from being deleted or cleaned up, turning the decision into one to leave it alone
+func protect(node *corev1.Node, decision *Decision) {
+	if decision.Action != ActionDelete && decision.Action != ActionCleanUp {
+		return
+	}
+	by := protection(node)
+	if by == "" {
+		return
+	}
+	decision.check("protected", "by %s", by)
+	decision.Action = ActionNone
+	decision.Reason = fmt.Sprintf("%s, but the node is protected by %s", decision.Reason, by)
+	decision.protected = true
+	decision.pastDeadline = false
+}
+
+// protected records a ProtectedNode event for a node whose deletion its protection blocked, once per Ready condition
+// transition
+func (r *NodeReconciler) protected(node *corev1.Node, decision *Decision) {
+	status, _ := getNodeReadyCondition(node.Status.Conditions)
+	transition := status.LastTransitionTime.String()
+	if previous, ok := r.protectedNodes.Load(node.UID); ok && previous == transition {
+		return
+	}
+	r.protectedNodes.Store(node.UID, transition)
+	r.Recorder.Event(newNodeRef(node), corev1.EventTypeWarning, protectedNodeEvent, decision.Reason)
+}
@@ -0,0 +1,41 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	corev1 "k8s.io/api/core/v1"
+)
+
+// RecheckAnnotation asks the controller to re-check a node right away, e.g. during incident response: setting it to a
+// new value (such as the current time) triggers a reconcile that skips the startup spread and the cloud lookup cache
+const RecheckAnnotation = "clc.nxtlytics.com/recheck"
+
+// recheckRequested returns true the first time the node is reconciled with a new RecheckAnnotation value
+func (r *NodeReconciler) recheckRequested(node *corev1.Node) bool {
+	value, ok := node.Annotations[RecheckAnnotation]
+	if !ok {
+		r.rechecks.Delete(node.UID)
+		return false
+	}
+	previous, ok := r.rechecks.Load(node.UID)
+	if ok && previous == value {
+		return false
+	}
+	r.rechecks.Store(node.UID, value)
+	// after a restart, the value may have been acted on already
+	return ok || !r.PersistState || loadState(node).Recheck != value
+}
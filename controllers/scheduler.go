@@ -0,0 +1,155 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/util/workqueue"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+// DefaultMaxBacklog is the default number of nodes the work queue may hold before scheduled reconciles wait
+const DefaultMaxBacklog = 500
+
+// schedulerPollInterval is how often the scheduler checks whether the work queue's backlog has gone down
+const schedulerPollInterval = time.Second
+
+// Priority orders the reconciles waiting in the scheduler; higher priorities are queued first
+type Priority int
+
+const (
+	// PriorityLow is for the periodic sweep, which only catches what other sources missed
+	PriorityLow Priority = iota
+	// PriorityNormal is for events that a node may need checking
+	PriorityNormal
+	// PriorityHigh is for events that an instance is going away, e.g. spot interruptions or scheduled retirements
+	PriorityHigh
+
+	priorityCount
+)
+
+// scheduler feeds the reconciles asked for by sources other than the node watch, i.e. the periodic sweep and external
+// event sources such as cloud event queues, into the controller's work queue. All sources share the work queue, which
+// dedups them with each other and with watch events, so a node several sources ask about is reconciled once.
+// Reconciles wait in the scheduler, by priority, while the work queue holds maxBacklog nodes or more, so a burst from
+// one source (e.g. the sweep of a large cluster) can't bury the nodes the watch reports.
+type scheduler struct {
+	maxBacklog int
+	wake       chan struct{}
+
+	mu sync.Mutex
+	// pending holds the priority of each node waiting in the scheduler
+	pending map[string]Priority
+	// waiting holds the nodes waiting at each priority, oldest first. Nodes whose priority was raised since are
+	// skipped.
+	waiting [priorityCount][]string
+}
+
+func newScheduler(maxBacklog int) *scheduler {
+	if maxBacklog <= 0 {
+		maxBacklog = DefaultMaxBacklog
+	}
+	return &scheduler{
+		maxBacklog: maxBacklog,
+		wake:       make(chan struct{}, 1),
+		pending:    map[string]Priority{},
+	}
+}
+
+// add schedules a reconcile of the named node, raising its priority if it is already waiting
+func (s *scheduler) add(name string, priority Priority) {
+	if priority < PriorityLow {
+		priority = PriorityLow
+	} else if priority >= priorityCount {
+		priority = PriorityHigh
+	}
+
+	s.mu.Lock()
+	if p, ok := s.pending[name]; !ok || p < priority {
+		s.pending[name] = priority
+		s.waiting[priority] = append(s.waiting[priority], name)
+	}
+	schedulerPending.Set(float64(len(s.pending)))
+	s.mu.Unlock()
+
+	select {
+	case s.wake <- struct{}{}:
+	default:
+	}
+}
+
+// next removes the oldest node waiting at the highest priority
+func (s *scheduler) next() (string, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for p := priorityCount - 1; p >= PriorityLow; p-- {
+		for len(s.waiting[p]) > 0 {
+			name := s.waiting[p][0]
+			s.waiting[p] = s.waiting[p][1:]
+			if current, ok := s.pending[name]; ok && current == p {
+				delete(s.pending, name)
+				schedulerPending.Set(float64(len(s.pending)))
+				return name, true
+			}
+		}
+	}
+	return "", false
+}
+
+// Start implements source.Source, moving waiting nodes to the controller's work queue until ctx is done
+func (s *scheduler) Start(ctx context.Context, _ handler.EventHandler, queue workqueue.RateLimitingInterface,
+	_ ...predicate.Predicate) error {
+	go s.run(ctx, queue)
+	return nil
+}
+
+func (s *scheduler) run(ctx context.Context, queue workqueue.RateLimitingInterface) {
+	ticker := time.NewTicker(schedulerPollInterval)
+	defer ticker.Stop()
+	for {
+		for queue.Len() < s.maxBacklog {
+			name, ok := s.next()
+			if !ok {
+				break
+			}
+			queue.Add(reconcile.Request{NamespacedName: types.NamespacedName{Name: name}})
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-s.wake:
+		case <-ticker.C:
+		}
+	}
+}
+
+// Trigger schedules a reconcile of the named node on behalf of source, e.g. a cloud event queue, so event sources
+// other than the node watch share the controller's deduplication and backpressure. Nodes outside the shard are
+// ignored. It must only be called after SetupWithManager.
+func (r *NodeReconciler) Trigger(name, source string, priority Priority) {
+	if !r.Shard.Owns(name) {
+		return
+	}
+	scheduledReconcilesTotal.WithLabelValues(source).Inc()
+	r.scheduler.add(name, priority)
+}
@@ -0,0 +1,67 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+// SettleProfile describes how quickly a cloud provider's API converges after an instance goes away, so the controller
+// waits as long as that provider needs instead of assuming all clouds behave alike
+type SettleProfile struct {
+	// ShutdownDelay is how long a node must have been not ready before its shut down instance is acted on, for APIs
+	// that report instances as stopped while they are only being restarted, e.g. redeployed or reimaged
+	ShutdownDelay time.Duration
+	// NotFoundWindow is how long after a node was created its instance may be missing from the cloud API, which is
+	// eventually consistent for new instances. Instances not found within the window are checked again after it.
+	NotFoundWindow time.Duration
+}
+
+// SettleProfiles are the default settle profiles, by cloud provider name. Providers without one act on shut down and
+// missing instances right away.
+var SettleProfiles = map[string]SettleProfile{
+	// DescribeInstances is eventually consistent and can miss instances for a few minutes after they launch
+	"aws": {NotFoundWindow: 5 * time.Minute},
+	// scale set instances are reported as stopped or deallocated while they're reimaged or redeployed, and new ones
+	// can take a while to show up in the scale set's instance view
+	"azure": {ShutdownDelay: 2 * time.Minute, NotFoundWindow: 2 * time.Minute},
+	// the compute API is strongly consistent, but instances restarted after a host error briefly go through STOPPING
+	"gce": {ShutdownDelay: time.Minute},
+	// AWS Config records new instances within a few minutes, occasionally more
+	"aws-config": {NotFoundWindow: 15 * time.Minute},
+	// Resource Graph is updated within minutes of the compute API, which has the azure profile's quirks too
+	"azure-resource-graph": {ShutdownDelay: 2 * time.Minute, NotFoundWindow: 10 * time.Minute},
+}
+
+// settling returns how much longer the node's cloud status needs before it can be trusted under its settle profile,
+// recording the checks in decision. Zero or less means it can be acted on.
+func (t thresholds) settling(node *corev1.Node, status providerNodeStatus, notReadyFor time.Duration,
+	decision *Decision) time.Duration {
+	switch {
+	case status == providerNodeStatusShutdown && t.shutdownDelay > 0:
+		decision.check("shutdown-delay", "%s, %s", t.shutdownDelay, exceeded(notReadyFor >= t.shutdownDelay))
+		return t.shutdownDelay - notReadyFor
+	case status == providerNodeStatusNotFound && t.notFoundWindow > 0:
+		age := time.Since(node.CreationTimestamp.Time)
+		decision.check("not-found-window", "%s after the node was created, %s", t.notFoundWindow,
+			exceeded(age >= t.notFoundWindow))
+		return t.notFoundWindow - age
+	}
+	return 0
+}
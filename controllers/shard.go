@@ -0,0 +1,62 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"hash/fnv"
+
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
+)
+
+// Shard is the subset of nodes a replica owns when nodes are sharded across several active replicas.
+// Nodes are assigned to shards by a consistent hash of their name, so changing the number of shards only moves
+// the nodes that have to move.
+type Shard struct {
+	// Count is the number of shards; 0 or 1 means the replica owns all nodes
+	Count int
+	// Index is this replica's shard, from 0 to Count-1
+	Index int
+}
+
+// Owns returns true if the node with the given name belongs to the shard
+func (s Shard) Owns(name string) bool {
+	if s.Count <= 1 {
+		return true
+	}
+	h := fnv.New64a()
+	h.Write([]byte(name))
+	return jumpHash(h.Sum64(), s.Count) == s.Index
+}
+
+// predicate filters out the events of nodes the shard doesn't own
+func (s Shard) predicate() predicate.Predicate {
+	return predicate.NewPredicateFuncs(func(obj client.Object) bool {
+		return s.Owns(obj.GetName())
+	})
+}
+
+// jumpHash is Lamping and Veach's jump consistent hash, mapping key to one of buckets buckets
+func jumpHash(key uint64, buckets int) int {
+	var b, j int64 = -1, 0
+	for j < int64(buckets) {
+		b = j
+		key = key*2862933555777941757 + 1
+		j = int64(float64(b+1) * (float64(int64(1)<<31) / float64((key>>33)+1)))
+	}
+	return int(b)
+}
@@ -0,0 +1,82 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// StateAnnotation holds what the controller remembers about a node when PersistState is set, so a restart or a leader
+// change doesn't repeat GaveUpOnNode events and re-checks, or forget that the cloud API asked to back off
+const StateAnnotation = "clc.nxtlytics.com/state"
+
+// nodeState is the value of StateAnnotation. Grace periods and deadlines don't need to be in it, since they're
+// measured from the node's Ready condition transition time, which survives restarts on its own.
+type nodeState struct {
+	// GaveUp is the Ready condition transition time the controller gave up on
+	GaveUp string `json:"gaveUp,omitempty"`
+	// Recheck is the last RecheckAnnotation value acted on
+	Recheck string `json:"recheck,omitempty"`
+	// NotBefore is when the node may be looked up again, after the cloud API throttled its lookup
+	NotBefore *metav1.Time `json:"notBefore,omitempty"`
+}
+
+// loadState returns the state stored on the node, or the zero state if there is none or it can't be parsed
+func loadState(node *corev1.Node) nodeState {
+	state := nodeState{}
+	if value, ok := node.Annotations[StateAnnotation]; ok {
+		_ = json.Unmarshal([]byte(value), &state)
+	}
+	return state
+}
+
+// saveState stores the node's state in StateAnnotation, if PersistState is set and the state changed. Errors are only
+// logged: the in-memory state still applies until the controller restarts.
+func (r *NodeReconciler) saveState(ctx context.Context, node *corev1.Node, update func(*nodeState)) {
+	if !r.PersistState || r.DryRun || r.Audit {
+		return
+	}
+	state := loadState(node)
+	update(&state)
+	value, err := json.Marshal(state)
+	if err != nil || node.Annotations[StateAnnotation] == string(value) {
+		return
+	}
+	err = applyNode(ctx, r.Client, node.Name, map[string]interface{}{
+		"metadata": map[string]interface{}{
+			"annotations": map[string]interface{}{StateAnnotation: string(value)},
+		},
+	})
+	if err != nil {
+		r.Log.Error(err, "Unable to save node state", "node", node.Name)
+	}
+}
+
+// backoffRemaining returns how much longer the cloud API asked to wait before looking the node up again, according to
+// its stored state
+func backoffRemaining(node *corev1.Node) time.Duration {
+	state := loadState(node)
+	if state.NotBefore == nil {
+		return 0
+	}
+	return time.Until(state.NotBefore.Time)
+}
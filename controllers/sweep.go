@@ -0,0 +1,212 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	ctrl "sigs.k8s.io/controller-runtime"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+// SweepSummary is how the reconciles of the nodes of one sweep ended. A sweep completes once every node it scheduled
+// has been reconciled, whichever source the reconcile came from.
+type SweepSummary struct {
+	Started   time.Time `json:"started"`
+	Completed time.Time `json:"completed"`
+	// Evaluated is the number of nodes reconciled, the sum of the counts below
+	Evaluated int `json:"evaluated"`
+	// Healthy is the number of nodes left alone
+	Healthy int `json:"healthy"`
+	// Pending is the number of nodes requeued, e.g. because their cloud status hasn't settled yet
+	Pending int `json:"pending"`
+	// Deleted is the number of nodes deleted, or that would have been in a dry run or audit
+	Deleted int `json:"deleted"`
+	// Skipped is the number of nodes given up on, protected or gone before they were reconciled
+	Skipped int `json:"skipped"`
+	// Errors is the number of reconciles that failed
+	Errors int `json:"errors"`
+	// Unfinished is the number of nodes not reconciled before the next sweep started; the sweep didn't complete
+	Unfinished int `json:"unfinished,omitempty"`
+}
+
+// sweepTracker follows the nodes of the sweep in progress until they have all been reconciled
+type sweepTracker struct {
+	mu sync.Mutex
+	// current is the summary of the sweep in progress, nil between sweeps
+	current *SweepSummary
+	// remaining holds the nodes of the sweep in progress that haven't been reconciled yet
+	remaining map[string]bool
+	// last is the summary of the last finished sweep
+	last *SweepSummary
+}
+
+// start begins a sweep of the named nodes, finishing the previous sweep as unfinished if it is still in progress
+func (t *sweepTracker) start(names []string) *SweepSummary {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	var overrun *SweepSummary
+	if t.current != nil {
+		t.current.Unfinished = len(t.remaining)
+		overrun = t.finish()
+	}
+	t.current = &SweepSummary{Started: time.Now()}
+	t.remaining = make(map[string]bool, len(names))
+	for _, name := range names {
+		t.remaining[name] = true
+	}
+	return overrun
+}
+
+// reconciled counts the reconcile of a node towards the sweep in progress, returning the sweep's summary if it was the
+// last node. It may be called on a nil tracker.
+func (t *sweepTracker) reconciled(name string, result ctrl.Result, err error, decision *Decision) *SweepSummary {
+	if t == nil {
+		return nil
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if !t.remaining[name] {
+		return nil
+	}
+	delete(t.remaining, name)
+
+	s := t.current
+	s.Evaluated++
+	switch {
+	case err != nil:
+		s.Errors++
+	case decision == nil && result.RequeueAfter > 0:
+		// delayed by a startup spread or a cloud API back off
+		s.Pending++
+	case decision == nil || decision.protected || decision.Action == ActionGiveUp:
+		s.Skipped++
+	case decision.Action == ActionRequeue:
+		s.Pending++
+	case decision.Action == ActionDelete || decision.Action == ActionCleanUp:
+		s.Deleted++
+	default:
+		s.Healthy++
+	}
+	return t.completed()
+}
+
+// completed finishes the sweep in progress if no nodes remain. t.mu must be held.
+func (t *sweepTracker) completed() *SweepSummary {
+	if t.current == nil || len(t.remaining) > 0 {
+		return nil
+	}
+	return t.finish()
+}
+
+// finish ends the sweep in progress. t.mu must be held.
+func (t *sweepTracker) finish() *SweepSummary {
+	s := t.current
+	s.Completed = time.Now()
+	t.last, t.current, t.remaining = s, nil, nil
+	summary := *s
+	return &summary
+}
+
+// LastSweep returns the summary of the last finished sweep, or nil if no sweep finished yet or SweepInterval isn't set
+func (r *NodeReconciler) LastSweep() *SweepSummary {
+	if r.sweeps == nil {
+		return nil
+	}
+	r.sweeps.mu.Lock()
+	defer r.sweeps.mu.Unlock()
+	if r.sweeps.last == nil {
+		return nil
+	}
+	summary := *r.sweeps.last
+	return &summary
+}
+
+// sweepFinished logs and exports the summary of a finished sweep. Only completed sweeps advance the
+// last_sweep_completed metric, so alerting on its age catches a pipeline that stopped getting through the nodes.
+func (r *NodeReconciler) sweepFinished(s *SweepSummary) {
+	if s == nil {
+		return
+	}
+	for result, count := range map[string]int{
+		"evaluated":  s.Evaluated,
+		"healthy":    s.Healthy,
+		"pending":    s.Pending,
+		"deleted":    s.Deleted,
+		"skipped":    s.Skipped,
+		"error":      s.Errors,
+		"unfinished": s.Unfinished,
+	} {
+		lastSweepNodes.WithLabelValues(result).Set(float64(count))
+	}
+	lastSweepDuration.Set(s.Completed.Sub(s.Started).Seconds())
+
+	values := []interface{}{
+		"started", s.Started, "duration", s.Completed.Sub(s.Started).Round(time.Second), "evaluated", s.Evaluated,
+		"healthy", s.Healthy, "pending", s.Pending, "deleted", s.Deleted, "skipped", s.Skipped, "errors", s.Errors,
+	}
+	if s.Unfinished > 0 {
+		r.Log.Info("Sweep did not complete before the next one started", append(values, "unfinished", s.Unfinished)...)
+		return
+	}
+	lastSweepCompleted.Set(float64(s.Completed.Unix()))
+	r.Log.Info("Sweep completed", values...)
+}
+
+// sweeper schedules a low priority reconcile of every node each interval, to catch missed events without the burst of
+// an informer resync
+type sweeper struct {
+	reconciler *NodeReconciler
+	interval   time.Duration
+}
+
+// Start implements manager.Runnable
+func (s *sweeper) Start(ctx context.Context) error {
+	r := s.reconciler
+	ticker := time.NewTicker(s.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+		nodes := &corev1.NodeList{}
+		if err := r.List(ctx, nodes); err != nil {
+			r.Log.Error(err, "Unable to list nodes to sweep")
+			continue
+		}
+		var names []string
+		for i := range nodes.Items {
+			if !isVirtualNode(&nodes.Items[i]) && r.Shard.Owns(nodes.Items[i].Name) {
+				names = append(names, nodes.Items[i].Name)
+			}
+		}
+		r.sweepFinished(r.sweeps.start(names))
+		for _, name := range names {
+			r.Trigger(name, "sweep", PriorityLow)
+		}
+		// an empty sweep completes right away
+		r.sweeps.mu.Lock()
+		summary := r.sweeps.completed()
+		r.sweeps.mu.Unlock()
+		r.sweepFinished(summary)
+	}
+}
@@ -0,0 +1,95 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+// DefaultVerifyTimeout is how long a VerifyHook command may run by default
+const DefaultVerifyTimeout = 30 * time.Second
+
+// maxVerifyOutput is how much of a VerifyHook command's output is kept for the decision's reason
+const maxVerifyOutput = 256
+
+// VerifyHook runs a user-supplied command before a node is deleted, e.g. an SSH check or a BMC ping. The command gets
+// the node's name, provider ID and addresses in the NODE_NAME, NODE_PROVIDER_ID and NODE_ADDRESSES (space separated)
+// environment variables; it exits 0 to confirm the node is dead, and anything else means it's still alive.
+type VerifyHook struct {
+	// Command is the command and its arguments; empty disables the hook. It isn't run by a shell.
+	Command []string
+	// Timeout is how long the command may run before it is killed, which counts as the node being alive.
+	// Defaults to DefaultVerifyTimeout.
+	Timeout time.Duration
+}
+
+// verify runs the command for the node, returning an error if it didn't confirm the node is dead
+func (h VerifyHook) verify(ctx context.Context, node *corev1.Node) error {
+	if len(h.Command) == 0 {
+		return nil
+	}
+	timeout := h.Timeout
+	if timeout <= 0 {
+		timeout = DefaultVerifyTimeout
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	addresses := make([]string, 0, len(node.Status.Addresses))
+	for _, addr := range node.Status.Addresses {
+		addresses = append(addresses, addr.Address)
+	}
+
+	var output bytes.Buffer
+	cmd := exec.CommandContext(ctx, h.Command[0], h.Command[1:]...)
+	cmd.Env = append(os.Environ(),
+		"NODE_NAME="+node.Name,
+		"NODE_PROVIDER_ID="+node.Spec.ProviderID,
+		"NODE_ADDRESSES="+strings.Join(addresses, " "),
+	)
+	cmd.Stdout = &output
+	cmd.Stderr = &output
+
+	err := cmd.Run()
+	if err == nil {
+		return nil
+	}
+	if ctx.Err() == context.DeadlineExceeded {
+		return fmt.Errorf("timed out after %s", timeout)
+	}
+	var exitErr *exec.ExitError
+	if !errors.As(err, &exitErr) {
+		return err
+	}
+	out := strings.TrimSpace(output.String())
+	if len(out) > maxVerifyOutput {
+		out = out[:maxVerifyOutput] + "..."
+	}
+	if out == "" {
+		return fmt.Errorf("exit status %d", exitErr.ExitCode())
+	}
+	return fmt.Errorf("exit status %d: %s", exitErr.ExitCode(), out)
+}
@@ -0,0 +1,59 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"strings"
+
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+// virtualNodeLabels are labels of nodes that aren't backed by a VM, so have no instance to look up: virtual-kubelet
+// nodes (e.g. ACI virtual nodes) and EKS Fargate nodes
+var virtualNodeLabels = map[string]string{
+	"type":                           "virtual-kubelet",
+	"eks.amazonaws.com/compute-type": "fargate",
+}
+
+// virtualNodeTaint is the taint key prefix of virtual-kubelet nodes, e.g. virtual-kubelet.io/provider
+const virtualNodeTaint = "virtual-kubelet.io/"
+
+// isVirtualNode returns true if the node isn't backed by a VM, going by its labels and taints
+func isVirtualNode(node *corev1.Node) bool {
+	for key, value := range virtualNodeLabels {
+		if node.Labels[key] == value {
+			return true
+		}
+	}
+	for _, taint := range node.Spec.Taints {
+		if strings.HasPrefix(taint.Key, virtualNodeTaint) {
+			return true
+		}
+	}
+	return false
+}
+
+// virtualNodePredicate filters out nodes that aren't backed by a VM, so they are never reconciled
+func virtualNodePredicate() predicate.Predicate {
+	return predicate.NewPredicateFuncs(func(obj client.Object) bool {
+		node, ok := obj.(*corev1.Node)
+		return !ok || !isVirtualNode(node)
+	})
+}
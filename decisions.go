@@ -0,0 +1,86 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/nxtlytics/cloud-lifecycle-controller/controllers"
+)
+
+// decisionsPath is where the metrics server serves the decision journal
+const decisionsPath = "/decisions"
+
+// decisionsHandler serves the decisions in the journal as JSON, oldest first. The node query parameter restricts them
+// to one node, e.g. /decisions?node=ip-10-0-0-1.
+func decisionsHandler(reconciler *controllers.NodeReconciler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		node := req.URL.Query().Get("node")
+		decisions := []controllers.JournalEntry{}
+		for _, entry := range reconciler.Decisions() {
+			if node == "" || entry.Node == node {
+				decisions = append(decisions, entry)
+			}
+		}
+		w.Header().Set("Content-Type", "application/json")
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(decisions); err != nil {
+			setupLog.Error(err, "Unable to write decisions")
+		}
+	})
+}
+
+// decisionDumper writes the decisions in the journal to stderr as JSON lines, oldest first, whenever the process
+// receives SIGQUIT. This replaces Go's default of dumping the goroutines and exiting. It runs on every replica, not just
+// the leader, so SIGQUIT does the same everywhere.
+type decisionDumper struct {
+	reconciler *controllers.NodeReconciler
+}
+
+// NeedLeaderElection implements manager.LeaderElectionRunnable
+func (decisionDumper) NeedLeaderElection() bool {
+	return false
+}
+
+// Start implements manager.Runnable
+func (d decisionDumper) Start(ctx context.Context) error {
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGQUIT)
+	defer signal.Stop(signals)
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-signals:
+		}
+		decisions := d.reconciler.Decisions()
+		setupLog.Info("Dumping the decision journal on SIGQUIT", "decisions", len(decisions))
+		enc := json.NewEncoder(os.Stderr)
+		for _, entry := range decisions {
+			if err := enc.Encode(entry); err != nil {
+				setupLog.Error(err, "Unable to dump the decision journal")
+				break
+			}
+		}
+	}
+}
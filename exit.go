@@ -0,0 +1,83 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"errors"
+)
+
+// Exit codes, so deployment automation and alerting can tell a configuration problem from an unavailable dependency
+const (
+	// exitFailure is any other failure, e.g. the manager stopped with an error while running
+	exitFailure = 1
+	// exitUsage is an unknown command or invalid flags
+	exitUsage = 2
+	// exitConfig is an invalid configuration: the flags, config file or cloud config have to be fixed
+	exitConfig = 3
+	// exitCloud is a cloud provider that couldn't be initialized, e.g. because of missing credentials or permissions.
+	// run retries in the background instead, so only commands that need the cloud at once exit with it.
+	exitCloud = 4
+	// exitKubernetes is a Kubernetes API server that couldn't be reached or refused the controller's credentials
+	exitKubernetes = 5
+)
+
+// failure is an error that stopped a command, with the kind of problem that caused it
+type failure struct {
+	kind string
+	code int
+	err  error
+}
+
+func (f *failure) Error() string {
+	return f.err.Error()
+}
+
+func (f *failure) Unwrap() error {
+	return f.err
+}
+
+// configError marks err as caused by an invalid configuration, unless it is already marked
+func configError(err error) error {
+	return classify(err, "config", exitConfig)
+}
+
+// cloudError marks err as caused by the cloud provider, unless it is already marked
+func cloudError(err error) error {
+	return classify(err, "cloud", exitCloud)
+}
+
+// kubernetesError marks err as caused by the Kubernetes API server, unless it is already marked
+func kubernetesError(err error) error {
+	return classify(err, "kubernetes", exitKubernetes)
+}
+
+func classify(err error, kind string, code int) error {
+	var f *failure
+	if err == nil || errors.As(err, &f) {
+		return err
+	}
+	return &failure{kind: kind, code: code, err: err}
+}
+
+// exitCode returns the kind of problem that caused a command's error and the exit code for it
+func exitCode(err error) (string, int) {
+	var f *failure
+	if errors.As(err, &f) {
+		return f.kind, f.code
+	}
+	return "unknown", exitFailure
+}
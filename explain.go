@@ -0,0 +1,117 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/nxtlytics/cloud-lifecycle-controller/controllers"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+)
+
+// explainPath is where the metrics server serves node evaluations, followed by the node name
+const explainPath = "/explain/"
+
+// explainNode evaluates a node like the controller would, first checking whether -node-selector and
+// -node-field-selector let the controller see it at all
+func explainNode(ctx context.Context, reconciler *controllers.NodeReconciler, node *corev1.Node) (*controllers.Decision, error) {
+	labelSelector, fieldSelector, err := nodeSelectors()
+	if err != nil {
+		return nil, configError(err)
+	}
+
+	var checks []controllers.Check
+	watched := true
+	if !labelSelector.Empty() {
+		matches := labelSelector.Matches(labels.Set(node.Labels))
+		checks = append(checks, controllers.Check{Name: "node-selector", Result: fmt.Sprintf("%s matches: %t",
+			labelSelector, matches)})
+		watched = watched && matches
+	}
+	if !fieldSelector.Empty() {
+		// the fields the API server supports in node field selectors
+		matches := fieldSelector.Matches(fields.Set{
+			"metadata.name":      node.Name,
+			"spec.unschedulable": strconv.FormatBool(node.Spec.Unschedulable),
+		})
+		checks = append(checks, controllers.Check{Name: "node-field-selector", Result: fmt.Sprintf("%s matches: %t",
+			fieldSelector, matches)})
+		watched = watched && matches
+	}
+	if !watched {
+		return &controllers.Decision{
+			Node:       node.Name,
+			ProviderID: node.Spec.ProviderID,
+			Action:     controllers.ActionNone,
+			Reason:     "Node doesn't match the node selectors, the controller never looks at it",
+			Checks:     checks,
+		}, nil
+	}
+
+	decision, err := reconciler.Explain(ctx, node)
+	if err != nil {
+		decision.Error = err.Error()
+	}
+	decision.Checks = append(checks, decision.Checks...)
+	return decision, nil
+}
+
+// explainHandler serves the evaluation of the node named in the request path as JSON, e.g. /explain/ip-10-0-0-1.
+// The node is read from the API server rather than the cache, so nodes the controller doesn't watch can be explained
+// too.
+func explainHandler(reader client.Reader, reconciler *controllers.NodeReconciler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		name := strings.TrimPrefix(req.URL.Path, explainPath)
+		if name == "" || strings.Contains(name, "/") {
+			http.Error(w, "usage: "+explainPath+"<node name>", http.StatusBadRequest)
+			return
+		}
+
+		node := &corev1.Node{}
+		if err := reader.Get(req.Context(), types.NamespacedName{Name: name}, node); err != nil {
+			status := http.StatusInternalServerError
+			if apierrors.IsNotFound(err) {
+				status = http.StatusNotFound
+			}
+			http.Error(w, fmt.Sprintf("unable to get node %s: %s", name, err), status)
+			return
+		}
+
+		decision, err := explainNode(req.Context(), reconciler, node)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(decision); err != nil {
+			setupLog.Error(err, "Unable to write node explanation", "node", name)
+		}
+	})
+}
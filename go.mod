@@ -3,11 +3,23 @@ module github.com/nxtlytics/cloud-lifecycle-controller
 go 1.16
 
 require (
+	github.com/Azure/go-autorest/autorest v0.11.1
+	github.com/Azure/go-autorest/autorest/adal v0.9.5
+	github.com/aws/aws-sdk-go v1.35.24
+	github.com/fsnotify/fsnotify v1.4.9
 	github.com/go-logr/logr v0.4.0
+	github.com/go-logr/zapr v0.2.0
+	github.com/lib/pq v1.10.9
+	github.com/prometheus/client_golang v1.7.1
+	go.uber.org/zap v1.15.0
+	golang.org/x/oauth2 v0.0.0-20200107190931-bf48bf16ab8d
+	golang.org/x/time v0.0.0-20200630173020-3af7569d3a1e
+	gopkg.in/gcfg.v1 v1.2.0
+	gopkg.in/warnings.v0 v0.1.1 // indirect
 	k8s.io/api v0.20.0
 	k8s.io/apimachinery v0.20.0
 	k8s.io/client-go v0.20.0
 	k8s.io/cloud-provider v0.20.0
-	k8s.io/legacy-cloud-providers v0.20.0
 	sigs.k8s.io/controller-runtime v0.7.2
+	sigs.k8s.io/yaml v1.2.0
 )
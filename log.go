@@ -0,0 +1,119 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/go-logr/logr"
+	"github.com/go-logr/zapr"
+	"go.uber.org/zap/zapcore"
+	"sigs.k8s.io/controller-runtime/pkg/log/zap"
+
+	uberzap "go.uber.org/zap"
+)
+
+const (
+	logModeProduction  = "production"
+	logModeDevelopment = "development"
+)
+
+// developmentLogging returns true if -log-mode is development, or the legacy -zap-devel flag is set
+func developmentLogging() bool {
+	return logMode == logModeDevelopment || opts.Development
+}
+
+// newLogger returns the logger configured by -log-mode, the -log-sampling-* flags and the zap flags, which override
+// the mode's defaults. It returns a production logger and an error if -log-mode or -log-sampling-thereafter is
+// invalid.
+func newLogger() (logr.Logger, error) {
+	var err error
+	if logMode != logModeProduction && logMode != logModeDevelopment {
+		err = fmt.Errorf("invalid -log-mode %q: must be %s or %s", logMode, logModeProduction, logModeDevelopment)
+	}
+	// zap's sampler divides by -log-sampling-thereafter, so sample nothing rather than panic on the first log line
+	sampling := logSamplingInitial > 0
+	if sampling && logSamplingThereafter < 1 {
+		if err == nil {
+			err = fmt.Errorf("invalid -log-sampling-thereafter %d: must be at least 1", logSamplingThereafter)
+		}
+		sampling = false
+	}
+	development := err == nil && developmentLogging()
+
+	// production logs are read by machines, e.g. Loki or CloudWatch, which parse ISO 8601 timestamps more readily
+	// than zap's default of seconds since the epoch
+	var encoderOpts []zap.EncoderConfigOption
+	if !development {
+		encoderOpts = append(encoderOpts, func(c *zapcore.EncoderConfig) { c.EncodeTime = zapcore.ISO8601TimeEncoder })
+	}
+	var encoder zapcore.Encoder
+	switch {
+	case opts.NewEncoder != nil:
+		// -zap-encoder
+		encoder = opts.NewEncoder(encoderOpts...)
+	case development:
+		encoder = zapcore.NewConsoleEncoder(uberzap.NewDevelopmentEncoderConfig())
+	default:
+		cfg := uberzap.NewProductionEncoderConfig()
+		for _, opt := range encoderOpts {
+			opt(&cfg)
+		}
+		encoder = zapcore.NewJSONEncoder(cfg)
+	}
+
+	stacktraceLevel := opts.StacktraceLevel
+	if stacktraceLevel == nil {
+		stacktraceLevel = zapcore.ErrorLevel
+		if development {
+			stacktraceLevel = zapcore.WarnLevel
+		}
+	}
+
+	sink := zapcore.AddSync(os.Stderr)
+	var core zapcore.Core = zapcore.NewCore(&zap.KubeAwareEncoder{Encoder: encoder, Verbose: development}, sink, logLevel)
+	zapOpts := []uberzap.Option{uberzap.ErrorOutput(sink), uberzap.AddStacktrace(stacktraceLevel)}
+	if development {
+		zapOpts = append(zapOpts, uberzap.Development())
+	} else if sampling {
+		core = &sampledCore{
+			Core:      zapcore.NewSampler(core, time.Second, logSamplingInitial, logSamplingThereafter),
+			unsampled: core,
+		}
+	}
+	return zapr.NewLogger(uberzap.New(core, zapOpts...)), err
+}
+
+// sampledCore samples entries at debug level and above, and passes more verbose ones (logger.V(2) and up) through
+// unsampled, since zap's sampler only counts the levels it knows
+type sampledCore struct {
+	zapcore.Core
+	unsampled zapcore.Core
+}
+
+func (c *sampledCore) With(fields []zapcore.Field) zapcore.Core {
+	return &sampledCore{Core: c.Core.With(fields), unsampled: c.unsampled.With(fields)}
+}
+
+func (c *sampledCore) Check(entry zapcore.Entry, checked *zapcore.CheckedEntry) *zapcore.CheckedEntry {
+	if entry.Level < zapcore.DebugLevel {
+		return c.unsampled.Check(entry, checked)
+	}
+	return c.Core.Check(entry, checked)
+}
@@ -17,27 +17,35 @@ limitations under the License.
 package main
 
 import (
+	"context"
 	"flag"
-	"io"
+	"fmt"
 	"os"
 	"strings"
+	"time"
 
 	"github.com/nxtlytics/cloud-lifecycle-controller/controllers"
+	"github.com/nxtlytics/cloud-lifecycle-controller/pkg/config"
+	"github.com/nxtlytics/cloud-lifecycle-controller/pkg/notify"
+	"go.uber.org/zap/zapcore"
 	"k8s.io/apimachinery/pkg/runtime"
-	"sigs.k8s.io/controller-runtime/pkg/healthz"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/leaderelection/resourcelock"
 	"sigs.k8s.io/controller-runtime/pkg/log/zap"
 
+	uberzap "go.uber.org/zap"
 	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
 	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
-	cloudprovider "k8s.io/cloud-provider"
 	ctrl "sigs.k8s.io/controller-runtime"
+	clientconfig "sigs.k8s.io/controller-runtime/pkg/client/config"
 
 	// Import all Kubernetes client auth plugins (e.g. Azure, GCP, OIDC, etc.)
 	// to ensure that exec-entrypoint and run can make use of them.
 	_ "k8s.io/client-go/plugin/pkg/client/auth"
-	_ "k8s.io/legacy-cloud-providers/aws"
 )
 
+const programName = "cloud-lifecycle-controller"
+
 var (
 	scheme   = runtime.NewScheme()
 	setupLog = ctrl.Log.WithName("setup")
@@ -45,118 +53,657 @@ var (
 
 // CLI flags
 var (
-	metricsAddr             string
-	enableLeaderElection    bool
-	leaderElectionNamespace string
-	probeAddr               string
-	cloudProvider           string
-	cloudConfig             string
-	dryRun                  bool
-	opts                    zap.Options
+	configFile                 string
+	configRefreshInterval      time.Duration
+	metricsAddr                string
+	enableLeaderElection       bool
+	leaderElectionNamespace    string
+	leaderElectionID           string
+	leaderElectionLock         string
+	leaseDuration              time.Duration
+	renewDeadline              time.Duration
+	retryPeriod                time.Duration
+	probeAddr                  string
+	explainEndpoint            bool
+	cloudProvider              string
+	cloudConfig                string
+	cloudConfigRefreshInterval time.Duration
+	cloudCABundle              string
+	cloudBatchWindow           time.Duration
+	cloudCacheTTL              time.Duration
+	cloudAPIQPS                float64
+	cloudAPIBurst              int
+	stripCachedNodes           bool
+	nodeSelector               string
+	nodeFieldSelector          string
+	shardCount                 int
+	shardIndex                 int
+	cloudZone                  string
+	cloudRegion                string
+	clusterID                  string
+	awsAssumeRoleARN           string
+	awsStateSource             string
+	awsConfigAggregator        string
+	azureStateSource           string
+	awsAssumeRoleExternalID    string
+	awsAdditionalRegions       stringList
+	awsEndpointURL             string
+	azureEnvironment           string
+	azureUseManagedIdentity    bool
+	azureUserAssignedIdentity  string
+	gceCredentialsFile         string
+	gceImpersonate             string
+	alicloudRAMRole            string
+	alicloudEndpoint           string
+	ibmEndpoint                string
+	libvirtURI                 string
+	maasURL                    string
+	bmcCriticalIsShutdown      bool
+	bmcAllowedNetworks         stringList
+	instanceScope              string
+	vaultAddress               string
+	vaultAuthPath              string
+	vaultRole                  string
+	vaultCredentialsPath       string
+	kubeContext                string
+	kubeAPIQPS                 float64
+	kubeAPIBurst               int
+	listPageSize               int64
+	watchTimeout               time.Duration
+	enabledControllerNames     = stringList{"*"}
+	dryRun                     bool
+	dryRunKube                 bool
+	dryRunCloud                bool
+	audit                      bool
+	chaos                      float64
+	deleteNodeClaims           bool
+	cleanUpTerminating         bool
+	deleteAs                   string
+	settleInterval             time.Duration
+	settleJitter               float64
+	settleProfileName          string
+	spotEvictionAction         string
+	giveUpAfter                time.Duration
+	unknownDeadline            time.Duration
+	persistState               bool
+	instanceConditionEnabled   bool
+	minNotReady                time.Duration
+	poolConfig                 string
+	clusterName                string
+	datadogEvents              bool
+	datadogSite                string
+	grafanaURL                 string
+	grafanaDashboardUID        string
+	jiraURL                    string
+	jiraProject                string
+	jiraIssueType              string
+	jiraLabels                 stringList
+	jiraStatefulOnly           bool
+	serviceNowURL              string
+	serviceNowRecord           string
+	serviceNowAssignmentGroup  string
+	googleChat                 bool
+	historyDriver              string
+	historyDSN                 string
+	historyTable               string
+	leaseMaxAge                time.Duration
+	probePort                  int
+	probeTimeout               time.Duration
+	verifyCommand              string
+	verifyTimeout              time.Duration
+	startupSpread              time.Duration
+	workers                    int
+	deletionWorkers            int
+	actionLimits               actionLimitsFlag
+	syncPeriod                 time.Duration
+	sweepInterval              time.Duration
+	maxBacklog                 int
+	groupSyncInterval          time.Duration
+	journalSize                int
+	shutdownTimeout            time.Duration
+	rateLimiterBaseDelay       time.Duration
+	rateLimiterMaxDelay        time.Duration
+	rateLimiterQPS             float64
+	rateLimiterBurst           int
+	logMode                    string
+	logSamplingInitial         int
+	logSamplingThereafter      int
+	opts                       zap.Options
 )
 
 func init() {
 	utilruntime.Must(clientgoscheme.AddToScheme(scheme))
+}
 
-	// CLI flags
-	flag.StringVar(&metricsAddr, "metrics-bind-address", ":8080", "The address the metric endpoint binds to.")
-	flag.StringVar(&probeAddr, "health-probe-bind-address", ":8081", "The address the probe endpoint binds to.")
-	flag.BoolVar(&enableLeaderElection, "leader-elect", false,
+// bindFlags registers the flags shared by all commands, so every command parses configuration the same way
+func bindFlags(fs *flag.FlagSet) {
+	fs.StringVar(&configFile, "config", "",
+		"Path to a YAML config file with flag values, keyed by flag name, or a reference to an AWS SSM parameter or "+
+			"Secrets Manager secret (ssm://<name>, secretsmanager://<id>). Command line flags take precedence.")
+	fs.DurationVar(&configRefreshInterval, "config-refresh-interval", time.Minute,
+		"How often to check a config stored in SSM Parameter Store or Secrets Manager for changes")
+	fs.StringVar(&metricsAddr, "metrics-bind-address", ":8080", "The address the metric endpoint binds to.")
+	fs.StringVar(&probeAddr, "health-probe-bind-address", ":8081", "The address the probe endpoint binds to.")
+	fs.BoolVar(&explainEndpoint, "explain-endpoint", false,
+		"Serve /explain/<node name> on the metrics endpoint, returning how the controller evaluates the node as JSON. "+
+			"Each request asks the cloud provider and runs the probe and verification command like a reconcile does")
+	fs.StringVar(&nodeSelector, "node-selector", "",
+		"Label selector of the nodes to manage, e.g. node.kubernetes.io/lifecycle=spot. Other nodes are never looked at")
+	fs.StringVar(&nodeFieldSelector, "node-field-selector", "",
+		"Field selector of the nodes to manage, e.g. spec.unschedulable=false. Other nodes are never looked at")
+	fs.IntVar(&shardCount, "shard-count", 1,
+		"Number of shards to split nodes into, so that as many replicas can be active at once, each managing one shard")
+	fs.IntVar(&shardIndex, "shard-index", 0,
+		"Shard of the nodes this replica manages, from 0 to -shard-count - 1. "+
+			"-1 uses the ordinal at the end of the hostname, e.g. 2 for StatefulSet pod cloud-lifecycle-controller-2")
+	fs.BoolVar(&stripCachedNodes, "strip-cached-nodes", true,
+		"Drop managed fields, container images and large annotations from cached nodes to save memory")
+	fs.BoolVar(&enableLeaderElection, "leader-elect", false,
 		"Enable leader election for controller manager. "+
 			"Enabling this will ensure there is only one active controller manager.")
-	flag.StringVar(&leaderElectionNamespace, "leader-election-namespace", "", "Namespace to use for leader election lease")
-	flag.StringVar(&cloudProvider, "cloud", "", "Cloud provider to use (aws, azure, gcs, ...)")
-	flag.StringVar(&cloudConfig, "cloud-config", "", "Path to cloud provider config file")
-	flag.BoolVar(&dryRun, "dry-run", false, "Don't actually delete anything")
-	opts = zap.Options{
-		Development: true,
+	fs.StringVar(&leaderElectionNamespace, "leader-election-namespace", "", "Namespace to use for leader election lease")
+	fs.StringVar(&leaderElectionID, "leader-election-id", "cloud-lifecycle-controller.nxtlytics.com",
+		"Name of the leader election lease. Use a different one for each instance running in the same namespace")
+	fs.StringVar(&leaderElectionLock, "leader-election-resource-lock", resourcelock.ConfigMapsLeasesResourceLock,
+		"Resource type used for leader election (leases, configmaps, endpoints, configmapsleases or endpointsleases). "+
+			"Switch from configmapsleases to leases in two steps, through a release using configmapsleases")
+	fs.DurationVar(&leaseDuration, "leader-elect-lease-duration", 15*time.Second,
+		"How long non-leader candidates wait after observing a leadership renewal before trying to take over")
+	fs.DurationVar(&renewDeadline, "leader-elect-renew-deadline", 10*time.Second,
+		"How long the leader keeps trying to renew leadership before giving it up. Must be less than the lease duration")
+	fs.DurationVar(&retryPeriod, "leader-elect-retry-period", 2*time.Second,
+		"How long candidates wait between tries to acquire or renew leadership")
+	fs.StringVar(&cloudProvider, "cloud", "",
+		"Cloud provider to use (aws, azure, gce, alicloud, bmc, digitalocean, equinixmetal, hcloud, ibm, inventory, "+
+			"libvirt, linode, maas, oci, ...)")
+	fs.StringVar(&cloudConfig, "cloud-config", "",
+		"Path to cloud provider config file, or a reference to a key in a Secret or ConfigMap "+
+			"(secret://<namespace>/<name>/<key>, configmap://<namespace>/<name>/<key>), an AWS SSM parameter "+
+			"(ssm://<name>) or a Secrets Manager secret (secretsmanager://<id>)")
+	fs.DurationVar(&cloudConfigRefreshInterval, "cloud-config-refresh-interval", time.Minute,
+		"How often to check the cloud config for changes")
+	fs.StringVar(&cloudCABundle, "cloud-ca-bundle", "",
+		"PEM file with CA certificates to trust for cloud API calls, in addition to the system's "+
+			"(aws, azure, gce, alicloud, bmc, digitalocean, equinixmetal, hcloud, ibm, linode, maas, oci)")
+	fs.DurationVar(&cloudBatchWindow, "cloud-batch-window", 100*time.Millisecond,
+		"How long instance lookups wait for others to share a bulk API call with, e.g. when many nodes fail at once. "+
+			"0 looks up each instance on its own (aws, azure, gce, alicloud)")
+	fs.DurationVar(&cloudCacheTTL, "cloud-cache-ttl", 30*time.Second,
+		"How long the cloud status of an instance is reused before it is looked up again. 0 disables caching")
+	fs.Float64Var(&cloudAPIQPS, "cloud-api-qps", 10,
+		"Most cloud API calls per second, so the controller can't use up the account's API quota. 0 disables the limit "+
+			"(aws, azure, gce, alicloud, bmc, digitalocean, equinixmetal, hcloud, ibm, linode, maas, oci)")
+	fs.IntVar(&cloudAPIBurst, "cloud-api-burst", 20, "Number of cloud API calls allowed in a burst above -cloud-api-qps")
+	fs.StringVar(&cloudZone, "zone", "",
+		"Availability zone to use for the cloud provider, instead of the one from -cloud-config or instance metadata (aws)")
+	fs.StringVar(&cloudRegion, "region", "",
+		"Region to use for the cloud provider, instead of the one from -cloud-config or instance metadata "+
+			"(aws, ibm, oci)")
+	fs.StringVar(&instanceScope, "instance-scope", "",
+		"Only reason about instances with this tag (aws, alicloud, digitalocean, equinixmetal, linode, maas, "+
+			"oci) or label (gce, hcloud), as key=value or just key, e.g. kubernetes.io/cluster/<id>=owned. Nodes whose "+
+			"instance exists without it are never acted on")
+	fs.StringVar(&clusterID, "cluster-id", "",
+		"Cluster ID used to scope cloud queries to the cluster's instances (aws). "+
+			"Discovered from the kubernetes.io/cluster/<id> instance tag if not set")
+	fs.StringVar(&awsAssumeRoleARN, "aws-assume-role-arn", "",
+		"IAM role to assume for all AWS API calls, e.g. to look up instances in another account (aws)")
+	fs.StringVar(&awsAssumeRoleExternalID, "aws-assume-role-external-id", "",
+		"External ID to pass when assuming -aws-assume-role-arn (aws)")
+	fs.Var(&awsAdditionalRegions, "aws-additional-regions",
+		"Comma separated list of other regions to look for instances in, for nodes whose provider ID has no zone (aws)")
+	fs.StringVar(&awsStateSource, "aws-state-source", "ec2",
+		"API to look up instances with: ec2 (DescribeInstances) or config (AWS Config advanced queries, which lag "+
+			"behind EC2 by a few minutes) (aws)")
+	fs.StringVar(&awsConfigAggregator, "aws-config-aggregator", "",
+		"AWS Config aggregator in the controller's region to query with -aws-state-source=config, instead of the "+
+			"recorder of each instance's region (aws)")
+	fs.StringVar(&azureEnvironment, "azure-environment", "",
+		"Azure environment to use instead of the one from -cloud-config, e.g. AzurePublicCloud, AzureChinaCloud or "+
+			"AzureUSGovernment (azure)")
+	fs.StringVar(&awsEndpointURL, "aws-endpoint-url", "",
+		"Send all AWS API calls to this endpoint, e.g. LocalStack or moto for testing (aws)")
+	fs.BoolVar(&azureUseManagedIdentity, "azure-use-managed-identity", false,
+		"Authenticate with the VM's managed identity instead of the credentials in -cloud-config (azure)")
+	fs.StringVar(&azureUserAssignedIdentity, "azure-user-assigned-identity-id", "",
+		"Client ID of the user-assigned managed identity to use with -azure-use-managed-identity (azure)")
+	fs.StringVar(&azureStateSource, "azure-state-source", "arm",
+		"API to look up instances with: arm (Microsoft.Compute) or resource-graph (Azure Resource Graph, which lags "+
+			"behind Microsoft.Compute by a few minutes) (azure)")
+	fs.StringVar(&gceCredentialsFile, "gce-credentials-file", "",
+		"Service account key file to authenticate with, instead of Application Default Credentials (gce)")
+	fs.StringVar(&gceImpersonate, "gce-impersonate-service-account", "",
+		"Email of a service account to impersonate for all compute API calls (gce)")
+	fs.StringVar(&alicloudRAMRole, "alicloud-ram-role", "",
+		"Authenticate with the credentials of this RAM role of the ECS instance, instead of the AccessKey in "+
+			"ALIBABA_CLOUD_ACCESS_KEY_ID and ALIBABA_CLOUD_ACCESS_KEY_SECRET (alicloud)")
+	fs.StringVar(&alicloudEndpoint, "alicloud-endpoint", "",
+		"ECS API endpoint to use instead of https://ecs.<region>.aliyuncs.com/, with %s for the region, e.g. "+
+			"https://ecs-vpc.%s.aliyuncs.com/ (alicloud)")
+	fs.StringVar(&ibmEndpoint, "ibm-endpoint", "",
+		"VPC API endpoint to use instead of https://<region>.iaas.cloud.ibm.com/, e.g. "+
+			"https://<region>.private.iaas.cloud.ibm.com/ (ibm)")
+	fs.StringVar(&libvirtURI, "libvirt-uri", "",
+		"libvirt connection URI to look up domains with instead of qemu:///system, e.g. "+
+			"qemu+ssh://root@kvm1/system (libvirt)")
+	fs.StringVar(&maasURL, "maas-url", "",
+		"MAAS server to look up machines with, e.g. http://maas.example.com:5240/MAAS/ (maas)")
+	fs.BoolVar(&bmcCriticalIsShutdown, "bmc-critical-health-shutdown", false,
+		"Treat powered on hosts whose Redfish system health is Critical as shut down (bmc)")
+	fs.Var(&bmcAllowedNetworks, "bmc-allowed-networks",
+		"Comma separated list of CIDRs BMC addresses must be in, e.g. the out-of-band management network. Required, "+
+			"since nodes can set their own BMC address annotation and the BMC credentials are sent to it (bmc)")
+	fs.StringVar(&vaultAddress, "vault-address", os.Getenv("VAULT_ADDR"), "Address of the Vault server to fetch cloud credentials from")
+	fs.StringVar(&vaultAuthPath, "vault-auth-path", "kubernetes", "Mount path of the Vault Kubernetes auth method")
+	fs.StringVar(&vaultRole, "vault-role", "",
+		"Vault Kubernetes auth role to log in as with the pod's service account token. Not needed if VAULT_TOKEN is set")
+	fs.StringVar(&vaultCredentialsPath, "vault-credentials-path", "",
+		"Vault path to read cloud credentials from, e.g. aws/creds/<role> or azure/creds/<role> (aws, azure). "+
+			"Leases are renewed, and the cloud provider is re-initialized with new credentials when they can't be")
+	fs.StringVar(&clusterName, "cluster-name", "", "Name of the cluster, used to tag notifications")
+	fs.BoolVar(&datadogEvents, "datadog-events", false,
+		"Post node deletions to the Datadog Events API, tagged with the cluster, pool and reason. The API key is "+
+			"read from DD_API_KEY")
+	fs.StringVar(&datadogSite, "datadog-site", notify.DefaultDatadogSite, "Datadog site to post events to, e.g. datadoghq.eu")
+	fs.StringVar(&grafanaURL, "grafana-url", "",
+		"Create a Grafana annotation for each node deletion through the API of the Grafana at this URL. The token is "+
+			"read from GRAFANA_TOKEN")
+	fs.StringVar(&grafanaDashboardUID, "grafana-dashboard-uid", "",
+		"UID of the dashboard to create -grafana-url annotations on, instead of organization-wide ones")
+	fs.StringVar(&jiraURL, "jira-url", "",
+		"Open an issue in the Jira at this URL for each node deletion that needs follow-up. The API token is read from "+
+			"JIRA_TOKEN, with JIRA_USER for basic auth")
+	fs.StringVar(&jiraProject, "jira-project", "", "Key of the Jira project to open -jira-url issues in")
+	fs.StringVar(&jiraIssueType, "jira-issue-type", notify.DefaultJiraIssueType, "Type of the -jira-url issues")
+	fs.Var(&jiraLabels, "jira-labels", "Comma separated list of labels to add to -jira-url issues")
+	fs.BoolVar(&jiraStatefulOnly, "jira-stateful-only", false,
+		"Only open -jira-url issues for nodes that ran pods with persistent volume claims")
+	fs.StringVar(&serviceNowURL, "servicenow-url", "",
+		"File a record for each node deletion in the ServiceNow instance at this URL. The credentials are read from "+
+			"SERVICENOW_USER and SERVICENOW_PASSWORD")
+	fs.StringVar(&serviceNowRecord, "servicenow-record", notify.ServiceNowIncident,
+		"Type of the -servicenow-url records: incident or change (a standard change request)")
+	fs.StringVar(&serviceNowAssignmentGroup, "servicenow-assignment-group", "",
+		"Group to assign -servicenow-url records to")
+	fs.BoolVar(&googleChat, "google-chat", false,
+		"Post a card for each node deletion to a Google Chat space. The webhook URL is read from GOOGLE_CHAT_WEBHOOK_URL")
+	fs.StringVar(&historyDriver, "history-driver", "postgres", "database/sql driver of -history-dsn. The binary includes postgres; others need a custom build")
+	fs.StringVar(&historyDSN, "history-dsn", "",
+		"Data source name of a SQL database to record every decision and deletion in, for long-term history. "+
+			"Best set with CLC_HISTORY_DSN")
+	fs.StringVar(&historyTable, "history-table", "node_events", "Table to record -history-dsn events in, created if needed. "+
+		"An identifier, optionally qualified with a schema, e.g. history.node_events")
+	fs.Var(&enabledControllerNames, "controllers",
+		"Comma separated list of controllers to run: '*' enables all, 'foo' enables the controller named foo, "+
+			"'-foo' disables it. Controllers: "+strings.Join(controllerNames(), ", ")+"; cloud-node and node-labels are only enabled by name")
+	fs.BoolVar(&dryRun, "dry-run", false, "Don't change anything, same as -dry-run-kube -dry-run-cloud")
+	fs.BoolVar(&dryRunKube, "dry-run-kube", false, "Don't change Kubernetes objects, e.g. delete nodes")
+	fs.BoolVar(&dryRunCloud, "dry-run-cloud", false, "Don't change cloud resources, i.e. "+
+		"don't delete the NodeClaims of nodes with -delete-nodeclaims, which terminates their instances")
+	fs.DurationVar(&settleInterval, "settle-interval", controllers.DefaultSettleInterval,
+		"How long to wait before re-checking a node whose cloud status isn't conclusive yet, e.g. while it shuts down")
+	fs.Float64Var(&settleJitter, "settle-jitter", 0.2,
+		"Extend each -settle-interval wait by a random amount up to this fraction of it, to spread out re-checks")
+	fs.StringVar(&settleProfileName, "settle-profile", "",
+		"How long the cloud API may take to converge after an instance goes away: aws, aws-config, azure, "+
+			"azure-resource-graph, gce or none. Shut down and missing instances are only acted on once it has. "+
+			"Defaults to the -cloud provider's, or its state source's")
+	fs.StringVar(&spotEvictionAction, "spot-eviction-action", "Delete",
+		"What to do with nodes whose spot instance was evicted (azure): Delete them without the settle profile's "+
+			"shutdown delay, GiveUp on them or leave them alone (None), e.g. for pools whose evicted VMs are restarted")
+	fs.DurationVar(&leaseMaxAge, "node-lease-max-age", 0,
+		"Don't delete a node whose lease in kube-node-lease was renewed within this duration, since its kubelet is "+
+			"still alive, e.g. 40s. 0 doesn't check leases")
+	fs.BoolVar(&deleteNodeClaims, "delete-nodeclaims", false,
+		"Delete the Karpenter NodeClaim owning a node instead of the node, so Karpenter's accounting and replacement "+
+			"logic run")
+	fs.BoolVar(&cleanUpTerminating, "clean-up-terminating-nodes", false,
+		"Instead of ignoring nodes that are already being deleted, force delete the pods stuck terminating on the dead "+
+			"ones and then delete their VolumeAttachments, so workloads and volumes can move while the node waits on "+
+			"finalizers")
+	fs.StringVar(&deleteAs, "delete-as", "",
+		"Service account to impersonate for node and NodeClaim deletions, as <namespace>/<name>, so only it needs "+
+			"permission to delete them. The controller's own identity then needs permission to impersonate it")
+	fs.IntVar(&probePort, "probe-port", 0,
+		"Don't delete a node while one of its addresses accepts TCP connections on this port, e.g. 10250 for the "+
+			"kubelet. 0 doesn't probe nodes")
+	fs.DurationVar(&probeTimeout, "probe-timeout", controllers.DefaultProbeTimeout,
+		"How long to wait for each -probe-port connection")
+	fs.StringVar(&verifyCommand, "verify-command", "",
+		"Command to run before deleting a node, which is only deleted if it exits 0. It gets NODE_NAME, "+
+			"NODE_PROVIDER_ID and NODE_ADDRESSES in its environment, and isn't run by a shell")
+	fs.DurationVar(&verifyTimeout, "verify-timeout", controllers.DefaultVerifyTimeout,
+		"How long -verify-command may run before it is killed and the node is left alone")
+	fs.DurationVar(&giveUpAfter, "give-up-after", 24*time.Hour,
+		"Stop re-checking a node whose cloud status still isn't conclusive this long after it became not ready, "+
+			"until its Ready condition changes. 0 never gives up")
+	fs.DurationVar(&unknownDeadline, "unknown-status-deadline", 0,
+		"Delete a node that has been not ready this long even though its cloud status is still unknown, e.g. because "+
+			"lookups keep failing, with a Warning event. Should be shorter than -give-up-after. 0 never does")
+	fs.DurationVar(&minNotReady, "min-not-ready", 0,
+		"Leave nodes that have been not ready for less than this alone, without asking the cloud provider, e.g. to "+
+			"ride out kubelet restarts")
+	fs.StringVar(&poolConfig, "pool-config", "",
+		"YAML file with per-pool overrides of -min-not-ready, -give-up-after, -unknown-status-deadline, "+
+			"-settle-interval, -node-lease-max-age, the settle profile and the allowed actions")
+	fs.BoolVar(&instanceConditionEnabled, "instance-condition", false,
+		"Maintain a "+string(controllers.InstanceCondition)+" condition on nodes with the cloud provider's view of "+
+			"their instance, each time a not ready node is checked")
+	fs.BoolVar(&persistState, "persist-state", false,
+		"Store what the controller remembers about nodes in their "+controllers.StateAnnotation+" annotation, so "+
+			"restarts and leader changes don't repeat GaveUpOnNode events and re-checks or forget cloud API backoffs")
+	fs.DurationVar(&shutdownTimeout, "shutdown-timeout", 30*time.Second,
+		"How long to wait for pending node deletions and events when stopping, e.g. on SIGTERM")
+	fs.DurationVar(&syncPeriod, "sync-period", 10*time.Hour,
+		"How often all nodes are re-checked even if nothing changed, to catch missed events. "+
+			"Lower values detect gone instances sooner at the cost of more cloud and API server load")
+	fs.DurationVar(&sweepInterval, "sweep-interval", 0,
+		"How often all nodes are re-checked at low priority, waiting while the work queue is backed up, to catch "+
+			"missed events without the burst of a -sync-period resync. 0 disables the sweep")
+	fs.DurationVar(&groupSyncInterval, "group-sync-interval", 0,
+		"How often to list the members of the cloud's autoscaling groups (aws, azure, gce), re-checking nodes whose "+
+			"instance left its group right away and reporting group instances without a node on /orphans on the "+
+			"metrics endpoint. 0 disables the sync")
+	fs.IntVar(&journalSize, "decision-journal-size", controllers.DefaultJournalSize,
+		"Number of recent decisions to keep in memory, served on /decisions on the metrics endpoint and dumped to "+
+			"stderr on SIGQUIT. Nodes left alone are only kept if protected or their check failed. 0 disables it")
+	fs.IntVar(&maxBacklog, "max-backlog", controllers.DefaultMaxBacklog,
+		"Number of nodes waiting to be checked above which re-checks from the sweep and other sources than node "+
+			"changes wait, highest priority first")
+	fs.IntVar(&workers, "workers", 1, "Number of nodes checked concurrently")
+	fs.IntVar(&deletionWorkers, "deletion-workers", controllers.DefaultDeletionWorkers,
+		"Number of nodes deleted concurrently. Deletions have their own workers, so they aren't held up by nodes "+
+			"waiting for cloud lookups")
+	fs.Var(&actionLimits, "action-limit",
+		"Limit of an action class on top of -deletion-workers, as <class>=qps:<per second>,burst:<n>,concurrency:<n> "+
+			"with any of the keys left out, e.g. terminate-instance=qps:0.05,concurrency:1. Classes are delete-node "+
+			"and terminate-instance (deleting a Karpenter NodeClaim with -delete-nodeclaims). Can be repeated")
+	fs.DurationVar(&startupSpread, "startup-spread", 30*time.Second,
+		"Spread the first check of each node over this window after startup or a leadership change, "+
+			"so the initial list of nodes doesn't cause a burst of cloud API calls. 0 checks all nodes at once")
+	fs.DurationVar(&rateLimiterBaseDelay, "rate-limiter-base-delay", 5*time.Millisecond,
+		"Delay before retrying a node after its first error, doubled after each further error")
+	fs.DurationVar(&rateLimiterMaxDelay, "rate-limiter-max-delay", 1000*time.Second,
+		"Maximum delay before retrying a node after errors")
+	fs.Float64Var(&rateLimiterQPS, "rate-limiter-qps", 10, "Overall rate at which nodes are retried after errors, per second")
+	fs.IntVar(&rateLimiterBurst, "rate-limiter-burst", 100, "Number of retries allowed in a burst above -rate-limiter-qps")
+	fs.BoolVar(&audit, "audit", false,
+		"Only observe: log every decision and record WouldDeleteNode events and metrics, without changing anything")
+	fs.Float64Var(&chaos, "chaos", 0,
+		"Fraction of node evaluations to fake as not ready with a shut down or missing instance, e.g. 0.05, to "+
+			"validate alerting and dashboards in staging. Requires -dry-run, -dry-run-kube or -audit")
+	fs.StringVar(&logMode, "log-mode", logModeProduction,
+		"Logging defaults: production (JSON with ISO 8601 timestamps, info level, sampled, stack traces on errors) or "+
+			"development (console, debug level, stack traces on warnings). The -zap-* flags override them")
+	fs.IntVar(&logSamplingInitial, "log-sampling-initial", 100,
+		"In production mode, number of log lines with the same level and message logged each second before the rest "+
+			"are sampled. 0 disables sampling")
+	fs.IntVar(&logSamplingThereafter, "log-sampling-thereafter", 100,
+		"In production mode, log every Nth of the log lines with the same level and message past -log-sampling-initial "+
+			"each second. Must be at least 1 when sampling is enabled")
+	opts = zap.Options{}
+	opts.BindFlags(fs)
+
+	// controller-runtime registers -kubeconfig on the global flag set
+	if f := flag.Lookup("kubeconfig"); f != nil {
+		fs.Var(f.Value, f.Name, f.Usage)
 	}
-	opts.BindFlags(flag.CommandLine)
-	flag.Parse()
+	fs.StringVar(&kubeContext, "context", "", "Name of the kubeconfig context to use, instead of the current context")
+	fs.Float64Var(&kubeAPIQPS, "kube-api-qps", 20, "Most Kubernetes API requests per second")
+	fs.IntVar(&kubeAPIBurst, "kube-api-burst", 30, "Number of Kubernetes API requests allowed in a burst above -kube-api-qps")
+	fs.Int64Var(&listPageSize, "list-page-size", 500,
+		"Number of nodes per page when listing nodes from etcd. 0 lists all nodes in one request")
+	fs.DurationVar(&watchTimeout, "watch-timeout", 0,
+		"How long each watch of nodes lasts before it is restarted. 0 uses a random duration between 5 and 10 minutes")
 }
 
-func main() {
-	ctrl.SetLogger(zap.New(zap.UseFlagOptions(&opts)))
-
-	ctrlOpts := ctrl.Options{
-		Scheme:                  scheme,
-		MetricsBindAddress:      metricsAddr,
-		Port:                    9443,
-		HealthProbeBindAddress:  probeAddr,
-		LeaderElection:          enableLeaderElection,
-		LeaderElectionID:        "cloud-lifecycle-controller.nxtlytics.com",
-		LeaderElectionNamespace: leaderElectionNamespace,
-		DryRunClient:            dryRun,
-	}
-	mgr, err := ctrl.NewManager(ctrl.GetConfigOrDie(), ctrlOpts)
+// actionLimitsFlag is a repeatable flag of controllers.ActionLimits, one action class each
+type actionLimitsFlag struct {
+	limits controllers.ActionLimits
+}
+
+func (f *actionLimitsFlag) String() string {
+	return f.limits.String()
+}
+
+func (f *actionLimitsFlag) Set(value string) error {
+	class, limit, err := controllers.ParseActionLimit(value)
 	if err != nil {
-		setupLog.Error(err, "unable to start manager")
-		os.Exit(1)
+		return err
+	}
+	if f.limits == nil {
+		f.limits = controllers.ActionLimits{}
 	}
+	f.limits[class] = limit
+	return nil
+}
 
-	var cloudConfigReader io.Reader
-	if cloudProvider == "aws" && cloudConfig == "" {
-		cloudConfigReader = strings.NewReader(awsConfig())
-	} else if cloudConfig != "" {
-		// read the cloud config file from disk per usual
-		cloudConfigReader, err = os.Open(cloudConfig)
-		if err != nil {
-			setupLog.Error(err, "Unable to read cloud provider configuration", "config", cloudConfig)
-			os.Exit(1)
+// stringList is a flag holding a comma separated list of values
+type stringList []string
+
+func (l *stringList) String() string {
+	return strings.Join(*l, ",")
+}
+
+func (l *stringList) Set(value string) error {
+	*l = nil
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			*l = append(*l, item)
+		}
+	}
+	return nil
+}
+
+// command is a subcommand of the binary
+type command struct {
+	name        string
+	description string
+	run         func(ctx context.Context, args []string) error
+}
+
+var commands = []command{
+	{name: "run", description: "Run the controller (default)", run: runCommand},
+	{name: "check-node", description: "Print what the controller would do with a single node", run: checkNodeCommand},
+	{name: "simulate", description: "Print what the controller would do with every node in the cluster", run: simulateCommand},
+	{name: "validate-config", description: "Check the configuration, cloud credentials and RBAC permissions", run: validateConfigCommand},
+	{name: "version", description: "Print version information", run: versionCommand},
+}
+
+func main() {
+	name, args := "run", os.Args[1:]
+	if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		name, args = args[0], args[1:]
+	}
+
+	if name == "help" {
+		usage()
+		return
+	}
+
+	for _, cmd := range commands {
+		if cmd.name != name {
+			continue
 		}
-	} else {
-		// no cloud config specified, no zone override... let the library automatically init, and propagagte errors up
-		setupLog.Info("Proceeding without cloud config, relying on underlying cloud library for init")
+		if err := cmd.run(ctrl.SetupSignalHandler(), args); err != nil {
+			kind, code := exitCode(err)
+			setupLog.Error(err, "Command failed", "command", name, "kind", kind, "exitCode", code)
+			os.Exit(code)
+		}
+		return
 	}
 
-	cloud, err := cloudprovider.GetCloudProvider(cloudProvider, cloudConfigReader)
+	fmt.Fprintf(os.Stderr, "Unknown command %q\n\n", name)
+	usage()
+	os.Exit(exitUsage)
+}
+
+func usage() {
+	fmt.Fprintf(os.Stderr, "Usage: %s [command] [flags]\n\nCommands:\n", programName)
+	for _, cmd := range commands {
+		fmt.Fprintf(os.Stderr, "  %-16s %s\n", cmd.name, cmd.description)
+	}
+	fmt.Fprintf(os.Stderr, "\nRun '%s <command> -h' for the flags of a command.\n", programName)
+}
+
+// parseFlags parses the shared flags plus any registered by extra, loads the environment and config file,
+// and sets up logging. The returned config file values are nil if no config file is used.
+func parseFlags(name string, args []string, extra func(fs *flag.FlagSet)) (*flag.FlagSet, config.Values, error) {
+	fs := flag.NewFlagSet(programName+" "+name, flag.ExitOnError)
+	bindFlags(fs)
+	if extra != nil {
+		extra(fs)
+	}
+	_ = fs.Parse(args) // ExitOnError
+
+	fileValues, configErr := loadConfig(fs)
+	if dryRun || audit {
+		dryRunKube, dryRunCloud = true, true
+	}
+
+	logLevel = newLogLevel()
+	logger, logErr := newLogger()
+	ctrl.SetLogger(logger)
+
+	if configErr != nil {
+		return nil, nil, configError(fmt.Errorf("unable to load configuration: %w", configErr))
+	}
+	if logErr != nil {
+		return nil, nil, configError(logErr)
+	}
+	return fs, fileValues, nil
+}
+
+// reloadableFlags can be changed in the config file without restarting the controller
+var reloadableFlags = map[string]bool{
+	"zap-log-level": true,
+}
+
+var logLevel uberzap.AtomicLevel
+
+// overridden holds the flags set on the command line or in the environment, which the config file can't change
+var overridden map[string]bool
+
+// loadConfig applies environment variables and the config file (if any) to the flags,
+// in order of precedence: command line flags > environment variables > config file
+func loadConfig(fs *flag.FlagSet) (config.Values, error) {
+	overridden = config.SetFlags(fs)
+	env := config.Environ(fs)
+	if err := config.Apply(fs, env, overridden); err != nil {
+		return nil, err
+	}
+	for key := range env {
+		overridden[key] = true
+	}
+
+	if configFile == "" {
+		return nil, nil
+	}
+	source, err := configSource()
+	if err != nil {
+		return nil, err
+	}
+	data, err := source.Read(context.Background(), nil)
+	if err != nil {
+		return nil, err
+	}
+	values, err := config.Parse(data)
 	if err != nil {
-		setupLog.Error(err, "Unable to initialize cloud provider", "provider", cloudProvider)
-		os.Exit(1)
+		return nil, err
 	}
+	return values, config.Apply(fs, values, overridden)
+}
 
-	instances, success := cloud.Instances()
-	if !success {
-		setupLog.Error(err, "Unable to set up cloud instances provider")
-		os.Exit(1)
+// configSource returns the source of the -config file. Secrets and ConfigMaps aren't supported, as the config file
+// is read before the Kubernetes client is set up; mount them as files instead.
+func configSource() (config.Source, error) {
+	source, err := config.ParseSource(configFile)
+	if err != nil {
+		return source, err
+	}
+	if source.InCluster() {
+		return source, fmt.Errorf("config %s can't be read from the cluster, mount it as a file instead", source)
 	}
+	return source, nil
+}
 
-	nodeReconciler := &controllers.NodeReconciler{
-		Recorder:       mgr.GetEventRecorderFor("cloud-lifecycle-controller"),
-		Client:         mgr.GetClient(),
-		CloudInstances: instances,
-		Log:            ctrl.Log.WithName("controllers").WithName("Node"),
-		Scheme:         mgr.GetScheme(),
-		DryRun:         dryRun,
+// watchConfig hot-reloads the settings in reloadableFlags whenever the config file changes.
+// Changes to any other setting are only logged, as they require a restart to take effect.
+// Config files in SSM Parameter Store or Secrets Manager are checked every -config-refresh-interval.
+func watchConfig(ctx context.Context, current config.Values) error {
+	log := ctrl.Log.WithName("config")
+	onChange := func(values config.Values) {
+		for _, key := range values.Changed(current) {
+			switch {
+			case overridden[key]:
+				log.Info("Ignoring config change for flag set on the command line or environment", "key", key)
+			case !reloadableFlags[key]:
+				log.Info("Config change requires a restart to take effect", "key", key)
+			case key == "zap-log-level":
+				if err := setLogLevel(values[key]); err != nil {
+					log.Error(err, "Invalid log level in config file", "value", values[key])
+					continue
+				}
+				log.Info("Reloaded log level", "level", values[key])
+			}
+		}
+		current = values
 	}
-	if err = nodeReconciler.SetupWithManager(mgr); err != nil {
-		setupLog.Error(err, "unable to create controller", "controller", "Node")
-		os.Exit(1)
+
+	source, err := configSource()
+	if err != nil {
+		return err
+	}
+	if source.Kind == config.SourceFile {
+		return config.Watch(ctx, configFile, log, onChange)
 	}
 
-	if err := mgr.AddHealthzCheck("healthz", healthz.Ping); err != nil {
-		setupLog.Error(err, "unable to set up health check")
-		os.Exit(1)
+	data, err := source.Read(ctx, nil)
+	if err != nil {
+		return err
 	}
-	if err := mgr.AddReadyzCheck("readyz", healthz.Ping); err != nil {
-		setupLog.Error(err, "unable to set up ready check")
-		os.Exit(1)
+	go config.PollSource(ctx, source, nil, configRefreshInterval, data, log, func(data []byte) error {
+		values, err := config.Parse(data)
+		if err != nil {
+			return err
+		}
+		onChange(values)
+		return nil
+	})
+	return nil
+}
+
+// restConfig returns the Kubernetes client config from -kubeconfig and -context, $KUBECONFIG, the in-cluster config
+// or ~/.kube/config, in that order, with the client rate limits from -kube-api-qps and -kube-api-burst
+func restConfig() (*rest.Config, error) {
+	cfg, err := clientconfig.GetConfigWithContext(kubeContext)
+	if err != nil {
+		return nil, err
 	}
+	cfg.QPS = float32(kubeAPIQPS)
+	cfg.Burst = kubeAPIBurst
+	return cfg, nil
+}
 
-	setupLog.Info("starting manager")
-	if err := mgr.Start(ctrl.SetupSignalHandler()); err != nil {
-		setupLog.Error(err, "problem running manager")
-		os.Exit(1)
+// newLogLevel returns an adjustable log level, initialized from the zap flags
+func newLogLevel() uberzap.AtomicLevel {
+	if level, ok := opts.Level.(uberzap.AtomicLevel); ok {
+		return level
 	}
+	if developmentLogging() {
+		return uberzap.NewAtomicLevelAt(zapcore.DebugLevel)
+	}
+	return uberzap.NewAtomicLevelAt(zapcore.InfoLevel)
 }
 
-// awsConfig is basically just a mock config so aws will continue without a config.
-func awsConfig() string {
-	return `
-[global]
-zone=
-KubernetesClusterID=FakeClusterID
-VPC=FakeVPC
-SubnetID=FakeSubnet
-`
+// setLogLevel parses level the same way as the -zap-log-level flag and applies it to the running logger
+func setLogLevel(level string) error {
+	var parsed zap.Options
+	fs := flag.NewFlagSet("log-level", flag.ContinueOnError)
+	parsed.BindFlags(fs)
+	if err := fs.Set("zap-log-level", level); err != nil {
+		return err
+	}
+	logLevel.SetLevel(parsed.Level.(uberzap.AtomicLevel).Level())
+	return nil
 }
@@ -0,0 +1,107 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/nxtlytics/cloud-lifecycle-controller/pkg/notify"
+	"sigs.k8s.io/controller-runtime/pkg/manager"
+
+	ctrl "sigs.k8s.io/controller-runtime"
+
+	// the PostgreSQL driver for -history-dsn
+	_ "github.com/lib/pq"
+)
+
+// newNotifier returns the notifier for the integrations enabled with flags, added to the manager, or nil if none is
+func newNotifier(mgr manager.Manager) (notify.Notifier, error) {
+	notifiers := map[string]notify.Notifier{}
+
+	if datadogEvents {
+		apiKey := os.Getenv("DD_API_KEY")
+		if apiKey == "" {
+			return nil, configError(errors.New("-datadog-events needs a Datadog API key in DD_API_KEY"))
+		}
+		notifiers["datadog"] = &notify.Datadog{Site: datadogSite, APIKey: apiKey}
+	}
+
+	if grafanaURL != "" {
+		token := os.Getenv("GRAFANA_TOKEN")
+		if token == "" {
+			return nil, configError(errors.New("-grafana-url needs a Grafana service account token in GRAFANA_TOKEN"))
+		}
+		notifiers["grafana"] = &notify.Grafana{URL: grafanaURL, Token: token, DashboardUID: grafanaDashboardUID}
+	}
+
+	if jiraURL != "" {
+		token := os.Getenv("JIRA_TOKEN")
+		if token == "" || jiraProject == "" {
+			return nil, configError(errors.New("-jira-url needs -jira-project and a Jira API token in JIRA_TOKEN"))
+		}
+		notifiers["jira"] = &notify.Jira{URL: jiraURL, User: os.Getenv("JIRA_USER"), Token: token,
+			Project: jiraProject, IssueType: jiraIssueType, Labels: jiraLabels, StatefulOnly: jiraStatefulOnly}
+	}
+
+	if serviceNowURL != "" {
+		user, password := os.Getenv("SERVICENOW_USER"), os.Getenv("SERVICENOW_PASSWORD")
+		if user == "" || password == "" {
+			return nil, configError(errors.New("-servicenow-url needs credentials in SERVICENOW_USER and SERVICENOW_PASSWORD"))
+		}
+		if serviceNowRecord != notify.ServiceNowIncident && serviceNowRecord != notify.ServiceNowChange {
+			return nil, configError(fmt.Errorf("invalid -servicenow-record %q: must be %s or %s",
+				serviceNowRecord, notify.ServiceNowIncident, notify.ServiceNowChange))
+		}
+		notifiers["servicenow"] = &notify.ServiceNow{URL: serviceNowURL, User: user, Password: password,
+			RecordType: serviceNowRecord, AssignmentGroup: serviceNowAssignmentGroup}
+	}
+
+	if googleChat {
+		webhookURL := os.Getenv("GOOGLE_CHAT_WEBHOOK_URL")
+		if webhookURL == "" {
+			return nil, configError(errors.New("-google-chat needs a Google Chat webhook URL in GOOGLE_CHAT_WEBHOOK_URL"))
+		}
+		notifiers["google-chat"] = &notify.GoogleChat{WebhookURL: webhookURL}
+	}
+
+	if historyDSN != "" {
+		db, err := sql.Open(historyDriver, historyDSN)
+		if err != nil {
+			// drivers register themselves when imported; only postgres is linked into the binary
+			return nil, configError(fmt.Errorf("unable to open -history-dsn with driver %q (available: %s): %w",
+				historyDriver, strings.Join(sql.Drivers(), ", "), err))
+		}
+		history, err := notify.NewSQL(db, historyTable)
+		if err != nil {
+			return nil, configError(fmt.Errorf("invalid -history-table: %w", err))
+		}
+		notifiers["history"] = history
+	}
+
+	if len(notifiers) == 0 {
+		return nil, nil
+	}
+	dispatcher := notify.NewDispatcher(clusterName, notifiers, ctrl.Log.WithName("notify"))
+	if err := mgr.Add(dispatcher); err != nil {
+		return nil, fmt.Errorf("unable to add notifier: %w", err)
+	}
+	return dispatcher, nil
+}
@@ -0,0 +1,44 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/nxtlytics/cloud-lifecycle-controller/controllers"
+)
+
+// orphansPath is where the metrics server serves the autoscaling group instances without a node
+const orphansPath = "/orphans"
+
+// orphansHandler serves the autoscaling group instances that have been without a node for a while, as of the last
+// group sync, as JSON
+func orphansHandler(reconciler *controllers.NodeReconciler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		orphans := reconciler.Orphans()
+		if orphans == nil {
+			orphans = []controllers.Orphan{}
+		}
+		w.Header().Set("Content-Type", "application/json")
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(orphans); err != nil {
+			setupLog.Error(err, "Unable to write orphans")
+		}
+	})
+}
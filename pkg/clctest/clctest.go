@@ -0,0 +1,158 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package clctest helps teams embedding the node controller test their wiring without a cluster or a cloud provider.
+// An Env is a NodeReconciler backed by a fake client, a scripted cloud and a recording event recorder:
+//
+//	env := clctest.New(clctest.Node("node-1", "aws:///us-east-1a/i-1", corev1.ConditionUnknown, time.Hour))
+//	env.Cloud.Script("aws:///us-east-1a/i-1", fake.Running, fake.Stopped, fake.Gone)
+//	_, err := env.Drive(ctx, "node-1", 5)
+//	exists, err := env.NodeExists(ctx, "node-1")
+package clctest
+
+import (
+	"context"
+
+	"github.com/go-logr/logr"
+	"github.com/nxtlytics/cloud-lifecycle-controller/controllers"
+	"github.com/nxtlytics/cloud-lifecycle-controller/pkg/cloud/fake"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	ctrl "sigs.k8s.io/controller-runtime"
+	fakeclient "sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+// Env is a node controller wired to fakes. Its reconciler's fields, e.g. DryRun, Pools or MinNotReady, can be changed
+// before reconciling, like the options of nodecleanup.New.
+//
+// controller-runtime's fake client doesn't support server-side apply, so the fake client of New turns the apply
+// patches of PersistState and InstanceCondition into strategic merge patches. Those merge the fields they set into the
+// node like server-side apply does, but don't track field managers or remove fields the controller stopped setting;
+// use NewWithClient with an envtest API server to test those.
+type Env struct {
+	// Client is the client holding the cluster's objects, a fake one unless the Env was made by NewWithClient
+	Client client.Client
+	// Cloud is the scripted cloud; instances without a script don't exist
+	Cloud *fake.Instances
+	// Recorder records the events of the reconciler
+	Recorder *Recorder
+	// Reconciler is the node controller under test
+	Reconciler *controllers.NodeReconciler
+}
+
+// New returns an Env whose fake client holds objs
+func New(objs ...client.Object) *Env {
+	return NewWithClient(applyClient{
+		Client: fakeclient.NewClientBuilder().WithScheme(clientgoscheme.Scheme).WithObjects(objs...).Build(),
+	})
+}
+
+// NewWithClient returns an Env whose reconciler reads and deletes objects with c, e.g. a client of an envtest API
+// server
+func NewWithClient(c client.Client) *Env {
+	env := &Env{
+		Client:   c,
+		Cloud:    fake.New(),
+		Recorder: NewRecorder(),
+	}
+	env.Reconciler = &controllers.NodeReconciler{
+		Client:         c,
+		Recorder:       env.Recorder,
+		CloudInstances: env.Cloud,
+		Log:            logr.Discard(),
+		Scheme:         clientgoscheme.Scheme,
+		APIReader:      c,
+	}
+	return env
+}
+
+// Reconcile reconciles the named node once
+func (e *Env) Reconcile(ctx context.Context, name string) (ctrl.Result, error) {
+	return e.Reconciler.Reconcile(ctx, ctrl.Request{NamespacedName: types.NamespacedName{Name: name}})
+}
+
+// Drive reconciles the named node until a reconcile neither fails nor asks to be requeued, at most max times, and
+// returns the last result. Requeue delays aren't waited for, so each reconcile plays the next step of the cloud's
+// script.
+func (e *Env) Drive(ctx context.Context, name string, max int) (ctrl.Result, error) {
+	var result ctrl.Result
+	var err error
+	for i := 0; i < max; i++ {
+		result, err = e.Reconcile(ctx, name)
+		if err == nil && !result.Requeue && result.RequeueAfter == 0 {
+			break
+		}
+	}
+	return result, err
+}
+
+// NodeExists returns true if the named node is still in the fake client
+func (e *Env) NodeExists(ctx context.Context, name string) (bool, error) {
+	err := e.Client.Get(ctx, types.NamespacedName{Name: name}, &corev1.Node{})
+	if apierrors.IsNotFound(err) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// applyClient is a client that makes server-side apply patches strategic merge patches, for the fake client
+type applyClient struct {
+	client.Client
+}
+
+// Patch implements client.Writer
+func (c applyClient) Patch(ctx context.Context, obj client.Object, patch client.Patch, opts ...client.PatchOption) error {
+	patch, err := strategicMerge(obj, patch)
+	if err != nil {
+		return err
+	}
+	return c.Client.Patch(ctx, obj, patch, opts...)
+}
+
+// Status implements client.StatusClient
+func (c applyClient) Status() client.StatusWriter {
+	return applyStatusWriter{StatusWriter: c.Client.Status()}
+}
+
+// applyStatusWriter is applyClient for the status subresource
+type applyStatusWriter struct {
+	client.StatusWriter
+}
+
+// Patch implements client.StatusWriter
+func (w applyStatusWriter) Patch(ctx context.Context, obj client.Object, patch client.Patch, opts ...client.PatchOption) error {
+	patch, err := strategicMerge(obj, patch)
+	if err != nil {
+		return err
+	}
+	return w.StatusWriter.Patch(ctx, obj, patch, opts...)
+}
+
+// strategicMerge returns an apply patch as a strategic merge patch, and other patches as they are
+func strategicMerge(obj client.Object, patch client.Patch) (client.Patch, error) {
+	if patch.Type() != types.ApplyPatchType {
+		return patch, nil
+	}
+	data, err := patch.Data(obj)
+	if err != nil {
+		return nil, err
+	}
+	return client.RawPatch(types.StrategicMergePatchType, data), nil
+}
@@ -0,0 +1,59 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package clctest
+
+import (
+	"time"
+
+	"k8s.io/apimachinery/pkg/types"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// Node returns a node with the provider ID whose Ready condition has had the given status for the given time
+func Node(name, providerID string, ready corev1.ConditionStatus, since time.Duration) *corev1.Node {
+	transition := metav1.NewTime(time.Now().Add(-since))
+	return &corev1.Node{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:              name,
+			UID:               types.UID("uid-" + name),
+			CreationTimestamp: transition,
+			Labels:            map[string]string{},
+			Annotations:       map[string]string{},
+		},
+		Spec: corev1.NodeSpec{ProviderID: providerID},
+		Status: corev1.NodeStatus{
+			Conditions: []corev1.NodeCondition{{
+				Type:               corev1.NodeReady,
+				Status:             ready,
+				LastHeartbeatTime:  transition,
+				LastTransitionTime: transition,
+			}},
+		},
+	}
+}
+
+// ReadyNode returns a node that has been ready for an hour
+func ReadyNode(name, providerID string) *corev1.Node {
+	return Node(name, providerID, corev1.ConditionTrue, time.Hour)
+}
+
+// NotReadyNode returns a node whose kubelet stopped reporting (Ready Unknown) the given time ago
+func NotReadyNode(name, providerID string, since time.Duration) *corev1.Node {
+	return Node(name, providerID, corev1.ConditionUnknown, since)
+}
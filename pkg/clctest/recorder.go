@@ -0,0 +1,102 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package clctest
+
+import (
+	"fmt"
+	"sync"
+
+	"k8s.io/apimachinery/pkg/runtime"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+// Event is an event recorded by a Recorder
+type Event struct {
+	// Object is the name of the object the event is about, e.g. the node
+	Object  string
+	Type    string
+	Reason  string
+	Message string
+}
+
+// Recorder is a record.EventRecorder that keeps the events it is given, for tests to inspect
+type Recorder struct {
+	mu     sync.Mutex
+	events []Event
+}
+
+// NewRecorder returns a Recorder with no events
+func NewRecorder() *Recorder {
+	return &Recorder{}
+}
+
+// Event implements record.EventRecorder
+func (r *Recorder) Event(object runtime.Object, eventType, reason, message string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.events = append(r.events, Event{Object: objectName(object), Type: eventType, Reason: reason, Message: message})
+}
+
+// Eventf implements record.EventRecorder
+func (r *Recorder) Eventf(object runtime.Object, eventType, reason, messageFmt string, args ...interface{}) {
+	r.Event(object, eventType, reason, fmt.Sprintf(messageFmt, args...))
+}
+
+// AnnotatedEventf implements record.EventRecorder; the annotations are dropped
+func (r *Recorder) AnnotatedEventf(object runtime.Object, _ map[string]string, eventType, reason, messageFmt string,
+	args ...interface{}) {
+	r.Eventf(object, eventType, reason, messageFmt, args...)
+}
+
+// Events returns the events recorded so far, oldest first
+func (r *Recorder) Events() []Event {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]Event(nil), r.events...)
+}
+
+// Reasons returns the reasons of the events recorded so far for the named object, oldest first, e.g.
+// [DeletingNode]
+func (r *Recorder) Reasons(name string) []string {
+	var reasons []string
+	for _, event := range r.Events() {
+		if event.Object == name {
+			reasons = append(reasons, event.Reason)
+		}
+	}
+	return reasons
+}
+
+// Reset forgets the events recorded so far
+func (r *Recorder) Reset() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.events = nil
+}
+
+// objectName returns the name of the object an event is about; the node controller records events about object
+// references
+func objectName(object runtime.Object) string {
+	switch o := object.(type) {
+	case *corev1.ObjectReference:
+		return o.Name
+	case interface{ GetName() string }:
+		return o.GetName()
+	}
+	return ""
+}
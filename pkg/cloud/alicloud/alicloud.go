@@ -0,0 +1,285 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package alicloud implements the cloud.Instances interface for Alibaba Cloud ECS instances.
+package alicloud
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/nxtlytics/cloud-lifecycle-controller/pkg/cloud"
+)
+
+// Config is the Alibaba Cloud configuration. It is set from flags and the environment; the Alibaba Cloud cloud
+// controller manager's cloud config isn't used.
+type Config struct {
+	// Auth selects the credentials
+	Auth AuthOptions
+	// APIEndpoint replaces the region's ECS endpoint, https://ecs.<region>.aliyuncs.com/, e.g. for VPC endpoints.
+	// It may hold a %s for the region.
+	APIEndpoint string
+	// HTTPClient is used for all API and metadata requests if set, e.g. to trust a custom CA bundle
+	HTTPClient *http.Client
+	// BatchWindow is how long lookups wait for lookups of other instances in the same region, so they can share a
+	// single DescribeInstances call. Zero looks up each instance on its own.
+	BatchWindow time.Duration
+	// Scope is the tag instances must have. Lookups of instances without it fail with a cloud.OutOfScopeError.
+	Scope cloud.Scope
+}
+
+// Instances looks up ECS instances by provider ID (alicloud://<region>.<instance id>) with DescribeInstances
+type Instances struct {
+	client      *http.Client
+	credentials *credentialsProvider
+	endpoint    string
+	scope       cloud.Scope
+	batcher     *cloud.Batcher
+}
+
+// describeBatchSize is the most instance IDs DescribeInstances accepts
+const describeBatchSize = 100
+
+// New creates an Instances for the given config
+func New(cfg *Config) (*Instances, error) {
+	client := cfg.HTTPClient
+	if client == nil {
+		client = http.DefaultClient
+	}
+	creds, err := newCredentialsProvider(cfg.Auth, client)
+	if err != nil {
+		return nil, err
+	}
+	endpoint := cfg.APIEndpoint
+	if endpoint == "" {
+		endpoint = "https://ecs.%s.aliyuncs.com/"
+	}
+	i := &Instances{
+		client:      client,
+		credentials: creds,
+		endpoint:    endpoint,
+		scope:       cfg.Scope,
+	}
+	i.batcher = cloud.NewBatcher(cfg.BatchWindow, describeBatchSize, i.describeInstances)
+	return i, nil
+}
+
+// ecsInstance is the subset of an instance the controller uses
+type ecsInstance struct {
+	InstanceID string `json:"InstanceId"`
+	// Status is Pending, Starting, Running, Stopping or Stopped
+	Status       string `json:"Status"`
+	InstanceType string `json:"InstanceType"`
+	ZoneID       string `json:"ZoneId"`
+	RegionID     string `json:"RegionId"`
+	Tags         struct {
+		Tag []struct {
+			Key   string `json:"TagKey"`
+			Value string `json:"TagValue"`
+		} `json:"Tag"`
+	} `json:"Tags"`
+}
+
+// tags returns the instance's tags as a map
+func (e *ecsInstance) tags() map[string]string {
+	tags := make(map[string]string, len(e.Tags.Tag))
+	for _, tag := range e.Tags.Tag {
+		tags[tag.Key] = tag.Value
+	}
+	return tags
+}
+
+// getInstance returns the instance of a provider ID, or nil if it doesn't exist
+func (i *Instances) getInstance(ctx context.Context, providerID string) (*ecsInstance, error) {
+	inst, err := parseProviderID(providerID)
+	if err != nil {
+		return nil, err
+	}
+	found, err := i.batcher.Get(ctx, inst.Region, inst.ID)
+	if err != nil || found == nil {
+		return nil, err
+	}
+	if !i.scope.Allows(found.(*ecsInstance).tags()) {
+		return nil, &cloud.OutOfScopeError{ProviderID: providerID, Scope: i.scope}
+	}
+	return found.(*ecsInstance), nil
+}
+
+// describeInstancesResponse is the response of DescribeInstances
+type describeInstancesResponse struct {
+	Instances struct {
+		Instance []*ecsInstance `json:"Instance"`
+	} `json:"Instances"`
+}
+
+// describeInstances returns the instances with the given IDs in a region, keyed by ID. Released instances aren't
+// returned.
+func (i *Instances) describeInstances(ctx context.Context, region string, ids []string) (map[string]interface{}, error) {
+	idList, _ := json.Marshal(ids)
+	params := url.Values{
+		"Action":      {"DescribeInstances"},
+		"Version":     {"2014-05-26"},
+		"RegionId":    {region},
+		"InstanceIds": {string(idList)},
+		"PageSize":    {fmt.Sprint(describeBatchSize)},
+	}
+	resp := &describeInstancesResponse{}
+	if err := i.call(ctx, region, params, resp); err != nil {
+		return nil, err
+	}
+	found := map[string]interface{}{}
+	for _, inst := range resp.Instances.Instance {
+		found[inst.InstanceID] = inst
+	}
+	return found, nil
+}
+
+// call sends a signed ECS RPC request to the region's endpoint and decodes the response into into
+func (i *Instances) call(ctx context.Context, region string, params url.Values, into interface{}) error {
+	creds, err := i.credentials.get(ctx)
+	if err != nil {
+		return err
+	}
+	nonce := make([]byte, 16)
+	if _, err := rand.Read(nonce); err != nil {
+		return err
+	}
+	params.Set("Format", "JSON")
+	params.Set("AccessKeyId", creds.AccessKeyID)
+	params.Set("SignatureMethod", "HMAC-SHA1")
+	params.Set("SignatureVersion", "1.0")
+	params.Set("SignatureNonce", hex.EncodeToString(nonce))
+	params.Set("Timestamp", time.Now().UTC().Format("2006-01-02T15:04:05Z"))
+	if creds.SecurityToken != "" {
+		params.Set("SecurityToken", creds.SecurityToken)
+	}
+	params.Set("Signature", sign(http.MethodGet, params, creds.AccessKeySecret))
+
+	endpoint := i.endpoint
+	if strings.Contains(endpoint, "%s") {
+		endpoint = fmt.Sprintf(endpoint, region)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint+"?"+params.Encode(), nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("User-Agent", "cloud-lifecycle-controller")
+
+	resp, err := i.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if err := checkResponse(resp, "calling "+params.Get("Action")+" in "+region); err != nil {
+		return err
+	}
+	if err := json.NewDecoder(resp.Body).Decode(into); err != nil {
+		return fmt.Errorf("unable to decode %s response: %w", params.Get("Action"), err)
+	}
+	return nil
+}
+
+// sign returns the signature of an RPC request, as described in
+// https://www.alibabacloud.com/help/en/ecs/developer-reference/request-signatures
+func sign(method string, params url.Values, secret string) string {
+	keys := make([]string, 0, len(params))
+	for key := range params {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	pairs := make([]string, 0, len(keys))
+	for _, key := range keys {
+		pairs = append(pairs, percentEncode(key)+"="+percentEncode(params.Get(key)))
+	}
+	stringToSign := method + "&" + percentEncode("/") + "&" + percentEncode(strings.Join(pairs, "&"))
+
+	mac := hmac.New(sha1.New, []byte(secret+"&"))
+	mac.Write([]byte(stringToSign))
+	return base64.StdEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// percentEncode encodes s as RFC 3986 requires, which the signature is computed over
+func percentEncode(s string) string {
+	s = url.QueryEscape(s)
+	s = strings.ReplaceAll(s, "+", "%20")
+	s = strings.ReplaceAll(s, "*", "%2A")
+	return strings.ReplaceAll(s, "%7E", "~")
+}
+
+// apiError is the error body of the ECS API
+type apiError struct {
+	Code string `json:"Code"`
+}
+
+// checkResponse returns an error for responses other than 200 OK, telling throttling and credential errors apart by
+// their error code, since the API returns them with other statuses than 429 and 401
+func checkResponse(resp *http.Response, action string) error {
+	err := cloud.CheckResponse(resp, action)
+	statusErr, ok := err.(*cloud.StatusError)
+	if !ok {
+		return err
+	}
+	parsed := &apiError{}
+	_ = json.Unmarshal(statusErr.Body, parsed)
+	switch {
+	case strings.HasPrefix(parsed.Code, "Throttling"):
+		return &cloud.ThrottlingError{Err: statusErr}
+	case strings.HasPrefix(parsed.Code, "InvalidAccessKeyId"), strings.HasPrefix(parsed.Code, "InvalidSecurityToken"),
+		parsed.Code == "SignatureDoesNotMatch":
+		return &cloud.CredentialsError{Err: statusErr}
+	}
+	return err
+}
+
+// InstanceExistsByProviderID returns true if the instance exists, i.e. hasn't been released. Stopped instances still
+// exist.
+func (i *Instances) InstanceExistsByProviderID(ctx context.Context, providerID string) (bool, error) {
+	inst, err := i.getInstance(ctx, providerID)
+	return inst != nil, err
+}
+
+// InstanceShutdownByProviderID returns true if the instance is stopping or stopped
+func (i *Instances) InstanceShutdownByProviderID(ctx context.Context, providerID string) (bool, error) {
+	inst, err := i.getInstance(ctx, providerID)
+	if err != nil || inst == nil {
+		return false, err
+	}
+	return inst.Status == "Stopping" || inst.Status == "Stopped", nil
+}
+
+// InstanceMetadataByProviderID implements cloud.MetadataGetter
+func (i *Instances) InstanceMetadataByProviderID(ctx context.Context, providerID string) (*cloud.Metadata, error) {
+	inst, err := i.getInstance(ctx, providerID)
+	if err != nil || inst == nil {
+		return nil, err
+	}
+	return &cloud.Metadata{
+		InstanceType: inst.InstanceType,
+		Zone:         inst.ZoneID,
+		Region:       inst.RegionID,
+	}, nil
+}
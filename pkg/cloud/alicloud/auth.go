@@ -0,0 +1,107 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package alicloud
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/nxtlytics/cloud-lifecycle-controller/pkg/cloud"
+)
+
+// metadataEndpoint is the ECS instance metadata service, which serves the credentials of the instance's RAM role
+const metadataEndpoint = "http://100.100.100.200/latest/meta-data/ram/security-credentials/"
+
+// AuthOptions selects the credentials ECS is called with
+type AuthOptions struct {
+	// AccessKeyID and AccessKeySecret are a RAM user's AccessKey, with SecurityToken if they are STS credentials
+	AccessKeyID     string
+	AccessKeySecret string
+	SecurityToken   string
+	// RAMRole, if set, uses the credentials of the ECS instance's RAM role with this name instead, from the instance
+	// metadata service. They are refreshed before they expire.
+	RAMRole string
+}
+
+// credentials are the credentials of a signed request
+type credentials struct {
+	AccessKeyID     string `json:"AccessKeyId"`
+	AccessKeySecret string `json:"AccessKeySecret"`
+	SecurityToken   string `json:"SecurityToken"`
+	Expiration      time.Time
+}
+
+// credentialsProvider returns the credentials to sign requests with
+type credentialsProvider struct {
+	client  *http.Client
+	static  *credentials
+	ramRole string
+
+	mu     sync.Mutex
+	cached *credentials
+}
+
+func newCredentialsProvider(auth AuthOptions, client *http.Client) (*credentialsProvider, error) {
+	if auth.RAMRole != "" {
+		return &credentialsProvider{client: client, ramRole: auth.RAMRole}, nil
+	}
+	if auth.AccessKeyID == "" || auth.AccessKeySecret == "" {
+		return nil, errors.New("no Alibaba Cloud credentials: set an AccessKey or a RAM role")
+	}
+	return &credentialsProvider{static: &credentials{
+		AccessKeyID:     auth.AccessKeyID,
+		AccessKeySecret: auth.AccessKeySecret,
+		SecurityToken:   auth.SecurityToken,
+	}}, nil
+}
+
+// get returns the static credentials, or the RAM role's, fetching new ones if they expire within 5 minutes
+func (p *credentialsProvider) get(ctx context.Context) (*credentials, error) {
+	if p.static != nil {
+		return p.static, nil
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.cached != nil && time.Until(p.cached.Expiration) > 5*time.Minute {
+		return p.cached, nil
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, metadataEndpoint+p.ramRole, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return nil, &cloud.CredentialsError{Err: fmt.Errorf("unable to get RAM role credentials: %w", err)}
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, &cloud.CredentialsError{Err: fmt.Errorf("unable to get credentials of RAM role %s: %s",
+			p.ramRole, resp.Status)}
+	}
+	creds := &credentials{}
+	if err := json.NewDecoder(resp.Body).Decode(creds); err != nil {
+		return nil, &cloud.CredentialsError{Err: fmt.Errorf("unable to decode RAM role credentials: %w", err)}
+	}
+	p.cached = creds
+	return creds, nil
+}
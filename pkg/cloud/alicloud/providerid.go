@@ -0,0 +1,44 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package alicloud
+
+import (
+	"fmt"
+	"strings"
+)
+
+// ProviderID returns the provider ID of an ECS instance, alicloud://<region>.<instance id>
+func ProviderID(region, instanceID string) string {
+	return "alicloud://" + region + "." + instanceID
+}
+
+// instance identifies an ECS instance by its region and ID
+type instance struct {
+	Region string
+	ID     string
+}
+
+// parseProviderID parses a provider ID like alicloud://<region>.<instance id>, or <region>.<instance id> as the
+// Alibaba Cloud cloud controller manager sets it
+func parseProviderID(providerID string) (*instance, error) {
+	ref := strings.TrimPrefix(providerID, "alicloud://")
+	i := strings.LastIndex(ref, ".")
+	if i <= 0 || i == len(ref)-1 || strings.Contains(ref, "/") || !strings.HasPrefix(ref[i+1:], "i-") {
+		return nil, fmt.Errorf("not an Alibaba Cloud provider ID: %q", providerID)
+	}
+	return &instance{Region: ref[:i], ID: ref[i+1:]}, nil
+}
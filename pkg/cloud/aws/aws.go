@@ -0,0 +1,159 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package aws implements the cloud.Instances interface for AWS EC2.
+package aws
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/ec2metadata"
+	"github.com/aws/aws-sdk-go/aws/endpoints"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/ec2"
+)
+
+// metadataTimeout bounds each call to the instance metadata service, so detection fails fast off EC2
+const metadataTimeout = 2 * time.Second
+
+var errNoRegion = errors.New("unable to determine AWS region: set -region or -zone, set AWS_REGION, " +
+	"or run on an EC2 instance with the instance metadata service enabled")
+
+// DetectZone determines the zone to configure the legacy cloud provider with when none was given.
+// It uses the region from the environment or shared config (AWS_REGION, ~/.aws/config), which is also how
+// IRSA/web identity pods get their region, and otherwise the availability zone from the instance metadata service.
+// The metadata client uses IMDSv2 session tokens and only falls back to IMDSv1 if tokens are unavailable.
+func DetectZone(ctx context.Context) (string, error) {
+	sess, err := newSession(nil)
+	if err != nil {
+		return "", err
+	}
+	if region := aws.StringValue(sess.Config.Region); region != "" {
+		return region, nil
+	}
+
+	metadata := newMetadataClient(sess)
+	zone, err := metadata.GetMetadataWithContext(ctx, "placement/availability-zone")
+	if err != nil {
+		return "", fmt.Errorf("%w (instance metadata: %v)", errNoRegion, err)
+	}
+	return zone, nil
+}
+
+// newMetadataClient returns an instance metadata client with short timeouts
+func newMetadataClient(sess *session.Session) *ec2metadata.EC2Metadata {
+	return ec2metadata.New(sess, &aws.Config{
+		HTTPClient: &http.Client{Timeout: metadataTimeout},
+		MaxRetries: aws.Int(1),
+	})
+}
+
+// RegionFromZone returns the region of an availability zone (us-east-1a -> us-east-1). Regions are returned as-is.
+func RegionFromZone(zone string) string {
+	return strings.TrimRightFunc(zone, unicode.IsLetter)
+}
+
+// PartitionForRegion returns the ID of the partition a region belongs to (aws, aws-cn, aws-us-gov, ...).
+// Regions the SDK doesn't know yet are matched by their prefix, e.g. cn- or us-gov-.
+func PartitionForRegion(region string) string {
+	if partition, ok := endpoints.PartitionForRegion(endpoints.DefaultPartitions(), region); ok {
+		return partition.ID()
+	}
+	return endpoints.AwsPartitionID
+}
+
+// InstanceIDFromProviderID extracts the EC2 instance ID from a provider ID like aws:///us-east-1a/i-0123456789abcdef0
+func InstanceIDFromProviderID(providerID string) (string, error) {
+	if !strings.HasPrefix(providerID, "aws://") {
+		return "", fmt.Errorf("not an AWS provider ID: %q", providerID)
+	}
+	id := providerID[strings.LastIndex(providerID, "/")+1:]
+	if !strings.HasPrefix(id, "i-") {
+		return "", fmt.Errorf("invalid instance ID in provider ID: %q", providerID)
+	}
+	return id, nil
+}
+
+// zoneFromProviderID returns the zone from a provider ID like aws:///us-east-1a/i-0123456789abcdef0,
+// or an empty string if it has none
+func zoneFromProviderID(providerID string) string {
+	parts := strings.Split(strings.TrimPrefix(providerID, "aws://"), "/")
+	if len(parts) < 2 {
+		return ""
+	}
+	return parts[len(parts)-2]
+}
+
+// Cluster tags, as used by the Kubernetes AWS cloud providers
+const (
+	clusterTagPrefix = "kubernetes.io/cluster/"
+	legacyClusterTag = "KubernetesCluster"
+)
+
+// maxClusterIDCandidates limits how many instances are described when looking for the cluster tag
+const maxClusterIDCandidates = 10
+
+// DiscoverClusterID finds the cluster ID in the kubernetes.io/cluster/<id> (or legacy KubernetesCluster) tag
+// of the controller's own instance and the given instances. It returns an empty ID if none of them are tagged.
+func DiscoverClusterID(ctx context.Context, cfg *Config, instanceIDs []string) (string, error) {
+	sess, err := newSession(cfg)
+	if err != nil {
+		return "", err
+	}
+
+	candidates := []string{}
+	if self, err := newMetadataClient(sess).GetMetadataWithContext(ctx, "instance-id"); err == nil {
+		candidates = append(candidates, self)
+	}
+	candidates = append(candidates, instanceIDs...)
+	if len(candidates) > maxClusterIDCandidates {
+		candidates = candidates[:maxClusterIDCandidates]
+	}
+	if len(candidates) == 0 {
+		return "", nil
+	}
+
+	client := ec2.New(sess, cfg.clientConfig(sess))
+	// filter rather than list IDs, so that instances that no longer exist don't fail the whole call
+	out, err := client.DescribeInstancesWithContext(ctx, &ec2.DescribeInstancesInput{
+		Filters: []*ec2.Filter{{Name: aws.String("instance-id"), Values: aws.StringSlice(candidates)}},
+	})
+	if err != nil {
+		return "", fmt.Errorf("unable to describe instances: %w", err)
+	}
+
+	for _, reservation := range out.Reservations {
+		for _, instance := range reservation.Instances {
+			for _, tag := range instance.Tags {
+				key := aws.StringValue(tag.Key)
+				if strings.HasPrefix(key, clusterTagPrefix) {
+					return strings.TrimPrefix(key, clusterTagPrefix), nil
+				}
+				if key == legacyClusterTag && aws.StringValue(tag.Value) != "" {
+					return aws.StringValue(tag.Value), nil
+				}
+			}
+		}
+	}
+	return "", nil
+}
@@ -0,0 +1,269 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package aws
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/configservice"
+	"github.com/aws/aws-sdk-go/service/configservice/configserviceiface"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	"github.com/nxtlytics/cloud-lifecycle-controller/pkg/cloud"
+)
+
+// The APIs instances can be looked up with
+const (
+	// StateSourceEC2 describes instances with the EC2 API
+	StateSourceEC2 = "ec2"
+	// StateSourceConfig queries the configuration items AWS Config recorded for instances, which only needs Config
+	// permissions rather than ec2:DescribeInstances, but lags behind EC2 by up to a few minutes. Instances AWS Config
+	// has no record of are errors rather than gone.
+	StateSourceConfig = "config"
+)
+
+// selectBatchSize is the most instance IDs queried with a single call, so the query stays within AWS Config's limit
+// on its length
+const selectBatchSize = 100
+
+// configClient returns the AWS Config client for a region, creating it on first use
+func (i *Instances) configClient(region string) configserviceiface.ConfigServiceAPI {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	client, ok := i.configClients[region]
+	if !ok {
+		client = configservice.New(i.sess, i.cfg.clientConfig(i.sess).WithRegion(region))
+		i.configClients[region] = client
+	}
+	return client
+}
+
+// Configuration item statuses of resources AWS Config saw being deleted
+const (
+	configItemDeleted            = "ResourceDeleted"
+	configItemDeletedNotRecorded = "ResourceDeletedNotRecorded"
+)
+
+// configItem is the subset of an instance's configuration item the controller uses
+type configItem struct {
+	ResourceID       string `json:"resourceId"`
+	Status           string `json:"configurationItemStatus"`
+	AvailabilityZone string `json:"availabilityZone"`
+	Configuration    struct {
+		InstanceType string `json:"instanceType"`
+		State        struct {
+			Name string `json:"name"`
+		} `json:"state"`
+	} `json:"configuration"`
+	Tags []struct {
+		Key   string `json:"key"`
+		Value string `json:"value"`
+	} `json:"tags"`
+}
+
+// deleted returns true if AWS Config recorded the instance's deletion
+func (c *configItem) deleted() bool {
+	return c.Status == configItemDeleted || c.Status == configItemDeletedNotRecorded
+}
+
+// notRecordedError is the result of an instance AWS Config has no configuration item for, which says nothing about
+// whether it exists: the recorder may not record instances, or the aggregator may not cover its account or region
+type notRecordedError struct {
+	region     string
+	instanceID string
+}
+
+func (e *notRecordedError) Error() string {
+	return fmt.Sprintf("AWS Config has no record of instance %s in %s: check that the recorder records "+
+		"AWS::EC2::Instance and the aggregator covers the instance's account and region", e.instanceID, e.region)
+}
+
+// instance returns the parts of the EC2 instance the configuration item has
+func (c *configItem) instance() *ec2.Instance {
+	instance := &ec2.Instance{
+		InstanceId:   aws.String(c.ResourceID),
+		InstanceType: aws.String(c.Configuration.InstanceType),
+		State:        &ec2.InstanceState{Name: aws.String(c.Configuration.State.Name)},
+		Placement:    &ec2.Placement{AvailabilityZone: aws.String(c.AvailabilityZone)},
+	}
+	for _, tag := range c.Tags {
+		instance.Tags = append(instance.Tags, &ec2.Tag{Key: aws.String(tag.Key), Value: aws.String(tag.Value)})
+	}
+	return instance
+}
+
+// selectInstancesInRegion looks up the instances of a region with an AWS Config advanced query, of the configured
+// aggregator or else of the region's own recorder.
+//
+// AWS Config only knows the instances it records: a recorder that doesn't record AWS::EC2::Instance, or an aggregator
+// missing the account or region, returns nothing for instances that are running, and EC2 can't tell since the
+// instance may be in another account. So only instances AWS Config recorded as deleted are reported as gone, and the
+// result of instances missing from the results is a *notRecordedError.
+func (i *Instances) selectInstancesInRegion(ctx context.Context, region string, instanceIDs []string) (map[string]interface{}, error) {
+	items, err := i.selectConfigItems(ctx, region, instanceIDs)
+	if err != nil {
+		return nil, err
+	}
+	found := make(map[string]interface{}, len(instanceIDs))
+	for _, id := range instanceIDs {
+		item, ok := items[id]
+		switch {
+		case !ok:
+			found[id] = &notRecordedError{region: region, instanceID: id}
+		case !item.deleted():
+			found[id] = item.instance()
+		}
+	}
+	return found, nil
+}
+
+// selectConfigItems returns the configuration items AWS Config has for the instances of a region, including the
+// ones of deleted instances
+func (i *Instances) selectConfigItems(ctx context.Context, region string, instanceIDs []string) (map[string]*configItem, error) {
+	if !isQueryValue(region) {
+		return nil, fmt.Errorf("invalid region %q", region)
+	}
+	quoted := make([]string, 0, len(instanceIDs))
+	for _, id := range instanceIDs {
+		// an ID that can't be quoted can't be an instance's either
+		if isQueryValue(id) {
+			quoted = append(quoted, "'"+id+"'")
+		}
+	}
+	if len(quoted) == 0 {
+		return map[string]*configItem{}, nil
+	}
+	expression := fmt.Sprintf("SELECT resourceId, configurationItemStatus, availabilityZone, configuration.instanceType, "+
+		"configuration.state.name, tags WHERE resourceType = 'AWS::EC2::Instance' AND awsRegion = '%s' "+
+		"AND resourceId IN (%s)", region, strings.Join(quoted, ", "))
+
+	results, err := i.selectResources(ctx, region, expression)
+	if err != nil {
+		if isCredentialsError(err) {
+			return nil, &cloud.CredentialsError{Err: err}
+		}
+		if request.IsErrorThrottle(err) {
+			return nil, &cloud.ThrottlingError{Err: err}
+		}
+		return nil, fmt.Errorf("unable to query AWS Config for instances in %s: %w", region, err)
+	}
+
+	found := map[string]*configItem{}
+	for _, result := range results {
+		item := &configItem{}
+		if err := json.Unmarshal([]byte(result), item); err != nil {
+			return nil, fmt.Errorf("unable to decode AWS Config query result: %w", err)
+		}
+		if _, ok := found[item.ResourceID]; ok {
+			return nil, fmt.Errorf("multiple instances found for instance: %s", item.ResourceID)
+		}
+		found[item.ResourceID] = item
+	}
+	return found, nil
+}
+
+// isQueryValue returns true if s only has the characters of region names and instance IDs, so it can be quoted in a
+// query as is
+func isQueryValue(s string) bool {
+	for _, c := range s {
+		if !(c >= 'a' && c <= 'z' || c >= '0' && c <= '9' || c == '-') {
+			return false
+		}
+	}
+	return s != ""
+}
+
+// selectResources runs an advanced query, following its pages, and returns the results as JSON documents
+func (i *Instances) selectResources(ctx context.Context, region, expression string) ([]string, error) {
+	var results []string
+	if aggregator := i.cfg.ConfigAggregator; aggregator != "" {
+		input := &configservice.SelectAggregateResourceConfigInput{
+			ConfigurationAggregatorName: aws.String(aggregator),
+			Expression:                  aws.String(expression),
+		}
+		// the aggregator lives in the controller's region, whichever regions it aggregates
+		err := i.configClient(i.cfg.Region()).SelectAggregateResourceConfigPagesWithContext(ctx, input,
+			func(out *configservice.SelectAggregateResourceConfigOutput, _ bool) bool {
+				results = append(results, aws.StringValueSlice(out.Results)...)
+				return true
+			})
+		return results, err
+	}
+
+	input := &configservice.SelectResourceConfigInput{Expression: aws.String(expression)}
+	for {
+		out, err := i.configClient(region).SelectResourceConfigWithContext(ctx, input)
+		if err != nil {
+			return nil, err
+		}
+		results = append(results, aws.StringValueSlice(out.Results)...)
+		if aws.StringValue(out.NextToken) == "" {
+			return results, nil
+		}
+		input.NextToken = out.NextToken
+	}
+}
+
+// CheckCoverage implements cloud.CoverageChecker: with StateSourceConfig, it returns an error if AWS Config has no
+// record of the instances of some of the provider IDs. It checks nothing with StateSourceEC2.
+func (i *Instances) CheckCoverage(ctx context.Context, providerIDs []string) error {
+	if i.cfg.StateSource != StateSourceConfig {
+		return nil
+	}
+	byRegion := map[string][]string{}
+	for _, providerID := range providerIDs {
+		instanceID, err := InstanceIDFromProviderID(providerID)
+		if err != nil {
+			return err
+		}
+		region := i.regions(providerID)[0]
+		byRegion[region] = append(byRegion[region], instanceID)
+	}
+
+	var uncovered []string
+	for region, instanceIDs := range byRegion {
+		for start := 0; start < len(instanceIDs); start += selectBatchSize {
+			end := start + selectBatchSize
+			if end > len(instanceIDs) {
+				end = len(instanceIDs)
+			}
+			batch := instanceIDs[start:end]
+			found, err := i.selectConfigItems(ctx, region, batch)
+			if err != nil {
+				return err
+			}
+			for _, id := range batch {
+				if _, ok := found[id]; !ok {
+					uncovered = append(uncovered, region+"/"+id)
+				}
+			}
+		}
+	}
+	if len(uncovered) > 0 {
+		sort.Strings(uncovered)
+		return fmt.Errorf("AWS Config has no record of %d instances, e.g. %s: check that the recorder "+
+			"records AWS::EC2::Instance and the aggregator covers all accounts and regions", len(uncovered),
+			uncovered[0])
+	}
+	return nil
+}
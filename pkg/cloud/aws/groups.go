@@ -0,0 +1,141 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package aws
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/autoscaling"
+	"github.com/aws/aws-sdk-go/service/autoscaling/autoscalingiface"
+	"github.com/nxtlytics/cloud-lifecycle-controller/pkg/cloud"
+)
+
+// autoscalingClient returns the Auto Scaling client for a region, creating it on first use
+func (i *Instances) autoscalingClient(region string) autoscalingiface.AutoScalingAPI {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	client, ok := i.autoscalingClients[region]
+	if !ok {
+		client = autoscaling.New(i.sess, i.cfg.clientConfig(i.sess).WithRegion(region))
+		i.autoscalingClients[region] = client
+	}
+	return client
+}
+
+// ListGroups implements cloud.GroupLister. It lists the Auto Scaling groups of the provider IDs' regions; only groups
+// with at least one of the provider IDs' instances are included, so groups of other clusters sharing the account
+// aren't reported. If the cluster ID is configured, groups without the cluster's tag are skipped too.
+func (i *Instances) ListGroups(ctx context.Context, providerIDs []string) (*cloud.GroupMembership, error) {
+	byInstanceID := map[string]string{}
+	regions := map[string]bool{}
+	for _, providerID := range providerIDs {
+		instanceID, err := InstanceIDFromProviderID(providerID)
+		if err != nil {
+			continue
+		}
+		byInstanceID[instanceID] = providerID
+		for _, region := range i.regions(providerID) {
+			regions[region] = true
+		}
+	}
+
+	membership := &cloud.GroupMembership{Groups: map[string]string{}, Others: map[string][]string{}}
+	for _, region := range sortedKeys(regions) {
+		if PartitionForRegion(region) != i.cfg.Partition() {
+			continue
+		}
+		groups, err := i.describeGroupsInRegion(ctx, region)
+		if err != nil {
+			return nil, err
+		}
+		for _, group := range groups {
+			name := aws.StringValue(group.AutoScalingGroupName)
+			var others []string
+			var matched bool
+			for _, instance := range group.Instances {
+				instanceID := aws.StringValue(instance.InstanceId)
+				if providerID, ok := byInstanceID[instanceID]; ok {
+					membership.Groups[providerID] = name
+					matched = true
+					continue
+				}
+				if strings.HasPrefix(aws.StringValue(instance.LifecycleState), "Terminat") {
+					continue
+				}
+				others = append(others, fmt.Sprintf("aws:///%s/%s", aws.StringValue(instance.AvailabilityZone), instanceID))
+			}
+			if matched && len(others) > 0 {
+				membership.Others[name] = others
+			}
+		}
+	}
+	return membership, nil
+}
+
+// describeGroupsInRegion returns the Auto Scaling groups of a region, skipping those without the cluster's tag if the
+// cluster ID is configured
+func (i *Instances) describeGroupsInRegion(ctx context.Context, region string) ([]*autoscaling.Group, error) {
+	var clusterTag string
+	if i.cfg.Global.KubernetesClusterID != "" {
+		clusterTag = "kubernetes.io/cluster/" + i.cfg.Global.KubernetesClusterID
+	}
+	var groups []*autoscaling.Group
+	input := &autoscaling.DescribeAutoScalingGroupsInput{MaxRecords: aws.Int64(100)}
+	err := i.autoscalingClient(region).DescribeAutoScalingGroupsPagesWithContext(ctx, input,
+		func(out *autoscaling.DescribeAutoScalingGroupsOutput, _ bool) bool {
+			for _, group := range out.AutoScalingGroups {
+				if clusterTag == "" || hasTag(group, clusterTag) {
+					groups = append(groups, group)
+				}
+			}
+			return true
+		})
+	if err != nil {
+		if isCredentialsError(err) {
+			return nil, &cloud.CredentialsError{Err: err}
+		}
+		if request.IsErrorThrottle(err) {
+			return nil, &cloud.ThrottlingError{Err: err}
+		}
+		return nil, fmt.Errorf("unable to describe Auto Scaling groups in %s: %w", region, err)
+	}
+	return groups, nil
+}
+
+func hasTag(group *autoscaling.Group, key string) bool {
+	for _, tag := range group.Tags {
+		if aws.StringValue(tag.Key) == key {
+			return true
+		}
+	}
+	return false
+}
+
+func sortedKeys(m map[string]bool) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,430 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package aws
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/arn"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/credentials/stscreds"
+	"github.com/aws/aws-sdk-go/aws/endpoints"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/autoscaling/autoscalingiface"
+	"github.com/aws/aws-sdk-go/service/configservice/configserviceiface"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	"github.com/aws/aws-sdk-go/service/ec2/ec2iface"
+	"github.com/nxtlytics/cloud-lifecycle-controller/pkg/cloud"
+	"gopkg.in/gcfg.v1"
+)
+
+// Config is the AWS cloud config. It has the same format as the legacy AWS cloud provider's config file so existing
+// files keep working; settings the controller has no use for (VPC, SubnetID, ...) are ignored.
+type Config struct {
+	Global struct {
+		// Zone is the availability zone (or region) the controller makes API calls in
+		Zone string
+		// RoleARN is the IAM role to assume when interacting with AWS APIs, e.g. in another account
+		RoleARN string
+		// ExternalID is passed when assuming RoleARN, if the role's trust policy requires it
+		ExternalID string
+		// KubernetesClusterID is the cluster id used to identify the cluster's instances
+		KubernetesClusterID string
+		// AdditionalRegion lists other regions to look for instances in, if their provider ID has no zone.
+		// Can be repeated.
+		AdditionalRegion []string
+		// EndpointURL sends all API calls to a single endpoint instead of the AWS endpoints, e.g. LocalStack or moto
+		// for testing. ServiceOverrides take precedence.
+		EndpointURL string
+	}
+	// ServiceOverride overrides the endpoints of AWS services, e.g. to use VPC endpoints. Overrides without a Region
+	// apply to all regions.
+	//
+	//	[ServiceOverride "1"]
+	//	Service = ec2
+	//	Region = us-east-1
+	//	URL = https://ec2.example.com
+	//	SigningRegion = us-east-1
+	ServiceOverride map[string]*struct {
+		Service       string
+		Region        string
+		URL           string
+		SigningRegion string
+		SigningMethod string
+		SigningName   string
+	}
+
+	// Credentials replaces the SDK's default credential chain, e.g. with credentials fetched from Vault.
+	// It can't be set in the config file.
+	Credentials *credentials.Credentials
+	// HTTPClient is used for all API calls if set, e.g. to trust a custom CA bundle. It can't be set in the config file.
+	HTTPClient *http.Client
+	// BatchWindow is how long lookups wait for lookups of other instances in the same region, so they can share a
+	// single DescribeInstances call. Zero describes each instance on its own. It can't be set in the config file.
+	BatchWindow time.Duration
+	// Scope is the tag instances must have, e.g. kubernetes.io/cluster/<id>=owned. Lookups of instances without it
+	// fail with a cloud.OutOfScopeError. It can't be set in the config file.
+	Scope cloud.Scope
+	// StateSource is the API instances are looked up with, StateSourceEC2 (the default) or StateSourceConfig.
+	// It can't be set in the config file.
+	StateSource string
+	// ConfigAggregator is the AWS Config aggregator in the configured region queried with StateSourceConfig, e.g. one
+	// aggregating an organization's accounts. Without it, the recorder of each instance's region is queried.
+	// It can't be set in the config file.
+	ConfigAggregator string
+}
+
+// ReadConfig parses an AWS cloud config. A nil reader returns an empty config.
+func ReadConfig(r io.Reader) (*Config, error) {
+	cfg := &Config{}
+	if r == nil {
+		return cfg, nil
+	}
+	if err := gcfg.FatalOnly(gcfg.ReadInto(cfg, r)); err != nil {
+		return nil, fmt.Errorf("unable to read AWS cloud config: %w", err)
+	}
+	return cfg, nil
+}
+
+// Region returns the region of the configured zone
+func (cfg *Config) Region() string {
+	return RegionFromZone(cfg.Global.Zone)
+}
+
+// Partition returns the partition of the configured region. Credentials, roles and endpoints are partition-specific,
+// so the controller only looks up instances in that partition.
+func (cfg *Config) Partition() string {
+	return PartitionForRegion(cfg.Region())
+}
+
+// validate checks that the role and additional regions are in the configured region's partition, since a mismatch
+// otherwise only shows up as confusing authentication errors
+func (cfg *Config) validate() error {
+	partition := cfg.Partition()
+	if cfg.Global.RoleARN != "" {
+		role, err := arn.Parse(cfg.Global.RoleARN)
+		if err != nil {
+			return fmt.Errorf("invalid role ARN %q: %w", cfg.Global.RoleARN, err)
+		}
+		if role.Partition != partition {
+			return fmt.Errorf("role %s is in partition %s, but region %s is in partition %s",
+				cfg.Global.RoleARN, role.Partition, cfg.Region(), partition)
+		}
+	}
+	for _, region := range cfg.Global.AdditionalRegion {
+		if regionPartition := PartitionForRegion(region); regionPartition != partition {
+			return fmt.Errorf("additional region %s is in partition %s, but region %s is in partition %s",
+				region, regionPartition, cfg.Region(), partition)
+		}
+	}
+	return nil
+}
+
+// resolver resolves service endpoints, taking ServiceOverrides into account
+func (cfg *Config) resolver() endpoints.ResolverFunc {
+	return func(service, region string, opts ...func(*endpoints.Options)) (endpoints.ResolvedEndpoint, error) {
+		for _, override := range cfg.ServiceOverride {
+			if override.Service == service && (override.Region == "" || override.Region == region) {
+				return endpoints.ResolvedEndpoint{
+					URL:           override.URL,
+					SigningRegion: override.SigningRegion,
+					SigningMethod: override.SigningMethod,
+					SigningName:   override.SigningName,
+				}, nil
+			}
+		}
+		if cfg.Global.EndpointURL != "" {
+			return endpoints.ResolvedEndpoint{URL: cfg.Global.EndpointURL, SigningRegion: region}, nil
+		}
+		return endpoints.DefaultResolver().EndpointFor(service, region, opts...)
+	}
+}
+
+// Instances looks up EC2 instances by provider ID.
+//
+// Instances are looked up in the region of the zone in their provider ID (aws:///<zone>/<instance>), so clusters
+// spanning several regions work without configuration. Provider IDs without a zone are looked up in the configured
+// region, then in each of the additional regions.
+//
+// Unless Config.Credentials is set, credentials come from the AWS SDK's default chain: environment variables, web identity tokens (IAM Roles for
+// Service Accounts), shared config/credentials files, and finally ECS task or EC2 instance roles, which are
+// fetched from the instance metadata service using IMDSv2 session tokens. Credentials are refreshed by the SDK
+// before they expire, so rotated IRSA tokens and instance role credentials are picked up without a restart.
+type Instances struct {
+	cfg  *Config
+	sess *session.Session
+
+	mu                 sync.Mutex
+	clients            map[string]ec2iface.EC2API
+	autoscalingClients map[string]autoscalingiface.AutoScalingAPI
+	configClients      map[string]configserviceiface.ConfigServiceAPI
+	batcher            *cloud.Batcher
+}
+
+// describeBatchSize is the most instance IDs described with a single call, the limit of values in a filter
+const describeBatchSize = 200
+
+// New creates an Instances for the given config
+func New(cfg *Config) (*Instances, error) {
+	if cfg.Global.Zone == "" {
+		return nil, fmt.Errorf("no AWS zone or region configured")
+	}
+	if err := cfg.validate(); err != nil {
+		return nil, err
+	}
+
+	sess, err := newSession(cfg)
+	if err != nil {
+		return nil, err
+	}
+	i := &Instances{
+		cfg:                cfg,
+		sess:               sess,
+		clients:            map[string]ec2iface.EC2API{},
+		autoscalingClients: map[string]autoscalingiface.AutoScalingAPI{},
+		configClients:      map[string]configserviceiface.ConfigServiceAPI{},
+	}
+	switch cfg.StateSource {
+	case "", StateSourceEC2:
+		i.batcher = cloud.NewBatcher(cfg.BatchWindow, describeBatchSize, i.describeInstancesInRegion)
+	case StateSourceConfig:
+		i.batcher = cloud.NewBatcher(cfg.BatchWindow, selectBatchSize, i.selectInstancesInRegion)
+	default:
+		return nil, fmt.Errorf("unknown AWS state source %q, must be %s or %s", cfg.StateSource, StateSourceEC2,
+			StateSourceConfig)
+	}
+	return i, nil
+}
+
+// client returns the EC2 client for a region, creating it on first use
+func (i *Instances) client(region string) ec2iface.EC2API {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	client, ok := i.clients[region]
+	if !ok {
+		client = ec2.New(i.sess, i.cfg.clientConfig(i.sess).WithRegion(region))
+		i.clients[region] = client
+	}
+	return client
+}
+
+// regions returns the regions to look for the instance of a provider ID in
+func (i *Instances) regions(providerID string) []string {
+	if zone := zoneFromProviderID(providerID); zone != "" {
+		return []string{RegionFromZone(zone)}
+	}
+	return append([]string{i.cfg.Region()}, i.cfg.Global.AdditionalRegion...)
+}
+
+// roleSessionName identifies the controller in CloudTrail when it assumes a role
+const roleSessionName = "cloud-lifecycle-controller"
+
+// clientConfig returns the SDK config for API calls in the configured region, using the credentials of RoleARN if set.
+// Assumed role credentials are refreshed before they expire.
+func (cfg *Config) clientConfig(sess *session.Session) *aws.Config {
+	awsConfig := aws.NewConfig().
+		WithRegion(cfg.Region()).
+		WithEndpointResolver(cfg.resolver()).
+		WithCredentialsChainVerboseErrors(true)
+	if cfg.Global.RoleARN != "" {
+		awsConfig = awsConfig.WithCredentials(stscreds.NewCredentials(sess, cfg.Global.RoleARN, func(p *stscreds.AssumeRoleProvider) {
+			p.RoleSessionName = roleSessionName
+			if cfg.Global.ExternalID != "" {
+				p.ExternalID = aws.String(cfg.Global.ExternalID)
+			}
+		}))
+	}
+	return awsConfig
+}
+
+// newSession creates a session using the config's credentials (or the default credential chain if cfg is nil
+// or has none), endpoint overrides and HTTP client. The session is also used to assume RoleARN, so ServiceOverrides
+// for sts apply to that.
+func newSession(cfg *Config) (*session.Session, error) {
+	opts := session.Options{SharedConfigState: session.SharedConfigEnable}
+	if cfg != nil {
+		if region := cfg.Region(); region != "" {
+			// the region also selects the partition's STS endpoint when assuming RoleARN
+			opts.Config.Region = aws.String(region)
+		}
+		opts.Config.Credentials = cfg.Credentials
+		opts.Config.HTTPClient = cfg.HTTPClient
+		opts.Config.EndpointResolver = cfg.resolver()
+	}
+	sess, err := session.NewSessionWithOptions(opts)
+	if err != nil {
+		return nil, fmt.Errorf("unable to create AWS session: %w", err)
+	}
+	return sess, nil
+}
+
+// describeInstance returns the instance for the provider ID, or nil if it doesn't exist in any of its regions
+func (i *Instances) describeInstance(ctx context.Context, providerID string) (*ec2.Instance, error) {
+	instanceID, err := InstanceIDFromProviderID(providerID)
+	if err != nil {
+		return nil, err
+	}
+
+	// an instance AWS Config has no record of in one region may still be in the next
+	var notRecorded error
+	for _, region := range i.regions(providerID) {
+		if partition := PartitionForRegion(region); partition != i.cfg.Partition() {
+			return nil, fmt.Errorf("instance %s is in partition %s, but the controller is configured for partition %s",
+				instanceID, partition, i.cfg.Partition())
+		}
+		instance, err := i.describeInstanceInRegion(ctx, region, instanceID)
+		var notRecordedErr *notRecordedError
+		if errors.As(err, &notRecordedErr) {
+			notRecorded = err
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		if instance != nil {
+			if !i.cfg.Scope.Allows(instanceTags(instance)) {
+				return nil, &cloud.OutOfScopeError{ProviderID: providerID, Scope: i.cfg.Scope}
+			}
+			return instance, nil
+		}
+	}
+	return nil, notRecorded
+}
+
+// instanceTags returns the tags of an instance as a map
+func instanceTags(instance *ec2.Instance) map[string]string {
+	tags := make(map[string]string, len(instance.Tags))
+	for _, tag := range instance.Tags {
+		tags[aws.StringValue(tag.Key)] = aws.StringValue(tag.Value)
+	}
+	return tags
+}
+
+func (i *Instances) describeInstanceInRegion(ctx context.Context, region, instanceID string) (*ec2.Instance, error) {
+	instance, err := i.batcher.Get(ctx, region, instanceID)
+	if err != nil || instance == nil {
+		return nil, err
+	}
+	if err, ok := instance.(error); ok {
+		return nil, err
+	}
+	return instance.(*ec2.Instance), nil
+}
+
+// describeInstancesInRegion describes the instances of a region with one (paginated) call. The IDs are given as a
+// filter rather than InstanceIds, so a single terminated and purged instance doesn't fail the whole call.
+func (i *Instances) describeInstancesInRegion(ctx context.Context, region string, instanceIDs []string) (map[string]interface{}, error) {
+	input := &ec2.DescribeInstancesInput{
+		Filters: []*ec2.Filter{{Name: aws.String("instance-id"), Values: aws.StringSlice(instanceIDs)}},
+	}
+	found := map[string]interface{}{}
+	var duplicate string
+	err := i.client(region).DescribeInstancesPagesWithContext(ctx, input, func(out *ec2.DescribeInstancesOutput, _ bool) bool {
+		for _, reservation := range out.Reservations {
+			for _, instance := range reservation.Instances {
+				id := aws.StringValue(instance.InstanceId)
+				if _, ok := found[id]; ok {
+					duplicate = id
+				}
+				found[id] = instance
+			}
+		}
+		return true
+	})
+	if err != nil {
+		if cloud.IsInstanceNotFound(err) {
+			return nil, nil
+		}
+		if isCredentialsError(err) {
+			return nil, &cloud.CredentialsError{Err: err}
+		}
+		if request.IsErrorThrottle(err) {
+			// the SDK already retried with backoff
+			return nil, &cloud.ThrottlingError{Err: err}
+		}
+		return nil, err
+	}
+	if duplicate != "" {
+		return nil, fmt.Errorf("multiple instances found for instance: %s", duplicate)
+	}
+	return found, nil
+}
+
+// InstanceExistsByProviderID returns true if the instance exists and is not terminated
+func (i *Instances) InstanceExistsByProviderID(ctx context.Context, providerID string) (bool, error) {
+	instance, err := i.describeInstance(ctx, providerID)
+	if err != nil || instance == nil {
+		return false, err
+	}
+	return instanceState(instance) != ec2.InstanceStateNameTerminated, nil
+}
+
+// InstanceShutdownByProviderID returns true if the instance is stopped
+func (i *Instances) InstanceShutdownByProviderID(ctx context.Context, providerID string) (bool, error) {
+	instance, err := i.describeInstance(ctx, providerID)
+	if err != nil || instance == nil {
+		return false, err
+	}
+	return instanceState(instance) == ec2.InstanceStateNameStopped, nil
+}
+
+// InstanceMetadataByProviderID implements cloud.MetadataGetter
+func (i *Instances) InstanceMetadataByProviderID(ctx context.Context, providerID string) (*cloud.Metadata, error) {
+	instance, err := i.describeInstance(ctx, providerID)
+	if err != nil || instance == nil {
+		return nil, err
+	}
+	metadata := &cloud.Metadata{InstanceType: aws.StringValue(instance.InstanceType)}
+	if instance.Placement != nil {
+		metadata.Zone = aws.StringValue(instance.Placement.AvailabilityZone)
+		metadata.Region = RegionFromZone(metadata.Zone)
+	}
+	return metadata, nil
+}
+
+func instanceState(instance *ec2.Instance) string {
+	if instance.State == nil {
+		return ""
+	}
+	return aws.StringValue(instance.State.Name)
+}
+
+// credentialsErrorCodes are the error codes of requests that failed because of expired or invalid credentials
+var credentialsErrorCodes = map[string]bool{
+	"AuthFailure":                 true,
+	"ExpiredToken":                true,
+	"ExpiredTokenException":       true,
+	"InvalidClientTokenId":        true,
+	"NoCredentialProviders":       true,
+	"RequestExpired":              true,
+	"UnrecognizedClientException": true,
+}
+
+func isCredentialsError(err error) bool {
+	var awsErr awserr.Error
+	return errors.As(err, &awsErr) && credentialsErrorCodes[awsErr.Code()]
+}
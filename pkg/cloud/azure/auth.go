@@ -0,0 +1,217 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package azure
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Azure/go-autorest/autorest"
+	"github.com/Azure/go-autorest/autorest/adal"
+	"github.com/Azure/go-autorest/autorest/azure"
+)
+
+// Environment variables injected by the Azure AD Workload Identity webhook
+const (
+	envClientID           = "AZURE_CLIENT_ID"
+	envTenantID           = "AZURE_TENANT_ID"
+	envFederatedTokenFile = "AZURE_FEDERATED_TOKEN_FILE"
+	envAuthorityHost      = "AZURE_AUTHORITY_HOST"
+)
+
+// newAuthorizer returns an authorizer for ARM requests, using (in order of preference) workload identity,
+// managed identity or a service principal secret. All of them refresh their tokens before they expire.
+func newAuthorizer(cfg *Config, env azure.Environment) (autorest.Authorizer, error) {
+	resource := env.TokenAudience
+	if resource == "" {
+		resource = env.ResourceManagerEndpoint
+	}
+
+	if cfg.UseWorkloadIdentity || os.Getenv(envFederatedTokenFile) != "" {
+		token, err := newFederatedToken(cfg, env, resource)
+		if err != nil {
+			return nil, err
+		}
+		return autorest.NewBearerAuthorizer(token), nil
+	}
+
+	if cfg.UseManagedIdentityExtension {
+		endpoint, err := adal.GetMSIVMEndpoint()
+		if err != nil {
+			return nil, fmt.Errorf("unable to get managed identity endpoint: %w", err)
+		}
+		var token *adal.ServicePrincipalToken
+		if cfg.UserAssignedIdentityID != "" {
+			token, err = adal.NewServicePrincipalTokenFromMSIWithUserAssignedID(endpoint, resource, cfg.UserAssignedIdentityID)
+		} else {
+			token, err = adal.NewServicePrincipalTokenFromMSI(endpoint, resource)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("unable to set up managed identity: %w", err)
+		}
+		return newBearerAuthorizer(cfg, token), nil
+	}
+
+	if cfg.AADClientID != "" && cfg.AADClientSecret != "" {
+		oauthConfig, err := adal.NewOAuthConfig(env.ActiveDirectoryEndpoint, cfg.TenantID)
+		if err != nil {
+			return nil, fmt.Errorf("unable to set up Azure AD OAuth config: %w", err)
+		}
+		token, err := adal.NewServicePrincipalToken(*oauthConfig, cfg.AADClientID, cfg.AADClientSecret, resource)
+		if err != nil {
+			return nil, fmt.Errorf("unable to set up service principal: %w", err)
+		}
+		return newBearerAuthorizer(cfg, token), nil
+	}
+
+	return nil, errors.New("no Azure credentials configured: use workload identity, managed identity " +
+		"(useManagedIdentityExtension) or a service principal (aadClientId, aadClientSecret)")
+}
+
+// newBearerAuthorizer returns an authorizer for an adal token that uses the config's HTTP client to refresh it
+func newBearerAuthorizer(cfg *Config, token *adal.ServicePrincipalToken) autorest.Authorizer {
+	if cfg.HTTPClient != nil {
+		token.SetSender(cfg.HTTPClient)
+	}
+	return autorest.NewBearerAuthorizer(token)
+}
+
+// tokenRefreshMargin is how long before expiry tokens are refreshed
+const tokenRefreshMargin = 5 * time.Minute
+
+// federatedToken is an adal.OAuthTokenProvider that exchanges a Kubernetes service account token for an Azure AD token
+// (Azure AD Workload Identity). The service account token file is re-read on every refresh, since kubelet rotates it.
+type federatedToken struct {
+	clientID  string
+	tokenURL  string
+	scope     string
+	tokenFile string
+	client    *http.Client
+
+	mu        sync.RWMutex
+	token     string
+	expiresOn time.Time
+}
+
+func newFederatedToken(cfg *Config, env azure.Environment, resource string) (*federatedToken, error) {
+	clientID := firstNonEmpty(cfg.AADClientID, os.Getenv(envClientID))
+	tenantID := firstNonEmpty(cfg.TenantID, os.Getenv(envTenantID))
+	tokenFile := firstNonEmpty(cfg.AADFederatedTokenFile, os.Getenv(envFederatedTokenFile))
+	authority := firstNonEmpty(os.Getenv(envAuthorityHost), env.ActiveDirectoryEndpoint)
+	if clientID == "" || tenantID == "" || tokenFile == "" {
+		return nil, fmt.Errorf("workload identity needs a client ID, tenant ID and federated token file (%s, %s, %s)",
+			envClientID, envTenantID, envFederatedTokenFile)
+	}
+
+	client := cfg.HTTPClient
+	if client == nil {
+		client = &http.Client{Timeout: 30 * time.Second}
+	}
+	return &federatedToken{
+		clientID:  clientID,
+		tokenURL:  strings.TrimSuffix(authority, "/") + "/" + tenantID + "/oauth2/v2.0/token",
+		scope:     strings.TrimSuffix(resource, "/") + "/.default",
+		tokenFile: tokenFile,
+		client:    client,
+	}, nil
+}
+
+// OAuthToken implements adal.OAuthTokenProvider
+func (t *federatedToken) OAuthToken() string {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	return t.token
+}
+
+// EnsureFreshWithContext implements adal.RefresherWithContext
+func (t *federatedToken) EnsureFreshWithContext(ctx context.Context) error {
+	t.mu.RLock()
+	fresh := t.token != "" && time.Until(t.expiresOn) > tokenRefreshMargin
+	t.mu.RUnlock()
+	if fresh {
+		return nil
+	}
+	return t.RefreshWithContext(ctx)
+}
+
+// RefreshExchangeWithContext implements adal.RefresherWithContext
+func (t *federatedToken) RefreshExchangeWithContext(ctx context.Context, _ string) error {
+	return t.RefreshWithContext(ctx)
+}
+
+// RefreshWithContext implements adal.RefresherWithContext
+func (t *federatedToken) RefreshWithContext(ctx context.Context) error {
+	assertion, err := ioutil.ReadFile(t.tokenFile)
+	if err != nil {
+		return fmt.Errorf("unable to read federated token file: %w", err)
+	}
+
+	form := url.Values{
+		"client_id":             {t.clientID},
+		"scope":                 {t.scope},
+		"grant_type":            {"client_credentials"},
+		"client_assertion_type": {"urn:ietf:params:oauth:client-assertion-type:jwt-bearer"},
+		"client_assertion":      {strings.TrimSpace(string(assertion))},
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, t.tokenURL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	resp, err := t.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("unable to exchange federated token: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		body, _ := ioutil.ReadAll(resp.Body)
+		return fmt.Errorf("unable to exchange federated token: %s: %s", resp.Status, body)
+	}
+
+	var result struct {
+		AccessToken string `json:"access_token"`
+		ExpiresIn   int64  `json:"expires_in"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return fmt.Errorf("unable to decode token response: %w", err)
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.token = result.AccessToken
+	t.expiresOn = time.Now().Add(time.Duration(result.ExpiresIn) * time.Second)
+	return nil
+}
+
+func firstNonEmpty(values ...string) string {
+	for _, value := range values {
+		if value != "" {
+			return value
+		}
+	}
+	return ""
+}
@@ -0,0 +1,526 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package azure implements the cloud.Instances interface for Azure virtual machines and scale set instances.
+package azure
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Azure/go-autorest/autorest"
+	"github.com/Azure/go-autorest/autorest/azure"
+	"github.com/nxtlytics/cloud-lifecycle-controller/pkg/cloud"
+	"sigs.k8s.io/yaml"
+)
+
+// computeAPIVersion is the Microsoft.Compute API version used for instance views
+const computeAPIVersion = "2020-12-01"
+
+// Config is the Azure cloud config. It has the same format (JSON or YAML) as the azure.json used by the Kubernetes
+// Azure cloud provider, so existing files keep working; settings the controller has no use for are ignored.
+type Config struct {
+	// Cloud is the name of the Azure environment, e.g. AzurePublicCloud (default), AzureChinaCloud or
+	// AzureUSGovernmentCloud
+	Cloud          string `json:"cloud"`
+	TenantID       string `json:"tenantId"`
+	SubscriptionID string `json:"subscriptionId"`
+	ResourceGroup  string `json:"resourceGroup"`
+
+	// AADClientID and AADClientSecret are the credentials of a service principal
+	AADClientID     string `json:"aadClientId"`
+	AADClientSecret string `json:"aadClientSecret"`
+
+	// UseManagedIdentityExtension authenticates with the VM's system-assigned managed identity,
+	// or the user-assigned identity with client ID UserAssignedIdentityID if set
+	UseManagedIdentityExtension bool   `json:"useManagedIdentityExtension"`
+	UserAssignedIdentityID      string `json:"userAssignedIdentityID"`
+
+	// UseWorkloadIdentity authenticates with Azure AD Workload Identity, exchanging the service account token in
+	// AADFederatedTokenFile for an Azure AD token. It is enabled automatically when the workload identity webhook
+	// has injected AZURE_FEDERATED_TOKEN_FILE, which also provides the client and tenant IDs.
+	UseWorkloadIdentity   bool   `json:"useWorkloadIdentity"`
+	AADFederatedTokenFile string `json:"aadFederatedTokenFile"`
+
+	// ResourceManagerEndpoint and ActiveDirectoryEndpoint override the endpoints of the Azure environment,
+	// e.g. to use private endpoints. For Azure Stack, set Cloud to AzureStackCloud and AZURE_ENVIRONMENT_FILEPATH instead.
+	ResourceManagerEndpoint string `json:"resourceManagerEndpoint"`
+	ActiveDirectoryEndpoint string `json:"activeDirectoryEndpoint"`
+
+	// PoolOverrides maps scale set names to the subscription and resource group their instances are looked up in,
+	// for pools whose provider IDs don't point at where the instances actually live
+	PoolOverrides map[string]PoolOverride `json:"poolOverrides"`
+
+	// HTTPClient is used for all API and token requests if set, e.g. to trust a custom CA bundle.
+	// It can't be set in the config file.
+	HTTPClient *http.Client `json:"-"`
+	// BatchWindow is how long lookups of scale set VMs wait for lookups of other instances of the same scale set, so
+	// they can share a single list call. Zero gets each instance view on its own, without listing the scale set.
+	// It can't be set in the config file.
+	BatchWindow time.Duration `json:"-"`
+	// StateSource is the API instance views are looked up with, StateSourceARM (the default) or
+	// StateSourceResourceGraph. With Resource Graph, lookups of all VMs of a subscription are batched.
+	// It can't be set in the config file.
+	StateSource string `json:"-"`
+}
+
+// PoolOverride overrides the subscription and/or resource group from the provider IDs of a pool's nodes
+type PoolOverride struct {
+	SubscriptionID string `json:"subscriptionId"`
+	ResourceGroup  string `json:"resourceGroup"`
+}
+
+// ReadConfig parses an Azure cloud config. A nil reader returns an empty config.
+func ReadConfig(r io.Reader) (*Config, error) {
+	cfg := &Config{}
+	if r == nil {
+		return cfg, nil
+	}
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	if err := yaml.Unmarshal(data, cfg); err != nil {
+		return nil, fmt.Errorf("unable to read Azure cloud config: %w", err)
+	}
+	return cfg, nil
+}
+
+// EnvironmentFromName returns the Azure environment with the given name, e.g. AzurePublicCloud, AzureChinaCloud,
+// AzureUSGovernmentCloud or AzureStackCloud. Names are case-insensitive and the Cloud suffix is optional.
+func EnvironmentFromName(name string) (azure.Environment, error) {
+	if !strings.HasSuffix(strings.ToLower(name), "cloud") {
+		name += "Cloud"
+	}
+	return azure.EnvironmentFromName(name)
+}
+
+// environment returns the Azure environment for the config, with any endpoint overrides applied
+func (cfg *Config) environment() (azure.Environment, error) {
+	env := azure.PublicCloud
+	if cfg.Cloud != "" {
+		var err error
+		if env, err = EnvironmentFromName(cfg.Cloud); err != nil {
+			return env, err
+		}
+	}
+	if cfg.ResourceManagerEndpoint != "" {
+		env.ResourceManagerEndpoint = cfg.ResourceManagerEndpoint
+	}
+	if cfg.ActiveDirectoryEndpoint != "" {
+		env.ActiveDirectoryEndpoint = cfg.ActiveDirectoryEndpoint
+	}
+	return env, nil
+}
+
+// Instances looks up Azure VMs and scale set VMs by provider ID, using their instance view.
+// Provider IDs are ARM resource IDs, so each instance is looked up in the subscription and resource group from its
+// provider ID (unless overridden for its pool), and nodes can span any number of them.
+type Instances struct {
+	client    autorest.Client
+	env       azure.Environment
+	overrides map[string]PoolOverride
+	batcher   *cloud.Batcher
+	// batched is true if scale set VMs are looked up by listing their scale set, i.e. BatchWindow is set
+	batched bool
+	// resourceGraph is true if instance views are looked up with Resource Graph
+	resourceGraph bool
+	// spotScaleSets caches whether scale sets have Spot priority, keyed by their lowercase resource ID. A scale set's
+	// priority can't be changed once it is created.
+	spotScaleSets sync.Map
+}
+
+// throttleRetries is how often throttled requests are retried, waiting throttleBackoff (doubling each time) or the
+// Retry-After delay in between, as long as that isn't longer than maxThrottleDelay
+const (
+	throttleRetries  = 3
+	throttleBackoff  = time.Second
+	maxThrottleDelay = 10 * time.Second
+)
+
+// listBatchSize is the most scale set VMs waiting for a list call before it is made early
+const listBatchSize = 1000
+
+// New creates an Instances for the given config
+func New(cfg *Config) (*Instances, error) {
+	env, err := cfg.environment()
+	if err != nil {
+		return nil, err
+	}
+	authorizer, err := newAuthorizer(cfg, env)
+	if err != nil {
+		return nil, err
+	}
+
+	client := autorest.NewClientWithUserAgent("cloud-lifecycle-controller")
+	client.Authorizer = authorizer
+	if cfg.HTTPClient != nil {
+		client.Sender = cfg.HTTPClient
+	}
+	// scale set names are case-insensitive
+	overrides := make(map[string]PoolOverride, len(cfg.PoolOverrides))
+	for pool, override := range cfg.PoolOverrides {
+		overrides[strings.ToLower(pool)] = override
+	}
+	i := &Instances{client: client, env: env, overrides: overrides, batched: cfg.BatchWindow > 0}
+	switch cfg.StateSource {
+	case "", StateSourceARM:
+		i.batcher = cloud.NewBatcher(cfg.BatchWindow, listBatchSize, i.listScaleSetInstanceViews)
+	case StateSourceResourceGraph:
+		i.resourceGraph = true
+		i.batcher = cloud.NewBatcher(cfg.BatchWindow, queryBatchSize, i.queryInstanceViews)
+	default:
+		return nil, fmt.Errorf("unknown Azure state source %q, must be %s or %s", cfg.StateSource, StateSourceARM,
+			StateSourceResourceGraph)
+	}
+	return i, nil
+}
+
+// instanceView is the subset of the compute instance view the controller uses
+type instanceView struct {
+	Statuses []instanceStatus `json:"statuses"`
+	// spot is true if the VM, or its scale set, has Spot priority. It isn't part of the instance view.
+	spot bool
+}
+
+// instanceStatus is a status of an instance view, e.g. PowerState/running
+type instanceStatus struct {
+	Code string `json:"code"`
+}
+
+// isSpot returns true for the priorities of spot VMs; Low is what Spot was called before
+func isSpot(priority string) bool {
+	return strings.EqualFold(priority, "Spot") || strings.EqualFold(priority, "Low")
+}
+
+// evicted returns true if the VM is a spot VM that is deallocated. Evicting a spot VM with the Deallocate eviction
+// policy deallocates it, while one stopped from the guest OS is only stopped; VMs evicted with the Delete policy are
+// gone instead.
+func (v *instanceView) evicted() bool {
+	switch v.powerState() {
+	case "PowerState/deallocating", "PowerState/deallocated":
+		return v.spot
+	default:
+		return false
+	}
+}
+
+// powerState returns the PowerState status code of the instance view, e.g. PowerState/running
+func (v *instanceView) powerState() string {
+	for _, status := range v.Statuses {
+		if strings.HasPrefix(status.Code, "PowerState/") {
+			return status.Code
+		}
+	}
+	return ""
+}
+
+// resource returns the resource to look up for a provider ID, with any pool overrides applied
+func (i *Instances) resource(providerID string) (*resource, error) {
+	res, err := parseProviderID(providerID)
+	if err != nil {
+		return nil, err
+	}
+	if override, ok := i.overrides[strings.ToLower(res.pool())]; ok && res.pool() != "" {
+		if override.SubscriptionID != "" {
+			res.SubscriptionID = override.SubscriptionID
+		}
+		if override.ResourceGroup != "" {
+			res.ResourceGroup = override.ResourceGroup
+		}
+	}
+	return res, nil
+}
+
+// getInstanceView returns the instance view of the provider ID's VM, or nil if it doesn't exist.
+// Scale set VMs are looked up in batches by listing their scale set if BatchWindow is set, and all VMs of a
+// subscription with Resource Graph.
+func (i *Instances) getInstanceView(ctx context.Context, providerID string) (*instanceView, error) {
+	res, err := i.resource(providerID)
+	if err != nil {
+		return nil, err
+	}
+	resourceID := res.String()
+
+	if i.resourceGraph {
+		view, err := i.batcher.Get(ctx, res.SubscriptionID, strings.ToLower(resourceID))
+		if err != nil || view == nil {
+			return nil, err
+		}
+		return view.(*instanceView), nil
+	}
+	if scaleSetID := res.scaleSetID(); scaleSetID != "" && i.batched {
+		view, err := i.batcher.Get(ctx, strings.ToLower(scaleSetID), strings.ToLower(resourceID))
+		if err != nil || view == nil {
+			return nil, err
+		}
+		return view.(*instanceView), nil
+	}
+	return i.getComputeInstanceView(ctx, res)
+}
+
+// getComputeInstanceView returns the instance view of a VM or scale set VM with a single Microsoft.Compute API call
+// (two for the first VM of a scale set, whose priority is its scale set's), or nil if it doesn't exist
+func (i *Instances) getComputeInstanceView(ctx context.Context, res *resource) (*instanceView, error) {
+	resourceID := res.String()
+	if scaleSetID := res.scaleSetID(); scaleSetID != "" {
+		return i.getScaleSetVMInstanceView(ctx, scaleSetID, resourceID)
+	}
+
+	// the VM with its instance view, rather than just the instance view, which doesn't have the VM's priority
+	resp, err := i.get(ctx,
+		autorest.WithPath(resourceID),
+		autorest.WithQueryParameters(map[string]interface{}{"$expand": "instanceView"}),
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotFound {
+		return nil, nil
+	}
+	if err := cloud.CheckResponse(resp, "getting instance view of "+resourceID); err != nil {
+		return nil, err
+	}
+
+	vm := &struct {
+		Properties struct {
+			Priority     string        `json:"priority"`
+			InstanceView *instanceView `json:"instanceView"`
+		} `json:"properties"`
+	}{}
+	if err := json.NewDecoder(resp.Body).Decode(vm); err != nil {
+		return nil, fmt.Errorf("unable to decode instance view of %s: %w", resourceID, err)
+	}
+	view := vm.Properties.InstanceView
+	if view == nil {
+		return nil, fmt.Errorf("no instance view in response for %s", resourceID)
+	}
+	view.spot = isSpot(vm.Properties.Priority)
+	return view, nil
+}
+
+// getScaleSetVMInstanceView returns the instance view of a scale set VM, or nil if it doesn't exist
+func (i *Instances) getScaleSetVMInstanceView(ctx context.Context, scaleSetID, resourceID string) (*instanceView, error) {
+	resp, err := i.get(ctx, autorest.WithPath(resourceID+"/instanceView"))
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotFound {
+		return nil, nil
+	}
+	if err := cloud.CheckResponse(resp, "getting instance view of "+resourceID); err != nil {
+		return nil, err
+	}
+	view := &instanceView{}
+	if err := json.NewDecoder(resp.Body).Decode(view); err != nil {
+		return nil, fmt.Errorf("unable to decode instance view of %s: %w", resourceID, err)
+	}
+	if view.spot, err = i.scaleSetSpot(ctx, scaleSetID); err != nil {
+		return nil, err
+	}
+	return view, nil
+}
+
+// scaleSetSpot returns true if the scale set's instances have Spot priority, and false if the scale set doesn't
+// exist. The priority of scale sets that exist is cached.
+func (i *Instances) scaleSetSpot(ctx context.Context, scaleSetID string) (bool, error) {
+	key := strings.ToLower(scaleSetID)
+	if spot, ok := i.spotScaleSets.Load(key); ok {
+		return spot.(bool), nil
+	}
+	resp, err := i.get(ctx, autorest.WithPath(scaleSetID))
+	if err != nil {
+		return false, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotFound {
+		return false, nil
+	}
+	if err := cloud.CheckResponse(resp, "getting scale set "+scaleSetID); err != nil {
+		return false, err
+	}
+	scaleSet := &struct {
+		Properties struct {
+			VirtualMachineProfile struct {
+				Priority string `json:"priority"`
+			} `json:"virtualMachineProfile"`
+		} `json:"properties"`
+	}{}
+	if err := json.NewDecoder(resp.Body).Decode(scaleSet); err != nil {
+		return false, fmt.Errorf("unable to decode scale set %s: %w", scaleSetID, err)
+	}
+	spot := isSpot(scaleSet.Properties.VirtualMachineProfile.Priority)
+	i.spotScaleSets.Store(key, spot)
+	return spot, nil
+}
+
+// scaleSetVMList is a page of the instances of a scale set, with their instance views
+type scaleSetVMList struct {
+	Value []struct {
+		ID         string `json:"id"`
+		Properties struct {
+			InstanceView *instanceView `json:"instanceView"`
+		} `json:"properties"`
+	} `json:"value"`
+	NextLink string `json:"nextLink"`
+}
+
+// listScaleSetInstanceViews returns the instance views of all the instances of a scale set, keyed by their lowercase
+// resource ID. A scale set that doesn't exist has no instances. The instances' priority is the scale set's, which
+// takes one more call the first time.
+func (i *Instances) listScaleSetInstanceViews(ctx context.Context, scaleSetID string, _ []string) (map[string]interface{}, error) {
+	views := map[string]interface{}{}
+	spot, err := i.scaleSetSpot(ctx, scaleSetID)
+	if err != nil {
+		return nil, err
+	}
+	decorators := []autorest.PrepareDecorator{
+		autorest.WithPath(scaleSetID + "/virtualMachines"),
+		autorest.WithQueryParameters(map[string]interface{}{"$expand": "instanceView"}),
+	}
+	for {
+		resp, err := i.get(ctx, decorators...)
+		if err != nil {
+			return nil, err
+		}
+		if resp.StatusCode == http.StatusNotFound {
+			resp.Body.Close()
+			return views, nil
+		}
+		if err := cloud.CheckResponse(resp, "listing instances of "+scaleSetID); err != nil {
+			resp.Body.Close()
+			return nil, err
+		}
+
+		page := &scaleSetVMList{}
+		err = json.NewDecoder(resp.Body).Decode(page)
+		resp.Body.Close()
+		if err != nil {
+			return nil, fmt.Errorf("unable to decode instances of %s: %w", scaleSetID, err)
+		}
+		for _, vm := range page.Value {
+			if vm.Properties.InstanceView != nil {
+				vm.Properties.InstanceView.spot = spot
+				views[strings.ToLower(vm.ID)] = vm.Properties.InstanceView
+			}
+		}
+		if page.NextLink == "" {
+			return views, nil
+		}
+		// the next link is a full URL with its own query parameters
+		decorators = []autorest.PrepareDecorator{autorest.WithBaseURL(page.NextLink)}
+	}
+}
+
+// get sends an authorized GET request to the resource manager
+func (i *Instances) get(ctx context.Context, decorators ...autorest.PrepareDecorator) (*http.Response, error) {
+	return i.send(ctx, computeAPIVersion, append([]autorest.PrepareDecorator{autorest.AsGet()}, decorators...)...)
+}
+
+// send sends an authorized request for an API version to the resource manager
+func (i *Instances) send(ctx context.Context, apiVersion string, decorators ...autorest.PrepareDecorator) (*http.Response, error) {
+	decorators = append([]autorest.PrepareDecorator{
+		autorest.WithBaseURL(strings.TrimSuffix(i.env.ResourceManagerEndpoint, "/")),
+	}, decorators...)
+	// query parameters go last, since WithPath appends to the whole URL
+	decorators = append(decorators,
+		autorest.WithQueryParameters(map[string]interface{}{"api-version": apiVersion}),
+		i.client.WithAuthorization(),
+	)
+	req, err := autorest.Prepare((&http.Request{}).WithContext(ctx), decorators...)
+	if err != nil {
+		// the only thing that can fail here is getting a token
+		return nil, &cloud.CredentialsError{Err: err}
+	}
+	// the body is read once, so retries can send it again
+	var body []byte
+	if req.Body != nil {
+		body, err = ioutil.ReadAll(req.Body)
+		req.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// throttled requests are retried a few times with exponential backoff, or after the Retry-After delay if it is
+	// short enough; otherwise the caller gets the 429 and the node is checked again later
+	backoff := throttleBackoff
+	for attempt := 0; ; attempt++ {
+		if body != nil {
+			req.Body = ioutil.NopCloser(bytes.NewReader(body))
+		}
+		resp, err := i.client.Do(req)
+		if err != nil || resp.StatusCode != http.StatusTooManyRequests || attempt == throttleRetries {
+			return resp, err
+		}
+		delay := cloud.ResponseRetryAfter(resp)
+		if delay == 0 {
+			delay = backoff
+			backoff *= 2
+		}
+		if delay > maxThrottleDelay {
+			return resp, nil
+		}
+		resp.Body.Close()
+		select {
+		case <-time.After(delay):
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+}
+
+// InstanceExistsByProviderID returns true if the VM exists
+func (i *Instances) InstanceExistsByProviderID(ctx context.Context, providerID string) (bool, error) {
+	view, err := i.getInstanceView(ctx, providerID)
+	return view != nil, err
+}
+
+// InstanceShutdownByProviderID returns true if the VM is stopped or deallocated
+func (i *Instances) InstanceShutdownByProviderID(ctx context.Context, providerID string) (bool, error) {
+	view, err := i.getInstanceView(ctx, providerID)
+	if err != nil || view == nil {
+		return false, err
+	}
+	switch view.powerState() {
+	case "PowerState/stopped", "PowerState/deallocating", "PowerState/deallocated":
+		return true, nil
+	default:
+		return false, nil
+	}
+}
+
+// InstanceEvictedByProviderID implements cloud.EvictionGetter, returning true if the VM is a deallocated spot VM
+func (i *Instances) InstanceEvictedByProviderID(ctx context.Context, providerID string) (bool, error) {
+	view, err := i.getInstanceView(ctx, providerID)
+	if err != nil || view == nil {
+		return false, err
+	}
+	return view.evicted(), nil
+}
@@ -0,0 +1,69 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package azure
+
+import (
+	"context"
+	"sort"
+	"strings"
+
+	"github.com/nxtlytics/cloud-lifecycle-controller/pkg/cloud"
+)
+
+// ListGroups implements cloud.GroupLister. It lists the instances of the scale sets of the provider IDs' scale set
+// VMs, named by their resource ID; standalone VMs aren't in any group. The listed instance IDs are lowercase.
+func (i *Instances) ListGroups(ctx context.Context, providerIDs []string) (*cloud.GroupMembership, error) {
+	// the provider IDs of each scale set's VMs, by their lowercase resource ID
+	scaleSets := map[string]map[string]string{}
+	for _, providerID := range providerIDs {
+		res, err := i.resource(providerID)
+		if err != nil {
+			continue
+		}
+		scaleSetID := res.scaleSetID()
+		if scaleSetID == "" {
+			continue
+		}
+		if scaleSets[scaleSetID] == nil {
+			scaleSets[scaleSetID] = map[string]string{}
+		}
+		scaleSets[scaleSetID][strings.ToLower(res.String())] = providerID
+	}
+
+	ids := make([]string, 0, len(scaleSets))
+	for scaleSetID := range scaleSets {
+		ids = append(ids, scaleSetID)
+	}
+	sort.Strings(ids)
+
+	membership := &cloud.GroupMembership{Groups: map[string]string{}, Others: map[string][]string{}}
+	for _, scaleSetID := range ids {
+		views, err := i.listScaleSetInstanceViews(ctx, scaleSetID, nil)
+		if err != nil {
+			return nil, err
+		}
+		for resourceID := range views {
+			if providerID, ok := scaleSets[scaleSetID][resourceID]; ok {
+				membership.Groups[providerID] = scaleSetID
+				continue
+			}
+			membership.Others[scaleSetID] = append(membership.Others[scaleSetID], "azure://"+resourceID)
+		}
+		sort.Strings(membership.Others[scaleSetID])
+	}
+	return membership, nil
+}
@@ -0,0 +1,75 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package azure
+
+import (
+	"fmt"
+	"strings"
+)
+
+// resource is a parsed ARM resource ID of a VM or scale set VM
+type resource struct {
+	SubscriptionID string
+	ResourceGroup  string
+	// Path is the part of the ID after the resource group, e.g. providers/Microsoft.Compute/virtualMachines/<name>
+	Path string
+}
+
+// parseProviderID parses a provider ID like
+// azure:///subscriptions/<sub>/resourceGroups/<rg>/providers/Microsoft.Compute/virtualMachines/<name>
+func parseProviderID(providerID string) (*resource, error) {
+	if !strings.HasPrefix(providerID, "azure://") {
+		return nil, fmt.Errorf("not an Azure provider ID: %q", providerID)
+	}
+
+	// /subscriptions/<sub>/resourceGroups/<rg>/<path>
+	parts := strings.SplitN(strings.TrimPrefix(providerID, "azure://"), "/", 6)
+	if len(parts) != 6 || parts[0] != "" || !strings.EqualFold(parts[1], "subscriptions") ||
+		!strings.EqualFold(parts[3], "resourceGroups") || parts[2] == "" || parts[4] == "" || parts[5] == "" {
+		return nil, fmt.Errorf("invalid resource ID in provider ID: %q", providerID)
+	}
+	return &resource{SubscriptionID: parts[2], ResourceGroup: parts[4], Path: parts[5]}, nil
+}
+
+// pool returns the name of the scale set the resource is an instance of, or "" for standalone VMs
+func (r *resource) pool() string {
+	segments := strings.Split(r.Path, "/")
+	for i := 0; i < len(segments)-1; i++ {
+		if strings.EqualFold(segments[i], "virtualMachineScaleSets") {
+			return segments[i+1]
+		}
+	}
+	return ""
+}
+
+// scaleSetID returns the resource ID of the scale set the resource is an instance of, or "" if it isn't a
+// scale set VM
+func (r *resource) scaleSetID() string {
+	segments := strings.Split(r.Path, "/")
+	if len(segments) != 6 || !strings.EqualFold(segments[2], "virtualMachineScaleSets") ||
+		!strings.EqualFold(segments[4], "virtualMachines") {
+		return ""
+	}
+	scaleSet := &resource{SubscriptionID: r.SubscriptionID, ResourceGroup: r.ResourceGroup,
+		Path: strings.Join(segments[:4], "/")}
+	return scaleSet.String()
+}
+
+// String returns the resource ID
+func (r *resource) String() string {
+	return "/subscriptions/" + r.SubscriptionID + "/resourceGroups/" + r.ResourceGroup + "/" + r.Path
+}
@@ -0,0 +1,204 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package azure
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/Azure/go-autorest/autorest"
+	"github.com/nxtlytics/cloud-lifecycle-controller/pkg/cloud"
+)
+
+// The APIs instance views can be looked up with
+const (
+	// StateSourceARM gets VMs and lists scale set VMs with the Microsoft.Compute API
+	StateSourceARM = "arm"
+	// StateSourceResourceGraph queries Azure Resource Graph for the power state of VMs and scale set VMs, which only
+	// needs read access to Resource Graph and takes one call per subscription, but lags behind the Microsoft.Compute
+	// API by up to a few minutes
+	StateSourceResourceGraph = "resource-graph"
+)
+
+// resourceGraphAPIVersion is the Microsoft.ResourceGraph API version used for queries
+const resourceGraphAPIVersion = "2021-03-01"
+
+// queryBatchSize is the most VMs queried with a single call, so the query stays well within Resource Graph's limit on
+// its length
+const queryBatchSize = 100
+
+// resourceGraphResponse is a page of Resource Graph query results
+type resourceGraphResponse struct {
+	Data []struct {
+		ID         string `json:"id"`
+		PowerState string `json:"powerState"`
+		Priority   string `json:"priority"`
+	} `json:"data"`
+	SkipToken string `json:"$skipToken"`
+}
+
+// queryInstanceViews returns the instance views of the VMs and scale set VMs of a subscription with the given lowercase
+// resource IDs, keyed by them, from Resource Graph. Scale set VMs have no priority in Resource Graph, so they are never
+// reported as spot VMs.
+//
+// Resource Graph only returns what the controller's identity may read, and returns nothing rather than an error
+// without read access. So VMs missing from the results are confirmed with the Microsoft.Compute API before they are
+// reported as gone, and if none of the VMs are in the results but any of them exist, the whole batch fails, since
+// Resource Graph evidently doesn't cover them.
+func (i *Instances) queryInstanceViews(ctx context.Context, subscriptionID string, resourceIDs []string) (map[string]interface{}, error) {
+	views, err := i.queryResourceGraph(ctx, subscriptionID, resourceIDs)
+	if err != nil {
+		return nil, err
+	}
+	queried := len(views)
+	confirmed := 0
+	for _, id := range resourceIDs {
+		if _, ok := views[id]; ok {
+			continue
+		}
+		res, err := parseProviderID("azure://" + id)
+		if err != nil {
+			return nil, err
+		}
+		view, err := i.getComputeInstanceView(ctx, res)
+		if err != nil {
+			return nil, fmt.Errorf("unable to confirm VM missing from Resource Graph: %w", err)
+		}
+		if view != nil {
+			views[id] = view
+			confirmed++
+		}
+	}
+	if queried == 0 && confirmed > 0 {
+		return nil, fmt.Errorf("Resource Graph returned none of %d VMs in subscription %s, but %d of them exist: check "+
+			"that the controller's identity can read them with Resource Graph", len(resourceIDs), subscriptionID,
+			confirmed)
+	}
+	return views, nil
+}
+
+// queryResourceGraph returns the instance views of the VMs and scale set VMs of a subscription with the given lowercase
+// resource IDs that Resource Graph has, keyed by them
+func (i *Instances) queryResourceGraph(ctx context.Context, subscriptionID string, resourceIDs []string) (map[string]interface{}, error) {
+	quoted := make([]string, 0, len(resourceIDs))
+	for _, id := range resourceIDs {
+		// an ID that can't be quoted can't be a VM's either
+		if !strings.ContainsAny(id, `'"\`) {
+			quoted = append(quoted, "'"+id+"'")
+		}
+	}
+	views := map[string]interface{}{}
+	if len(quoted) == 0 {
+		return views, nil
+	}
+	query := "union (Resources | where type =~ 'microsoft.compute/virtualmachines'), " +
+		"(ComputeResources | where type =~ 'microsoft.compute/virtualmachinescalesets/virtualmachines') " +
+		"| where id in~ (" + strings.Join(quoted, ", ") + ") " +
+		"| project id, powerState = tostring(properties.extended.instanceView.powerState.code), " +
+		"priority = tostring(properties.priority)"
+
+	request := map[string]interface{}{
+		"subscriptions": []string{subscriptionID},
+		"query":         query,
+	}
+	for {
+		resp, err := i.send(ctx, resourceGraphAPIVersion,
+			autorest.AsPost(),
+			autorest.AsContentType("application/json"),
+			autorest.WithPath("providers/Microsoft.ResourceGraph/resources"),
+			autorest.WithJSON(request),
+		)
+		if err != nil {
+			return nil, err
+		}
+		if err := cloud.CheckResponse(resp, "querying Resource Graph in subscription "+subscriptionID); err != nil {
+			resp.Body.Close()
+			return nil, err
+		}
+		page := &resourceGraphResponse{}
+		err = json.NewDecoder(resp.Body).Decode(page)
+		resp.Body.Close()
+		if err != nil {
+			return nil, fmt.Errorf("unable to decode Resource Graph results in subscription %s: %w", subscriptionID, err)
+		}
+		for _, vm := range page.Data {
+			view := &instanceView{spot: isSpot(vm.Priority)}
+			if vm.PowerState != "" {
+				view.Statuses = append(view.Statuses, instanceStatus{Code: vm.PowerState})
+			}
+			views[strings.ToLower(vm.ID)] = view
+		}
+		if page.SkipToken == "" {
+			return views, nil
+		}
+		request["options"] = map[string]interface{}{"$skipToken": page.SkipToken}
+	}
+}
+
+// CheckCoverage implements cloud.CoverageChecker: with StateSourceResourceGraph, it returns an error if VMs of the
+// provider IDs exist that Resource Graph has no record of. It checks nothing with StateSourceARM.
+func (i *Instances) CheckCoverage(ctx context.Context, providerIDs []string) error {
+	if !i.resourceGraph {
+		return nil
+	}
+	bySubscription := map[string][]string{}
+	resources := map[string]*resource{}
+	for _, providerID := range providerIDs {
+		res, err := i.resource(providerID)
+		if err != nil {
+			return err
+		}
+		id := strings.ToLower(res.String())
+		bySubscription[res.SubscriptionID] = append(bySubscription[res.SubscriptionID], id)
+		resources[id] = res
+	}
+
+	var uncovered []string
+	for subscriptionID, ids := range bySubscription {
+		for start := 0; start < len(ids); start += queryBatchSize {
+			end := start + queryBatchSize
+			if end > len(ids) {
+				end = len(ids)
+			}
+			views, err := i.queryResourceGraph(ctx, subscriptionID, ids[start:end])
+			if err != nil {
+				return err
+			}
+			for _, id := range ids[start:end] {
+				if _, ok := views[id]; ok {
+					continue
+				}
+				view, err := i.getComputeInstanceView(ctx, resources[id])
+				if err != nil {
+					return err
+				}
+				if view != nil {
+					uncovered = append(uncovered, id)
+				}
+			}
+		}
+	}
+	if len(uncovered) > 0 {
+		sort.Strings(uncovered)
+		return fmt.Errorf("Resource Graph has no record of %d VMs that exist, e.g. %s: check that the controller's "+
+			"identity can read them with Resource Graph", len(uncovered), uncovered[0])
+	}
+	return nil
+}
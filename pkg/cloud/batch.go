@@ -0,0 +1,107 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cloud
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// BatchFunc looks up keys that belong to the same group (e.g. instances in the same region) with a single bulk API
+// call, and returns the results of the keys that were found. Results for keys that weren't asked for are ignored.
+type BatchFunc func(ctx context.Context, group string, keys []string) (map[string]interface{}, error)
+
+// Batcher collects the lookups made within a short window and serves them with one BatchFunc call per group, so many
+// nodes failing at once (e.g. during a zone outage) don't cause one API call per node
+type Batcher struct {
+	window  time.Duration
+	maxSize int
+	lookup  BatchFunc
+
+	mu      sync.Mutex
+	pending map[string]*batch
+}
+
+// batch is a set of keys waiting to be looked up together
+type batch struct {
+	keys    map[string]bool
+	done    chan struct{}
+	results map[string]interface{}
+	err     error
+}
+
+// NewBatcher returns a Batcher that waits up to window for more lookups of a group before calling lookup, and calls
+// it early once maxSize keys are pending. A zero window looks up every key on its own.
+func NewBatcher(window time.Duration, maxSize int, lookup BatchFunc) *Batcher {
+	return &Batcher{window: window, maxSize: maxSize, lookup: lookup, pending: map[string]*batch{}}
+}
+
+// Get returns the result for key, or nil if it wasn't found
+func (b *Batcher) Get(ctx context.Context, group, key string) (interface{}, error) {
+	if b.window <= 0 {
+		results, err := b.lookup(ctx, group, []string{key})
+		return results[key], err
+	}
+
+	b.mu.Lock()
+	pending, ok := b.pending[group]
+	if !ok {
+		pending = &batch{keys: map[string]bool{}, done: make(chan struct{})}
+		b.pending[group] = pending
+		time.AfterFunc(b.window, func() { b.flush(group, pending) })
+	}
+	pending.keys[key] = true
+	if b.maxSize > 0 && len(pending.keys) >= b.maxSize {
+		// detached right away, so no more keys join it before it is looked up
+		delete(b.pending, group)
+		go b.lookupBatch(group, pending)
+	}
+	b.mu.Unlock()
+
+	select {
+	case <-pending.done:
+		return pending.results[key], pending.err
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// flush looks up the keys of a batch once its window is over, unless it was already detached to be looked up early
+func (b *Batcher) flush(group string, pending *batch) {
+	b.mu.Lock()
+	if b.pending[group] != pending {
+		b.mu.Unlock()
+		return
+	}
+	delete(b.pending, group)
+	b.mu.Unlock()
+	b.lookupBatch(group, pending)
+}
+
+// lookupBatch looks up the keys of a batch that was detached from pending, so its keys no longer change
+func (b *Batcher) lookupBatch(group string, pending *batch) {
+	keys := make([]string, 0, len(pending.keys))
+	for key := range pending.keys {
+		keys = append(keys, key)
+	}
+
+	// the batch is shared by several reconciles, so it isn't tied to any of their contexts;
+	// each of them stops waiting when its own context is done
+	pending.results, pending.err = b.lookup(context.Background(), group, keys)
+	close(pending.done)
+}
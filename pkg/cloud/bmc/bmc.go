@@ -0,0 +1,182 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package bmc implements the cloud.Instances interface for bare metal hosts, asking their baseboard management
+// controller with Redfish or IPMI.
+package bmc
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+
+	"github.com/nxtlytics/cloud-lifecycle-controller/pkg/cloud"
+)
+
+// AddressAnnotation is the node annotation with the address of its host's BMC: a Redfish URL like
+// https://10.0.0.5 (or the system's URL, e.g. https://10.0.0.5/redfish/v1/Systems/1, if the BMC manages several) or an
+// IPMI address like ipmi://10.0.0.5. The host must be an IP address in one of the allowed networks, since the node's
+// kubelet can set the annotation and the fleet's BMC credentials are sent to it.
+const AddressAnnotation = "clc.nxtlytics.com/bmc-address"
+
+// Config is the BMC configuration. There is no cloud config file, so it is set from flags and the environment.
+type Config struct {
+	// Address returns the BMC address of the named node, from its AddressAnnotation, or "" if it has none
+	Address func(ctx context.Context, nodeName string) (string, error)
+	// AllowedNetworks are the networks BMC addresses must be in, e.g. the out-of-band management network. Required.
+	AllowedNetworks []*net.IPNet
+	// Username and Password are the BMC credentials, the same for all hosts
+	Username string
+	Password string
+	// HTTPClient is used for all Redfish requests if set, e.g. to trust the BMCs' CA
+	HTTPClient *http.Client
+	// CriticalIsShutdown treats hosts whose Redfish system health is Critical as shut down, e.g. hung with a fatal
+	// hardware error, even if they are powered on
+	CriticalIsShutdown bool
+	// IPMITool is the ipmitool binary to run for IPMI addresses, looked up in PATH. Defaults to ipmitool.
+	IPMITool string
+}
+
+// Instances looks up bare metal hosts by provider ID (bmc:///<node name>), asking the BMC in the node's
+// AddressAnnotation for the host's power state
+type Instances struct {
+	address            func(ctx context.Context, nodeName string) (string, error)
+	allowedNetworks    []*net.IPNet
+	username           string
+	password           string
+	client             *http.Client
+	criticalIsShutdown bool
+	ipmitool           string
+
+	// systems holds the Redfish system URL of each BMC base URL, once found
+	systems sync.Map
+}
+
+// New creates an Instances for the given config
+func New(cfg *Config) (*Instances, error) {
+	if cfg.Address == nil {
+		return nil, errors.New("no BMC address lookup")
+	}
+	if len(cfg.AllowedNetworks) == 0 {
+		return nil, errors.New("no networks BMC addresses are allowed in")
+	}
+	if cfg.Username == "" || cfg.Password == "" {
+		return nil, errors.New("no BMC username or password")
+	}
+	i := &Instances{
+		address:            cfg.Address,
+		allowedNetworks:    cfg.AllowedNetworks,
+		username:           cfg.Username,
+		password:           cfg.Password,
+		client:             cfg.HTTPClient,
+		criticalIsShutdown: cfg.CriticalIsShutdown,
+		ipmitool:           cfg.IPMITool,
+	}
+	if i.client == nil {
+		i.client = http.DefaultClient
+	}
+	if i.ipmitool == "" {
+		i.ipmitool = "ipmitool"
+	}
+	return i, nil
+}
+
+// host is the state of a host as its BMC reports it
+type host struct {
+	// powerState is On, Off, PoweringOn or PoweringOff
+	powerState string
+	// health is the Redfish system health, OK, Warning or Critical, or "" over IPMI
+	health string
+}
+
+// getHost returns the state of the provider ID's host. A BMC can't prove that its host is gone, so anything other than
+// an answer about the host is an error.
+func (i *Instances) getHost(ctx context.Context, providerID string) (*host, error) {
+	name, err := parseProviderID(providerID)
+	if err != nil {
+		return nil, err
+	}
+	address, err := i.address(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+	if address == "" {
+		// without a BMC the controller can't know anything about the host, so it must leave the node alone
+		return nil, &cloud.OutOfScopeError{ProviderID: providerID, Scope: cloud.Scope{Key: AddressAnnotation}}
+	}
+
+	if !strings.Contains(address, "://") {
+		address = "https://" + address
+	}
+	u, err := url.Parse(address)
+	if err != nil {
+		return nil, fmt.Errorf("invalid BMC address %q of node %s: %w", address, name, err)
+	}
+	if u.Scheme != "https" && u.Scheme != "ipmi" {
+		return nil, fmt.Errorf("invalid BMC address %q of node %s: must be an https:// Redfish URL or ipmi://<host>",
+			address, name)
+	}
+	if !i.allowed(u.Hostname()) {
+		return nil, fmt.Errorf("BMC address %q of node %s is not an IP address in an allowed network", address, name)
+	}
+	if u.Scheme == "ipmi" {
+		return i.ipmiHost(ctx, u.Host)
+	}
+	return i.redfishHost(ctx, u)
+}
+
+// allowed returns true if host is an IP address in one of the allowed networks
+func (i *Instances) allowed(host string) bool {
+	ip := net.ParseIP(host)
+	if ip == nil {
+		return false
+	}
+	for _, network := range i.allowedNetworks {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// InstanceExistsByProviderID returns true if the host's BMC answers for it. BMCs can't tell whether their host was
+// decommissioned, so hosts never go missing; unanswered lookups are errors.
+func (i *Instances) InstanceExistsByProviderID(ctx context.Context, providerID string) (bool, error) {
+	h, err := i.getHost(ctx, providerID)
+	return h != nil, err
+}
+
+// InstanceShutdownByProviderID returns true if the host is powered off or powering off, or, with CriticalIsShutdown,
+// if its health is Critical
+func (i *Instances) InstanceShutdownByProviderID(ctx context.Context, providerID string) (bool, error) {
+	h, err := i.getHost(ctx, providerID)
+	if err != nil {
+		return false, err
+	}
+	switch {
+	case h.powerState == "Off", h.powerState == "PoweringOff":
+		return true, nil
+	case i.criticalIsShutdown && h.health == "Critical":
+		return true, nil
+	default:
+		return false, nil
+	}
+}
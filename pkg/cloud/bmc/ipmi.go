@@ -0,0 +1,80 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package bmc
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+
+	"github.com/nxtlytics/cloud-lifecycle-controller/pkg/cloud"
+)
+
+// ipmiTimeout is how long a single ipmitool call may take, so an unreachable BMC doesn't hang lookups
+const ipmiTimeout = 30 * time.Second
+
+// ipmiHost returns the power state of the host of an IPMI BMC (host or host:port), with ipmitool over IPMI v2.0
+// (lanplus). IPMI has no notion of a missing host, so the host always exists if the BMC answers.
+func (i *Instances) ipmiHost(ctx context.Context, address string) (*host, error) {
+	args := []string{"-I", "lanplus", "-H", address, "-U", i.username, "-E", "chassis", "power", "status"}
+	if hostname, port, err := net.SplitHostPort(address); err == nil {
+		args = []string{"-I", "lanplus", "-H", hostname, "-p", port, "-U", i.username, "-E", "chassis", "power",
+			"status"}
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, ipmiTimeout)
+	defer cancel()
+	var stdout, stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, i.ipmitool, args...)
+	// -E reads the password from IPMI_PASSWORD, so it doesn't show up in the process list
+	cmd.Env = append(os.Environ(), "IPMI_PASSWORD="+i.password)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+
+	err := cmd.Run()
+	if ctx.Err() == context.DeadlineExceeded {
+		return nil, fmt.Errorf("getting power state from BMC %s timed out after %s", address, ipmiTimeout)
+	}
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		out := strings.TrimSpace(stderr.String())
+		if strings.Contains(out, "RAKP") || strings.Contains(out, "nauthorized") {
+			return nil, &cloud.CredentialsError{Err: fmt.Errorf("unable to log in to BMC %s: %s", address, out)}
+		}
+		return nil, fmt.Errorf("unable to get power state from BMC %s: exit status %d: %s", address,
+			exitErr.ExitCode(), out)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	// Chassis Power is on
+	switch out := strings.TrimSpace(stdout.String()); {
+	case strings.HasSuffix(out, " on"):
+		return &host{powerState: "On"}, nil
+	case strings.HasSuffix(out, " off"):
+		return &host{powerState: "Off"}, nil
+	default:
+		return nil, fmt.Errorf("unexpected power status from BMC %s: %q", address, out)
+	}
+}
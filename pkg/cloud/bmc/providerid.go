@@ -0,0 +1,40 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package bmc
+
+import (
+	"fmt"
+	"strings"
+)
+
+// ProviderID returns the provider ID of a bare metal node, bmc:///<node name>, e.g. for the kubelet's --provider-id.
+// The host's BMC is found from the node's AddressAnnotation.
+func ProviderID(nodeName string) string {
+	return "bmc:///" + nodeName
+}
+
+// parseProviderID returns the node name of a provider ID like bmc:///<node name>
+func parseProviderID(providerID string) (string, error) {
+	if !strings.HasPrefix(providerID, "bmc://") {
+		return "", fmt.Errorf("not a BMC provider ID: %q", providerID)
+	}
+	name := strings.TrimPrefix(strings.TrimPrefix(providerID, "bmc://"), "/")
+	if name == "" || strings.Contains(name, "/") {
+		return "", fmt.Errorf("invalid BMC provider ID: %q", providerID)
+	}
+	return name, nil
+}
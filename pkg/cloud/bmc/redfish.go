@@ -0,0 +1,112 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package bmc
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/nxtlytics/cloud-lifecycle-controller/pkg/cloud"
+)
+
+// systemsPath is the Redfish collection of the systems a BMC manages
+const systemsPath = "/redfish/v1/Systems"
+
+// system is the subset of a Redfish ComputerSystem the controller uses
+type system struct {
+	PowerState string `json:"PowerState"`
+	Status     struct {
+		// State is e.g. Enabled, Disabled or Absent
+		State  string `json:"State"`
+		Health string `json:"Health"`
+	} `json:"Status"`
+}
+
+// redfishHost returns the state of the system at a Redfish URL. A URL without a path is the BMC's only system. A
+// missing or absent system is an error rather than a missing host: it is more likely a wrong system URL or a BMC
+// that was just reset than a decommissioned host.
+func (i *Instances) redfishHost(ctx context.Context, u *url.URL) (*host, error) {
+	systemURL, err := i.systemURL(ctx, u)
+	if err != nil {
+		return nil, err
+	}
+	s := &system{}
+	if err := i.redfishGet(ctx, systemURL, s); err != nil {
+		return nil, err
+	}
+	if s.Status.State == "Absent" {
+		return nil, fmt.Errorf("BMC reports system %s as absent", systemURL)
+	}
+	return &host{powerState: s.PowerState, health: s.Status.Health}, nil
+}
+
+// systemURL returns the URL of the Redfish system of a BMC address, finding the BMC's only system if the address has
+// no path
+func (i *Instances) systemURL(ctx context.Context, u *url.URL) (string, error) {
+	if strings.Trim(u.Path, "/") != "" {
+		return u.String(), nil
+	}
+	base := u.Scheme + "://" + u.Host
+	if systemURL, ok := i.systems.Load(base); ok {
+		return systemURL.(string), nil
+	}
+
+	collection := &struct {
+		Members []struct {
+			ID string `json:"@odata.id"`
+		} `json:"Members"`
+	}{}
+	if err := i.redfishGet(ctx, base+systemsPath, collection); err != nil {
+		return "", err
+	}
+	if len(collection.Members) != 1 {
+		return "", fmt.Errorf("BMC %s manages %d systems, set the system's URL in the %s annotation", base,
+			len(collection.Members), AddressAnnotation)
+	}
+	systemURL := base + collection.Members[0].ID
+	i.systems.Store(base, systemURL)
+	return systemURL, nil
+}
+
+// redfishGet sends a GET request to a BMC and decodes the response into into
+func (i *Instances) redfishGet(ctx context.Context, resource string, into interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, resource, nil)
+	if err != nil {
+		return err
+	}
+	req.SetBasicAuth(i.username, i.password)
+	req.Header.Set("Accept", "application/json")
+	req.Header.Set("User-Agent", "cloud-lifecycle-controller")
+
+	resp, err := i.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if err := cloud.CheckResponse(resp, "getting "+resource, http.StatusServiceUnavailable); err != nil {
+		return err
+	}
+	if err := json.NewDecoder(resp.Body).Decode(into); err != nil {
+		return fmt.Errorf("unable to decode %s: %w", resource, err)
+	}
+	return nil
+}
@@ -0,0 +1,143 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cloud
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// Cache is an Instances implementation that remembers the results of another one for a short time, so a node that is
+// checked repeatedly (e.g. retried after an error, or looked at by several controllers) doesn't cause an API call each
+// time. Errors aren't cached.
+type Cache struct {
+	instances Instances
+	ttl       time.Duration
+
+	mu        sync.Mutex
+	entries   map[cacheKey]cacheEntry
+	lastSweep time.Time
+}
+
+// cacheKey identifies a cached result; exists, shutdown and evicted results are cached separately
+type cacheKey struct {
+	method     string
+	providerID string
+}
+
+type cacheEntry struct {
+	result  bool
+	expires time.Time
+}
+
+// NewCache returns a Cache of instances' results that keeps them for ttl. A zero ttl caches nothing.
+func NewCache(instances Instances, ttl time.Duration) *Cache {
+	return &Cache{instances: instances, ttl: ttl, entries: map[cacheKey]cacheEntry{}}
+}
+
+// noCacheKey is the context key of WithoutCache
+type noCacheKey struct{}
+
+// WithoutCache returns a context whose lookups skip the cached results of a Cache, e.g. when an operator asked for a
+// node to be re-checked. The fresh results are cached.
+func WithoutCache(ctx context.Context) context.Context {
+	return context.WithValue(ctx, noCacheKey{}, true)
+}
+
+// InstanceExistsByProviderID implements Instances
+func (c *Cache) InstanceExistsByProviderID(ctx context.Context, providerID string) (bool, error) {
+	return c.get(ctx, cacheKey{"exists", providerID}, func() (bool, error) {
+		return c.instances.InstanceExistsByProviderID(ctx, providerID)
+	})
+}
+
+// InstanceShutdownByProviderID implements Instances
+func (c *Cache) InstanceShutdownByProviderID(ctx context.Context, providerID string) (bool, error) {
+	return c.get(ctx, cacheKey{"shutdown", providerID}, func() (bool, error) {
+		return c.instances.InstanceShutdownByProviderID(ctx, providerID)
+	})
+}
+
+// InstanceMetadataByProviderID implements MetadataGetter, if the cached Instances implementation does. Metadata
+// isn't cached, since it's only looked up once per node.
+func (c *Cache) InstanceMetadataByProviderID(ctx context.Context, providerID string) (*Metadata, error) {
+	return InstanceMetadata(ctx, c.instances, providerID)
+}
+
+// InstanceEvictedByProviderID implements EvictionGetter, if the cached Instances implementation does
+func (c *Cache) InstanceEvictedByProviderID(ctx context.Context, providerID string) (bool, error) {
+	return c.get(ctx, cacheKey{"evicted", providerID}, func() (bool, error) {
+		return InstanceEvicted(ctx, c.instances, providerID)
+	})
+}
+
+// NodeProviderID implements NodeNamer, if the cached Instances implementation does
+func (c *Cache) NodeProviderID(nodeName string) string {
+	return NodeProviderID(c.instances, nodeName)
+}
+
+// CheckCoverage implements CoverageChecker, if the cached Instances implementation does
+func (c *Cache) CheckCoverage(ctx context.Context, providerIDs []string) error {
+	return CheckCoverage(ctx, c.instances, providerIDs)
+}
+
+// ListGroups implements GroupLister, if the cached Instances implementation does. Group membership isn't cached,
+// since it's listed in bulk on its own schedule.
+func (c *Cache) ListGroups(ctx context.Context, providerIDs []string) (*GroupMembership, error) {
+	return ListGroups(ctx, c.instances, providerIDs)
+}
+
+// get returns the cached result for key, calling lookup if there is none, it expired or ctx is WithoutCache
+func (c *Cache) get(ctx context.Context, key cacheKey, lookup func() (bool, error)) (bool, error) {
+	if c.ttl <= 0 {
+		return lookup()
+	}
+
+	now := time.Now()
+	c.mu.Lock()
+	entry, ok := c.entries[key]
+	c.mu.Unlock()
+	if skip, _ := ctx.Value(noCacheKey{}).(bool); ok && now.Before(entry.expires) && !skip {
+		return entry.result, nil
+	}
+
+	result, err := lookup()
+	if err != nil {
+		return result, err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.entries[key] = cacheEntry{result: result, expires: now.Add(c.ttl)}
+	c.sweep(now)
+	return result, nil
+}
+
+// sweep removes expired entries, at most once per ttl, so nodes that are gone don't stay in the cache forever.
+// c.mu must be held.
+func (c *Cache) sweep(now time.Time) {
+	if now.Sub(c.lastSweep) < c.ttl {
+		return
+	}
+	c.lastSweep = now
+	for key, entry := range c.entries {
+		if !now.Before(entry.expires) {
+			delete(c.entries, key)
+		}
+	}
+}
@@ -0,0 +1,297 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package cloud contains the cloud provider abstractions used by the controllers.
+package cloud
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws/awserr"
+
+	cloudprovider "k8s.io/cloud-provider"
+)
+
+// Instances is the subset of k8s.io/cloud-provider's Instances interface used by the controllers.
+// Any cloudprovider.Instances implementation satisfies it.
+type Instances interface {
+	// InstanceExistsByProviderID returns true if the instance for the given provider exists.
+	InstanceExistsByProviderID(ctx context.Context, providerID string) (bool, error)
+	// InstanceShutdownByProviderID returns true if the instance is shutdown in cloudprovider
+	InstanceShutdownByProviderID(ctx context.Context, providerID string) (bool, error)
+}
+
+// Metadata is an instance's type and placement, as the well-known node labels describe them
+type Metadata struct {
+	InstanceType string
+	Zone         string
+	Region       string
+}
+
+// MetadataGetter is implemented by the Instances implementations that can describe an instance's type and placement
+type MetadataGetter interface {
+	// InstanceMetadataByProviderID returns the instance's metadata, or nil if it doesn't exist
+	InstanceMetadataByProviderID(ctx context.Context, providerID string) (*Metadata, error)
+}
+
+// ErrMetadataNotSupported is returned by InstanceMetadata for Instances implementations that can't describe instances
+var ErrMetadataNotSupported = errors.New("cloud provider doesn't support instance metadata")
+
+// InstanceMetadata returns the metadata of the instance for the provider ID, or nil if it doesn't exist. It returns
+// ErrMetadataNotSupported if instances isn't a MetadataGetter.
+func InstanceMetadata(ctx context.Context, instances Instances, providerID string) (*Metadata, error) {
+	getter, ok := instances.(MetadataGetter)
+	if !ok {
+		return nil, ErrMetadataNotSupported
+	}
+	return getter.InstanceMetadataByProviderID(ctx, providerID)
+}
+
+// EvictionGetter is implemented by the Instances implementations that can tell spot evictions from other shutdowns,
+// e.g. Azure, whose evicted spot VMs are deallocated like VMs stopped on purpose
+type EvictionGetter interface {
+	// InstanceEvictedByProviderID returns true if the instance was shut down because its spot capacity was reclaimed
+	InstanceEvictedByProviderID(ctx context.Context, providerID string) (bool, error)
+}
+
+// InstanceEvicted returns true if the instance for the provider ID was evicted. Instances implementations that
+// aren't EvictionGetters never report evictions.
+func InstanceEvicted(ctx context.Context, instances Instances, providerID string) (bool, error) {
+	getter, ok := instances.(EvictionGetter)
+	if !ok {
+		return false, nil
+	}
+	return getter.InstanceEvictedByProviderID(ctx, providerID)
+}
+
+// NodeNamer is implemented by the Instances implementations whose instances are named after their nodes by
+// convention, e.g. libvirt domains, so nodes without a provider ID can still be looked up
+type NodeNamer interface {
+	// NodeProviderID returns the provider ID of the instance named after the node
+	NodeProviderID(nodeName string) string
+}
+
+// NodeProviderID returns the provider ID of the instance named after the node, or "" if instances isn't a NodeNamer
+func NodeProviderID(instances Instances, nodeName string) string {
+	namer, ok := instances.(NodeNamer)
+	if !ok {
+		return ""
+	}
+	return namer.NodeProviderID(nodeName)
+}
+
+// CoverageChecker is implemented by the Instances implementations whose state source may not know every instance,
+// e.g. AWS Config or Azure Resource Graph, so validate-config can tell before instances are taken for gone
+type CoverageChecker interface {
+	// CheckCoverage returns an error if the state source has no record of instances of the provider IDs that exist
+	CheckCoverage(ctx context.Context, providerIDs []string) error
+}
+
+// CheckCoverage checks that the state source of instances knows the instances of the provider IDs. Instances
+// implementations that aren't CoverageCheckers always do.
+func CheckCoverage(ctx context.Context, instances Instances, providerIDs []string) error {
+	checker, ok := instances.(CoverageChecker)
+	if !ok {
+		return nil
+	}
+	return checker.CheckCoverage(ctx, providerIDs)
+}
+
+// CredentialsError is returned by backends when a request fails because the credentials are expired, revoked or
+// can't be refreshed, i.e. when re-initializing the backend (and re-reading the credentials) might fix it
+type CredentialsError struct {
+	Err error
+}
+
+func (e *CredentialsError) Error() string {
+	return "cloud credentials: " + e.Err.Error()
+}
+
+func (e *CredentialsError) Unwrap() error {
+	return e.Err
+}
+
+// IsCredentialsError returns true if err is or wraps a CredentialsError
+func IsCredentialsError(err error) bool {
+	var credsErr *CredentialsError
+	return errors.As(err, &credsErr)
+}
+
+// ThrottlingError is returned by backends when the cloud API throttled a request, after the backend's own retries
+type ThrottlingError struct {
+	Err error
+	// RetryAfter is how long the cloud API asked to wait before retrying, zero if it didn't say
+	RetryAfter time.Duration
+}
+
+func (e *ThrottlingError) Error() string {
+	return "cloud API throttled: " + e.Err.Error()
+}
+
+func (e *ThrottlingError) Unwrap() error {
+	return e.Err
+}
+
+// RetryAfter returns how long to wait before retrying if err is or wraps a ThrottlingError, and whether it does
+func RetryAfter(err error) (time.Duration, bool) {
+	var throttlingErr *ThrottlingError
+	if !errors.As(err, &throttlingErr) {
+		return 0, false
+	}
+	return throttlingErr.RetryAfter, true
+}
+
+// IsInstanceNotFound returns true if err means that the instance doesn't exist: cloudprovider.InstanceNotFound, or an
+// EC2 InvalidInstanceID.NotFound error from cloud providers that pass those on. The backends in this repository
+// report missing instances as not existing instead.
+func IsInstanceNotFound(err error) bool {
+	if errors.Is(err, cloudprovider.InstanceNotFound) {
+		return true
+	}
+	var awsErr awserr.Error
+	return errors.As(err, &awsErr) && strings.HasPrefix(awsErr.Code(), "InvalidInstanceID.NotFound")
+}
+
+// Reloadable is an Instances implementation that can be swapped at runtime, e.g. when the cloud config changes
+type Reloadable struct {
+	mu        sync.RWMutex
+	instances Instances
+	failed    chan struct{}
+}
+
+// NewReloadable returns a Reloadable initially delegating to instances
+func NewReloadable(instances Instances) *Reloadable {
+	return &Reloadable{instances: instances, failed: make(chan struct{}, 1)}
+}
+
+// unavailable is the Instances of a Reloadable whose cloud provider couldn't be initialized yet
+type unavailable struct {
+	err error
+}
+
+func (u unavailable) InstanceExistsByProviderID(context.Context, string) (bool, error) {
+	return false, u.err
+}
+
+func (u unavailable) InstanceShutdownByProviderID(context.Context, string) (bool, error) {
+	return false, u.err
+}
+
+func (u unavailable) InstanceMetadataByProviderID(context.Context, string) (*Metadata, error) {
+	return nil, u.err
+}
+
+func (u unavailable) InstanceEvictedByProviderID(context.Context, string) (bool, error) {
+	return false, u.err
+}
+
+func (u unavailable) ListGroups(context.Context, []string) (*GroupMembership, error) {
+	return nil, u.err
+}
+
+// NewUnavailable returns a Reloadable for a cloud provider that couldn't be initialized because of err. Lookups fail
+// until Set is called, and CredentialsFailed receives a value right away, so the provider is re-initialized like
+// after a credentials failure.
+func NewUnavailable(err error) *Reloadable {
+	r := NewReloadable(unavailable{err: fmt.Errorf("cloud provider is not initialized: %w", err)})
+	r.failed <- struct{}{}
+	return r
+}
+
+// Available returns false while a Reloadable created with NewUnavailable hasn't been Set
+func (r *Reloadable) Available() bool {
+	_, ok := r.get().(unavailable)
+	return !ok
+}
+
+// CredentialsFailed returns a channel that receives a value when a call fails with a CredentialsError,
+// signaling that the backend should be re-initialized. Failures are coalesced until the value is received.
+func (r *Reloadable) CredentialsFailed() <-chan struct{} {
+	return r.failed
+}
+
+func (r *Reloadable) check(err error) {
+	if !IsCredentialsError(err) {
+		return
+	}
+	select {
+	case r.failed <- struct{}{}:
+	default:
+	}
+}
+
+// Set replaces the Instances implementation used for all subsequent calls
+func (r *Reloadable) Set(instances Instances) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.instances = instances
+}
+
+func (r *Reloadable) get() Instances {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.instances
+}
+
+// InstanceExistsByProviderID implements Instances
+func (r *Reloadable) InstanceExistsByProviderID(ctx context.Context, providerID string) (bool, error) {
+	exists, err := r.get().InstanceExistsByProviderID(ctx, providerID)
+	r.check(err)
+	return exists, err
+}
+
+// InstanceShutdownByProviderID implements Instances
+func (r *Reloadable) InstanceShutdownByProviderID(ctx context.Context, providerID string) (bool, error) {
+	shutdown, err := r.get().InstanceShutdownByProviderID(ctx, providerID)
+	r.check(err)
+	return shutdown, err
+}
+
+// InstanceMetadataByProviderID implements MetadataGetter, if the current Instances implementation does
+func (r *Reloadable) InstanceMetadataByProviderID(ctx context.Context, providerID string) (*Metadata, error) {
+	metadata, err := InstanceMetadata(ctx, r.get(), providerID)
+	r.check(err)
+	return metadata, err
+}
+
+// InstanceEvictedByProviderID implements EvictionGetter, if the current Instances implementation does
+func (r *Reloadable) InstanceEvictedByProviderID(ctx context.Context, providerID string) (bool, error) {
+	evicted, err := InstanceEvicted(ctx, r.get(), providerID)
+	r.check(err)
+	return evicted, err
+}
+
+// NodeProviderID implements NodeNamer, if the current Instances implementation does
+func (r *Reloadable) NodeProviderID(nodeName string) string {
+	return NodeProviderID(r.get(), nodeName)
+}
+
+// CheckCoverage implements CoverageChecker, if the current Instances implementation does
+func (r *Reloadable) CheckCoverage(ctx context.Context, providerIDs []string) error {
+	return CheckCoverage(ctx, r.get(), providerIDs)
+}
+
+// ListGroups implements GroupLister, if the current Instances implementation does
+func (r *Reloadable) ListGroups(ctx context.Context, providerIDs []string) (*GroupMembership, error) {
+	membership, err := ListGroups(ctx, r.get(), providerIDs)
+	r.check(err)
+	return membership, err
+}
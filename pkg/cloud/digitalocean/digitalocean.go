@@ -0,0 +1,155 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package digitalocean implements the cloud.Instances interface for DigitalOcean droplets.
+package digitalocean
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/nxtlytics/cloud-lifecycle-controller/pkg/cloud"
+)
+
+// DefaultAPIEndpoint is the DigitalOcean API endpoint droplets are looked up with
+const DefaultAPIEndpoint = "https://api.digitalocean.com/"
+
+// Config is the DigitalOcean configuration. DigitalOcean has no cloud config file, so it is set from flags and the
+// environment.
+type Config struct {
+	// Token is the API token droplets are looked up with. A read-only token is enough.
+	Token string
+	// APIEndpoint replaces DefaultAPIEndpoint, e.g. for testing
+	APIEndpoint string
+	// HTTPClient is used for all API requests if set, e.g. to trust a custom CA bundle
+	HTTPClient *http.Client
+	// Scope is the tag droplets must have, e.g. k8s:<cluster id>. Lookups of droplets without it fail with a
+	// cloud.OutOfScopeError.
+	Scope cloud.Scope
+}
+
+// Instances looks up droplets by provider ID (digitalocean://<droplet id>) with the DigitalOcean API
+type Instances struct {
+	client   *http.Client
+	token    string
+	endpoint string
+	scope    cloud.Scope
+}
+
+// New creates an Instances for the given config
+func New(cfg *Config) (*Instances, error) {
+	if cfg.Token == "" {
+		return nil, errors.New("no DigitalOcean API token")
+	}
+	client := cfg.HTTPClient
+	if client == nil {
+		client = http.DefaultClient
+	}
+	endpoint := cfg.APIEndpoint
+	if endpoint == "" {
+		endpoint = DefaultAPIEndpoint
+	}
+	return &Instances{
+		client:   client,
+		token:    cfg.Token,
+		endpoint: strings.TrimSuffix(endpoint, "/") + "/",
+		scope:    cfg.Scope,
+	}, nil
+}
+
+// droplet is the subset of a droplet the controller uses
+type droplet struct {
+	ID int `json:"id"`
+	// Status is new, active, off or archive
+	Status   string   `json:"status"`
+	SizeSlug string   `json:"size_slug"`
+	Tags     []string `json:"tags"`
+	Region   struct {
+		Slug string `json:"slug"`
+	} `json:"region"`
+}
+
+// getDroplet returns the droplet of a provider ID, or nil if it doesn't exist
+func (i *Instances) getDroplet(ctx context.Context, providerID string) (*droplet, error) {
+	id, err := parseProviderID(providerID)
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, i.endpoint+"v2/droplets/"+strconv.Itoa(id), nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Authorization", "Bearer "+i.token)
+	req.Header.Set("User-Agent", "cloud-lifecycle-controller")
+
+	resp, err := i.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotFound {
+		return nil, nil
+	}
+	if err := cloud.CheckResponse(resp, fmt.Sprintf("getting droplet %d", id)); err != nil {
+		return nil, err
+	}
+	body := &struct {
+		Droplet *droplet `json:"droplet"`
+	}{}
+	if err := json.NewDecoder(resp.Body).Decode(body); err != nil {
+		return nil, fmt.Errorf("unable to decode droplet %d: %w", id, err)
+	}
+	if body.Droplet == nil {
+		return nil, fmt.Errorf("no droplet in response for droplet %d", id)
+	}
+	if !i.scope.Allows(cloud.ParseTags(body.Droplet.Tags)) {
+		return nil, &cloud.OutOfScopeError{ProviderID: providerID, Scope: i.scope}
+	}
+	return body.Droplet, nil
+}
+
+// InstanceExistsByProviderID returns true if the droplet exists. Powered off droplets still exist.
+func (i *Instances) InstanceExistsByProviderID(ctx context.Context, providerID string) (bool, error) {
+	d, err := i.getDroplet(ctx, providerID)
+	return d != nil, err
+}
+
+// InstanceShutdownByProviderID returns true if the droplet is powered off or archived
+func (i *Instances) InstanceShutdownByProviderID(ctx context.Context, providerID string) (bool, error) {
+	d, err := i.getDroplet(ctx, providerID)
+	if err != nil || d == nil {
+		return false, err
+	}
+	return d.Status == "off" || d.Status == "archive", nil
+}
+
+// InstanceMetadataByProviderID implements cloud.MetadataGetter. DigitalOcean regions have no zones, so Zone is empty.
+func (i *Instances) InstanceMetadataByProviderID(ctx context.Context, providerID string) (*cloud.Metadata, error) {
+	d, err := i.getDroplet(ctx, providerID)
+	if err != nil || d == nil {
+		return nil, err
+	}
+	return &cloud.Metadata{
+		InstanceType: d.SizeSlug,
+		Region:       d.Region.Slug,
+	}, nil
+}
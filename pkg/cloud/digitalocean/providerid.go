@@ -0,0 +1,41 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package digitalocean
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// ProviderID returns the provider ID of a droplet, digitalocean://<droplet id>, as the DigitalOcean cloud controller
+// manager sets it
+func ProviderID(dropletID int) string {
+	return "digitalocean://" + strconv.Itoa(dropletID)
+}
+
+// parseProviderID returns the droplet ID of a provider ID like digitalocean://<droplet id>
+func parseProviderID(providerID string) (int, error) {
+	if !strings.HasPrefix(providerID, "digitalocean://") {
+		return 0, fmt.Errorf("not a DigitalOcean provider ID: %q", providerID)
+	}
+	id, err := strconv.Atoi(strings.TrimPrefix(providerID, "digitalocean://"))
+	if err != nil || id <= 0 {
+		return 0, fmt.Errorf("invalid DigitalOcean provider ID: %q", providerID)
+	}
+	return id, nil
+}
@@ -0,0 +1,168 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package equinixmetal implements the cloud.Instances interface for Equinix Metal devices.
+package equinixmetal
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/nxtlytics/cloud-lifecycle-controller/pkg/cloud"
+)
+
+// DefaultAPIEndpoint is the Equinix Metal API endpoint devices are looked up with
+const DefaultAPIEndpoint = "https://api.equinix.com/metal/v1/"
+
+// Config is the Equinix Metal configuration. It is set from flags and the environment.
+type Config struct {
+	// Token is the API token devices are looked up with. A read-only project or user token is enough.
+	Token string
+	// APIEndpoint replaces DefaultAPIEndpoint, e.g. for testing
+	APIEndpoint string
+	// HTTPClient is used for all API requests if set, e.g. to trust a custom CA bundle
+	HTTPClient *http.Client
+	// Scope is the tag devices must have. Equinix Metal tags are plain strings, so a tag like k8s:<cluster id> has the
+	// key k8s. Lookups of devices without it fail with a cloud.OutOfScopeError.
+	Scope cloud.Scope
+}
+
+// Instances looks up devices by provider ID (equinixmetal://<device id>) with the Equinix Metal API
+type Instances struct {
+	client   *http.Client
+	token    string
+	endpoint string
+	scope    cloud.Scope
+}
+
+// New creates an Instances for the given config
+func New(cfg *Config) (*Instances, error) {
+	if cfg.Token == "" {
+		return nil, errors.New("no Equinix Metal API token")
+	}
+	client := cfg.HTTPClient
+	if client == nil {
+		client = http.DefaultClient
+	}
+	endpoint := cfg.APIEndpoint
+	if endpoint == "" {
+		endpoint = DefaultAPIEndpoint
+	}
+	return &Instances{
+		client:   client,
+		token:    cfg.Token,
+		endpoint: strings.TrimSuffix(endpoint, "/") + "/",
+		scope:    cfg.Scope,
+	}, nil
+}
+
+// device is the subset of a device the controller uses
+type device struct {
+	ID string `json:"id"`
+	// State is e.g. queued, provisioning, active, powering_off, inactive, reinstalling, deprovisioning or failed
+	State string   `json:"state"`
+	Tags  []string `json:"tags"`
+	Plan  struct {
+		Slug string `json:"slug"`
+	} `json:"plan"`
+	Metro *struct {
+		Code string `json:"code"`
+	} `json:"metro"`
+	Facility *struct {
+		Code string `json:"code"`
+	} `json:"facility"`
+}
+
+// getDevice returns the device of a provider ID, or nil if it doesn't exist
+func (i *Instances) getDevice(ctx context.Context, providerID string) (*device, error) {
+	id, err := parseProviderID(providerID)
+	if err != nil {
+		return nil, err
+	}
+	query := url.Values{"include": {"plan,metro,facility"}}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet,
+		i.endpoint+"devices/"+url.PathEscape(id)+"?"+query.Encode(), nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("X-Auth-Token", i.token)
+	req.Header.Set("Accept", "application/json")
+	req.Header.Set("User-Agent", "cloud-lifecycle-controller")
+
+	resp, err := i.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotFound {
+		return nil, nil
+	}
+	if err := cloud.CheckResponse(resp, "getting device "+id); err != nil {
+		return nil, err
+	}
+	d := &device{}
+	if err := json.NewDecoder(resp.Body).Decode(d); err != nil {
+		return nil, fmt.Errorf("unable to decode device %s: %w", id, err)
+	}
+	if !i.scope.Allows(cloud.ParseTags(d.Tags)) {
+		return nil, &cloud.OutOfScopeError{ProviderID: providerID, Scope: i.scope}
+	}
+	return d, nil
+}
+
+// InstanceExistsByProviderID returns true if the device exists. Powered off devices still exist.
+func (i *Instances) InstanceExistsByProviderID(ctx context.Context, providerID string) (bool, error) {
+	d, err := i.getDevice(ctx, providerID)
+	return d != nil, err
+}
+
+// InstanceShutdownByProviderID returns true if the device is powering off, powered off (inactive) or being
+// deprovisioned
+func (i *Instances) InstanceShutdownByProviderID(ctx context.Context, providerID string) (bool, error) {
+	d, err := i.getDevice(ctx, providerID)
+	if err != nil || d == nil {
+		return false, err
+	}
+	switch d.State {
+	case "powering_off", "inactive", "deprovisioning":
+		return true, nil
+	default:
+		return false, nil
+	}
+}
+
+// InstanceMetadataByProviderID implements cloud.MetadataGetter. The metro (e.g. da) is the region and the facility
+// (e.g. da11) the zone, like the Equinix Metal cloud controller manager labels them.
+func (i *Instances) InstanceMetadataByProviderID(ctx context.Context, providerID string) (*cloud.Metadata, error) {
+	d, err := i.getDevice(ctx, providerID)
+	if err != nil || d == nil {
+		return nil, err
+	}
+	metadata := &cloud.Metadata{InstanceType: d.Plan.Slug}
+	if d.Metro != nil {
+		metadata.Region = d.Metro.Code
+	}
+	if d.Facility != nil {
+		metadata.Zone = d.Facility.Code
+	}
+	return metadata, nil
+}
@@ -0,0 +1,46 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package equinixmetal
+
+import (
+	"fmt"
+	"strings"
+)
+
+// ProviderID returns the provider ID of a device, equinixmetal://<device id>, as the Equinix Metal cloud controller
+// manager sets it
+func ProviderID(deviceID string) string {
+	return "equinixmetal://" + deviceID
+}
+
+// parseProviderID returns the device ID of a provider ID like equinixmetal://<device id>, or packet://<device id> as
+// set by the cloud controller manager before Packet became Equinix Metal
+func parseProviderID(providerID string) (string, error) {
+	var id string
+	switch {
+	case strings.HasPrefix(providerID, "equinixmetal://"):
+		id = strings.TrimPrefix(providerID, "equinixmetal://")
+	case strings.HasPrefix(providerID, "packet://"):
+		id = strings.TrimPrefix(providerID, "packet://")
+	default:
+		return "", fmt.Errorf("not an Equinix Metal provider ID: %q", providerID)
+	}
+	if id == "" || strings.Contains(id, "/") {
+		return "", fmt.Errorf("invalid Equinix Metal provider ID: %q", providerID)
+	}
+	return id, nil
+}
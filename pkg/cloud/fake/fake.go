@@ -0,0 +1,130 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package fake contains a scripted cloud.Instances for exercising the controllers without a cloud provider, e.g. in
+// envtest scenarios where an instance disappears, reappears or the cloud API throttles lookups.
+package fake
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/nxtlytics/cloud-lifecycle-controller/pkg/cloud"
+)
+
+// State is what the fake cloud reports for an instance at one step of its script
+type State struct {
+	Exists   bool
+	Shutdown bool
+	// Evicted reports a shut down instance as a spot instance whose capacity was reclaimed
+	Evicted bool
+	// Err, if set, is returned by both lookups instead of the state
+	Err error
+}
+
+var (
+	// Running is an instance that exists and is running
+	Running = State{Exists: true}
+	// Stopped is an instance that exists and is shut down
+	Stopped = State{Exists: true, Shutdown: true}
+	// Gone is an instance that doesn't exist
+	Gone = State{}
+	// Evicted is a spot instance that exists, shut down after its capacity was reclaimed
+	Evicted = State{Exists: true, Shutdown: true, Evicted: true}
+)
+
+// Throttled is a lookup throttled by the cloud API, asking to retry after retryAfter
+func Throttled(retryAfter time.Duration) State {
+	return State{Err: &cloud.ThrottlingError{Err: errThrottled, RetryAfter: retryAfter}}
+}
+
+var errThrottled = errors.New("request limit exceeded")
+
+// Instances is a cloud.Instances that plays back a script of states for each provider ID. Each
+// InstanceExistsByProviderID call advances the instance to the next state of its script, and the last state is
+// repeated once the script runs out; InstanceShutdownByProviderID and InstanceEvictedByProviderID report the current
+// state. Instances without a script don't exist.
+type Instances struct {
+	mu      sync.Mutex
+	scripts map[string][]State
+	calls   map[string]int
+}
+
+var (
+	_ cloud.Instances      = &Instances{}
+	_ cloud.EvictionGetter = &Instances{}
+)
+
+// New returns an Instances with no scripts
+func New() *Instances {
+	return &Instances{scripts: map[string][]State{}, calls: map[string]int{}}
+}
+
+// Script replaces the script of the instance with the given provider ID and restarts it
+func (f *Instances) Script(providerID string, states ...State) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.scripts[providerID] = states
+	f.calls[providerID] = 0
+}
+
+// Calls returns the number of InstanceExistsByProviderID calls for the given provider ID since its script was set
+func (f *Instances) Calls(providerID string) int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.calls[providerID]
+}
+
+// current returns the state of the instance, advancing its script first if advance is set
+func (f *Instances) current(providerID string, advance bool) State {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	script := f.scripts[providerID]
+	if len(script) == 0 {
+		return Gone
+	}
+	if advance {
+		f.calls[providerID]++
+	}
+	step := f.calls[providerID] - 1
+	if step < 0 {
+		step = 0
+	}
+	if step >= len(script) {
+		step = len(script) - 1
+	}
+	return script[step]
+}
+
+// InstanceExistsByProviderID implements cloud.Instances
+func (f *Instances) InstanceExistsByProviderID(_ context.Context, providerID string) (bool, error) {
+	state := f.current(providerID, true)
+	return state.Exists, state.Err
+}
+
+// InstanceShutdownByProviderID implements cloud.Instances
+func (f *Instances) InstanceShutdownByProviderID(_ context.Context, providerID string) (bool, error) {
+	state := f.current(providerID, false)
+	return state.Shutdown, state.Err
+}
+
+// InstanceEvictedByProviderID implements cloud.EvictionGetter
+func (f *Instances) InstanceEvictedByProviderID(_ context.Context, providerID string) (bool, error) {
+	state := f.current(providerID, false)
+	return state.Evicted, state.Err
+}
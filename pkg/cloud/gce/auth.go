@@ -0,0 +1,134 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package gce
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"time"
+
+	"golang.org/x/oauth2"
+	"golang.org/x/oauth2/google"
+)
+
+// computeScope is the OAuth scope needed to read instances
+const computeScope = "https://www.googleapis.com/auth/compute.readonly"
+
+// iamCredentialsURL is the IAM Credentials API endpoint that mints access tokens for impersonated service accounts
+const iamCredentialsURL = "https://iamcredentials.googleapis.com/v1/projects/-/serviceAccounts/%s:generateAccessToken"
+
+// AuthOptions configures how the GCE backend authenticates
+type AuthOptions struct {
+	// CredentialsFile is a service account key file. If empty, Application Default Credentials are used, which
+	// covers GKE Workload Identity (through the metadata server) and GOOGLE_APPLICATION_CREDENTIALS.
+	CredentialsFile string
+	// ImpersonateServiceAccount is the email of a service account to impersonate with the base credentials
+	ImpersonateServiceAccount string
+	// Delegates is the chain of service accounts to impersonate through to ImpersonateServiceAccount
+	Delegates []string
+}
+
+// TokenSource returns a token source for the compute API. Tokens are cached and refreshed before they expire.
+func TokenSource(ctx context.Context, opts AuthOptions) (oauth2.TokenSource, error) {
+	var base oauth2.TokenSource
+	scopes := []string{computeScope}
+	if opts.ImpersonateServiceAccount != "" {
+		// the base credentials only need to be able to call the IAM Credentials API
+		scopes = []string{"https://www.googleapis.com/auth/cloud-platform"}
+	}
+
+	if opts.CredentialsFile != "" {
+		data, err := ioutil.ReadFile(opts.CredentialsFile)
+		if err != nil {
+			return nil, fmt.Errorf("unable to read GCP credentials file: %w", err)
+		}
+		creds, err := google.CredentialsFromJSON(ctx, data, scopes...)
+		if err != nil {
+			return nil, fmt.Errorf("unable to parse GCP credentials file: %w", err)
+		}
+		base = creds.TokenSource
+	} else {
+		creds, err := google.FindDefaultCredentials(ctx, scopes...)
+		if err != nil {
+			return nil, fmt.Errorf("unable to find GCP application default credentials: %w", err)
+		}
+		base = creds.TokenSource
+	}
+
+	if opts.ImpersonateServiceAccount == "" {
+		return base, nil
+	}
+	return oauth2.ReuseTokenSource(nil, &impersonatedTokenSource{
+		ctx:       ctx,
+		client:    oauth2.NewClient(ctx, base),
+		target:    opts.ImpersonateServiceAccount,
+		delegates: opts.Delegates,
+	}), nil
+}
+
+// impersonatedTokenSource mints access tokens for a service account with the IAM Credentials API
+type impersonatedTokenSource struct {
+	ctx       context.Context
+	client    *http.Client
+	target    string
+	delegates []string
+}
+
+// Token implements oauth2.TokenSource
+func (s *impersonatedTokenSource) Token() (*oauth2.Token, error) {
+	delegates := make([]string, 0, len(s.delegates))
+	for _, delegate := range s.delegates {
+		delegates = append(delegates, "projects/-/serviceAccounts/"+delegate)
+	}
+	body, err := json.Marshal(map[string]interface{}{
+		"scope":     []string{computeScope},
+		"delegates": delegates,
+		"lifetime":  "3600s",
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequestWithContext(s.ctx, http.MethodPost, fmt.Sprintf(iamCredentialsURL, s.target), bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("unable to impersonate %s: %w", s.target, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		msg, _ := ioutil.ReadAll(resp.Body)
+		return nil, fmt.Errorf("unable to impersonate %s: %s: %s", s.target, resp.Status, msg)
+	}
+
+	var result struct {
+		AccessToken string    `json:"accessToken"`
+		ExpireTime  time.Time `json:"expireTime"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return nil, fmt.Errorf("unable to decode impersonated token: %w", err)
+	}
+	return &oauth2.Token{AccessToken: result.AccessToken, TokenType: "Bearer", Expiry: result.ExpireTime}, nil
+}
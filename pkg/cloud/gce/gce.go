@@ -0,0 +1,287 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package gce implements the cloud.Instances interface for Google Compute Engine instances.
+package gce
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/nxtlytics/cloud-lifecycle-controller/pkg/cloud"
+	"golang.org/x/oauth2"
+	"gopkg.in/gcfg.v1"
+)
+
+// DefaultAPIEndpoint is the compute API endpoint instances are looked up with
+const DefaultAPIEndpoint = "https://compute.googleapis.com/compute/v1/"
+
+// Config is the GCE cloud config. It has the same format as the legacy GCE cloud provider's gce.conf so existing files
+// keep working; settings the controller has no use for (project, network, node tags, ...) are ignored, since
+// instances are looked up in the project and zone of their provider ID.
+type Config struct {
+	Global struct {
+		// APIEndpoint replaces DefaultAPIEndpoint, e.g. to use Private Service Connect
+		APIEndpoint string `gcfg:"api-endpoint"`
+	}
+
+	// Auth selects the credentials. It can't be set in the config file.
+	Auth AuthOptions
+	// HTTPClient is used for all API and token requests if set, e.g. to trust a custom CA bundle.
+	// It can't be set in the config file.
+	HTTPClient *http.Client
+	// BatchWindow is how long lookups wait for lookups of other instances in the same zone, so they can share a
+	// single list call. Zero gets each instance on its own. It can't be set in the config file.
+	BatchWindow time.Duration
+	// Scope is the label instances must have, e.g. goog-k8s-cluster-name=<name>. Lookups of instances without it fail
+	// with a cloud.OutOfScopeError. It can't be set in the config file.
+	Scope cloud.Scope
+}
+
+// ReadConfig parses a GCE cloud config. A nil reader returns an empty config.
+func ReadConfig(r io.Reader) (*Config, error) {
+	cfg := &Config{}
+	if r == nil {
+		return cfg, nil
+	}
+	if err := gcfg.FatalOnly(gcfg.ReadInto(cfg, r)); err != nil {
+		return nil, fmt.Errorf("unable to read GCE cloud config: %w", err)
+	}
+	return cfg, nil
+}
+
+// Instances looks up GCE instances by provider ID (gce://<project>/<zone>/<instance>) with the compute API.
+// Credentials come from AuthOptions: a service account key file, or Application Default Credentials, which covers
+// GKE Workload Identity and the instance's service account.
+type Instances struct {
+	client   *http.Client
+	endpoint string
+	scope    cloud.Scope
+	batcher  *cloud.Batcher
+}
+
+// listBatchSize is the most instances of a zone listed with a single call, so the name filter stays short
+const listBatchSize = 100
+
+// New creates an Instances for the given config
+func New(ctx context.Context, cfg *Config) (*Instances, error) {
+	if cfg.HTTPClient != nil {
+		// also used for token requests
+		ctx = context.WithValue(ctx, oauth2.HTTPClient, cfg.HTTPClient)
+	}
+	tokens, err := TokenSource(ctx, cfg.Auth)
+	if err != nil {
+		return nil, err
+	}
+
+	endpoint := cfg.Global.APIEndpoint
+	if endpoint == "" {
+		endpoint = DefaultAPIEndpoint
+	}
+	i := &Instances{
+		client:   oauth2.NewClient(ctx, tokens),
+		endpoint: strings.TrimSuffix(endpoint, "/") + "/",
+		scope:    cfg.Scope,
+	}
+	i.batcher = cloud.NewBatcher(cfg.BatchWindow, listBatchSize, i.listInstances)
+	return i, nil
+}
+
+// computeInstance is the subset of a compute instance the controller uses
+type computeInstance struct {
+	Name string `json:"name"`
+	// Status is e.g. RUNNING, STOPPING or TERMINATED (which means stopped, not deleted)
+	Status      string            `json:"status"`
+	MachineType string            `json:"machineType"`
+	Zone        string            `json:"zone"`
+	Labels      map[string]string `json:"labels"`
+}
+
+// instanceFields are the fields requested for each instance
+const instanceFields = "name,status,machineType,zone,labels"
+
+// getInstance returns the instance of a provider ID, or nil if it doesn't exist
+func (i *Instances) getInstance(ctx context.Context, providerID string) (*computeInstance, error) {
+	inst, err := parseProviderID(providerID)
+	if err != nil {
+		return nil, err
+	}
+	found, err := i.batcher.Get(ctx, inst.group(), inst.Name)
+	if err != nil || found == nil {
+		return nil, err
+	}
+	if !i.scope.Allows(found.(*computeInstance).Labels) {
+		return nil, &cloud.OutOfScopeError{ProviderID: providerID, Scope: i.scope}
+	}
+	return found.(*computeInstance), nil
+}
+
+// instanceList is a page of the instances of a zone
+type instanceList struct {
+	Items         []*computeInstance `json:"items"`
+	NextPageToken string             `json:"nextPageToken"`
+}
+
+// listInstances returns the instances with the given names in a project and zone (the group, <project>/<zone>),
+// keyed by name. A single name is looked up with a get call, since that's cheaper than filtering a list.
+func (i *Instances) listInstances(ctx context.Context, group string, names []string) (map[string]interface{}, error) {
+	zonePath := "projects/" + strings.Replace(group, "/", "/zones/", 1) + "/instances"
+	found := map[string]interface{}{}
+
+	if len(names) == 1 {
+		inst := &computeInstance{}
+		ok, err := i.get(ctx, zonePath+"/"+url.PathEscape(names[0]), url.Values{"fields": {instanceFields}}, inst)
+		if err != nil || !ok {
+			return found, err
+		}
+		found[inst.Name] = inst
+		return found, nil
+	}
+
+	filters := make([]string, 0, len(names))
+	for _, name := range names {
+		filters = append(filters, fmt.Sprintf("(name = %q)", name))
+	}
+	query := url.Values{
+		"filter": {strings.Join(filters, " OR ")},
+		"fields": {"items(" + instanceFields + "),nextPageToken"},
+	}
+	for {
+		page := &instanceList{}
+		ok, err := i.get(ctx, zonePath, query, page)
+		if err != nil || !ok {
+			// a zone that doesn't exist has no instances
+			return found, err
+		}
+		for _, inst := range page.Items {
+			found[inst.Name] = inst
+		}
+		if page.NextPageToken == "" {
+			return found, nil
+		}
+		query.Set("pageToken", page.NextPageToken)
+	}
+}
+
+// get sends a GET request to the compute API and decodes the response into into. It returns false if the resource
+// doesn't exist.
+func (i *Instances) get(ctx context.Context, resource string, query url.Values, into interface{}) (bool, error) {
+	return i.call(ctx, http.MethodGet, resource, query, into)
+}
+
+// call sends a request without a body to the compute API and decodes the response into into. It returns false if the
+// resource doesn't exist.
+func (i *Instances) call(ctx context.Context, method, resource string, query url.Values, into interface{}) (bool, error) {
+	req, err := http.NewRequestWithContext(ctx, method, i.endpoint+resource+"?"+query.Encode(), nil)
+	if err != nil {
+		return false, err
+	}
+	req.Header.Set("User-Agent", "cloud-lifecycle-controller")
+
+	resp, err := i.client.Do(req)
+	if err != nil {
+		var tokenErr *oauth2.RetrieveError
+		if errors.As(err, &tokenErr) {
+			return false, &cloud.CredentialsError{Err: err}
+		}
+		return false, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotFound {
+		return false, nil
+	}
+	action := "getting " + resource
+	if method != http.MethodGet {
+		action = "calling " + resource
+	}
+	if err := checkResponse(resp, action); err != nil {
+		return false, err
+	}
+	if err := json.NewDecoder(resp.Body).Decode(into); err != nil {
+		return false, fmt.Errorf("unable to decode %s: %w", resource, err)
+	}
+	return true, nil
+}
+
+// apiError is the error body of the compute API
+type apiError struct {
+	Error struct {
+		Errors []struct {
+			Reason string `json:"reason"`
+		} `json:"errors"`
+	} `json:"error"`
+}
+
+// checkResponse returns an error for responses other than 200 OK, including quota errors, which are 403s with a
+// rate limit reason, as throttling errors
+func checkResponse(resp *http.Response, action string) error {
+	err := cloud.CheckResponse(resp, action)
+	statusErr, ok := err.(*cloud.StatusError)
+	parsed := &apiError{}
+	if !ok || statusErr.StatusCode != http.StatusForbidden || json.Unmarshal(statusErr.Body, parsed) != nil {
+		return err
+	}
+	for _, e := range parsed.Error.Errors {
+		if e.Reason == "rateLimitExceeded" || e.Reason == "userRateLimitExceeded" {
+			return &cloud.ThrottlingError{Err: err}
+		}
+	}
+	return err
+}
+
+// InstanceExistsByProviderID returns true if the instance exists. Stopped instances (TERMINATED) still exist.
+func (i *Instances) InstanceExistsByProviderID(ctx context.Context, providerID string) (bool, error) {
+	inst, err := i.getInstance(ctx, providerID)
+	return inst != nil, err
+}
+
+// InstanceShutdownByProviderID returns true if the instance is stopping, stopped or suspended
+func (i *Instances) InstanceShutdownByProviderID(ctx context.Context, providerID string) (bool, error) {
+	inst, err := i.getInstance(ctx, providerID)
+	if err != nil || inst == nil {
+		return false, err
+	}
+	switch inst.Status {
+	case "STOPPING", "TERMINATED", "SUSPENDING", "SUSPENDED":
+		return true, nil
+	default:
+		return false, nil
+	}
+}
+
+// InstanceMetadataByProviderID implements cloud.MetadataGetter
+func (i *Instances) InstanceMetadataByProviderID(ctx context.Context, providerID string) (*cloud.Metadata, error) {
+	inst, err := i.getInstance(ctx, providerID)
+	if err != nil || inst == nil {
+		return nil, err
+	}
+	// machine types and zones are returned as URLs
+	zone := path.Base(inst.Zone)
+	return &cloud.Metadata{
+		InstanceType: path.Base(inst.MachineType),
+		Zone:         zone,
+		Region:       regionFromZone(zone),
+	}, nil
+}
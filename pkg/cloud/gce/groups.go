@@ -0,0 +1,163 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package gce
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+
+	"github.com/nxtlytics/cloud-lifecycle-controller/pkg/cloud"
+)
+
+// groupManagerList is a page of the managed instance groups of a zone or region
+type groupManagerList struct {
+	Items []struct {
+		Name string `json:"name"`
+	} `json:"items"`
+	NextPageToken string `json:"nextPageToken"`
+}
+
+// managedInstanceList is a page of the instances of a managed instance group
+type managedInstanceList struct {
+	ManagedInstances []struct {
+		// Instance is the instance's URL
+		Instance string `json:"instance"`
+		// CurrentAction is e.g. NONE, CREATING or DELETING
+		CurrentAction string `json:"currentAction"`
+	} `json:"managedInstances"`
+	NextPageToken string `json:"nextPageToken"`
+}
+
+// ListGroups implements cloud.GroupLister. It lists the zonal managed instance groups of the provider IDs' zones and
+// the regional ones of their regions, named <project>/<zone or region>/<name>; only groups with at least one of the
+// provider IDs' instances are included.
+func (i *Instances) ListGroups(ctx context.Context, providerIDs []string) (*cloud.GroupMembership, error) {
+	byInstance := map[string]string{}
+	// the zones and regions to list groups in, as projects/<project>/zones/<zone> or projects/<project>/regions/<region>
+	locations := map[string]bool{}
+	for _, providerID := range providerIDs {
+		inst, err := parseProviderID(providerID)
+		if err != nil {
+			continue
+		}
+		byInstance[ProviderID(inst.Project, inst.Zone, inst.Name)] = providerID
+		locations["projects/"+inst.Project+"/zones/"+inst.Zone] = true
+		locations["projects/"+inst.Project+"/regions/"+regionFromZone(inst.Zone)] = true
+	}
+	sorted := make([]string, 0, len(locations))
+	for location := range locations {
+		sorted = append(sorted, location)
+	}
+	sort.Strings(sorted)
+
+	membership := &cloud.GroupMembership{Groups: map[string]string{}, Others: map[string][]string{}}
+	for _, location := range sorted {
+		names, err := i.listGroupManagers(ctx, location)
+		if err != nil {
+			return nil, err
+		}
+		for _, name := range names {
+			members, err := i.listManagedInstances(ctx, location+"/instanceGroupManagers/"+url.PathEscape(name))
+			if err != nil {
+				return nil, err
+			}
+			group := groupName(location, name)
+			var others []string
+			var matched bool
+			for _, member := range members {
+				if providerID, ok := byInstance[member]; ok {
+					membership.Groups[providerID] = group
+					matched = true
+					continue
+				}
+				others = append(others, member)
+			}
+			if matched && len(others) > 0 {
+				membership.Others[group] = others
+			}
+		}
+	}
+	return membership, nil
+}
+
+// groupName returns the name of a group in a location, <project>/<zone or region>/<name>
+func groupName(location, name string) string {
+	parts := strings.Split(location, "/")
+	return parts[1] + "/" + parts[3] + "/" + name
+}
+
+// listGroupManagers returns the names of the managed instance groups of a location
+func (i *Instances) listGroupManagers(ctx context.Context, location string) ([]string, error) {
+	var names []string
+	query := url.Values{"fields": {"items(name),nextPageToken"}}
+	for {
+		page := &groupManagerList{}
+		ok, err := i.get(ctx, location+"/instanceGroupManagers", query, page)
+		if err != nil || !ok {
+			return names, err
+		}
+		for _, item := range page.Items {
+			names = append(names, item.Name)
+		}
+		if page.NextPageToken == "" {
+			return names, nil
+		}
+		query.Set("pageToken", page.NextPageToken)
+	}
+}
+
+// listManagedInstances returns the provider IDs of the instances of a managed instance group, leaving out those being
+// deleted or abandoned
+func (i *Instances) listManagedInstances(ctx context.Context, manager string) ([]string, error) {
+	var providerIDs []string
+	query := url.Values{}
+	for {
+		page := &managedInstanceList{}
+		ok, err := i.call(ctx, http.MethodPost, manager+"/listManagedInstances", query, page)
+		if err != nil || !ok {
+			return providerIDs, err
+		}
+		for _, member := range page.ManagedInstances {
+			switch member.CurrentAction {
+			case "DELETING", "ABANDONING":
+				continue
+			}
+			if providerID := providerIDFromURL(member.Instance); providerID != "" {
+				providerIDs = append(providerIDs, providerID)
+			}
+		}
+		if page.NextPageToken == "" {
+			return providerIDs, nil
+		}
+		query.Set("pageToken", page.NextPageToken)
+	}
+}
+
+// providerIDFromURL returns the provider ID of an instance URL, .../projects/<project>/zones/<zone>/instances/<name>,
+// or "" if it isn't one
+func providerIDFromURL(instanceURL string) string {
+	parts := strings.Split(instanceURL, "/")
+	for i := 0; i+5 < len(parts); i++ {
+		if parts[i] == "projects" && parts[i+2] == "zones" && parts[i+4] == "instances" {
+			return ProviderID(parts[i+1], parts[i+3], parts[i+5])
+		}
+	}
+	return ""
+}
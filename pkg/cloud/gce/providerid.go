@@ -0,0 +1,60 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package gce
+
+import (
+	"fmt"
+	"strings"
+)
+
+// instance identifies a GCE instance by its project, zone and name
+type instance struct {
+	Project string
+	Zone    string
+	Name    string
+}
+
+// ProviderID returns the provider ID of a GCE instance, gce://<project>/<zone>/<instance>, as the kubelet and the
+// GCE cloud provider set it
+func ProviderID(project, zone, name string) string {
+	return "gce://" + project + "/" + zone + "/" + name
+}
+
+// parseProviderID parses a provider ID like gce://<project>/<zone>/<instance>
+func parseProviderID(providerID string) (*instance, error) {
+	if !strings.HasPrefix(providerID, "gce://") {
+		return nil, fmt.Errorf("not a GCE provider ID: %q", providerID)
+	}
+	parts := strings.Split(strings.TrimPrefix(providerID, "gce://"), "/")
+	if len(parts) != 3 || parts[0] == "" || parts[1] == "" || parts[2] == "" {
+		return nil, fmt.Errorf("invalid GCE provider ID: %q", providerID)
+	}
+	return &instance{Project: parts[0], Zone: parts[1], Name: parts[2]}, nil
+}
+
+// group returns the project and zone of the instance, which are looked up together
+func (i *instance) group() string {
+	return i.Project + "/" + i.Zone
+}
+
+// regionFromZone returns the region of a zone, e.g. us-central1 for us-central1-a
+func regionFromZone(zone string) string {
+	if i := strings.LastIndex(zone, "-"); i > 0 {
+		return zone[:i]
+	}
+	return zone
+}
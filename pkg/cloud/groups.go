@@ -0,0 +1,52 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cloud
+
+import (
+	"context"
+	"errors"
+)
+
+// GroupMembership is which autoscaling groups (AWS Auto Scaling groups, Azure scale sets, GCE managed instance groups)
+// the instances of some provider IDs are members of, and which other instances the groups have
+type GroupMembership struct {
+	// Groups maps each of the provider IDs whose instance is a member of a group to the group's name
+	Groups map[string]string
+	// Others holds the provider IDs of the members of each group that aren't among the provider IDs, by group name
+	Others map[string][]string
+}
+
+// GroupLister is implemented by the Instances implementations that can list the members of autoscaling groups in bulk,
+// which is far cheaper than looking up each instance in large clusters
+type GroupLister interface {
+	// ListGroups returns the membership of the groups the provider IDs' instances may belong to. Instances that
+	// aren't in any group the backend can find are left out of GroupMembership.Groups.
+	ListGroups(ctx context.Context, providerIDs []string) (*GroupMembership, error)
+}
+
+// ErrGroupsNotSupported is returned by ListGroups for Instances implementations that can't list groups
+var ErrGroupsNotSupported = errors.New("cloud provider doesn't support listing autoscaling groups")
+
+// ListGroups returns the group membership of the provider IDs' instances. It returns ErrGroupsNotSupported if
+// instances isn't a GroupLister.
+func ListGroups(ctx context.Context, instances Instances, providerIDs []string) (*GroupMembership, error) {
+	lister, ok := instances.(GroupLister)
+	if !ok {
+		return nil, ErrGroupsNotSupported
+	}
+	return lister.ListGroups(ctx, providerIDs)
+}
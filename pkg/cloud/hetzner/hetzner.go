@@ -0,0 +1,197 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package hetzner implements the cloud.Instances interface for Hetzner Cloud servers.
+package hetzner
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/nxtlytics/cloud-lifecycle-controller/pkg/cloud"
+)
+
+// DefaultAPIEndpoint is the Hetzner Cloud API endpoint servers are looked up with
+const DefaultAPIEndpoint = "https://api.hetzner.cloud/v1/"
+
+// Config is the Hetzner Cloud configuration. Hetzner Cloud has no cloud config file, so it is set from flags and the
+// environment.
+type Config struct {
+	// Token is the API token servers are looked up with. A read-only token is enough.
+	Token string
+	// APIEndpoint replaces DefaultAPIEndpoint, e.g. for testing
+	APIEndpoint string
+	// HTTPClient is used for all API requests if set, e.g. to trust a custom CA bundle
+	HTTPClient *http.Client
+	// Scope is the label servers must have. Lookups of servers without it fail with a cloud.OutOfScopeError.
+	Scope cloud.Scope
+}
+
+// Instances looks up Hetzner Cloud servers by provider ID (hcloud://<server id>) with the Hetzner Cloud API
+type Instances struct {
+	client   *http.Client
+	token    string
+	endpoint string
+	scope    cloud.Scope
+}
+
+// New creates an Instances for the given config
+func New(cfg *Config) (*Instances, error) {
+	if cfg.Token == "" {
+		return nil, errors.New("no Hetzner Cloud API token")
+	}
+	client := cfg.HTTPClient
+	if client == nil {
+		client = http.DefaultClient
+	}
+	endpoint := cfg.APIEndpoint
+	if endpoint == "" {
+		endpoint = DefaultAPIEndpoint
+	}
+	return &Instances{
+		client:   client,
+		token:    cfg.Token,
+		endpoint: strings.TrimSuffix(endpoint, "/") + "/",
+		scope:    cfg.Scope,
+	}, nil
+}
+
+// hcloudServer is the subset of a server the controller uses
+type hcloudServer struct {
+	ID   int64  `json:"id"`
+	Name string `json:"name"`
+	// Status is e.g. running, initializing, starting, stopping, off or deleting
+	Status     string            `json:"status"`
+	Labels     map[string]string `json:"labels"`
+	ServerType struct {
+		Name string `json:"name"`
+	} `json:"server_type"`
+	Datacenter struct {
+		Name     string `json:"name"`
+		Location struct {
+			Name string `json:"name"`
+		} `json:"location"`
+	} `json:"datacenter"`
+}
+
+// getServer returns the server of a provider ID, or nil if it doesn't exist
+func (i *Instances) getServer(ctx context.Context, providerID string) (*hcloudServer, error) {
+	ref, err := parseProviderID(providerID)
+	if err != nil {
+		return nil, err
+	}
+
+	var found *hcloudServer
+	if ref.ID != 0 {
+		body := &struct {
+			Server *hcloudServer `json:"server"`
+		}{}
+		ok, err := i.get(ctx, "servers/"+strconv.FormatInt(ref.ID, 10), nil, body)
+		if err != nil || !ok {
+			return nil, err
+		}
+		found = body.Server
+	} else {
+		body := &struct {
+			Servers []*hcloudServer `json:"servers"`
+		}{}
+		if _, err := i.get(ctx, "servers", url.Values{"name": {ref.Name}}, body); err != nil {
+			return nil, err
+		}
+		if len(body.Servers) > 0 {
+			found = body.Servers[0]
+		}
+	}
+	if found == nil {
+		return nil, nil
+	}
+	if !i.scope.Allows(found.Labels) {
+		return nil, &cloud.OutOfScopeError{ProviderID: providerID, Scope: i.scope}
+	}
+	return found, nil
+}
+
+// get sends a GET request to the Hetzner Cloud API and decodes the response into into. It returns false if the
+// resource doesn't exist.
+func (i *Instances) get(ctx context.Context, resource string, query url.Values, into interface{}) (bool, error) {
+	u := i.endpoint + resource
+	if len(query) > 0 {
+		u += "?" + query.Encode()
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+	if err != nil {
+		return false, err
+	}
+	req.Header.Set("Authorization", "Bearer "+i.token)
+	req.Header.Set("User-Agent", "cloud-lifecycle-controller")
+
+	resp, err := i.client.Do(req)
+	if err != nil {
+		return false, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotFound {
+		return false, nil
+	}
+	if err := cloud.CheckResponse(resp, "getting "+resource); err != nil {
+		return false, err
+	}
+	if err := json.NewDecoder(resp.Body).Decode(into); err != nil {
+		return false, fmt.Errorf("unable to decode %s: %w", resource, err)
+	}
+	return true, nil
+}
+
+// InstanceExistsByProviderID returns true if the server exists. Powered off servers still exist.
+func (i *Instances) InstanceExistsByProviderID(ctx context.Context, providerID string) (bool, error) {
+	s, err := i.getServer(ctx, providerID)
+	return s != nil, err
+}
+
+// InstanceShutdownByProviderID returns true if the server is stopping, powered off or being deleted
+func (i *Instances) InstanceShutdownByProviderID(ctx context.Context, providerID string) (bool, error) {
+	s, err := i.getServer(ctx, providerID)
+	if err != nil || s == nil {
+		return false, err
+	}
+	switch s.Status {
+	case "stopping", "off", "deleting":
+		return true, nil
+	default:
+		return false, nil
+	}
+}
+
+// InstanceMetadataByProviderID implements cloud.MetadataGetter. Like the hcloud cloud controller manager, it reports
+// the location (e.g. fsn1) as the region and the datacenter (e.g. fsn1-dc14) as the zone.
+func (i *Instances) InstanceMetadataByProviderID(ctx context.Context, providerID string) (*cloud.Metadata, error) {
+	s, err := i.getServer(ctx, providerID)
+	if err != nil || s == nil {
+		return nil, err
+	}
+	return &cloud.Metadata{
+		InstanceType: s.ServerType.Name,
+		Zone:         s.Datacenter.Name,
+		Region:       s.Datacenter.Location.Name,
+	}, nil
+}
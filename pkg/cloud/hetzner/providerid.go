@@ -0,0 +1,51 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package hetzner
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// ProviderID returns the provider ID of a Hetzner Cloud server, hcloud://<server id>, as the hcloud cloud controller
+// manager sets it
+func ProviderID(serverID int64) string {
+	return "hcloud://" + strconv.FormatInt(serverID, 10)
+}
+
+// server identifies a server by its ID, or by its name if the ID is zero
+type server struct {
+	ID   int64
+	Name string
+}
+
+// parseProviderID parses a provider ID like hcloud://<server id>. Provider IDs holding a server name instead of an
+// ID, e.g. hcloud://<name> as some installers set them, are looked up by name.
+func parseProviderID(providerID string) (*server, error) {
+	if !strings.HasPrefix(providerID, "hcloud://") {
+		return nil, fmt.Errorf("not a Hetzner Cloud provider ID: %q", providerID)
+	}
+	ref := strings.TrimPrefix(providerID, "hcloud://")
+	if ref == "" || strings.Contains(ref, "/") {
+		return nil, fmt.Errorf("invalid Hetzner Cloud provider ID: %q", providerID)
+	}
+	if id, err := strconv.ParseInt(ref, 10, 64); err == nil && id > 0 {
+		return &server{ID: id}, nil
+	}
+	return &server{Name: ref}, nil
+}
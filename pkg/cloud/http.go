@@ -0,0 +1,130 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cloud
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"time"
+
+	"golang.org/x/time/rate"
+)
+
+// NewHTTPClient returns an HTTP client for cloud API calls that trusts the CA certificates in the PEM file caBundle
+// in addition to the system's, e.g. for TLS-intercepting proxies or private endpoints with an internal CA
+func NewHTTPClient(caBundle string) (*http.Client, error) {
+	pem, err := ioutil.ReadFile(caBundle)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read CA bundle: %w", err)
+	}
+	pool, err := x509.SystemCertPool()
+	if err != nil {
+		pool = x509.NewCertPool()
+	}
+	if !pool.AppendCertsFromPEM(pem) {
+		return nil, fmt.Errorf("no certificates found in CA bundle %s", caBundle)
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.TLSClientConfig = &tls.Config{RootCAs: pool}
+	return &http.Client{Transport: transport}, nil
+}
+
+// rateLimitedTransport is an http.RoundTripper that waits for a rate limiter before each request
+type rateLimitedTransport struct {
+	transport http.RoundTripper
+	limiter   *rate.Limiter
+}
+
+// NewRateLimitedTransport returns an http.RoundTripper that waits for limiter before sending each request with
+// transport (or http.DefaultTransport if nil), so the controller's cloud API calls stay within a client-side quota
+func NewRateLimitedTransport(transport http.RoundTripper, limiter *rate.Limiter) http.RoundTripper {
+	if transport == nil {
+		transport = http.DefaultTransport
+	}
+	return &rateLimitedTransport{transport: transport, limiter: limiter}
+}
+
+func (t *rateLimitedTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if err := t.limiter.Wait(req.Context()); err != nil {
+		return nil, fmt.Errorf("cloud API rate limit: %w", err)
+	}
+	return t.transport.RoundTrip(req)
+}
+
+// StatusError is a cloud API response with an unexpected status
+type StatusError struct {
+	// Action is what the request was for, e.g. getting droplet 42
+	Action     string
+	StatusCode int
+	Status     string
+	// Body is the start of the response body, which usually explains the error
+	Body []byte
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("unexpected status %s %s: %s", e.Status, e.Action, e.Body)
+}
+
+// CheckResponse returns a StatusError for responses other than 200 OK. It is wrapped in a CredentialsError for 401
+// Unauthorized, and in a ThrottlingError for 429 Too Many Requests and any of throttledStatuses, e.g. 503 Service
+// Unavailable for APIs that shed load with it, which waits ResponseRetryAfter.
+func CheckResponse(resp *http.Response, action string, throttledStatuses ...int) error {
+	if resp.StatusCode == http.StatusOK {
+		return nil
+	}
+	body, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 4096))
+	err := &StatusError{Action: action, StatusCode: resp.StatusCode, Status: resp.Status, Body: body}
+	if resp.StatusCode == http.StatusUnauthorized {
+		return &CredentialsError{Err: err}
+	}
+	throttled := resp.StatusCode == http.StatusTooManyRequests
+	for _, status := range throttledStatuses {
+		throttled = throttled || resp.StatusCode == status
+	}
+	if throttled {
+		return &ThrottlingError{Err: err, RetryAfter: ResponseRetryAfter(resp)}
+	}
+	return err
+}
+
+// ResponseRetryAfter returns how long a response asks to wait before retrying: the Retry-After header, in seconds or
+// as an HTTP date, or else the time until the RateLimit-Reset header's Unix time, which some APIs send instead. It is
+// zero if neither is set.
+func ResponseRetryAfter(resp *http.Response) time.Duration {
+	if header := resp.Header.Get("Retry-After"); header != "" {
+		if seconds, err := strconv.Atoi(header); err == nil && seconds > 0 {
+			return time.Duration(seconds) * time.Second
+		}
+		if at, err := http.ParseTime(header); err == nil && time.Until(at) > 0 {
+			return time.Until(at)
+		}
+	}
+	reset, err := strconv.ParseInt(resp.Header.Get("RateLimit-Reset"), 10, 64)
+	if err != nil {
+		return 0
+	}
+	if wait := time.Until(time.Unix(reset, 0)); wait > 0 {
+		return wait
+	}
+	return 0
+}
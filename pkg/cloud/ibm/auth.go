@@ -0,0 +1,82 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ibm
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"golang.org/x/oauth2"
+)
+
+// DefaultIAMEndpoint is the IAM endpoint API keys are exchanged for tokens with
+const DefaultIAMEndpoint = "https://iam.cloud.ibm.com/identity/token"
+
+// apiKeyTokenSource exchanges an IAM API key for access tokens. Wrapped in oauth2.ReuseTokenSource, tokens are only
+// requested again shortly before they expire.
+type apiKeyTokenSource struct {
+	ctx      context.Context
+	client   *http.Client
+	endpoint string
+	apiKey   string
+}
+
+// Token implements oauth2.TokenSource
+func (s *apiKeyTokenSource) Token() (*oauth2.Token, error) {
+	form := url.Values{
+		"grant_type": {"urn:ibm:params:oauth:grant-type:apikey"},
+		"apikey":     {s.apiKey},
+	}
+	req, err := http.NewRequestWithContext(s.ctx, http.MethodPost, s.endpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("unable to get IAM token: %w", err)
+	}
+	defer resp.Body.Close()
+	body, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if resp.StatusCode != http.StatusOK {
+		// reported like oauth2's own token errors, so they are recognized as credentials errors
+		return nil, &oauth2.RetrieveError{Response: resp, Body: body}
+	}
+
+	parsed := &struct {
+		AccessToken string `json:"access_token"`
+		TokenType   string `json:"token_type"`
+		ExpiresIn   int64  `json:"expires_in"`
+	}{}
+	if err := json.Unmarshal(body, parsed); err != nil {
+		return nil, fmt.Errorf("unable to decode IAM token: %w", err)
+	}
+	return &oauth2.Token{
+		AccessToken: parsed.AccessToken,
+		TokenType:   parsed.TokenType,
+		Expiry:      time.Now().Add(time.Duration(parsed.ExpiresIn) * time.Second),
+	}, nil
+}
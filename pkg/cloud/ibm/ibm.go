@@ -0,0 +1,171 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package ibm implements the cloud.Instances interface for IBM Cloud VPC instances.
+package ibm
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/nxtlytics/cloud-lifecycle-controller/pkg/cloud"
+	"golang.org/x/oauth2"
+)
+
+// apiVersion is the VPC API version requested, which fixes the response format
+const apiVersion = "2023-01-01"
+
+// Config is the IBM Cloud VPC configuration. It is set from flags and the environment.
+type Config struct {
+	// APIKey is the IAM API key instances are looked up with
+	APIKey string
+	// Region is the VPC region, e.g. us-south
+	Region string
+	// APIEndpoint replaces the region's VPC endpoint, https://<region>.iaas.cloud.ibm.com/, e.g. for private endpoints
+	APIEndpoint string
+	// IAMEndpoint replaces DefaultIAMEndpoint
+	IAMEndpoint string
+	// HTTPClient is used for all API and token requests if set, e.g. to trust a custom CA bundle
+	HTTPClient *http.Client
+}
+
+// Instances looks up IBM Cloud VPC instances by provider ID (ibm://<account id>///<cluster id>/<instance id>) with
+// the VPC API of one region
+type Instances struct {
+	client   *http.Client
+	endpoint string
+}
+
+// New creates an Instances for the given config
+func New(ctx context.Context, cfg *Config) (*Instances, error) {
+	if cfg.APIKey == "" {
+		return nil, errors.New("no IBM Cloud API key")
+	}
+	if cfg.Region == "" && cfg.APIEndpoint == "" {
+		return nil, errors.New("no IBM Cloud VPC region configured")
+	}
+	httpClient := cfg.HTTPClient
+	if httpClient == nil {
+		httpClient = http.DefaultClient
+	}
+	iamEndpoint := cfg.IAMEndpoint
+	if iamEndpoint == "" {
+		iamEndpoint = DefaultIAMEndpoint
+	}
+	endpoint := cfg.APIEndpoint
+	if endpoint == "" {
+		endpoint = "https://" + cfg.Region + ".iaas.cloud.ibm.com/"
+	}
+
+	tokens := oauth2.ReuseTokenSource(nil, &apiKeyTokenSource{
+		ctx:      ctx,
+		client:   httpClient,
+		endpoint: iamEndpoint,
+		apiKey:   cfg.APIKey,
+	})
+	return &Instances{
+		client:   &http.Client{Transport: &oauth2.Transport{Source: tokens, Base: httpClient.Transport}},
+		endpoint: strings.TrimSuffix(endpoint, "/") + "/",
+	}, nil
+}
+
+// vpcInstance is the subset of an instance the controller uses
+type vpcInstance struct {
+	ID string `json:"id"`
+	// Status is e.g. pending, running, stopping, stopped, restarting, suspended or deleting
+	Status  string `json:"status"`
+	Profile struct {
+		Name string `json:"name"`
+	} `json:"profile"`
+	Zone struct {
+		Name string `json:"name"`
+	} `json:"zone"`
+}
+
+// getInstance returns the instance of a provider ID, or nil if it doesn't exist
+func (i *Instances) getInstance(ctx context.Context, providerID string) (*vpcInstance, error) {
+	id, err := parseProviderID(providerID)
+	if err != nil {
+		return nil, err
+	}
+	query := url.Values{"version": {apiVersion}, "generation": {"2"}}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet,
+		i.endpoint+"v1/instances/"+url.PathEscape(id)+"?"+query.Encode(), nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("User-Agent", "cloud-lifecycle-controller")
+
+	resp, err := i.client.Do(req)
+	if err != nil {
+		var tokenErr *oauth2.RetrieveError
+		if errors.As(err, &tokenErr) {
+			return nil, &cloud.CredentialsError{Err: err}
+		}
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotFound {
+		return nil, nil
+	}
+	if err := cloud.CheckResponse(resp, "getting instance "+id); err != nil {
+		return nil, err
+	}
+	inst := &vpcInstance{}
+	if err := json.NewDecoder(resp.Body).Decode(inst); err != nil {
+		return nil, fmt.Errorf("unable to decode instance %s: %w", id, err)
+	}
+	return inst, nil
+}
+
+// InstanceExistsByProviderID returns true if the instance exists. Stopped instances still exist.
+func (i *Instances) InstanceExistsByProviderID(ctx context.Context, providerID string) (bool, error) {
+	inst, err := i.getInstance(ctx, providerID)
+	return inst != nil, err
+}
+
+// InstanceShutdownByProviderID returns true if the instance is stopping, stopped, suspended or being deleted
+func (i *Instances) InstanceShutdownByProviderID(ctx context.Context, providerID string) (bool, error) {
+	inst, err := i.getInstance(ctx, providerID)
+	if err != nil || inst == nil {
+		return false, err
+	}
+	switch inst.Status {
+	case "stopping", "stopped", "suspending", "suspended", "deleting":
+		return true, nil
+	default:
+		return false, nil
+	}
+}
+
+// InstanceMetadataByProviderID implements cloud.MetadataGetter
+func (i *Instances) InstanceMetadataByProviderID(ctx context.Context, providerID string) (*cloud.Metadata, error) {
+	inst, err := i.getInstance(ctx, providerID)
+	if err != nil || inst == nil {
+		return nil, err
+	}
+	return &cloud.Metadata{
+		InstanceType: inst.Profile.Name,
+		Zone:         inst.Zone.Name,
+		Region:       regionFromZone(inst.Zone.Name),
+	}, nil
+}
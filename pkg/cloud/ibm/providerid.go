@@ -0,0 +1,49 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ibm
+
+import (
+	"fmt"
+	"strings"
+)
+
+// ProviderID returns the provider ID of an IBM Cloud VPC instance, ibm://<account id>///<cluster id>/<instance id>,
+// as the IBM cloud controller manager sets it
+func ProviderID(accountID, clusterID, instanceID string) string {
+	return "ibm://" + accountID + "///" + clusterID + "/" + instanceID
+}
+
+// parseProviderID returns the instance ID of a provider ID like ibm://<account id>///<cluster id>/<instance id>
+func parseProviderID(providerID string) (string, error) {
+	if !strings.HasPrefix(providerID, "ibm://") {
+		return "", fmt.Errorf("not an IBM Cloud provider ID: %q", providerID)
+	}
+	parts := strings.Split(strings.TrimPrefix(providerID, "ibm://"), "/")
+	id := parts[len(parts)-1]
+	if len(parts) < 2 || id == "" {
+		return "", fmt.Errorf("invalid IBM Cloud provider ID: %q", providerID)
+	}
+	return id, nil
+}
+
+// regionFromZone returns the region of a zone, e.g. us-south for us-south-1
+func regionFromZone(zone string) string {
+	if i := strings.LastIndex(zone, "-"); i > 0 {
+		return zone[:i]
+	}
+	return zone
+}
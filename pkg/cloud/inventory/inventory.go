@@ -0,0 +1,126 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package inventory implements the cloud.Instances interface for a static inventory of the fleet, for clusters
+// without a cloud API to ask, e.g. air-gapped ones. Instances missing from the inventory don't exist.
+package inventory
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"strings"
+
+	"sigs.k8s.io/yaml"
+
+	"github.com/nxtlytics/cloud-lifecycle-controller/pkg/cloud"
+)
+
+// Config is an inventory document, in YAML or JSON:
+//
+//	instances:
+//	- name: worker-1
+//	  instanceType: r640
+//	  zone: rack-a
+//	- providerID: libvirt:///worker-2
+//	  shutdown: true
+type Config struct {
+	Instances []Instance `json:"instances"`
+}
+
+// Instance is an instance of the inventory
+type Instance struct {
+	// Name is the instance's name, for the provider ID inventory:///<name>
+	Name string `json:"name,omitempty"`
+	// ProviderID is the instance's provider ID instead of the one of Name, e.g. one set by an installer
+	ProviderID string `json:"providerID,omitempty"`
+	// Shutdown marks the instance as shut down, e.g. while it is powered off for maintenance
+	Shutdown bool `json:"shutdown,omitempty"`
+
+	InstanceType string `json:"instanceType,omitempty"`
+	Zone         string `json:"zone,omitempty"`
+	Region       string `json:"region,omitempty"`
+}
+
+// ReadConfig reads an inventory. Unknown fields are errors, so a typo can't drop instances from it.
+func ReadConfig(r io.Reader) (*Config, error) {
+	if r == nil {
+		return nil, errors.New("no inventory")
+	}
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read inventory: %w", err)
+	}
+	cfg := &Config{}
+	if err := yaml.UnmarshalStrict(data, cfg); err != nil {
+		return nil, fmt.Errorf("unable to parse inventory: %w", err)
+	}
+	return cfg, nil
+}
+
+// Instances looks up instances by provider ID in the inventory
+type Instances struct {
+	instances map[string]*Instance
+}
+
+// New creates an Instances for the given inventory. An empty inventory is an error, since it would have every node
+// deleted.
+func New(cfg *Config) (*Instances, error) {
+	if len(cfg.Instances) == 0 {
+		return nil, errors.New("inventory has no instances")
+	}
+	i := &Instances{instances: make(map[string]*Instance, len(cfg.Instances))}
+	for n := range cfg.Instances {
+		instance := &cfg.Instances[n]
+		providerID := instance.ProviderID
+		switch {
+		case providerID == "" && instance.Name == "":
+			return nil, fmt.Errorf("instance %d of the inventory has neither a name nor a provider ID", n)
+		case providerID == "":
+			providerID = ProviderID(instance.Name)
+		case !strings.Contains(providerID, "://"):
+			return nil, fmt.Errorf("invalid provider ID %q in the inventory", providerID)
+		}
+		if _, ok := i.instances[providerID]; ok {
+			return nil, fmt.Errorf("instance %s is in the inventory twice", providerID)
+		}
+		i.instances[providerID] = instance
+	}
+	return i, nil
+}
+
+// InstanceExistsByProviderID returns true if the instance is in the inventory
+func (i *Instances) InstanceExistsByProviderID(_ context.Context, providerID string) (bool, error) {
+	_, ok := i.instances[providerID]
+	return ok, nil
+}
+
+// InstanceShutdownByProviderID returns true if the instance is marked as shut down in the inventory
+func (i *Instances) InstanceShutdownByProviderID(_ context.Context, providerID string) (bool, error) {
+	instance, ok := i.instances[providerID]
+	return ok && instance.Shutdown, nil
+}
+
+// InstanceMetadataByProviderID returns the instance type, zone and region from the inventory
+func (i *Instances) InstanceMetadataByProviderID(_ context.Context, providerID string) (*cloud.Metadata, error) {
+	instance, ok := i.instances[providerID]
+	if !ok {
+		return nil, nil
+	}
+	return &cloud.Metadata{InstanceType: instance.InstanceType, Zone: instance.Zone, Region: instance.Region}, nil
+}
@@ -0,0 +1,134 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package libvirt implements the cloud.Instances interface for libvirt domains, e.g. KVM virtual machines.
+package libvirt
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+
+	"github.com/nxtlytics/cloud-lifecycle-controller/pkg/cloud"
+)
+
+// DefaultURI is the libvirt connection URI used if none is configured, the local QEMU/KVM system daemon
+const DefaultURI = "qemu:///system"
+
+// commandTimeout is how long a single virsh call may take, so an unreachable remote hypervisor doesn't hang lookups
+const commandTimeout = 30 * time.Second
+
+// Config is the libvirt configuration. There is no cloud config file, so it is set from flags.
+type Config struct {
+	// URI is the libvirt connection URI, e.g. qemu+ssh://root@kvm1/system. Defaults to DefaultURI.
+	URI string
+	// Virsh is the virsh binary to run, looked up in PATH. Defaults to virsh.
+	Virsh string
+}
+
+// Instances looks up libvirt domains by provider ID (libvirt:///<domain>) with virsh, which supports every libvirt
+// connection URI (local sockets, SSH, TLS) without linking against libvirt
+type Instances struct {
+	uri   string
+	virsh string
+}
+
+// New creates an Instances for the given config
+func New(cfg *Config) (*Instances, error) {
+	i := &Instances{uri: cfg.URI, virsh: cfg.Virsh}
+	if i.uri == "" {
+		i.uri = DefaultURI
+	}
+	if i.virsh == "" {
+		i.virsh = "virsh"
+	}
+	if _, err := exec.LookPath(i.virsh); err != nil {
+		return nil, fmt.Errorf("unable to find virsh, which libvirt lookups need: %w", err)
+	}
+	return i, nil
+}
+
+// domainState returns the state of the provider ID's domain as virsh reports it, e.g. "running" or "shut off", or ""
+// if it doesn't exist
+func (i *Instances) domainState(ctx context.Context, providerID string) (string, error) {
+	domain, err := parseProviderID(providerID)
+	if err != nil {
+		return "", err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, commandTimeout)
+	defer cancel()
+	var stdout, stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, i.virsh, "--connect", i.uri, "--quiet", "domstate", "--domain", domain)
+	// errors are matched by message, so they mustn't be translated
+	cmd.Env = append(os.Environ(), "LC_ALL=C")
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+
+	err = cmd.Run()
+	if err == nil {
+		return strings.TrimSpace(stdout.String()), nil
+	}
+	if ctx.Err() == context.DeadlineExceeded {
+		return "", fmt.Errorf("getting state of domain %s timed out after %s", domain, commandTimeout)
+	}
+	var exitErr *exec.ExitError
+	if !errors.As(err, &exitErr) {
+		return "", err
+	}
+	out := strings.TrimSpace(stderr.String())
+	switch {
+	case strings.Contains(out, "Domain not found"):
+		// only libvirt's VIR_ERR_NO_DOMAIN; virsh also says "failed to get domain" for connection errors and ACL
+		// denials, which say nothing about the domain
+		return "", nil
+	case strings.Contains(out, "authentication failed"), strings.Contains(out, "Permission denied"):
+		return "", &cloud.CredentialsError{Err: fmt.Errorf("unable to connect to %s: %s", i.uri, out)}
+	}
+	return "", fmt.Errorf("unable to get state of domain %s: exit status %d: %s", domain, exitErr.ExitCode(), out)
+}
+
+// NodeProviderID implements cloud.NodeNamer: domains are named after their nodes by convention, so nodes without a
+// provider ID are looked up as the domain of the same name
+func (i *Instances) NodeProviderID(nodeName string) string {
+	return ProviderID(nodeName)
+}
+
+// InstanceExistsByProviderID returns true if the domain is defined. Destroying a persistent domain only shuts it off;
+// transient domains are gone once destroyed.
+func (i *Instances) InstanceExistsByProviderID(ctx context.Context, providerID string) (bool, error) {
+	state, err := i.domainState(ctx, providerID)
+	return state != "", err
+}
+
+// InstanceShutdownByProviderID returns true if the domain is shutting down, shut off (e.g. destroyed) or crashed
+func (i *Instances) InstanceShutdownByProviderID(ctx context.Context, providerID string) (bool, error) {
+	state, err := i.domainState(ctx, providerID)
+	if err != nil {
+		return false, err
+	}
+	switch state {
+	case "in shutdown", "shut off", "crashed":
+		return true, nil
+	default:
+		return false, nil
+	}
+}
@@ -0,0 +1,40 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package libvirt
+
+import (
+	"fmt"
+	"strings"
+)
+
+// ProviderID returns the provider ID of a libvirt domain, libvirt:///<domain>, e.g. for the kubelet's --provider-id.
+// The domain is its name or UUID; by convention it is the node name.
+func ProviderID(domain string) string {
+	return "libvirt:///" + domain
+}
+
+// parseProviderID returns the domain of a provider ID like libvirt:///<domain>
+func parseProviderID(providerID string) (string, error) {
+	if !strings.HasPrefix(providerID, "libvirt://") {
+		return "", fmt.Errorf("not a libvirt provider ID: %q", providerID)
+	}
+	domain := strings.TrimPrefix(strings.TrimPrefix(providerID, "libvirt://"), "/")
+	if domain == "" || strings.Contains(domain, "/") {
+		return "", fmt.Errorf("invalid libvirt provider ID: %q", providerID)
+	}
+	return domain, nil
+}
@@ -0,0 +1,153 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package linode implements the cloud.Instances interface for Linodes.
+package linode
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/nxtlytics/cloud-lifecycle-controller/pkg/cloud"
+)
+
+// DefaultAPIEndpoint is the Linode API endpoint Linodes are looked up with
+const DefaultAPIEndpoint = "https://api.linode.com/v4/"
+
+// Config is the Linode configuration. Linode has no cloud config file, so it is set from flags and the environment.
+type Config struct {
+	// Token is the personal access token Linodes are looked up with. Read-only access to Linodes is enough.
+	Token string
+	// APIEndpoint replaces DefaultAPIEndpoint, e.g. for testing
+	APIEndpoint string
+	// HTTPClient is used for all API requests if set, e.g. to trust a custom CA bundle
+	HTTPClient *http.Client
+	// Scope is the tag Linodes must have. Linode tags are plain strings, so a tag like k8s:<cluster id> has the key
+	// k8s. Lookups of Linodes without it fail with a cloud.OutOfScopeError.
+	Scope cloud.Scope
+}
+
+// Instances looks up Linodes by provider ID (linode://<linode id>) with the Linode API
+type Instances struct {
+	client   *http.Client
+	token    string
+	endpoint string
+	scope    cloud.Scope
+}
+
+// New creates an Instances for the given config
+func New(cfg *Config) (*Instances, error) {
+	if cfg.Token == "" {
+		return nil, errors.New("no Linode API token")
+	}
+	client := cfg.HTTPClient
+	if client == nil {
+		client = http.DefaultClient
+	}
+	endpoint := cfg.APIEndpoint
+	if endpoint == "" {
+		endpoint = DefaultAPIEndpoint
+	}
+	return &Instances{
+		client:   client,
+		token:    cfg.Token,
+		endpoint: strings.TrimSuffix(endpoint, "/") + "/",
+		scope:    cfg.Scope,
+	}, nil
+}
+
+// instance is the subset of a Linode the controller uses
+type instance struct {
+	ID int `json:"id"`
+	// Status is e.g. provisioning, booting, running, shutting_down, offline, rebooting, migrating or deleting
+	Status string   `json:"status"`
+	Type   string   `json:"type"`
+	Region string   `json:"region"`
+	Tags   []string `json:"tags"`
+}
+
+// getInstance returns the Linode of a provider ID, or nil if it doesn't exist
+func (i *Instances) getInstance(ctx context.Context, providerID string) (*instance, error) {
+	id, err := parseProviderID(providerID)
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, i.endpoint+"linode/instances/"+strconv.Itoa(id), nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Authorization", "Bearer "+i.token)
+	req.Header.Set("User-Agent", "cloud-lifecycle-controller")
+
+	resp, err := i.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotFound {
+		return nil, nil
+	}
+	if err := cloud.CheckResponse(resp, fmt.Sprintf("getting Linode %d", id)); err != nil {
+		return nil, err
+	}
+	l := &instance{}
+	if err := json.NewDecoder(resp.Body).Decode(l); err != nil {
+		return nil, fmt.Errorf("unable to decode Linode %d: %w", id, err)
+	}
+	if !i.scope.Allows(cloud.ParseTags(l.Tags)) {
+		return nil, &cloud.OutOfScopeError{ProviderID: providerID, Scope: i.scope}
+	}
+	return l, nil
+}
+
+// InstanceExistsByProviderID returns true if the Linode exists. Powered off Linodes still exist.
+func (i *Instances) InstanceExistsByProviderID(ctx context.Context, providerID string) (bool, error) {
+	l, err := i.getInstance(ctx, providerID)
+	return l != nil, err
+}
+
+// InstanceShutdownByProviderID returns true if the Linode is shutting down, powered off (offline or stopped) or being
+// deleted
+func (i *Instances) InstanceShutdownByProviderID(ctx context.Context, providerID string) (bool, error) {
+	l, err := i.getInstance(ctx, providerID)
+	if err != nil || l == nil {
+		return false, err
+	}
+	switch l.Status {
+	case "shutting_down", "offline", "stopped", "deleting":
+		return true, nil
+	default:
+		return false, nil
+	}
+}
+
+// InstanceMetadataByProviderID implements cloud.MetadataGetter. Linode regions have no zones, so Zone is empty.
+func (i *Instances) InstanceMetadataByProviderID(ctx context.Context, providerID string) (*cloud.Metadata, error) {
+	l, err := i.getInstance(ctx, providerID)
+	if err != nil || l == nil {
+		return nil, err
+	}
+	return &cloud.Metadata{
+		InstanceType: l.Type,
+		Region:       l.Region,
+	}, nil
+}
@@ -0,0 +1,40 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package linode
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// ProviderID returns the provider ID of a Linode, linode://<linode id>, as the Linode cloud controller manager sets it
+func ProviderID(linodeID int) string {
+	return "linode://" + strconv.Itoa(linodeID)
+}
+
+// parseProviderID returns the Linode ID of a provider ID like linode://<linode id>
+func parseProviderID(providerID string) (int, error) {
+	if !strings.HasPrefix(providerID, "linode://") {
+		return 0, fmt.Errorf("not a Linode provider ID: %q", providerID)
+	}
+	id, err := strconv.Atoi(strings.TrimPrefix(providerID, "linode://"))
+	if err != nil || id <= 0 {
+		return 0, fmt.Errorf("invalid Linode provider ID: %q", providerID)
+	}
+	return id, nil
+}
@@ -0,0 +1,227 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package maas implements the cloud.Instances interface for machines deployed by Canonical MAAS.
+package maas
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/nxtlytics/cloud-lifecycle-controller/pkg/cloud"
+)
+
+// Config is the MAAS configuration. MAAS has no cloud config file, so it is set from flags and the environment.
+type Config struct {
+	// URL is the MAAS server, e.g. http://maas.example.com:5240/MAAS/
+	URL string
+	// APIKey is the API key machines are looked up with, <consumer key>:<token key>:<token secret>
+	APIKey string
+	// HTTPClient is used for all API requests if set, e.g. to trust a custom CA bundle
+	HTTPClient *http.Client
+	// Scope is the tag machines must have. MAAS tag names have no values, so only the scope's key is matched.
+	// Lookups of machines without it fail with a cloud.OutOfScopeError.
+	Scope cloud.Scope
+}
+
+// Instances looks up MAAS machines by provider ID (maas:///<hostname>) with the MAAS 2.0 API
+type Instances struct {
+	client   *http.Client
+	endpoint string
+	consumer string
+	token    string
+	secret   string
+	scope    cloud.Scope
+}
+
+// New creates an Instances for the given config. The API key must be an admin's: MAAS only lists the machines of
+// other users to admins, so any other key would have the nodes on machines it can't see taken for gone.
+func New(ctx context.Context, cfg *Config) (*Instances, error) {
+	if cfg.URL == "" {
+		return nil, errors.New("no MAAS URL")
+	}
+	parts := strings.Split(cfg.APIKey, ":")
+	if len(parts) != 3 || parts[0] == "" || parts[1] == "" || parts[2] == "" {
+		return nil, errors.New("no MAAS API key, or it isn't <consumer key>:<token key>:<token secret>")
+	}
+	client := cfg.HTTPClient
+	if client == nil {
+		client = http.DefaultClient
+	}
+	i := &Instances{
+		client:   client,
+		endpoint: strings.TrimSuffix(cfg.URL, "/") + "/api/2.0/",
+		consumer: parts[0],
+		token:    parts[1],
+		secret:   parts[2],
+		scope:    cfg.Scope,
+	}
+
+	user := &struct {
+		Username    string `json:"username"`
+		IsSuperuser bool   `json:"is_superuser"`
+	}{}
+	if err := i.get(ctx, "users/", url.Values{"op": {"whoami"}}, user); err != nil {
+		return nil, fmt.Errorf("unable to check the MAAS API key's user: %w", err)
+	}
+	if !user.IsSuperuser {
+		return nil, fmt.Errorf("the MAAS API key is user %s's, who isn't an admin and can't see other users' machines",
+			user.Username)
+	}
+	return i, nil
+}
+
+// machine is the subset of a MAAS machine the controller uses
+type machine struct {
+	Hostname string `json:"hostname"`
+	// StatusName is e.g. Deployed, Releasing, Ready or Broken
+	StatusName string `json:"status_name"`
+	// PowerState is on, off, unknown or error
+	PowerState string   `json:"power_state"`
+	TagNames   []string `json:"tag_names"`
+	Zone       struct {
+		Name string `json:"name"`
+	} `json:"zone"`
+}
+
+// released are the statuses of machines that aren't deployed: released back to the pool (or never deployed),
+// being commissioned, tested or wiped, or retired. Their nodes' operating system is gone.
+var released = map[string]bool{
+	"New":                  true,
+	"Commissioning":        true,
+	"Failed commissioning": true,
+	"Testing":              true,
+	"Failed testing":       true,
+	"Ready":                true,
+	"Allocated":            true,
+	"Disk erasing":         true,
+	"Failed disk erasing":  true,
+	"Retired":              true,
+}
+
+// tags returns the machine's tags as a map for scope checks
+func (m *machine) tags() map[string]string {
+	tags := make(map[string]string, len(m.TagNames))
+	for _, tag := range m.TagNames {
+		tags[tag] = ""
+	}
+	return tags
+}
+
+// getMachine returns the machine of a provider ID, or nil if it doesn't exist or isn't deployed
+func (i *Instances) getMachine(ctx context.Context, providerID string) (*machine, error) {
+	hostname, err := parseProviderID(providerID)
+	if err != nil {
+		return nil, err
+	}
+	var machines []*machine
+	if err := i.get(ctx, "machines/", url.Values{"hostname": {hostname}}, &machines); err != nil {
+		return nil, err
+	}
+	for _, m := range machines {
+		if m.Hostname != hostname {
+			continue
+		}
+		if released[m.StatusName] {
+			return nil, nil
+		}
+		if !i.scope.Allows(m.tags()) {
+			return nil, &cloud.OutOfScopeError{ProviderID: providerID, Scope: i.scope}
+		}
+		return m, nil
+	}
+	return nil, nil
+}
+
+// get sends a GET request for a resource of the API and decodes the response into into
+func (i *Instances) get(ctx context.Context, resource string, query url.Values, into interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, i.endpoint+resource+"?"+query.Encode(), nil)
+	if err != nil {
+		return err
+	}
+	authorization, err := i.authorization()
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", authorization)
+	req.Header.Set("User-Agent", "cloud-lifecycle-controller")
+
+	resp, err := i.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	// MAAS answers 503 while its region controller is busy
+	err = cloud.CheckResponse(resp, "getting "+resource+"?"+query.Encode(), http.StatusServiceUnavailable)
+	if err != nil {
+		return err
+	}
+	if err := json.NewDecoder(resp.Body).Decode(into); err != nil {
+		return fmt.Errorf("unable to decode %s: %w", resource, err)
+	}
+	return nil
+}
+
+// authorization returns the Authorization header of a request, signed with OAuth 1.0 PLAINTEXT like MAAS clients do
+func (i *Instances) authorization() (string, error) {
+	nonce := make([]byte, 16)
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+	return fmt.Sprintf(`OAuth oauth_version="1.0", oauth_signature_method="PLAINTEXT", oauth_consumer_key=%q, `+
+		`oauth_token=%q, oauth_signature=%q, oauth_nonce=%q, oauth_timestamp="%d"`,
+		i.consumer, i.token, "&"+url.QueryEscape(i.secret), hex.EncodeToString(nonce), time.Now().Unix()), nil
+}
+
+// InstanceExistsByProviderID returns true if the machine is deployed, or in a state a deployed machine can be in, e.g.
+// Broken or Releasing. Released machines, and those MAAS never deployed, don't exist.
+func (i *Instances) InstanceExistsByProviderID(ctx context.Context, providerID string) (bool, error) {
+	m, err := i.getMachine(ctx, providerID)
+	return m != nil, err
+}
+
+// InstanceShutdownByProviderID returns true if the machine is broken, being released, failed to deploy, or is
+// powered off
+func (i *Instances) InstanceShutdownByProviderID(ctx context.Context, providerID string) (bool, error) {
+	m, err := i.getMachine(ctx, providerID)
+	if err != nil || m == nil {
+		return false, err
+	}
+	switch m.StatusName {
+	case "Broken", "Releasing", "Failed releasing", "Failed deployment":
+		return true, nil
+	}
+	return m.PowerState == "off", nil
+}
+
+// InstanceMetadataByProviderID implements cloud.MetadataGetter. MAAS has zones but no regions or instance types, so
+// only Zone is set.
+func (i *Instances) InstanceMetadataByProviderID(ctx context.Context, providerID string) (*cloud.Metadata, error) {
+	m, err := i.getMachine(ctx, providerID)
+	if err != nil || m == nil {
+		return nil, err
+	}
+	return &cloud.Metadata{Zone: m.Zone.Name}, nil
+}
@@ -0,0 +1,43 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package maas
+
+import (
+	"fmt"
+	"strings"
+)
+
+// ProviderID returns the provider ID of a MAAS machine, maas:///<hostname>, e.g. for the kubelet's --provider-id
+func ProviderID(hostname string) string {
+	return "maas:///" + hostname
+}
+
+// parseProviderID returns the hostname of a provider ID like maas:///<hostname>. A fully qualified name is cut at its
+// first dot, since MAAS hostnames don't include the domain.
+func parseProviderID(providerID string) (string, error) {
+	if !strings.HasPrefix(providerID, "maas://") {
+		return "", fmt.Errorf("not a MAAS provider ID: %q", providerID)
+	}
+	hostname := strings.TrimPrefix(strings.TrimPrefix(providerID, "maas://"), "/")
+	if i := strings.Index(hostname, "."); i >= 0 {
+		hostname = hostname[:i]
+	}
+	if hostname == "" || strings.Contains(hostname, "/") {
+		return "", fmt.Errorf("invalid MAAS provider ID: %q", providerID)
+	}
+	return hostname, nil
+}
@@ -0,0 +1,83 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package oci
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// signer signs OCI API requests with an API signing key, as described in
+// https://docs.oracle.com/en-us/iaas/Content/API/Concepts/signingrequests.htm
+type signer struct {
+	keyID string
+	key   *rsa.PrivateKey
+}
+
+func newSigner(auth AuthConfig) (*signer, error) {
+	if auth.Tenancy == "" || auth.User == "" || auth.Fingerprint == "" || auth.PrivateKey == "" {
+		return nil, errors.New("incomplete OCI credentials: tenancy, user, fingerprint and key are required")
+	}
+	if auth.Passphrase != "" {
+		return nil, errors.New("encrypted OCI API keys are not supported")
+	}
+	block, _ := pem.Decode([]byte(auth.PrivateKey))
+	if block == nil {
+		return nil, errors.New("no PEM private key in the OCI credentials")
+	}
+	var key *rsa.PrivateKey
+	if parsed, err := x509.ParsePKCS1PrivateKey(block.Bytes); err == nil {
+		key = parsed
+	} else {
+		parsed, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf("unable to parse OCI API key: %w", err)
+		}
+		var ok bool
+		if key, ok = parsed.(*rsa.PrivateKey); !ok {
+			return nil, errors.New("OCI API key is not an RSA key")
+		}
+	}
+	return &signer{keyID: auth.Tenancy + "/" + auth.User + "/" + auth.Fingerprint, key: key}, nil
+}
+
+// sign adds the date and authorization headers to a GET request
+func (s *signer) sign(req *http.Request) error {
+	req.Header.Set("Date", time.Now().UTC().Format(http.TimeFormat))
+	target := strings.ToLower(req.Method) + " " + req.URL.RequestURI()
+	signingString := "date: " + req.Header.Get("Date") + "\n(request-target): " + target + "\nhost: " + req.URL.Host
+
+	digest := sha256.Sum256([]byte(signingString))
+	signature, err := rsa.SignPKCS1v15(rand.Reader, s.key, crypto.SHA256, digest[:])
+	if err != nil {
+		return fmt.Errorf("unable to sign OCI request: %w", err)
+	}
+	req.Header.Set("Authorization", fmt.Sprintf(
+		`Signature version="1",keyId="%s",algorithm="rsa-sha256",headers="date (request-target) host",signature="%s"`,
+		s.keyID, base64.StdEncoding.EncodeToString(signature)))
+	return nil
+}
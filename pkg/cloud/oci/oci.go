@@ -0,0 +1,204 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package oci implements the cloud.Instances interface for Oracle Cloud Infrastructure compute instances.
+package oci
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/nxtlytics/cloud-lifecycle-controller/pkg/cloud"
+	"sigs.k8s.io/yaml"
+)
+
+// Config is the OCI cloud config. It has the same format as the OCI cloud controller manager's cloud-provider.yaml so
+// existing files keep working; settings the controller has no use for (compartment, VCN, load balancers, ...) are
+// ignored.
+type Config struct {
+	Auth AuthConfig `json:"auth"`
+
+	// APIEndpoint replaces the region's compute API endpoint, https://iaas.<region>.oraclecloud.com/. It can't be set
+	// in the config file.
+	APIEndpoint string `json:"-"`
+	// HTTPClient is used for all API requests if set, e.g. to trust a custom CA bundle. It can't be set in the config
+	// file.
+	HTTPClient *http.Client `json:"-"`
+	// Scope is the freeform tag instances must have. Lookups of instances without it fail with a
+	// cloud.OutOfScopeError. It can't be set in the config file.
+	Scope cloud.Scope `json:"-"`
+}
+
+// AuthConfig holds the API signing key credentials of an OCI user
+type AuthConfig struct {
+	Region      string `json:"region"`
+	Tenancy     string `json:"tenancy"`
+	User        string `json:"user"`
+	Fingerprint string `json:"fingerprint"`
+	// PrivateKey is the PEM encoded API signing key
+	PrivateKey string `json:"key"`
+	// Passphrase of PrivateKey; encrypted keys aren't supported
+	Passphrase string `json:"passphrase"`
+	// UseInstancePrincipals isn't supported; it is only parsed to fail clearly
+	UseInstancePrincipals bool `json:"useInstancePrincipals"`
+}
+
+// ReadConfig parses an OCI cloud config. A nil reader returns an empty config.
+func ReadConfig(r io.Reader) (*Config, error) {
+	cfg := &Config{}
+	if r == nil {
+		return cfg, nil
+	}
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read OCI cloud config: %w", err)
+	}
+	if err := yaml.Unmarshal(data, cfg); err != nil {
+		return nil, fmt.Errorf("unable to parse OCI cloud config: %w", err)
+	}
+	return cfg, nil
+}
+
+// Instances looks up OCI instances by provider ID (oci://<instance OCID>) with the compute API of one region. Lookups
+// of instances in other regions fail.
+type Instances struct {
+	client   *http.Client
+	signer   *signer
+	endpoint string
+	region   string
+	scope    cloud.Scope
+}
+
+// New creates an Instances for the given config
+func New(cfg *Config) (*Instances, error) {
+	if cfg.Auth.UseInstancePrincipals {
+		return nil, errors.New("OCI instance principals are not supported, use an API signing key")
+	}
+	if cfg.Auth.Region == "" {
+		return nil, errors.New("no OCI region configured")
+	}
+	s, err := newSigner(cfg.Auth)
+	if err != nil {
+		return nil, err
+	}
+	client := cfg.HTTPClient
+	if client == nil {
+		client = http.DefaultClient
+	}
+	endpoint := cfg.APIEndpoint
+	if endpoint == "" {
+		endpoint = "https://iaas." + cfg.Auth.Region + ".oraclecloud.com/"
+	}
+	return &Instances{
+		client:   client,
+		signer:   s,
+		endpoint: strings.TrimSuffix(endpoint, "/") + "/",
+		region:   cfg.Auth.Region,
+		scope:    cfg.Scope,
+	}, nil
+}
+
+// computeInstance is the subset of an instance the controller uses
+type computeInstance struct {
+	ID string `json:"id"`
+	// LifecycleState is e.g. PROVISIONING, RUNNING, STOPPING, STOPPED, TERMINATING or TERMINATED
+	LifecycleState     string            `json:"lifecycleState"`
+	Shape              string            `json:"shape"`
+	AvailabilityDomain string            `json:"availabilityDomain"`
+	FreeformTags       map[string]string `json:"freeformTags"`
+}
+
+// getInstance returns the instance of a provider ID, or nil if it doesn't exist
+func (i *Instances) getInstance(ctx context.Context, providerID string) (*computeInstance, error) {
+	ocid, err := parseProviderID(providerID)
+	if err != nil {
+		return nil, err
+	}
+	if region := ocidRegion(ocid); region != i.region {
+		// the region's API would report it as not found
+		return nil, fmt.Errorf("instance %s is in region %s, not %s", ocid, region, i.region)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, i.endpoint+"20160918/instances/"+url.PathEscape(ocid), nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("User-Agent", "cloud-lifecycle-controller")
+	if err := i.signer.sign(req); err != nil {
+		return nil, err
+	}
+
+	resp, err := i.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotFound {
+		return nil, nil
+	}
+	if err := cloud.CheckResponse(resp, "getting instance "+ocid); err != nil {
+		return nil, err
+	}
+	inst := &computeInstance{}
+	if err := json.NewDecoder(resp.Body).Decode(inst); err != nil {
+		return nil, fmt.Errorf("unable to decode instance %s: %w", ocid, err)
+	}
+	if !i.scope.Allows(inst.FreeformTags) {
+		return nil, &cloud.OutOfScopeError{ProviderID: providerID, Scope: i.scope}
+	}
+	return inst, nil
+}
+
+// InstanceExistsByProviderID returns true if the instance exists and is not terminated. Terminated instances are
+// still returned by the API for a while.
+func (i *Instances) InstanceExistsByProviderID(ctx context.Context, providerID string) (bool, error) {
+	inst, err := i.getInstance(ctx, providerID)
+	return inst != nil && inst.LifecycleState != "TERMINATED", err
+}
+
+// InstanceShutdownByProviderID returns true if the instance is stopping, stopped or terminating
+func (i *Instances) InstanceShutdownByProviderID(ctx context.Context, providerID string) (bool, error) {
+	inst, err := i.getInstance(ctx, providerID)
+	if err != nil || inst == nil {
+		return false, err
+	}
+	switch inst.LifecycleState {
+	case "STOPPING", "STOPPED", "TERMINATING", "TERMINATED":
+		return true, nil
+	default:
+		return false, nil
+	}
+}
+
+// InstanceMetadataByProviderID implements cloud.MetadataGetter. The availability domain is reported as the zone.
+func (i *Instances) InstanceMetadataByProviderID(ctx context.Context, providerID string) (*cloud.Metadata, error) {
+	inst, err := i.getInstance(ctx, providerID)
+	if err != nil || inst == nil || inst.LifecycleState == "TERMINATED" {
+		return nil, err
+	}
+	return &cloud.Metadata{
+		InstanceType: inst.Shape,
+		Zone:         inst.AvailabilityDomain,
+		Region:       i.region,
+	}, nil
+}
@@ -0,0 +1,58 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package oci
+
+import (
+	"fmt"
+	"strings"
+)
+
+// ProviderID returns the provider ID of an OCI instance, oci://<instance OCID>, as the OCI cloud controller manager
+// sets it
+func ProviderID(ocid string) string {
+	return "oci://" + ocid
+}
+
+// parseProviderID returns the instance OCID of a provider ID like oci://<instance OCID>
+func parseProviderID(providerID string) (string, error) {
+	if !strings.HasPrefix(providerID, "oci://") {
+		return "", fmt.Errorf("not an OCI provider ID: %q", providerID)
+	}
+	ocid := strings.TrimPrefix(providerID, "oci://")
+	if !strings.HasPrefix(ocid, "ocid1.instance.") || strings.Contains(ocid, "/") {
+		return "", fmt.Errorf("invalid OCI provider ID: %q", providerID)
+	}
+	return ocid, nil
+}
+
+// legacyRegionKeys are the regions whose OCIDs hold their short key instead of their name
+var legacyRegionKeys = map[string]string{
+	"iad": "us-ashburn-1",
+	"phx": "us-phoenix-1",
+}
+
+// ocidRegion returns the region of an OCID like ocid1.instance.oc1.<region>.<unique id>
+func ocidRegion(ocid string) string {
+	parts := strings.Split(ocid, ".")
+	if len(parts) < 5 {
+		return ""
+	}
+	if name, ok := legacyRegionKeys[parts[3]]; ok {
+		return name
+	}
+	return parts[3]
+}
@@ -0,0 +1,100 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cloud
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// Scope restricts the instances a backend reasons about to the ones with a tag (or label), e.g.
+// kubernetes.io/cluster/<name>=owned, so the controller can't be made to act on a node because of an instance of
+// another cluster sharing the account. The zero Scope allows all instances.
+type Scope struct {
+	Key string
+	// Value is the tag's required value; empty allows any value
+	Value string
+}
+
+// ParseScope parses a scope in the form key=value, or key to allow any value. An empty string is the zero Scope.
+func ParseScope(s string) (Scope, error) {
+	if s == "" {
+		return Scope{}, nil
+	}
+	key, value := s, ""
+	if i := strings.Index(s, "="); i >= 0 {
+		key, value = s[:i], s[i+1:]
+	}
+	if key == "" {
+		return Scope{}, fmt.Errorf("invalid instance scope %q: no tag key", s)
+	}
+	return Scope{Key: key, Value: value}, nil
+}
+
+// Empty returns true for the zero Scope
+func (s Scope) Empty() bool {
+	return s.Key == ""
+}
+
+// Allows returns true if an instance with the given tags is in scope
+func (s Scope) Allows(tags map[string]string) bool {
+	if s.Empty() {
+		return true
+	}
+	value, ok := tags[s.Key]
+	return ok && (s.Value == "" || value == s.Value)
+}
+
+func (s Scope) String() string {
+	if s.Value == "" {
+		return s.Key
+	}
+	return s.Key + "=" + s.Value
+}
+
+// OutOfScopeError is returned by backends for instances that exist but aren't in their Scope. The controller must not
+// act on the node: its instance is not the cluster's.
+type OutOfScopeError struct {
+	ProviderID string
+	Scope      Scope
+}
+
+func (e *OutOfScopeError) Error() string {
+	return fmt.Sprintf("instance %s is not tagged %s", e.ProviderID, e.Scope)
+}
+
+// IsOutOfScope returns true if err is or wraps an OutOfScopeError
+func IsOutOfScope(err error) bool {
+	var scopeErr *OutOfScopeError
+	return errors.As(err, &scopeErr)
+}
+
+// ParseTags returns plain string tags, like those of DigitalOcean, Equinix Metal and Linode, as a map for scope checks.
+// Each tag is split at its first colon, so k8s:<cluster id> has the key k8s and the value <cluster id>, and a tag
+// without a colon has an empty value.
+func ParseTags(tags []string) map[string]string {
+	parsed := make(map[string]string, len(tags))
+	for _, tag := range tags {
+		key, value := tag, ""
+		if i := strings.Index(tag, ":"); i >= 0 {
+			key, value = tag[:i], tag[i+1:]
+		}
+		parsed[key] = value
+	}
+	return parsed
+}
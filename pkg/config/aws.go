@@ -0,0 +1,101 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package config
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/arn"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/secretsmanager"
+	"github.com/aws/aws-sdk-go/service/ssm"
+
+	awscloud "github.com/nxtlytics/cloud-lifecycle-controller/pkg/cloud/aws"
+)
+
+// awsConfig returns the SDK config for reading the parameter or secret with the given name or ARN, in the region of
+// the ARN if it is one, and otherwise in the region from the environment or the instance metadata service
+func awsConfig(ctx context.Context, sess *session.Session, nameOrARN string) (*aws.Config, error) {
+	if parsed, err := arn.Parse(nameOrARN); err == nil {
+		return aws.NewConfig().WithRegion(parsed.Region), nil
+	}
+	if aws.StringValue(sess.Config.Region) != "" {
+		return aws.NewConfig(), nil
+	}
+	zone, err := awscloud.DetectZone(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return aws.NewConfig().WithRegion(awscloud.RegionFromZone(zone)), nil
+}
+
+func newAWSSession() (*session.Session, error) {
+	sess, err := session.NewSessionWithOptions(session.Options{SharedConfigState: session.SharedConfigEnable})
+	if err != nil {
+		return nil, fmt.Errorf("unable to create AWS session: %w", err)
+	}
+	return sess, nil
+}
+
+// readSSMParameter returns the (decrypted) value of an SSM Parameter Store parameter
+func readSSMParameter(ctx context.Context, name string) ([]byte, error) {
+	sess, err := newAWSSession()
+	if err != nil {
+		return nil, err
+	}
+	cfg, err := awsConfig(ctx, sess, name)
+	if err != nil {
+		return nil, err
+	}
+
+	out, err := ssm.New(sess, cfg).GetParameterWithContext(ctx, &ssm.GetParameterInput{
+		Name:           aws.String(name),
+		WithDecryption: aws.Bool(true),
+	})
+	if err != nil {
+		return nil, err
+	}
+	if out.Parameter == nil {
+		return nil, fmt.Errorf("parameter %s has no value", name)
+	}
+	return []byte(aws.StringValue(out.Parameter.Value)), nil
+}
+
+// readSecretsManagerSecret returns the current value of a Secrets Manager secret
+func readSecretsManagerSecret(ctx context.Context, id string) ([]byte, error) {
+	sess, err := newAWSSession()
+	if err != nil {
+		return nil, err
+	}
+	cfg, err := awsConfig(ctx, sess, id)
+	if err != nil {
+		return nil, err
+	}
+
+	out, err := secretsmanager.New(sess, cfg).GetSecretValueWithContext(ctx, &secretsmanager.GetSecretValueInput{
+		SecretId: aws.String(id),
+	})
+	if err != nil {
+		return nil, err
+	}
+	if out.SecretString != nil {
+		return []byte(*out.SecretString), nil
+	}
+	return out.SecretBinary, nil
+}
@@ -0,0 +1,217 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package config loads controller settings from a YAML file and the environment.
+//
+// The file is a flat mapping of flag names to values, so every CLI flag can also be set from the file:
+//
+//	cloud: aws
+//	dry-run: true
+//	zap-log-level: info
+//
+// List values are joined with commas, which matches how repeated/list flags are parsed.
+//
+// Flags can also be set with environment variables named after the flag, e.g. CLC_DRY_RUN for -dry-run.
+// Precedence is command line flags, then environment variables, then the config file.
+package config
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/go-logr/logr"
+	"sigs.k8s.io/yaml"
+)
+
+// Values is a set of flag values keyed by flag name
+type Values map[string]string
+
+// Load reads and parses the config file at path
+func Load(path string) (Values, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return Parse(data)
+}
+
+// Parse parses the YAML contents of a config file
+func Parse(data []byte) (Values, error) {
+	raw := map[string]interface{}{}
+	if err := yaml.Unmarshal(data, &raw); err != nil {
+		return nil, fmt.Errorf("unable to parse config: %w", err)
+	}
+
+	values := Values{}
+	for key, value := range raw {
+		str, err := stringify(value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid value for %q: %w", key, err)
+		}
+		values[key] = str
+	}
+	return values, nil
+}
+
+func stringify(value interface{}) (string, error) {
+	switch v := value.(type) {
+	case nil:
+		return "", nil
+	case string:
+		return v, nil
+	case bool:
+		return strconv.FormatBool(v), nil
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64), nil
+	case []interface{}:
+		items := make([]string, 0, len(v))
+		for _, item := range v {
+			str, err := stringify(item)
+			if err != nil {
+				return "", err
+			}
+			items = append(items, str)
+		}
+		return strings.Join(items, ","), nil
+	default:
+		return "", fmt.Errorf("unsupported type %T", value)
+	}
+}
+
+// EnvPrefix is prepended to the environment variable name of every flag
+const EnvPrefix = "CLC_"
+
+// EnvVar returns the name of the environment variable for a flag, e.g. CLC_DRY_RUN for dry-run
+func EnvVar(name string) string {
+	return EnvPrefix + strings.ToUpper(strings.NewReplacer("-", "_", ".", "_").Replace(name))
+}
+
+// Environ returns the values of all flags in the flag set that have their environment variable set
+func Environ(fs *flag.FlagSet) Values {
+	values := Values{}
+	fs.VisitAll(func(f *flag.Flag) {
+		if value, ok := os.LookupEnv(EnvVar(f.Name)); ok {
+			values[f.Name] = value
+		}
+	})
+	return values
+}
+
+// Apply sets every value on the flag set, except for flags listed in skip (e.g. ones already set on the command line).
+// Unknown keys are reported as an error so typos in the config file don't go unnoticed.
+func Apply(fs *flag.FlagSet, values Values, skip map[string]bool) error {
+	for _, key := range values.Keys() {
+		f := fs.Lookup(key)
+		if f == nil {
+			return fmt.Errorf("unknown config key %q", key)
+		}
+		if skip[key] {
+			continue
+		}
+		if err := f.Value.Set(values[key]); err != nil {
+			return fmt.Errorf("invalid value for %q: %w", key, err)
+		}
+	}
+	return nil
+}
+
+// Keys returns the keys of the values in a stable order
+func (v Values) Keys() []string {
+	keys := make([]string, 0, len(v))
+	for key := range v {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// Changed returns the keys whose values differ between v and other
+func (v Values) Changed(other Values) []string {
+	var changed []string
+	for key, value := range v {
+		if otherValue, ok := other[key]; !ok || otherValue != value {
+			changed = append(changed, key)
+		}
+	}
+	for key := range other {
+		if _, ok := v[key]; !ok {
+			changed = append(changed, key)
+		}
+	}
+	sort.Strings(changed)
+	return changed
+}
+
+// SetFlags returns the names of the flags that were explicitly set on the flag set
+func SetFlags(fs *flag.FlagSet) map[string]bool {
+	set := map[string]bool{}
+	fs.Visit(func(f *flag.Flag) {
+		set[f.Name] = true
+	})
+	return set
+}
+
+// Watch calls onChange with the new values every time the config file changes, until ctx is done.
+// The parent directory is watched rather than the file itself so that atomic replaces (editors, ConfigMap
+// symlink swaps) are picked up. Files that fail to parse are logged and ignored.
+func Watch(ctx context.Context, path string, log logr.Logger, onChange func(Values)) error {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return err
+	}
+	if err := watcher.Add(filepath.Dir(path)); err != nil {
+		watcher.Close()
+		return err
+	}
+
+	current, err := Load(path)
+	if err != nil {
+		watcher.Close()
+		return err
+	}
+
+	go func() {
+		defer watcher.Close()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case err := <-watcher.Errors:
+				log.Error(err, "Error watching config file", "config", path)
+			case <-watcher.Events:
+				values, err := Load(path)
+				if err != nil {
+					log.Error(err, "Unable to reload config file, keeping previous configuration", "config", path)
+					continue
+				}
+				if len(values.Changed(current)) == 0 {
+					continue
+				}
+				current = values
+				onChange(values)
+			}
+		}
+	}()
+	return nil
+}
@@ -0,0 +1,164 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package config
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io/ioutil"
+	"strings"
+	"time"
+
+	"github.com/go-logr/logr"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+// Source kinds
+const (
+	SourceFile           = "file"
+	SourceSecret         = "secret"
+	SourceConfigMap      = "configmap"
+	SourceSSM            = "ssm"
+	SourceSecretsManager = "secretsmanager"
+)
+
+// Source is a reference to a config document: a file path, a key in a Secret or ConfigMap, an AWS SSM Parameter Store
+// parameter or an AWS Secrets Manager secret (by name or ARN):
+//
+//	/etc/kubernetes/cloud.conf
+//	secret://<namespace>/<name>/<key>
+//	configmap://<namespace>/<name>/<key>
+//	ssm://<parameter-name>
+//	secretsmanager://<secret-id>
+type Source struct {
+	Kind      string
+	Path      string
+	Namespace string
+	Name      string
+	Key       string
+}
+
+// ParseSource parses a config reference
+func ParseSource(ref string) (Source, error) {
+	for _, kind := range []string{SourceSSM, SourceSecretsManager} {
+		prefix := kind + "://"
+		if !strings.HasPrefix(ref, prefix) {
+			continue
+		}
+		path := strings.TrimPrefix(ref, prefix)
+		if path == "" {
+			return Source{}, fmt.Errorf("invalid %s reference %q, expected %s<name>", kind, ref, prefix)
+		}
+		return Source{Kind: kind, Path: path}, nil
+	}
+	for _, kind := range []string{SourceSecret, SourceConfigMap} {
+		prefix := kind + "://"
+		if !strings.HasPrefix(ref, prefix) {
+			continue
+		}
+		parts := strings.Split(strings.TrimPrefix(ref, prefix), "/")
+		if len(parts) != 3 || parts[0] == "" || parts[1] == "" || parts[2] == "" {
+			return Source{}, fmt.Errorf("invalid %s reference %q, expected %s<namespace>/<name>/<key>", kind, ref, prefix)
+		}
+		return Source{Kind: kind, Namespace: parts[0], Name: parts[1], Key: parts[2]}, nil
+	}
+	return Source{Kind: SourceFile, Path: ref}, nil
+}
+
+// InCluster returns true if the source is stored in the Kubernetes API
+func (s Source) InCluster() bool {
+	return s.Kind == SourceSecret || s.Kind == SourceConfigMap
+}
+
+func (s Source) String() string {
+	switch s.Kind {
+	case SourceFile:
+		return s.Path
+	case SourceSSM, SourceSecretsManager:
+		return s.Kind + "://" + s.Path
+	}
+	return fmt.Sprintf("%s://%s/%s/%s", s.Kind, s.Namespace, s.Name, s.Key)
+}
+
+// Read returns the contents of the source. c is only used for in-cluster sources and should be an uncached reader,
+// so that the controller doesn't need to watch every Secret in the cluster.
+func (s Source) Read(ctx context.Context, c client.Reader) ([]byte, error) {
+	key := types.NamespacedName{Namespace: s.Namespace, Name: s.Name}
+	switch s.Kind {
+	case SourceSecret:
+		secret := &corev1.Secret{}
+		if err := c.Get(ctx, key, secret); err != nil {
+			return nil, err
+		}
+		data, ok := secret.Data[s.Key]
+		if !ok {
+			return nil, fmt.Errorf("key %q not found in secret %s", s.Key, key)
+		}
+		return data, nil
+	case SourceConfigMap:
+		cm := &corev1.ConfigMap{}
+		if err := c.Get(ctx, key, cm); err != nil {
+			return nil, err
+		}
+		if data, ok := cm.Data[s.Key]; ok {
+			return []byte(data), nil
+		}
+		if data, ok := cm.BinaryData[s.Key]; ok {
+			return data, nil
+		}
+		return nil, fmt.Errorf("key %q not found in configmap %s", s.Key, key)
+	case SourceSSM:
+		return readSSMParameter(ctx, s.Path)
+	case SourceSecretsManager:
+		return readSecretsManagerSecret(ctx, s.Path)
+	default:
+		return ioutil.ReadFile(s.Path)
+	}
+}
+
+// PollSource reads the source every interval and calls onChange with the new contents when they differ from current,
+// until ctx is done. Read errors are logged and retried on the next tick.
+func PollSource(ctx context.Context, s Source, c client.Reader, interval time.Duration, current []byte, log logr.Logger, onChange func([]byte) error) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		data, err := s.Read(ctx, c)
+		if err != nil {
+			log.Error(err, "Unable to read config", "source", s.String())
+			continue
+		}
+		if bytes.Equal(data, current) {
+			continue
+		}
+		log.Info("Config changed, reloading", "source", s.String())
+		if err := onChange(data); err != nil {
+			log.Error(err, "Unable to apply changed config, will retry", "source", s.String())
+			continue
+		}
+		current = data
+	}
+}
@@ -0,0 +1,257 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package nodecache provides a manager cache for Nodes that only caches the nodes the controllers act on, and can
+// keep slimmed-down copies of them, to reduce the controller's memory use on large clusters.
+//
+// Stripped nodes lack the fields Strip removes, so they must never be written back with Update; the controllers only
+// delete or patch nodes.
+package nodecache
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+	"sigs.k8s.io/controller-runtime/pkg/cache"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	toolscache "k8s.io/client-go/tools/cache"
+)
+
+// MaxAnnotationSize is the size above which annotations are dropped from cached nodes, e.g.
+// kubectl.kubernetes.io/last-applied-configuration
+const MaxAnnotationSize = 512
+
+// defaultResync is controller-runtime's default resync period
+const defaultResync = 10 * time.Hour
+
+var nodeGVK = corev1.SchemeGroupVersion.WithKind("Node")
+
+// Strip removes the parts of a node the controllers don't use and that make up most of its size:
+// managed fields, the list of container images and large annotations
+func Strip(node *corev1.Node) {
+	node.ManagedFields = nil
+	node.Status.Images = nil
+	for key, value := range node.Annotations {
+		if len(value) > MaxAnnotationSize {
+			delete(node.Annotations, key)
+		}
+	}
+}
+
+// nodeCache serves Nodes from its own informer, and everything else from controller-runtime's
+// default cache
+type nodeCache struct {
+	cache.Cache
+	informer toolscache.SharedIndexInformer
+}
+
+// Options configures which nodes are cached and how
+type Options struct {
+	// LabelSelector and FieldSelector restrict the nodes that are listed and watched. Nodes that don't match are
+	// never cached, and the controllers never see them.
+	LabelSelector labels.Selector
+	FieldSelector fields.Selector
+	// Strip removes the fields Strip removes from cached nodes
+	Strip bool
+	// PageSize is the number of nodes per page when nodes are listed from etcd; 0 lists all nodes in one request.
+	// Lists served from the API server's watch cache aren't paginated.
+	PageSize int64
+	// WatchTimeout is how long each watch lasts before it is restarted, instead of a random duration between 5 and
+	// 10 minutes
+	WatchTimeout time.Duration
+}
+
+// NewCacheFunc returns a cache.NewCacheFunc for the manager's NewCache option that caches nodes as configured by opts
+func NewCacheFunc(opts Options) cache.NewCacheFunc {
+	return func(config *rest.Config, cacheOpts cache.Options) (cache.Cache, error) {
+		return newNodeCache(config, cacheOpts, opts)
+	}
+}
+
+func newNodeCache(config *rest.Config, cacheOpts cache.Options, opts Options) (cache.Cache, error) {
+	fallback, err := cache.New(config, cacheOpts)
+	if err != nil {
+		return nil, err
+	}
+	clientset, err := kubernetes.NewForConfig(config)
+	if err != nil {
+		return nil, fmt.Errorf("unable to create node cache client: %w", err)
+	}
+
+	resync := defaultResync
+	if cacheOpts.Resync != nil {
+		resync = *cacheOpts.Resync
+	}
+	// like controller-runtime's informers, so they don't all resync at the same time
+	resync = wait.Jitter(resync, 0.1)
+	restrict := func(options *metav1.ListOptions) {
+		if opts.LabelSelector != nil {
+			options.LabelSelector = opts.LabelSelector.String()
+		}
+		if opts.FieldSelector != nil {
+			options.FieldSelector = opts.FieldSelector.String()
+		}
+	}
+	strip := func(node *corev1.Node) {
+		if opts.Strip {
+			Strip(node)
+		}
+	}
+	listWatch := &toolscache.ListWatch{
+		ListFunc: func(options metav1.ListOptions) (runtime.Object, error) {
+			restrict(&options)
+			// the informer's pager sets a limit when it paginates
+			if options.Limit > 0 {
+				options.Limit = opts.PageSize
+			}
+			nodes, err := clientset.CoreV1().Nodes().List(context.TODO(), options)
+			if err != nil {
+				return nil, err
+			}
+			for i := range nodes.Items {
+				strip(&nodes.Items[i])
+			}
+			return nodes, nil
+		},
+		WatchFunc: func(options metav1.ListOptions) (watch.Interface, error) {
+			restrict(&options)
+			if opts.WatchTimeout > 0 {
+				timeout := int64(opts.WatchTimeout.Seconds())
+				options.TimeoutSeconds = &timeout
+			}
+			w, err := clientset.CoreV1().Nodes().Watch(context.TODO(), options)
+			if err != nil {
+				return nil, err
+			}
+			return watch.Filter(w, func(event watch.Event) (watch.Event, bool) {
+				if node, ok := event.Object.(*corev1.Node); ok {
+					strip(node)
+				}
+				return event, true
+			}), nil
+		},
+	}
+	informer := toolscache.NewSharedIndexInformer(listWatch, &corev1.Node{}, resync, toolscache.Indexers{})
+	return &nodeCache{Cache: fallback, informer: informer}, nil
+}
+
+// Get implements client.Reader
+func (c *nodeCache) Get(ctx context.Context, key client.ObjectKey, obj client.Object) error {
+	node, ok := obj.(*corev1.Node)
+	if !ok {
+		return c.Cache.Get(ctx, key, obj)
+	}
+	if err := c.waitForSync(ctx); err != nil {
+		return err
+	}
+
+	item, exists, err := c.informer.GetIndexer().GetByKey(key.Name)
+	if err != nil {
+		return err
+	}
+	if !exists {
+		return apierrors.NewNotFound(corev1.Resource("nodes"), key.Name)
+	}
+	item.(*corev1.Node).DeepCopyInto(node)
+	node.SetGroupVersionKind(nodeGVK)
+	return nil
+}
+
+// List implements client.Reader. Only label selectors are supported for nodes.
+func (c *nodeCache) List(ctx context.Context, list client.ObjectList, opts ...client.ListOption) error {
+	nodes, ok := list.(*corev1.NodeList)
+	if !ok {
+		return c.Cache.List(ctx, list, opts...)
+	}
+	listOpts := &client.ListOptions{}
+	listOpts.ApplyOptions(opts)
+	if listOpts.FieldSelector != nil && !listOpts.FieldSelector.Empty() {
+		return fmt.Errorf("field selectors are not supported when listing cached nodes")
+	}
+	if err := c.waitForSync(ctx); err != nil {
+		return err
+	}
+
+	nodes.Items = nil
+	for _, item := range c.informer.GetIndexer().List() {
+		node := item.(*corev1.Node)
+		if listOpts.LabelSelector != nil && !listOpts.LabelSelector.Matches(labels.Set(node.Labels)) {
+			continue
+		}
+		nodes.Items = append(nodes.Items, *node.DeepCopy())
+	}
+	nodes.ResourceVersion = c.informer.LastSyncResourceVersion()
+	return nil
+}
+
+// GetInformer implements cache.Informers
+func (c *nodeCache) GetInformer(ctx context.Context, obj client.Object) (cache.Informer, error) {
+	if _, ok := obj.(*corev1.Node); ok {
+		return c.informer, nil
+	}
+	return c.Cache.GetInformer(ctx, obj)
+}
+
+// GetInformerForKind implements cache.Informers
+func (c *nodeCache) GetInformerForKind(ctx context.Context, gvk schema.GroupVersionKind) (cache.Informer, error) {
+	if gvk == nodeGVK {
+		return c.informer, nil
+	}
+	return c.Cache.GetInformerForKind(ctx, gvk)
+}
+
+// Start implements cache.Informers. It blocks until ctx is done.
+func (c *nodeCache) Start(ctx context.Context) error {
+	go c.informer.Run(ctx.Done())
+	return c.Cache.Start(ctx)
+}
+
+// WaitForCacheSync implements cache.Informers
+func (c *nodeCache) WaitForCacheSync(ctx context.Context) bool {
+	return toolscache.WaitForCacheSync(ctx.Done(), c.informer.HasSynced) && c.Cache.WaitForCacheSync(ctx)
+}
+
+// IndexField implements client.FieldIndexer. Field indexes aren't supported for nodes.
+func (c *nodeCache) IndexField(ctx context.Context, obj client.Object, field string, extractValue client.IndexerFunc) error {
+	if _, ok := obj.(*corev1.Node); ok {
+		return fmt.Errorf("field indexes are not supported on cached nodes")
+	}
+	return c.Cache.IndexField(ctx, obj, field, extractValue)
+}
+
+// waitForSync waits for the node informer to sync, like controller-runtime's cache does for reads
+func (c *nodeCache) waitForSync(ctx context.Context) error {
+	if c.informer.HasSynced() {
+		return nil
+	}
+	if !toolscache.WaitForCacheSync(ctx.Done(), c.informer.HasSynced) {
+		return &cache.ErrCacheNotStarted{}
+	}
+	return nil
+}
@@ -0,0 +1,446 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package nodecleanup lets other controller managers embed the node cleanup controller, which deletes nodes whose
+// cloud instances no longer exist or are shut down, instead of running the cloud-lifecycle-controller binary:
+//
+//	reconciler, err := nodecleanup.New(mgr, nodecleanup.WithCloud(instances), nodecleanup.WithDryRun(true),
+//		nodecleanup.WithPolicy(nodecleanup.Policy{MinNotReady: time.Minute, UnknownDeadline: time.Hour}))
+package nodecleanup
+
+import (
+	"errors"
+	"time"
+
+	"github.com/go-logr/logr"
+	"github.com/nxtlytics/cloud-lifecycle-controller/controllers"
+	"github.com/nxtlytics/cloud-lifecycle-controller/pkg/cloud"
+	"github.com/nxtlytics/cloud-lifecycle-controller/pkg/notify"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/manager"
+	"sigs.k8s.io/controller-runtime/pkg/ratelimiter"
+
+	ctrl "sigs.k8s.io/controller-runtime"
+)
+
+// Option configures the node cleanup controller
+type Option func(*options)
+
+type options struct {
+	cloud        cloud.Instances
+	dryRun       bool
+	dryRunCloud  bool
+	audit        bool
+	settle       time.Duration
+	jitter       float64
+	profile      controllers.SettleProfile
+	eviction     controllers.Action
+	rateLimiter  ratelimiter.RateLimiter
+	giveUpAfter  time.Duration
+	shard        controllers.Shard
+	spread       time.Duration
+	workers      int
+	deleters     int
+	actionLimits controllers.ActionLimits
+	leaseMaxAge  time.Duration
+	probe        controllers.Probe
+	verify       controllers.VerifyHook
+	chaos        float64
+	nodeClaims   bool
+	cleanUp      bool
+	deleter      client.Client
+	deadline     time.Duration
+	minNotReady  time.Duration
+	pools        controllers.Pools
+	notifier     notify.Notifier
+	statefulPods bool
+	persist      bool
+	condition    bool
+	sweep        time.Duration
+	maxBacklog   int
+	groupSync    time.Duration
+	journalSize  int
+	log          logr.Logger
+	recorder     record.EventRecorder
+}
+
+// Policy holds the thresholds nodes are evaluated with, which decide when a not ready node is deleted, re-checked
+// or given up on. Zero fields keep the controller's defaults, like the options setting them individually.
+type Policy struct {
+	// SettleInterval is how long to wait before re-checking a node whose cloud status isn't conclusive yet, extended by
+	// up to SettleJitter times the interval
+	SettleInterval time.Duration
+	SettleJitter   float64
+	// SettleProfile is how long the cloud provider's API may take to converge after an instance goes away
+	SettleProfile controllers.SettleProfile
+	// GiveUpAfter stops re-checking nodes whose cloud status still hasn't settled this long after they became not ready
+	GiveUpAfter time.Duration
+	// UnknownDeadline deletes nodes that have been not ready this long even though their cloud status is unknown
+	UnknownDeadline time.Duration
+	// MinNotReady leaves nodes that have been not ready for less than this alone
+	MinNotReady time.Duration
+	// LeaseMaxAge keeps nodes whose Lease was renewed this recently from being deleted
+	LeaseMaxAge time.Duration
+	// SpotEvictionAction is what to do with nodes whose spot instance was evicted
+	SpotEvictionAction controllers.Action
+	// Pools overrides the thresholds above for the nodes of some pools
+	Pools controllers.Pools
+}
+
+// WithPolicy sets all the thresholds nodes are evaluated with at once, replacing those set by earlier options such as
+// WithGiveUpAfter or WithPools
+func WithPolicy(p Policy) Option {
+	return func(o *options) {
+		o.settle = p.SettleInterval
+		o.jitter = p.SettleJitter
+		o.profile = p.SettleProfile
+		o.giveUpAfter = p.GiveUpAfter
+		o.deadline = p.UnknownDeadline
+		o.minNotReady = p.MinNotReady
+		o.leaseMaxAge = p.LeaseMaxAge
+		o.eviction = p.SpotEvictionAction
+		o.pools = p.Pools
+	}
+}
+
+// WithCloud sets the cloud instances to look nodes up in. Required.
+func WithCloud(instances cloud.Instances) Option {
+	return func(o *options) {
+		o.cloud = instances
+	}
+}
+
+// WithDryRun makes the controller only log and record events for the changes it would make, both to Kubernetes
+// and to the cloud
+func WithDryRun(dryRun bool) Option {
+	return func(o *options) {
+		o.dryRun = dryRun
+		o.dryRunCloud = dryRun
+	}
+}
+
+// WithDryRunKube makes the controller skip changes to Kubernetes objects, e.g. node deletions
+func WithDryRunKube(dryRun bool) Option {
+	return func(o *options) {
+		o.dryRun = dryRun
+	}
+}
+
+// WithDryRunCloud makes the controller skip changes to cloud resources: with WithDeleteNodeClaims, nodes that would be
+// deleted by deleting their NodeClaim, which terminates their instance, are left alone like in a dry run
+func WithDryRunCloud(dryRun bool) Option {
+	return func(o *options) {
+		o.dryRunCloud = dryRun
+	}
+}
+
+// WithAudit makes the controller only observe: decisions are logged and nodes that would be deleted get
+// a WouldDeleteNode event, but nothing is changed
+func WithAudit(audit bool) Option {
+	return func(o *options) {
+		o.audit = audit
+	}
+}
+
+// WithSettleInterval sets how long to wait before re-checking a node whose cloud status isn't conclusive yet,
+// extended by up to jitter times the interval. Defaults to controllers.DefaultSettleInterval without jitter.
+func WithSettleInterval(interval time.Duration, jitter float64) Option {
+	return func(o *options) {
+		o.settle = interval
+		o.jitter = jitter
+	}
+}
+
+// WithGiveUpAfter stops re-checking nodes whose cloud status still hasn't settled this long after they became not
+// ready, until their Ready condition changes. Zero (the default) never gives up.
+func WithGiveUpAfter(giveUpAfter time.Duration) Option {
+	return func(o *options) {
+		o.giveUpAfter = giveUpAfter
+	}
+}
+
+// WithShard only reconciles the nodes of shard index out of count, when nodes are sharded across several
+// active replicas
+func WithShard(count, index int) Option {
+	return func(o *options) {
+		o.shard = controllers.Shard{Count: count, Index: index}
+	}
+}
+
+// WithStartupSpread spreads the first reconcile of each node over spread after the controller starts, instead of
+// checking all nodes at once
+func WithStartupSpread(spread time.Duration) Option {
+	return func(o *options) {
+		o.spread = spread
+	}
+}
+
+// WithWorkers sets the number of nodes checked concurrently (1 by default) and the number of nodes deleted
+// concurrently (controllers.DefaultDeletionWorkers by default). Deletions have their own workers so they aren't held up
+// by nodes waiting for cloud lookups.
+func WithWorkers(workers, deletionWorkers int) Option {
+	return func(o *options) {
+		o.workers = workers
+		o.deleters = deletionWorkers
+	}
+}
+
+// WithActionLimits limits how often and how many at once nodes are deleted by each action class, e.g. instance
+// terminations through Karpenter NodeClaims, on top of the deletion workers
+func WithActionLimits(limits controllers.ActionLimits) Option {
+	return func(o *options) {
+		o.actionLimits = limits
+	}
+}
+
+// WithLeaseMaxAge keeps nodes from being deleted while their Lease in kube-node-lease was renewed within maxAge,
+// which means their kubelet is still alive. Leases are read from the API server, not the manager's cache.
+func WithLeaseMaxAge(maxAge time.Duration) Option {
+	return func(o *options) {
+		o.leaseMaxAge = maxAge
+	}
+}
+
+// WithProbe keeps nodes from being deleted while one of their addresses accepts TCP connections on port, e.g. 10250
+// for the kubelet. Each connection waits up to timeout, or controllers.DefaultProbeTimeout if it is 0.
+func WithProbe(port int, timeout time.Duration) Option {
+	return func(o *options) {
+		o.probe = controllers.Probe{Port: port, Timeout: timeout}
+	}
+}
+
+// WithVerifyCommand runs command before each node deletion, which only goes ahead if it exits 0. See
+// controllers.VerifyHook for what the command is given. It is killed after timeout, or
+// controllers.DefaultVerifyTimeout if it is 0.
+func WithVerifyCommand(command []string, timeout time.Duration) Option {
+	return func(o *options) {
+		o.verify = controllers.VerifyHook{Command: command, Timeout: timeout}
+	}
+}
+
+// WithChaos makes the controller report a fraction of the nodes it evaluates as not ready with their instance shut
+// down or not found, to validate alerting and dashboards in staging. It requires WithDryRun, WithDryRunKube or
+// WithAudit.
+func WithChaos(fraction float64) Option {
+	return func(o *options) {
+		o.chaos = fraction
+	}
+}
+
+// WithDeleteNodeClaims deletes the Karpenter NodeClaim owning a node instead of the node, so Karpenter's accounting and
+// replacement logic run. Nodes without a NodeClaim are deleted as usual.
+func WithDeleteNodeClaims(deleteNodeClaims bool) Option {
+	return func(o *options) {
+		o.nodeClaims = deleteNodeClaims
+	}
+}
+
+// WithCleanUpTerminating evaluates nodes that are already being deleted, and instead of deleting the dead ones
+// again, force deletes their pods stuck terminating and then deletes their VolumeAttachments
+func WithCleanUpTerminating(cleanUp bool) Option {
+	return func(o *options) {
+		o.cleanUp = cleanUp
+	}
+}
+
+// WithDeleter deletes nodes and NodeClaims with c instead of the manager's client, e.g. a client impersonating a
+// service account that may only delete them, so RBAC separates observing nodes from deleting them
+func WithDeleter(c client.Client) Option {
+	return func(o *options) {
+		o.deleter = c
+	}
+}
+
+// WithUnknownDeadline deletes nodes that have been not ready for longer than deadline even though their cloud status
+// is still unknown, with a Warning event. It should be shorter than the WithGiveUpAfter duration.
+func WithUnknownDeadline(deadline time.Duration) Option {
+	return func(o *options) {
+		o.deadline = deadline
+	}
+}
+
+// WithMinNotReady leaves nodes that have been not ready for less than minNotReady alone, without asking the cloud
+// provider
+func WithMinNotReady(minNotReady time.Duration) Option {
+	return func(o *options) {
+		o.minNotReady = minNotReady
+	}
+}
+
+// WithPools overrides the thresholds and allowed actions for the nodes of some pools, see controllers.ParsePools
+func WithPools(pools controllers.Pools) Option {
+	return func(o *options) {
+		o.pools = pools
+	}
+}
+
+// WithNotifier reports node deletions, including dry-run and audited ones, to notifier. Use a notify.Dispatcher added
+// to the manager to keep slow notifiers from holding up the controller.
+func WithNotifier(notifier notify.Notifier) Option {
+	return func(o *options) {
+		o.notifier = notifier
+	}
+}
+
+// WithStatefulPods lists the pods of deleted nodes from the API server and adds the ones with persistent volume claims
+// to the notifications
+func WithStatefulPods(statefulPods bool) Option {
+	return func(o *options) {
+		o.statefulPods = statefulPods
+	}
+}
+
+// WithPersistState stores what the controller remembers about nodes (e.g. that it gave up on them, or that the cloud
+// API asked to back off) in an annotation on the nodes, so restarts and leader changes don't reset it
+func WithPersistState(persist bool) Option {
+	return func(o *options) {
+		o.persist = persist
+	}
+}
+
+// WithInstanceCondition maintains a CloudInstanceHealthy condition on the nodes checked against the cloud provider
+func WithInstanceCondition(condition bool) Option {
+	return func(o *options) {
+		o.condition = condition
+	}
+}
+
+// WithSweep schedules a low priority reconcile of every node each interval, to catch missed events, and sets the
+// work queue backlog above which reconciles from sources other than the node watch wait (0 uses the default)
+func WithSweep(interval time.Duration, maxBacklog int) Option {
+	return func(o *options) {
+		o.sweep = interval
+		o.maxBacklog = maxBacklog
+	}
+}
+
+// WithGroupSync lists the members of the cloud's autoscaling groups each interval, reconciling nodes whose instance left
+// its group right away and reporting group instances without a node as orphans. The cloud must implement
+// cloud.GroupLister (AWS, Azure and GCE do).
+func WithGroupSync(interval time.Duration) Option {
+	return func(o *options) {
+		o.groupSync = interval
+	}
+}
+
+// WithJournal keeps the last size decisions in memory, for NodeReconciler.Decisions. Zero keeps none.
+func WithJournal(size int) Option {
+	return func(o *options) {
+		o.journalSize = size
+	}
+}
+
+// WithSettleProfile sets how long the cloud provider's API may take to converge after an instance goes away, e.g.
+// controllers.SettleProfiles["aws"]. Shut down and missing instances are acted on right away by default.
+func WithSettleProfile(profile controllers.SettleProfile) Option {
+	return func(o *options) {
+		o.profile = profile
+	}
+}
+
+// WithSpotEvictionAction sets what to do with nodes whose spot instance was evicted, for cloud providers that can
+// tell evictions from other shutdowns: controllers.ActionDelete (the default), ActionGiveUp or ActionNone
+func WithSpotEvictionAction(action controllers.Action) Option {
+	return func(o *options) {
+		o.eviction = action
+	}
+}
+
+// WithRateLimiter sets the rate limiter for retrying nodes after errors, instead of controller-runtime's default
+func WithRateLimiter(rateLimiter ratelimiter.RateLimiter) Option {
+	return func(o *options) {
+		o.rateLimiter = rateLimiter
+	}
+}
+
+// WithLogger sets the logger, instead of ctrl.Log.WithName("controllers").WithName("Node")
+func WithLogger(log logr.Logger) Option {
+	return func(o *options) {
+		o.log = log
+	}
+}
+
+// WithEventRecorder sets the event recorder, instead of one for the cloud-lifecycle-controller component
+func WithEventRecorder(recorder record.EventRecorder) Option {
+	return func(o *options) {
+		o.recorder = recorder
+	}
+}
+
+// New creates the node cleanup controller and adds it to mgr
+func New(mgr manager.Manager, opts ...Option) (*controllers.NodeReconciler, error) {
+	o := &options{
+		log: ctrl.Log.WithName("controllers").WithName("Node"),
+	}
+	for _, opt := range opts {
+		opt(o)
+	}
+	if o.cloud == nil {
+		return nil, errors.New("nodecleanup: no cloud instances configured, use WithCloud")
+	}
+	if o.chaos > 0 && !o.dryRun && !o.audit {
+		return nil, errors.New("nodecleanup: chaos mode would delete healthy nodes, use it with WithDryRun or WithAudit")
+	}
+	if o.recorder == nil {
+		o.recorder = mgr.GetEventRecorderFor("cloud-lifecycle-controller")
+	}
+
+	reconciler := &controllers.NodeReconciler{
+		Client:             mgr.GetClient(),
+		Recorder:           o.recorder,
+		CloudInstances:     o.cloud,
+		Log:                o.log,
+		Scheme:             mgr.GetScheme(),
+		DryRun:             o.dryRun,
+		DryRunCloud:        o.dryRunCloud,
+		Audit:              o.audit,
+		SettleInterval:     o.settle,
+		SettleJitter:       o.jitter,
+		SettleProfile:      o.profile,
+		SpotEvictionAction: o.eviction,
+		RateLimiter:        o.rateLimiter,
+		GiveUpAfter:        o.giveUpAfter,
+		Shard:              o.shard,
+		StartupSpread:      o.spread,
+		Workers:            o.workers,
+		DeletionWorkers:    o.deleters,
+		ActionLimits:       o.actionLimits,
+		LeaseMaxAge:        o.leaseMaxAge,
+		APIReader:          mgr.GetAPIReader(),
+		Probe:              o.probe,
+		Verify:             o.verify,
+		Chaos:              o.chaos,
+		DeleteNodeClaims:   o.nodeClaims,
+		CleanUpTerminating: o.cleanUp,
+		Deleter:            o.deleter,
+		UnknownDeadline:    o.deadline,
+		MinNotReady:        o.minNotReady,
+		Pools:              o.pools,
+		Notifier:           o.notifier,
+		NotifyStatefulPods: o.statefulPods,
+		PersistState:       o.persist,
+		InstanceCondition:  o.condition,
+		SweepInterval:      o.sweep,
+		MaxBacklog:         o.maxBacklog,
+		GroupSyncInterval:  o.groupSync,
+		JournalSize:        o.journalSize,
+	}
+	if err := reconciler.SetupWithManager(mgr); err != nil {
+		return nil, err
+	}
+	return reconciler, nil
+}
@@ -0,0 +1,96 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package notify
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// DefaultDatadogSite is the Datadog site events are posted to by default
+const DefaultDatadogSite = "datadoghq.com"
+
+// Datadog posts events to the Datadog Events API, tagged with the cluster, pool and reason so they can be overlaid on
+// dashboards
+type Datadog struct {
+	// Site is the Datadog site, e.g. datadoghq.eu. Defaults to DefaultDatadogSite.
+	Site   string
+	APIKey string
+	// Tags are added to every event
+	Tags   []string
+	Client *http.Client
+}
+
+// datadogEvent is the body of a Datadog Events API request
+type datadogEvent struct {
+	Title          string   `json:"title"`
+	Text           string   `json:"text"`
+	Tags           []string `json:"tags"`
+	AlertType      string   `json:"alert_type"`
+	AggregationKey string   `json:"aggregation_key"`
+	SourceTypeName string   `json:"source_type_name"`
+	DateHappened   int64    `json:"date_happened"`
+}
+
+// Notify implements Notifier
+func (d *Datadog) Notify(ctx context.Context, event Event) error {
+	tags := append([]string{"source:cloud-lifecycle-controller", "event:" + string(event.Type),
+		"node:" + event.Node, fmt.Sprintf("dry_run:%t", event.DryRun)}, d.Tags...)
+	for key, value := range map[string]string{"cluster": event.Cluster, "pool": event.Pool, "reason": event.Reason} {
+		if value != "" {
+			tags = append(tags, key+":"+strings.ToLower(value))
+		}
+	}
+	body, err := json.Marshal(datadogEvent{
+		Title:          event.Title(),
+		Text:           event.Message,
+		Tags:           tags,
+		AlertType:      "info",
+		AggregationKey: event.Cluster,
+		SourceTypeName: "kubernetes",
+		DateHappened:   event.Time.Unix(),
+	})
+	if err != nil {
+		return err
+	}
+
+	site := d.Site
+	if site == "" {
+		site = DefaultDatadogSite
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, "https://api."+site+"/api/v1/events", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("DD-API-KEY", d.APIKey)
+
+	client := d.Client
+	if client == nil {
+		client = defaultHTTPClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("unable to post Datadog event: %w", err)
+	}
+	defer resp.Body.Close()
+	return checkResponse(resp, "posting Datadog event")
+}
@@ -0,0 +1,116 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package notify
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+)
+
+// GoogleChat posts a card for each event to a Google Chat space through an incoming webhook
+type GoogleChat struct {
+	// WebhookURL is the space's incoming webhook URL, including its key and token
+	WebhookURL string
+	Client     *http.Client
+}
+
+// googleChatMessage is the body of a Google Chat webhook request with a single card
+type googleChatMessage struct {
+	CardsV2 []googleChatCardWithID `json:"cardsV2"`
+}
+
+type googleChatCardWithID struct {
+	CardID string         `json:"cardId"`
+	Card   googleChatCard `json:"card"`
+}
+
+type googleChatCard struct {
+	Header   googleChatHeader    `json:"header"`
+	Sections []googleChatSection `json:"sections"`
+}
+
+type googleChatHeader struct {
+	Title    string `json:"title"`
+	Subtitle string `json:"subtitle,omitempty"`
+}
+
+type googleChatSection struct {
+	Widgets []googleChatWidget `json:"widgets"`
+}
+
+type googleChatWidget struct {
+	DecoratedText *googleChatDecoratedText `json:"decoratedText,omitempty"`
+	TextParagraph *googleChatText          `json:"textParagraph,omitempty"`
+}
+
+type googleChatDecoratedText struct {
+	TopLabel string `json:"topLabel"`
+	Text     string `json:"text"`
+}
+
+type googleChatText struct {
+	Text string `json:"text"`
+}
+
+// Notify implements Notifier
+func (g *GoogleChat) Notify(ctx context.Context, event Event) error {
+	widgets := []googleChatWidget{{TextParagraph: &googleChatText{Text: event.Message}}}
+	for _, field := range []struct{ name, value string }{
+		{"Node", event.Node},
+		{"Provider ID", event.ProviderID},
+		{"Pool", event.Pool},
+		{"Cloud status", event.Reason},
+	} {
+		if field.value != "" {
+			widgets = append(widgets, googleChatWidget{
+				DecoratedText: &googleChatDecoratedText{TopLabel: field.name, Text: field.value},
+			})
+		}
+	}
+	body, err := json.Marshal(googleChatMessage{CardsV2: []googleChatCardWithID{{
+		CardID: string(event.Type),
+		Card: googleChatCard{
+			Header:   googleChatHeader{Title: event.Title(), Subtitle: event.Cluster},
+			Sections: []googleChatSection{{Widgets: widgets}},
+		},
+	}}})
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, g.WebhookURL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json; charset=UTF-8")
+
+	client := g.Client
+	if client == nil {
+		client = defaultHTTPClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		// the error includes the URL, which holds the webhook's credentials
+		return fmt.Errorf("unable to post Google Chat message: %w", errors.Unwrap(err))
+	}
+	defer resp.Body.Close()
+	return checkResponse(resp, "posting Google Chat message")
+}
@@ -0,0 +1,88 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package notify
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// Grafana creates a Grafana annotation for each event through its HTTP API, so graphs show when nodes were deleted
+type Grafana struct {
+	// URL is the base URL of Grafana, e.g. https://grafana.example.com
+	URL string
+	// Token is a service account token or API key allowed to create annotations
+	Token string
+	// DashboardUID, if set, restricts the annotations to one dashboard; otherwise they are organization-wide
+	DashboardUID string
+	// Tags are added to every annotation
+	Tags   []string
+	Client *http.Client
+}
+
+// grafanaAnnotation is the body of a Grafana create annotation request
+type grafanaAnnotation struct {
+	DashboardUID string   `json:"dashboardUID,omitempty"`
+	Time         int64    `json:"time"`
+	Tags         []string `json:"tags"`
+	Text         string   `json:"text"`
+}
+
+// Notify implements Notifier
+func (g *Grafana) Notify(ctx context.Context, event Event) error {
+	tags := append([]string{"cloud-lifecycle-controller", string(event.Type)}, g.Tags...)
+	for _, value := range []string{event.Cluster, event.Pool} {
+		if value != "" {
+			tags = append(tags, value)
+		}
+	}
+	if event.DryRun {
+		tags = append(tags, "dry-run")
+	}
+	body, err := json.Marshal(grafanaAnnotation{
+		DashboardUID: g.DashboardUID,
+		Time:         event.Time.UnixNano() / 1e6,
+		Tags:         tags,
+		Text:         event.Title() + ": " + event.Message,
+	})
+	if err != nil {
+		return err
+	}
+
+	url := strings.TrimSuffix(g.URL, "/") + "/api/annotations"
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+g.Token)
+
+	client := g.Client
+	if client == nil {
+		client = defaultHTTPClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("unable to create Grafana annotation: %w", err)
+	}
+	defer resp.Body.Close()
+	return checkResponse(resp, "creating Grafana annotation")
+}
@@ -0,0 +1,140 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package notify
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// DefaultJiraIssueType is the type of the issues Jira creates by default
+const DefaultJiraIssueType = "Task"
+
+// Jira opens a Jira issue for the node deletions that need follow-up, so the work is tracked. Dry-run deletions are
+// skipped.
+type Jira struct {
+	// URL is the base URL of Jira, e.g. https://example.atlassian.net
+	URL string
+	// User and Token authenticate with basic auth, e.g. an Atlassian account email and API token. Without a User,
+	// Token is sent as a bearer token, e.g. a Jira Data Center personal access token.
+	User  string
+	Token string
+	// Project is the key of the project to create issues in
+	Project string
+	// IssueType defaults to DefaultJiraIssueType
+	IssueType string
+	Labels    []string
+	// StatefulOnly only opens issues for nodes that ran pods with persistent volume claims
+	StatefulOnly bool
+	Client       *http.Client
+}
+
+// jiraIssue is the body of a Jira create issue request
+type jiraIssue struct {
+	Fields jiraFields `json:"fields"`
+}
+
+type jiraFields struct {
+	Project     jiraKey  `json:"project"`
+	IssueType   jiraName `json:"issuetype"`
+	Summary     string   `json:"summary"`
+	Description string   `json:"description"`
+	Labels      []string `json:"labels,omitempty"`
+}
+
+type jiraKey struct {
+	Key string `json:"key"`
+}
+
+type jiraName struct {
+	Name string `json:"name"`
+}
+
+// Notify implements Notifier
+func (j *Jira) Notify(ctx context.Context, event Event) error {
+	if event.DryRun || (j.StatefulOnly && len(event.StatefulPods) == 0) {
+		return nil
+	}
+
+	issueType := j.IssueType
+	if issueType == "" {
+		issueType = DefaultJiraIssueType
+	}
+	summary := event.Title()
+	if event.Cluster != "" {
+		summary = fmt.Sprintf("[%s] %s", event.Cluster, summary)
+	}
+	body, err := json.Marshal(jiraIssue{Fields: jiraFields{
+		Project:     jiraKey{Key: j.Project},
+		IssueType:   jiraName{Name: issueType},
+		Summary:     summary,
+		Description: describe(event),
+		Labels:      j.Labels,
+	}})
+	if err != nil {
+		return err
+	}
+
+	url := strings.TrimSuffix(j.URL, "/") + "/rest/api/2/issue"
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if j.User != "" {
+		req.SetBasicAuth(j.User, j.Token)
+	} else {
+		req.Header.Set("Authorization", "Bearer "+j.Token)
+	}
+
+	client := j.Client
+	if client == nil {
+		client = defaultHTTPClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("unable to create Jira issue: %w", err)
+	}
+	defer resp.Body.Close()
+	return checkResponse(resp, "creating Jira issue")
+}
+
+// describe returns a plain text description of the event, one detail per line, for tickets and records
+func describe(event Event) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "%s\n\n", event.Message)
+	for _, field := range []struct{ name, value string }{
+		{"Cluster", event.Cluster},
+		{"Node", event.Node},
+		{"Provider ID", event.ProviderID},
+		{"Pool", event.Pool},
+		{"Cloud status", event.Reason},
+		{"Time", event.Time.UTC().Format("2006-01-02 15:04:05 MST")},
+	} {
+		if field.value != "" {
+			fmt.Fprintf(&b, "%s: %s\n", field.name, field.value)
+		}
+	}
+	if len(event.StatefulPods) > 0 {
+		fmt.Fprintf(&b, "Pods with persistent volume claims: %s\n", strings.Join(event.StatefulPods, ", "))
+	}
+	return b.String()
+}
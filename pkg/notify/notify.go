@@ -0,0 +1,190 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package notify reports what the controllers do, e.g. node deletions, to external systems such as event streams and
+// chat rooms.
+package notify
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/go-logr/logr"
+)
+
+// EventType is the kind of thing an Event reports
+type EventType string
+
+const (
+	// NodeDeleted is reported when a node was deleted, or would have been in a dry run or audit
+	NodeDeleted EventType = "NodeDeleted"
+	// NodeEvaluated is reported for every decision made about a node that isn't ready. Only Subscribers that want
+	// it get it.
+	NodeEvaluated EventType = "NodeEvaluated"
+)
+
+// Event is something a controller did
+type Event struct {
+	Type EventType
+	// Cluster is the name of the cluster, filled in by the Dispatcher
+	Cluster    string
+	Node       string
+	ProviderID string
+	// Pool is the node's pool or node group, if it has one
+	Pool string
+	// Reason is a short reason for machines, e.g. the cloud status NotFound
+	Reason string
+	// Message is a sentence for humans
+	Message string
+	// StatefulPods are the namespace/name of the node's pods with persistent volume claims, if the controller was
+	// asked to look them up
+	StatefulPods []string
+	// DryRun is true if nothing was actually changed
+	DryRun bool
+	Time   time.Time
+	// Decision is the controller's full decision about the node, for notifiers that keep complete records. It
+	// marshals to JSON.
+	Decision interface{}
+}
+
+// Title returns a one-line summary of the event
+func (e Event) Title() string {
+	switch {
+	case e.Type == NodeDeleted && e.DryRun:
+		return fmt.Sprintf("Would delete node %s", e.Node)
+	case e.Type == NodeDeleted:
+		return fmt.Sprintf("Deleted node %s", e.Node)
+	default:
+		return fmt.Sprintf("%s: %s", e.Type, e.Node)
+	}
+}
+
+// Notifier reports events to an external system
+type Notifier interface {
+	Notify(ctx context.Context, event Event) error
+}
+
+// Subscriber is implemented by notifiers that want other events than NodeDeleted, the only ones other notifiers get
+type Subscriber interface {
+	Wants(eventType EventType) bool
+}
+
+// wants returns true if the notifier wants events of the type
+func wants(notifier Notifier, eventType EventType) bool {
+	if subscriber, ok := notifier.(Subscriber); ok {
+		return subscriber.Wants(eventType)
+	}
+	return eventType == NodeDeleted
+}
+
+// defaultTimeout bounds each notification, including retries within a Notifier
+const defaultTimeout = 10 * time.Second
+
+// defaultHTTPClient is used by the notifiers that aren't given an HTTP client
+var defaultHTTPClient = &http.Client{Timeout: defaultTimeout}
+
+// checkResponse returns an error if resp isn't a 2xx response
+func checkResponse(resp *http.Response, action string) error {
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("%s: unexpected status %s", action, resp.Status)
+	}
+	return nil
+}
+
+// dispatcherQueueSize is how many events a Dispatcher holds before it drops new ones
+const dispatcherQueueSize = 100
+
+// ErrQueueFull is returned by Dispatcher.Notify when it drops an event because its queue is full
+var ErrQueueFull = errors.New("notification queue is full")
+
+// Dispatcher is a Notifier that hands events to other notifiers in the background, so slow or failing external
+// systems don't hold up the controllers. Failures are logged. It implements manager.Runnable, and only delivers
+// events while it runs.
+type Dispatcher struct {
+	cluster   string
+	notifiers map[string]Notifier
+	log       logr.Logger
+	events    chan Event
+}
+
+// NewDispatcher returns a Dispatcher delivering events to notifiers, keyed by a name for logging, with the cluster name
+// filled in
+func NewDispatcher(cluster string, notifiers map[string]Notifier, log logr.Logger) *Dispatcher {
+	return &Dispatcher{
+		cluster:   cluster,
+		notifiers: notifiers,
+		log:       log,
+		events:    make(chan Event, dispatcherQueueSize),
+	}
+}
+
+// Notify queues the event for delivery. It never blocks; events are dropped with ErrQueueFull if the queue is full.
+func (d *Dispatcher) Notify(_ context.Context, event Event) error {
+	wanted := false
+	for _, notifier := range d.notifiers {
+		wanted = wanted || wants(notifier, event.Type)
+	}
+	if !wanted {
+		return nil
+	}
+	event.Cluster = d.cluster
+	if event.Time.IsZero() {
+		event.Time = time.Now()
+	}
+	select {
+	case d.events <- event:
+		return nil
+	default:
+		return fmt.Errorf("%w, dropping %s event for node %s", ErrQueueFull, event.Type, event.Node)
+	}
+}
+
+// Start delivers events until ctx is done, then delivers the events already queued
+func (d *Dispatcher) Start(ctx context.Context) error {
+	for {
+		select {
+		case event := <-d.events:
+			d.deliver(event)
+		case <-ctx.Done():
+			for {
+				select {
+				case event := <-d.events:
+					d.deliver(event)
+				default:
+					return nil
+				}
+			}
+		}
+	}
+}
+
+// deliver sends the event to every notifier. It isn't tied to the manager's context, so queued events are still
+// delivered when the manager stops.
+func (d *Dispatcher) deliver(event Event) {
+	for name, notifier := range d.notifiers {
+		if !wants(notifier, event.Type) {
+			continue
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), defaultTimeout)
+		if err := notifier.Notify(ctx, event); err != nil {
+			d.log.Error(err, "Unable to send notification", "notifier", name, "event", event.Type, "node", event.Node)
+		}
+		cancel()
+	}
+}
@@ -0,0 +1,94 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package notify
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// ServiceNow record types
+const (
+	ServiceNowIncident = "incident"
+	ServiceNowChange   = "change"
+)
+
+// ServiceNow files a record for each node deletion through the ServiceNow Table API, for change-managed environments
+// that have to keep records of automated destructive actions: an incident, or a standard change request. Dry-run
+// deletions are skipped.
+type ServiceNow struct {
+	// URL is the base URL of the instance, e.g. https://example.service-now.com
+	URL      string
+	User     string
+	Password string
+	// RecordType is ServiceNowIncident (the default) or ServiceNowChange
+	RecordType string
+	// AssignmentGroup, if set, is the sys_id or name of the group the records are assigned to
+	AssignmentGroup string
+	Client          *http.Client
+}
+
+// Notify implements Notifier
+func (s *ServiceNow) Notify(ctx context.Context, event Event) error {
+	if event.DryRun {
+		return nil
+	}
+
+	table := "incident"
+	record := map[string]string{
+		"short_description": event.Title(),
+		"description":       describe(event),
+	}
+	if event.Cluster != "" {
+		record["short_description"] = fmt.Sprintf("[%s] %s", event.Cluster, event.Title())
+	}
+	if s.RecordType == ServiceNowChange {
+		table = "change_request"
+		record["type"] = "standard"
+	}
+	if s.AssignmentGroup != "" {
+		record["assignment_group"] = s.AssignmentGroup
+	}
+	body, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+
+	url := strings.TrimSuffix(s.URL, "/") + "/api/now/table/" + table
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Accept", "application/json")
+	req.SetBasicAuth(s.User, s.Password)
+
+	client := s.Client
+	if client == nil {
+		client = defaultHTTPClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("unable to create ServiceNow %s: %w", table, err)
+	}
+	defer resp.Body.Close()
+	return checkResponse(resp, "creating ServiceNow "+table)
+}
@@ -0,0 +1,104 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package notify
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strings"
+	"sync"
+)
+
+// SQL records every event, including NodeEvaluated ones, in a SQL database, for reporting and trend analysis over
+// longer periods than logs and events are kept. The statements work with PostgreSQL and SQLite; the driver is up to
+// the caller.
+type SQL struct {
+	db *sql.DB
+	// table is the quoted table name
+	table string
+
+	// mu guards created, so the table is created once, and again on the next event if creating it failed
+	mu      sync.Mutex
+	created bool
+}
+
+// tableName matches the table names NewSQL accepts: an identifier, optionally qualified with a schema
+var tableName = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*(\.[A-Za-z_][A-Za-z0-9_]*)?$`)
+
+// NewSQL returns a SQL notifier recording events in table, which is created if it doesn't exist. The table name may be
+// qualified with a schema, e.g. history.node_events, and is quoted in the statements, so it is case sensitive.
+func NewSQL(db *sql.DB, table string) (*SQL, error) {
+	if !tableName.MatchString(table) {
+		return nil, fmt.Errorf("invalid table name %q: must be an identifier of letters, digits and underscores, "+
+			"optionally qualified with a schema", table)
+	}
+	return &SQL{db: db, table: `"` + strings.Replace(table, ".", `"."`, 1) + `"`}, nil
+}
+
+// Wants implements Subscriber: SQL records every event type
+func (s *SQL) Wants(EventType) bool {
+	return true
+}
+
+// create creates the table if it doesn't exist yet. It has its own timeout rather than the event's context, so one
+// event can't cut it short for the others waiting on it.
+func (s *SQL) create() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.created {
+		return nil
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), defaultTimeout)
+	defer cancel()
+	_, err := s.db.ExecContext(ctx, `CREATE TABLE IF NOT EXISTS `+s.table+` (
+	time        TIMESTAMP NOT NULL,
+	type        TEXT NOT NULL,
+	cluster     TEXT NOT NULL,
+	node        TEXT NOT NULL,
+	provider_id TEXT NOT NULL,
+	pool        TEXT NOT NULL,
+	reason      TEXT NOT NULL,
+	message     TEXT NOT NULL,
+	dry_run     BOOLEAN NOT NULL,
+	decision    TEXT NOT NULL
+)`)
+	s.created = err == nil
+	return err
+}
+
+// Notify implements Notifier
+func (s *SQL) Notify(ctx context.Context, event Event) error {
+	if err := s.create(); err != nil {
+		return fmt.Errorf("unable to create table %s: %w", s.table, err)
+	}
+	decision, err := json.Marshal(event.Decision)
+	if err != nil {
+		return err
+	}
+	_, err = s.db.ExecContext(ctx, `INSERT INTO `+s.table+
+		` (time, type, cluster, node, provider_id, pool, reason, message, dry_run, decision)
+VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)`,
+		event.Time.UTC(), string(event.Type), event.Cluster, event.Node, event.ProviderID, event.Pool, event.Reason,
+		event.Message, event.DryRun, string(decision))
+	if err != nil {
+		return fmt.Errorf("unable to record %s event in %s: %w", event.Type, s.table, err)
+	}
+	return nil
+}
@@ -0,0 +1,113 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package vault
+
+import (
+	"context"
+	"math"
+	"sync"
+	"time"
+
+	"github.com/go-logr/logr"
+	"k8s.io/apimachinery/pkg/util/wait"
+)
+
+// minLeaseTTL is the shortest remaining lease duration worth renewing; shorter leases (e.g. ones that hit their max TTL)
+// are replaced with new credentials instead
+const minLeaseTTL = time.Minute
+
+// Credentials are dynamic credentials read from a Vault secret engine, e.g. aws/creds/<role>
+type Credentials struct {
+	client *Client
+	path   string
+
+	mu     sync.RWMutex
+	secret *Secret
+}
+
+// NewCredentials returns credentials read from path, e.g. aws/creds/node-reader
+func NewCredentials(client *Client, path string) *Credentials {
+	return &Credentials{client: client, path: path}
+}
+
+// Fetch reads new credentials from Vault
+func (c *Credentials) Fetch(ctx context.Context) (*Secret, error) {
+	secret, err := c.client.Read(ctx, c.path)
+	if err != nil {
+		return nil, err
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.secret = secret
+	return secret, nil
+}
+
+// Current returns the most recently fetched credentials
+func (c *Credentials) Current() *Secret {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.secret
+}
+
+// Run keeps the lease of the credentials renewed until ctx is done. Renewal is attempted when two thirds of the lease
+// have passed. When the lease can't be renewed (any more), new credentials are fetched, retrying with backoff, and
+// onRotate is called so the caller can start using them.
+func (c *Credentials) Run(ctx context.Context, log logr.Logger, onRotate func()) {
+	for {
+		secret := c.Current()
+		if secret == nil || secret.LeaseID == "" || secret.LeaseDuration <= 0 {
+			// static credentials, nothing to renew
+			return
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(secret.TTL() * 2 / 3):
+		}
+
+		if secret.Renewable {
+			renewed, err := c.client.Renew(ctx, secret.LeaseID, secret.TTL())
+			if err == nil && renewed.TTL() >= minLeaseTTL {
+				c.mu.Lock()
+				c.secret.LeaseDuration = renewed.LeaseDuration
+				c.mu.Unlock()
+				log.V(1).Info("Renewed Vault lease", "lease", secret.LeaseID, "ttl", renewed.TTL())
+				continue
+			}
+			if err != nil {
+				log.Error(err, "Unable to renew Vault lease, fetching new credentials", "lease", secret.LeaseID)
+			}
+		}
+
+		backoff := wait.Backoff{Duration: time.Second, Factor: 2, Jitter: 0.1, Steps: math.MaxInt32, Cap: time.Minute}
+		for {
+			_, err := c.Fetch(ctx)
+			if err == nil {
+				break
+			}
+			log.Error(err, "Unable to fetch new credentials from Vault, will retry", "path", c.path)
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(backoff.Step()):
+			}
+		}
+		log.Info("Fetched new credentials from Vault", "path", c.path)
+		onRotate()
+	}
+}
@@ -0,0 +1,188 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package vault fetches cloud credentials from HashiCorp Vault secret engines (e.g. aws/creds/<role>,
+// azure/creds/<role>) and keeps their leases renewed.
+package vault
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// serviceAccountTokenFile is the pod's service account token, used to log in with the Kubernetes auth method
+const serviceAccountTokenFile = "/var/run/secrets/kubernetes.io/serviceaccount/token"
+
+// Client is a minimal Vault API client. It authenticates with VAULT_TOKEN if set, and otherwise logs in with the
+// Kubernetes auth method using the pod's service account token, logging in again when the Vault token expires.
+type Client struct {
+	// Address is the Vault server address, e.g. https://vault.example.com:8200
+	Address string
+	// AuthPath is the mount path of the Kubernetes auth method, e.g. kubernetes
+	AuthPath string
+	// Role is the Kubernetes auth role to log in as
+	Role string
+
+	http *http.Client
+
+	mu    sync.Mutex
+	token string
+}
+
+// NewClient returns a client for the Vault server at address
+func NewClient(address, authPath, role string) *Client {
+	return &Client{
+		Address:  strings.TrimSuffix(address, "/"),
+		AuthPath: strings.Trim(authPath, "/"),
+		Role:     role,
+		http:     &http.Client{Timeout: 30 * time.Second},
+		token:    os.Getenv("VAULT_TOKEN"),
+	}
+}
+
+// Secret is a Vault secret with its lease
+type Secret struct {
+	LeaseID       string                 `json:"lease_id"`
+	LeaseDuration int                    `json:"lease_duration"`
+	Renewable     bool                   `json:"renewable"`
+	Data          map[string]interface{} `json:"data"`
+	Auth          *struct {
+		ClientToken string `json:"client_token"`
+	} `json:"auth"`
+}
+
+// String returns the string value of a data key, or "" if it's missing
+func (s *Secret) String(key string) string {
+	value, _ := s.Data[key].(string)
+	return value
+}
+
+// TTL returns the lease duration of the secret
+func (s *Secret) TTL() time.Duration {
+	return time.Duration(s.LeaseDuration) * time.Second
+}
+
+// errPermissionDenied is returned for 403 responses, which Vault also returns for expired tokens
+var errPermissionDenied = errors.New("permission denied")
+
+// Read reads the secret at path, e.g. aws/creds/node-reader
+func (c *Client) Read(ctx context.Context, path string) (*Secret, error) {
+	return c.authenticated(ctx, http.MethodGet, "/v1/"+strings.Trim(path, "/"), nil)
+}
+
+// Renew renews a lease, asking for it to be extended by increment
+func (c *Client) Renew(ctx context.Context, leaseID string, increment time.Duration) (*Secret, error) {
+	return c.authenticated(ctx, http.MethodPut, "/v1/sys/leases/renew", map[string]interface{}{
+		"lease_id":  leaseID,
+		"increment": int(increment.Seconds()),
+	})
+}
+
+// authenticated makes a request with the Vault token, logging in first if there is none or it was rejected
+func (c *Client) authenticated(ctx context.Context, method, path string, body interface{}) (*Secret, error) {
+	c.mu.Lock()
+	token := c.token
+	c.mu.Unlock()
+
+	if token != "" {
+		secret, err := c.do(ctx, method, path, token, body)
+		if !errors.Is(err, errPermissionDenied) || c.Role == "" {
+			return secret, err
+		}
+	}
+
+	token, err := c.login(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return c.do(ctx, method, path, token, body)
+}
+
+// login logs in with the Kubernetes auth method and stores the resulting token
+func (c *Client) login(ctx context.Context) (string, error) {
+	if c.Role == "" {
+		return "", errors.New("no Vault token or Kubernetes auth role configured")
+	}
+	jwt, err := ioutil.ReadFile(serviceAccountTokenFile)
+	if err != nil {
+		return "", fmt.Errorf("unable to read service account token: %w", err)
+	}
+
+	secret, err := c.do(ctx, http.MethodPost, "/v1/auth/"+c.AuthPath+"/login", "", map[string]interface{}{
+		"role": c.Role,
+		"jwt":  strings.TrimSpace(string(jwt)),
+	})
+	if err != nil {
+		return "", fmt.Errorf("unable to log in to Vault: %w", err)
+	}
+	if secret.Auth == nil || secret.Auth.ClientToken == "" {
+		return "", errors.New("unable to log in to Vault: no token in response")
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.token = secret.Auth.ClientToken
+	return c.token, nil
+}
+
+func (c *Client) do(ctx context.Context, method, path, token string, body interface{}) (*Secret, error) {
+	var reqBody io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return nil, err
+		}
+		reqBody = bytes.NewReader(data)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, c.Address+path, reqBody)
+	if err != nil {
+		return nil, err
+	}
+	if token != "" {
+		req.Header.Set("X-Vault-Token", token)
+	}
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusForbidden {
+		return nil, fmt.Errorf("%s %s: %w", method, path, errPermissionDenied)
+	}
+	if resp.StatusCode != http.StatusOK {
+		msg, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 1024))
+		return nil, fmt.Errorf("%s %s: unexpected status %s: %s", method, path, resp.Status, msg)
+	}
+
+	secret := &Secret{}
+	if err := json.NewDecoder(resp.Body).Decode(secret); err != nil {
+		return nil, fmt.Errorf("%s %s: unable to decode response: %w", method, path, err)
+	}
+	return secret, nil
+}
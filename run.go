@@ -0,0 +1,197 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/nxtlytics/cloud-lifecycle-controller/pkg/cloud"
+	"github.com/nxtlytics/cloud-lifecycle-controller/pkg/nodecache"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/apimachinery/pkg/labels"
+	"sigs.k8s.io/controller-runtime/pkg/cache"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/healthz"
+
+	corev1 "k8s.io/api/core/v1"
+	ctrl "sigs.k8s.io/controller-runtime"
+)
+
+// newNodeCache returns the manager cache for nodes, restricted by -node-selector and -node-field-selector
+func newNodeCache() (cache.NewCacheFunc, error) {
+	labelSelector, fieldSelector, err := nodeSelectors()
+	if err != nil {
+		return nil, err
+	}
+	return nodecache.NewCacheFunc(nodecache.Options{
+		LabelSelector: labelSelector,
+		FieldSelector: fieldSelector,
+		Strip:         stripCachedNodes,
+		PageSize:      listPageSize,
+		WatchTimeout:  watchTimeout,
+	}), nil
+}
+
+// nodeSelectors parses -node-selector and -node-field-selector
+func nodeSelectors() (labels.Selector, fields.Selector, error) {
+	labelSelector, err := labels.Parse(nodeSelector)
+	if err != nil {
+		return nil, nil, fmt.Errorf("invalid -node-selector: %w", err)
+	}
+	fieldSelector, err := fields.ParseSelector(nodeFieldSelector)
+	if err != nil {
+		return nil, nil, fmt.Errorf("invalid -node-field-selector: %w", err)
+	}
+	return labelSelector, fieldSelector, nil
+}
+
+// resolveShard checks -shard-count and -shard-index, taking the shard index from the hostname if it is -1
+func resolveShard() error {
+	if shardCount < 1 {
+		return fmt.Errorf("invalid -shard-count %d: must be at least 1", shardCount)
+	}
+	if shardIndex == -1 {
+		hostname, err := os.Hostname()
+		if err != nil {
+			return fmt.Errorf("unable to get hostname for shard index: %w", err)
+		}
+		ordinal := hostname[strings.LastIndex(hostname, "-")+1:]
+		if shardIndex, err = strconv.Atoi(ordinal); err != nil {
+			return fmt.Errorf("unable to get shard index from hostname %s: no ordinal suffix", hostname)
+		}
+	}
+	if shardIndex < 0 || shardIndex >= shardCount {
+		return fmt.Errorf("invalid -shard-index %d: must be between 0 and %d", shardIndex, shardCount-1)
+	}
+	return nil
+}
+
+// runCommand runs the controller manager until ctx is done
+func runCommand(ctx context.Context, args []string) error {
+	_, fileValues, err := parseFlags("run", args, nil)
+	if err != nil {
+		return err
+	}
+
+	if configFile != "" {
+		if err := watchConfig(ctx, fileValues); err != nil {
+			return configError(fmt.Errorf("unable to watch config file %s: %w", configFile, err))
+		}
+	}
+
+	if chaos > 0 && !dryRunKube {
+		return configError(errors.New("-chaos requires -dry-run, -dry-run-kube or -audit, it would delete healthy nodes"))
+	}
+	if chaos < 0 || chaos > 1 {
+		return configError(fmt.Errorf("invalid -chaos %g: must be between 0 and 1", chaos))
+	}
+
+	if err := resolveShard(); err != nil {
+		return configError(err)
+	}
+	if shardCount > 1 && enableLeaderElection {
+		// replicas of different shards must not compete for the same lock
+		leaderElectionID = fmt.Sprintf("%s-shard-%d", leaderElectionID, shardIndex)
+	}
+
+	if enableLeaderElection && (leaseDuration <= renewDeadline || renewDeadline <= retryPeriod) {
+		return configError(fmt.Errorf("invalid leader election timings: need lease duration (%s) > renew deadline (%s) > retry period (%s)",
+			leaseDuration, renewDeadline, retryPeriod))
+	}
+
+	ctrlOpts := ctrl.Options{
+		Scheme:                     scheme,
+		MetricsBindAddress:         metricsAddr,
+		Port:                       9443,
+		HealthProbeBindAddress:     probeAddr,
+		LeaderElection:             enableLeaderElection,
+		LeaderElectionID:           leaderElectionID,
+		LeaderElectionResourceLock: leaderElectionLock,
+		LeaderElectionNamespace:    leaderElectionNamespace,
+		LeaseDuration:              &leaseDuration,
+		RenewDeadline:              &renewDeadline,
+		RetryPeriod:                &retryPeriod,
+		DryRunClient:               dryRunKube,
+		SyncPeriod:                 &syncPeriod,
+		GracefulShutdownTimeout:    &shutdownTimeout,
+		// secrets and configmaps are only read occasionally (e.g. the cloud config), so they aren't worth caching
+		ClientDisableCacheFor: []client.Object{&corev1.Secret{}, &corev1.ConfigMap{}},
+	}
+	if ctrlOpts.NewCache, err = newNodeCache(); err != nil {
+		return configError(err)
+	}
+	cfg, err := restConfig()
+	if err != nil {
+		return configError(fmt.Errorf("unable to get kubernetes client configuration: %w", err))
+	}
+	mgr, err := ctrl.NewManager(cfg, ctrlOpts)
+	if err != nil {
+		return kubernetesError(fmt.Errorf("unable to start manager: %w", err))
+	}
+
+	instances, err := newCloudInstances(ctx, mgr.GetAPIReader())
+	if err != nil {
+		if kind, _ := exitCode(err); kind != "cloud" {
+			return err
+		}
+		// e.g. IAM changes that haven't propagated yet or a metadata service hiccup; retrying is better than
+		// crash-looping, and lookups fail (so nothing is deleted) until it succeeds
+		setupLog.Error(err, "Unable to initialize cloud provider, retrying in the background")
+		instances = cloud.NewUnavailable(err)
+	}
+	if err := watchCloudConfig(ctx, mgr, instances); err != nil {
+		return fmt.Errorf("unable to watch cloud config: %w", err)
+	}
+	if err := recoverCloudCredentials(mgr, instances); err != nil {
+		return fmt.Errorf("unable to set up cloud credentials recovery: %w", err)
+	}
+	if err := renewVaultCredentials(mgr, instances); err != nil {
+		return fmt.Errorf("unable to set up Vault lease renewal: %w", err)
+	}
+
+	// the cache is shared by all controllers
+	if err := setupControllers(mgr, cloud.NewCache(instances, cloudCacheTTL)); err != nil {
+		return err
+	}
+
+	if err := mgr.AddHealthzCheck("healthz", healthz.Ping); err != nil {
+		return fmt.Errorf("unable to set up health check: %w", err)
+	}
+	if err := mgr.AddReadyzCheck("readyz", healthz.Ping); err != nil {
+		return fmt.Errorf("unable to set up ready check: %w", err)
+	}
+	if err := mgr.AddReadyzCheck("cloud", func(*http.Request) error {
+		if !instances.Available() {
+			return errors.New("cloud provider is not initialized")
+		}
+		return nil
+	}); err != nil {
+		return fmt.Errorf("unable to set up ready check: %w", err)
+	}
+
+	setupLog.Info("starting manager")
+	if err := mgr.Start(ctx); err != nil {
+		return fmt.Errorf("problem running manager: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,99 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"text/tabwriter"
+
+	"github.com/nxtlytics/cloud-lifecycle-controller/controllers"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+// simulateCommand evaluates every node in the cluster once and prints a report of what the controller would do
+func simulateCommand(ctx context.Context, args []string) error {
+	_, _, err := parseFlags("simulate", args, bindOutputFlag)
+	if err != nil {
+		return err
+	}
+
+	reconciler, err := newOneShotReconciler(ctx)
+	if err != nil {
+		return err
+	}
+
+	labelSelector, fieldSelector, err := nodeSelectors()
+	if err != nil {
+		return err
+	}
+	nodes := &corev1.NodeList{}
+	if err := reconciler.List(ctx, nodes, client.MatchingLabelsSelector{Selector: labelSelector},
+		client.MatchingFieldsSelector{Selector: fieldSelector}); err != nil {
+		return fmt.Errorf("unable to list nodes: %w", err)
+	}
+
+	decisions := make([]*controllers.Decision, 0, len(nodes.Items))
+	for i := range nodes.Items {
+		decision, err := reconciler.Evaluate(ctx, &nodes.Items[i])
+		if err != nil {
+			decision.Error = err.Error()
+		}
+		decisions = append(decisions, decision)
+	}
+
+	switch outputFormat {
+	case "json":
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(decisions)
+	case "text":
+		printReport(os.Stdout, decisions)
+		return nil
+	default:
+		return fmt.Errorf("unknown output format %q", outputFormat)
+	}
+}
+
+func printReport(w io.Writer, decisions []*controllers.Decision) {
+	counts := map[controllers.Action]int{}
+
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "NODE\tREADY\tCLOUD STATUS\tACTION\tREASON")
+	for _, d := range decisions {
+		reason := d.Reason
+		if d.Error != "" {
+			reason = fmt.Sprintf("%s (error: %s)", reason, d.Error)
+		}
+		cloudStatus := d.CloudStatus
+		if cloudStatus == "" {
+			cloudStatus = "-"
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\n", d.Node, d.Ready, cloudStatus, d.Action, reason)
+		counts[d.Action]++
+	}
+	tw.Flush()
+
+	fmt.Fprintf(w, "\n%d nodes: %d would be deleted, %d would be cleaned up, %d would be rechecked, %d given up on, "+
+		"%d left alone\n", len(decisions), counts[controllers.ActionDelete], counts[controllers.ActionCleanUp],
+		counts[controllers.ActionRequeue], counts[controllers.ActionGiveUp], counts[controllers.ActionNone])
+}
@@ -0,0 +1,250 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/nxtlytics/cloud-lifecycle-controller/pkg/cloud"
+	"github.com/nxtlytics/cloud-lifecycle-controller/pkg/config"
+	"k8s.io/client-go/tools/leaderelection/resourcelock"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	authorizationv1 "k8s.io/api/authorization/v1"
+	corev1 "k8s.io/api/core/v1"
+)
+
+// permission is an API permission the controller needs
+type permission struct {
+	group       string
+	resource    string
+	subresource string
+	verb        string
+	namespace   string
+	name        string
+	// deleteAs is set for the permissions the -delete-as service account needs instead of the controller
+	deleteAs bool
+}
+
+// requiredPermissions returns the permissions the controller needs with the current flags
+func requiredPermissions() []permission {
+	perms := []permission{
+		{resource: "nodes", verb: "get"},
+		{resource: "nodes", verb: "list"},
+		{resource: "nodes", verb: "watch"},
+		{resource: "events", verb: "create"},
+		{resource: "events", verb: "patch"},
+	}
+	if !dryRunKube {
+		perms = append(perms, permission{resource: "nodes", verb: "delete", deleteAs: deleteAs != ""})
+	}
+	if deleteNodeClaims && !dryRunKube {
+		perms = append(perms, permission{group: "karpenter.sh", resource: "nodeclaims", verb: "delete",
+			deleteAs: deleteAs != ""})
+	}
+	if cleanUpTerminating {
+		perms = append(perms, permission{resource: "pods", verb: "list"},
+			permission{group: "storage.k8s.io", resource: "volumeattachments", verb: "list"})
+		if !dryRunKube {
+			perms = append(perms, permission{resource: "pods", verb: "delete", deleteAs: deleteAs != ""},
+				permission{group: "storage.k8s.io", resource: "volumeattachments", verb: "delete",
+					deleteAs: deleteAs != ""})
+		}
+	}
+	if namespace, name, ok := splitDeleteAs(); ok && !dryRunKube {
+		perms = append(perms, permission{resource: "serviceaccounts", verb: "impersonate", namespace: namespace,
+			name: name})
+	}
+	if names, err := enabledControllers(); err == nil && !dryRunKube {
+		for _, name := range names {
+			if name == "cloud-node" || name == "node-labels" || (name == "node" && persistState) {
+				perms = append(perms, permission{resource: "nodes", verb: "patch"})
+			}
+		}
+	}
+	if instanceConditionEnabled && !dryRunKube {
+		perms = append(perms, permission{resource: "nodes", subresource: "status", verb: "patch"})
+	}
+	if jiraURL != "" && jiraStatefulOnly {
+		perms = append(perms, permission{resource: "pods", verb: "list"})
+	}
+	if leaseMaxAge > 0 {
+		perms = append(perms, permission{group: "coordination.k8s.io", resource: "leases", verb: "get",
+			namespace: "kube-node-lease"})
+	}
+	if source, err := config.ParseSource(cloudConfig); err == nil && source.InCluster() {
+		perms = append(perms, permission{resource: source.Kind + "s", verb: "get", namespace: source.Namespace})
+	}
+	if enableLeaderElection {
+		for _, resource := range leaderElectionResources() {
+			for _, verb := range []string{"get", "create", "update"} {
+				perms = append(perms, permission{group: resource.group, resource: resource.resource, verb: verb,
+					namespace: leaderElectionNamespace})
+			}
+		}
+	}
+	return perms
+}
+
+// leaderElectionResources returns the resources used by the -leader-election-resource-lock;
+// the multilocks (e.g. configmapsleases) use both
+func leaderElectionResources() []permission {
+	var resources []permission
+	if strings.HasPrefix(leaderElectionLock, resourcelock.ConfigMapsResourceLock) {
+		resources = append(resources, permission{resource: "configmaps"})
+	}
+	if strings.HasPrefix(leaderElectionLock, resourcelock.EndpointsResourceLock) {
+		resources = append(resources, permission{resource: "endpoints"})
+	}
+	if strings.HasSuffix(leaderElectionLock, resourcelock.LeasesResourceLock) {
+		resources = append(resources, permission{group: "coordination.k8s.io", resource: "leases"})
+	}
+	return resources
+}
+
+// validateConfigCommand checks the configuration, cloud credentials and RBAC permissions,
+// and fails if anything would prevent the controller from working
+func validateConfigCommand(ctx context.Context, args []string) error {
+	if _, _, err := parseFlags("validate-config", args, nil); err != nil {
+		return err
+	}
+
+	failures := 0
+	check := func(name string, err error, hint string) {
+		if err == nil {
+			fmt.Printf("OK    %s\n", name)
+			return
+		}
+		failures++
+		fmt.Printf("FAIL  %s: %v\n", name, err)
+		if hint != "" {
+			fmt.Printf("      %s\n", hint)
+		}
+	}
+	check("configuration", nil, "")
+	_, err := enabledControllers()
+	check("controllers", err, "")
+
+	cfg, err := restConfig()
+	check("kubernetes client configuration", err, "Run in-cluster or set -kubeconfig and -context")
+	if err != nil {
+		return fmt.Errorf("%d checks failed", failures)
+	}
+	c, err := client.New(cfg, client.Options{Scheme: scheme})
+	check("kubernetes client", err, "")
+	if err != nil {
+		return fmt.Errorf("%d checks failed", failures)
+	}
+
+	var deleteAsClient client.Client
+	if deleteAs != "" {
+		deleteAsCfg, err := deleteAsConfig(cfg)
+		if err == nil {
+			deleteAsClient, err = client.New(deleteAsCfg, client.Options{Scheme: scheme})
+		}
+		check("-delete-as client", err, "Set -delete-as to <namespace>/<service account>")
+	}
+
+	for _, perm := range requiredPermissions() {
+		if !perm.deleteAs {
+			check(fmt.Sprintf("permission to %s %s", perm.verb, perm.describe()), checkPermission(ctx, c, perm),
+				"Grant this permission to the controller's service account in its ClusterRole/Role")
+			continue
+		}
+		if deleteAsClient != nil {
+			// a SelfSubjectAccessReview made while impersonating reviews the impersonated service account
+			check(fmt.Sprintf("permission of -delete-as %s to %s %s", deleteAs, perm.verb, perm.describe()),
+				checkPermission(ctx, deleteAsClient, perm),
+				"Grant this permission to the -delete-as service account in its ClusterRole/Role")
+		}
+	}
+
+	instances, err := newCloudInstances(ctx, c)
+	check("cloud provider initialization", err, "Check -cloud, -cloud-config and the cloud credentials available to the controller")
+	if err == nil {
+		nodes := &corev1.NodeList{}
+		if err := c.List(ctx, nodes); err == nil {
+			var providerIDs []string
+			for _, node := range nodes.Items {
+				if node.Spec.ProviderID == "" {
+					continue
+				}
+				if len(providerIDs) == 0 {
+					_, err := instances.InstanceExistsByProviderID(ctx, node.Spec.ProviderID)
+					check(fmt.Sprintf("cloud lookup of node %s (%s)", node.Name, node.Spec.ProviderID), err,
+						"Check that the cloud credentials allow describing instances")
+				}
+				providerIDs = append(providerIDs, node.Spec.ProviderID)
+			}
+			if len(providerIDs) > 0 {
+				check("state source coverage of all nodes", cloud.CheckCoverage(ctx, instances, providerIDs),
+					"Make sure -aws-state-source or -azure-state-source knows every instance, or use the default")
+			}
+		}
+	}
+
+	if failures > 0 {
+		return fmt.Errorf("%d checks failed", failures)
+	}
+	fmt.Println("Configuration is valid")
+	return nil
+}
+
+func (p permission) describe() string {
+	resource := p.resource
+	if p.group != "" {
+		resource = p.resource + "." + p.group
+	}
+	if p.subresource != "" {
+		resource += "/" + p.subresource
+	}
+	if p.name != "" {
+		resource += " " + p.name
+	}
+	if p.namespace != "" {
+		return fmt.Sprintf("%s in namespace %s", resource, p.namespace)
+	}
+	return resource
+}
+
+// checkPermission uses a SelfSubjectAccessReview to check whether the controller's identity has the permission
+func checkPermission(ctx context.Context, c client.Client, perm permission) error {
+	review := &authorizationv1.SelfSubjectAccessReview{
+		Spec: authorizationv1.SelfSubjectAccessReviewSpec{
+			ResourceAttributes: &authorizationv1.ResourceAttributes{
+				Group:       perm.group,
+				Resource:    perm.resource,
+				Subresource: perm.subresource,
+				Verb:        perm.verb,
+				Namespace:   perm.namespace,
+				Name:        perm.name,
+			},
+		},
+	}
+	if err := c.Create(ctx, review); err != nil {
+		return fmt.Errorf("unable to review access: %w", err)
+	}
+	if !review.Status.Allowed {
+		if review.Status.Reason != "" {
+			return fmt.Errorf("denied: %s", review.Status.Reason)
+		}
+		return fmt.Errorf("denied")
+	}
+	return nil
+}